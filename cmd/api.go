@@ -0,0 +1,653 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/matcher"
+	"github.com/cli/go-gh/v2/pkg/jq"
+	"github.com/spf13/cobra"
+)
+
+// apiOptions holds the flags shared by the api and graphql commands
+type apiOptions struct {
+	hostname  string
+	method    string
+	rawFields []string
+	fields    []string
+	headers   []string
+	paginate  bool
+	jqFilter  string
+	include   bool
+	asApp     bool
+	appID     int64
+	repo      string
+}
+
+// apiRequest describes a single authenticated HTTP call
+type apiRequest struct {
+	method  string
+	url     string
+	body    []byte
+	headers map[string]string
+}
+
+// apiResponse holds the parts of a response the commands need
+type apiResponse struct {
+	statusCode int
+	status     string
+	header     http.Header
+	body       []byte
+}
+
+func NewAPICmd() *cobra.Command {
+	opts := &apiOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "api <endpoint>",
+		Short: "Make an authenticated GitHub REST API request as the app",
+		Long: `Make an authenticated request to the GitHub REST API using a configured GitHub App.
+
+By default the request is authenticated with an installation token minted for
+the matching app. Use --as-app to authenticate with the app JWT instead, which
+is required for app-level endpoints such as /app and /app/installations.
+
+The app is selected with --app-id, or by matching --repo against the configured
+patterns. When only one app is configured it is used automatically.
+
+Fields given with -f/--raw-field are sent as strings. Fields given with
+-F/--field are converted: true, false, null and integers keep their JSON type
+and "@file" reads the value from a file ("@-" reads standard input). For GET
+requests fields are added to the query string, otherwise they are sent as a
+JSON body.
+
+The endpoint is a path relative to the API base URL. A full URL is accepted
+only if it uses https on the API host, since the token is sent with it.`,
+		Example: `  # Inspect the app itself (JWT authentication)
+  gh app-auth api /app --as-app --app-id 123456
+
+  # List installations of the app
+  gh app-auth api /app/installations --as-app --app-id 123456 --jq '.[].account.login'
+
+  # List repositories visible to the installation, following pagination
+  gh app-auth api /installation/repositories --repo github.com/myorg/repo --paginate
+
+  # Query a GitHub Enterprise Server host
+  gh app-auth api /app --as-app --app-id 42 --hostname github.example.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return apiRun(cmd, opts, args[0])
+		},
+	}
+
+	addAPIFlags(cmd, opts)
+	cmd.Flags().StringVarP(&opts.method, "method", "X", "",
+		"HTTP method (default: GET, or POST when fields are given)")
+	cmd.Flags().BoolVarP(&opts.include, "include", "i", false,
+		"Include HTTP response status line and headers in the output")
+
+	return cmd
+}
+
+func NewGraphQLCmd() *cobra.Command {
+	opts := &apiOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "graphql",
+		Short: "Make an authenticated GitHub GraphQL request as the app",
+		Long: `Make an authenticated request to the GitHub GraphQL API using a configured GitHub App.
+
+The "query" and "operationName" fields are sent as-is; every other field is
+passed as a GraphQL variable. With --paginate the query must accept an
+$endCursor variable and select pageInfo { hasNextPage endCursor } on the
+connection to paginate. When the response holds several pageInfo objects, the
+first one in the response is followed.`,
+		Example: `  # Query repositories visible to the installation
+  gh app-auth graphql --repo github.com/myorg/repo \
+    -f query='query { viewer { login } }'
+
+  # Paginate a connection
+  gh app-auth graphql --repo github.com/myorg/repo --paginate \
+    -F owner=myorg -f query='
+      query($owner: String!, $endCursor: String) {
+        organization(login: $owner) {
+          repositories(first: 100, after: $endCursor) {
+            nodes { nameWithOwner }
+            pageInfo { hasNextPage endCursor }
+          }
+        }
+      }' --jq '.data.organization.repositories.nodes[].nameWithOwner'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return graphqlRun(cmd, opts)
+		},
+	}
+
+	addAPIFlags(cmd, opts)
+
+	return cmd
+}
+
+// addAPIFlags registers the flags shared by api and graphql
+func addAPIFlags(cmd *cobra.Command, opts *apiOptions) {
+	cmd.Flags().StringVar(&opts.hostname, "hostname", "",
+		"GitHub hostname (default: derived from --repo or the app patterns)")
+	cmd.Flags().StringArrayVarP(&opts.rawFields, "raw-field", "f", nil, "Add a string parameter in key=value format")
+	cmd.Flags().StringArrayVarP(&opts.fields, "field", "F", nil, "Add a typed parameter in key=value format")
+	cmd.Flags().StringArrayVarP(&opts.headers, "header", "H", nil, "Add a HTTP request header in key:value format")
+	cmd.Flags().BoolVar(&opts.paginate, "paginate", false, "Fetch all pages of results")
+	cmd.Flags().StringVarP(&opts.jqFilter, "jq", "q", "", "Filter JSON output using a jq expression")
+	cmd.Flags().BoolVar(&opts.asApp, "as-app", false,
+		"Authenticate as the app with a JWT instead of an installation token")
+	cmd.Flags().Int64Var(&opts.appID, "app-id", 0, "GitHub App ID to authenticate with")
+	cmd.Flags().StringVarP(&opts.repo, "repo", "R", "", "Repository used to select the app and installation")
+}
+
+func apiRun(cmd *cobra.Command, opts *apiOptions, endpoint string) error {
+	host, client, token, err := resolveAPICredentials(opts)
+	if err != nil {
+		return err
+	}
+
+	params, err := parseAPIFields(opts.rawFields, opts.fields, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	method := strings.ToUpper(opts.method)
+	if method == "" {
+		method = http.MethodGet
+		if len(params) > 0 {
+			method = http.MethodPost
+		}
+	}
+
+	requestURL, err := buildAPIURL(auth.APIBaseURL(host), endpoint)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if len(params) > 0 {
+		if method == http.MethodGet || method == http.MethodHead {
+			requestURL = appendQueryParams(requestURL, params)
+		} else {
+			body, err = json.Marshal(params)
+			if err != nil {
+				return fmt.Errorf("failed to encode request body: %w", err)
+			}
+		}
+	}
+
+	headers, err := parseAPIHeaders(opts.headers)
+	if err != nil {
+		return err
+	}
+
+	req := apiRequest{method: method, url: requestURL, body: body, headers: headers}
+	return runRESTRequest(client, req, token, opts, cmd.OutOrStdout(), cmd.ErrOrStderr())
+}
+
+func graphqlRun(cmd *cobra.Command, opts *apiOptions) error {
+	host, client, token, err := resolveAPICredentials(opts)
+	if err != nil {
+		return err
+	}
+
+	params, err := parseAPIFields(opts.rawFields, opts.fields, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	query, ok := params["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return fmt.Errorf("a GraphQL query is required: use -f query='...'")
+	}
+
+	payload := map[string]interface{}{"query": query}
+	variables := make(map[string]interface{})
+	for key, value := range params {
+		switch key {
+		case "query":
+		case "operationName":
+			payload["operationName"] = value
+		default:
+			variables[key] = value
+		}
+	}
+	payload["variables"] = variables
+
+	headers, err := parseAPIHeaders(opts.headers)
+	if err != nil {
+		return err
+	}
+
+	return runGraphQLRequest(
+		client, auth.GraphQLURL(host), payload, headers, token, opts, cmd.OutOrStdout(), cmd.ErrOrStderr(),
+	)
+}
+
+// resolveAPICredentials selects the app, host and token used for the request. With
+// --as-app the token is empty: the returned client authenticates with JWTs, and retries
+// requests rejected for clock skew.
+func resolveAPICredentials(opts *apiOptions) (host string, client *http.Client, token string, err error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", nil, "", fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	app, err := selectAPIApp(cfg, opts.appID, opts.repo)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	host = opts.hostname
+	if host == "" && opts.repo != "" {
+		host = extractHost(opts.repo)
+	}
+	if host == "" && len(app.Patterns) > 0 {
+		host = extractHostFromPattern(app.Patterns[0])
+	}
+	if host == "" {
+		host = gitHubAPIHost
+	}
+
+	authenticator := auth.NewAuthenticator()
+	if opts.asApp {
+		return host, &http.Client{Transport: authenticator.AppJWTTransport(app, nil)}, "", nil
+	}
+
+	repoURL := opts.repo
+	if repoURL == "" {
+		repoURL = "https://" + host
+	}
+	token, _, err = authenticator.GetCredentials(app, repoURL)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("failed to get installation token for app %d: %w", app.AppID, err)
+	}
+	return host, &http.Client{}, token, nil
+}
+
+// selectAPIApp picks the app by ID, by repository match, or the only configured app
+func selectAPIApp(cfg *config.Config, appID int64, repo string) (*config.GitHubApp, error) {
+	if appID > 0 {
+		for i := range cfg.GitHubApps {
+			if cfg.GitHubApps[i].AppID == appID {
+				return &cfg.GitHubApps[i], nil
+			}
+		}
+		return nil, fmt.Errorf("app with ID %d not found in configuration", appID)
+	}
+
+	if repo != "" {
+		app, err := matcher.NewMatcher(cfg.GitHubApps).Match(repo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match repository %s: %w", repo, err)
+		}
+		if app == nil {
+			return nil, fmt.Errorf("no GitHub App configured for %s", repo)
+		}
+		return app, nil
+	}
+
+	switch len(cfg.GitHubApps) {
+	case 0:
+		return nil, fmt.Errorf("no GitHub Apps configured. Run 'gh app-auth setup' first")
+	case 1:
+		return &cfg.GitHubApps[0], nil
+	default:
+		return nil, fmt.Errorf("multiple GitHub Apps configured: use --app-id or --repo to select one")
+	}
+}
+
+// runRESTRequest performs a REST request, following Link headers when paginating.
+// Only next pages on the scheme and host of the first request are followed, as the
+// token is sent to them.
+func runRESTRequest(
+	client *http.Client, req apiRequest, token string, opts *apiOptions, out, errOut io.Writer,
+) error {
+	for {
+		resp, err := doAPIRequest(client, req, token)
+		if err != nil {
+			return err
+		}
+
+		if err := writeAPIResponse(resp, opts, out, errOut); err != nil {
+			return err
+		}
+
+		if !opts.paginate {
+			return nil
+		}
+		next, err := auth.FollowNextPage(resp.header.Get("Link"), req.url)
+		if err != nil || next == "" {
+			return err
+		}
+		req.url = next
+	}
+}
+
+// runGraphQLRequest performs a GraphQL request, following pageInfo.endCursor when paginating
+func runGraphQLRequest(
+	client *http.Client, endpoint string, payload map[string]interface{},
+	headers map[string]string, token string, opts *apiOptions, out, errOut io.Writer,
+) error {
+	for {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to encode GraphQL request: %w", err)
+		}
+
+		req := apiRequest{method: http.MethodPost, url: endpoint, body: body, headers: headers}
+		resp, err := doAPIRequest(client, req, token)
+		if err != nil {
+			return err
+		}
+
+		if err := writeAPIResponse(resp, opts, out, errOut); err != nil {
+			return err
+		}
+
+		// Like gh api graphql, a response reporting errors fails even with status 200
+		if err := graphQLErrors(resp.body); err != nil {
+			return err
+		}
+
+		if !opts.paginate {
+			return nil
+		}
+
+		hasNext, endCursor := findPageInfo(resp.body)
+		if !hasNext || endCursor == "" {
+			return nil
+		}
+		variables, ok := payload["variables"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		variables["endCursor"] = endCursor
+	}
+}
+
+// doAPIRequest sends a single request with the given token, if any
+func doAPIRequest(client *http.Client, req apiRequest, token string) (*apiResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var bodyReader io.Reader
+	if req.body != nil {
+		bodyReader = bytes.NewReader(req.body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, req.url, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	httpReq.Header.Set("Accept", "application/vnd.github+json")
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range req.headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &apiResponse{
+		statusCode: resp.StatusCode,
+		status:     resp.Status,
+		header:     resp.Header,
+		body:       data,
+	}, nil
+}
+
+// writeAPIResponse prints a response, applying the jq filter to successful JSON bodies.
+// The body of an error response is printed to errOut.
+func writeAPIResponse(resp *apiResponse, opts *apiOptions, out, errOut io.Writer) error {
+	if opts.include {
+		fmt.Fprintf(out, "HTTP %s\n", resp.status)
+		keys := make([]string, 0, len(resp.header))
+		for key := range resp.header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range resp.header[key] {
+				fmt.Fprintf(out, "%s: %s\n", key, value)
+			}
+		}
+		fmt.Fprintln(out)
+	}
+
+	if resp.statusCode >= 300 {
+		if len(resp.body) > 0 {
+			fmt.Fprintln(errOut, strings.TrimSpace(string(resp.body)))
+		}
+		return fmt.Errorf("GitHub API returned status %d", resp.statusCode)
+	}
+
+	if len(resp.body) == 0 {
+		return nil
+	}
+
+	if opts.jqFilter != "" {
+		if err := jq.Evaluate(bytes.NewReader(resp.body), out, opts.jqFilter); err != nil {
+			return fmt.Errorf("failed to apply jq filter: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := out.Write(resp.body); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(resp.body, []byte("\n")) {
+		_, err := fmt.Fprintln(out)
+		return err
+	}
+	return nil
+}
+
+// buildAPIURL joins an endpoint with the API base URL unless it is already absolute.
+// Absolute endpoints must use https on the API host, as the app's token is sent to them.
+func buildAPIURL(baseURL, endpoint string) (string, error) {
+	if strings.HasPrefix(endpoint, "http://") {
+		return "", fmt.Errorf("refusing to send credentials over plain http: %s", endpoint)
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(endpoint, "/"), nil
+	}
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid API base URL %q: %w", baseURL, err)
+	}
+	if !strings.EqualFold(endpointURL.Host, base.Host) {
+		return "", fmt.Errorf("endpoint host %s does not match the API host %s", endpointURL.Host, base.Host)
+	}
+	return endpoint, nil
+}
+
+// appendQueryParams adds fields to the query string of a URL
+func appendQueryParams(requestURL string, params map[string]interface{}) string {
+	values := url.Values{}
+	for key, value := range params {
+		if value == nil {
+			values.Set(key, "")
+			continue
+		}
+		values.Set(key, fmt.Sprintf("%v", value))
+	}
+	separator := "?"
+	if strings.Contains(requestURL, "?") {
+		separator = "&"
+	}
+	return requestURL + separator + values.Encode()
+}
+
+// parseAPIFields converts -f and -F flags into request parameters
+func parseAPIFields(rawFields, typedFields []string, stdin io.Reader) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+
+	for _, field := range rawFields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid field format %q: expected key=value", field)
+		}
+		params[key] = value
+	}
+
+	for _, field := range typedFields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid field format %q: expected key=value", field)
+		}
+		typed, err := magicFieldValue(value, stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read value for field %q: %w", key, err)
+		}
+		params[key] = typed
+	}
+
+	return params, nil
+}
+
+// magicFieldValue converts a -F value to its JSON type
+func magicFieldValue(value string, stdin io.Reader) (interface{}, error) {
+	if strings.HasPrefix(value, "@") {
+		var data []byte
+		var err error
+		if value == "@-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(value[1:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+
+	return value, nil
+}
+
+// parseAPIHeaders converts -H flags into a header map
+func parseAPIHeaders(headers []string) (map[string]string, error) {
+	result := make(map[string]string, len(headers))
+	for _, header := range headers {
+		key, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid header format %q: expected key:value", header)
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return result, nil
+}
+
+// graphQLErrors returns an error listing the messages of a GraphQL response's top-level errors
+func graphQLErrors(body []byte) error {
+	var response struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || len(response.Errors) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(response.Errors))
+	for _, e := range response.Errors {
+		messages = append(messages, e.Message)
+	}
+	return fmt.Errorf("GraphQL request failed: %s", strings.Join(messages, "; "))
+}
+
+// findPageInfo returns the first pageInfo object of a GraphQL response in document order
+func findPageInfo(body []byte) (hasNextPage bool, endCursor string) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	// objects tracks whether each open container is an object; expectKey whether the
+	// next token of the innermost object is a key
+	var objects []bool
+	expectKey := false
+	inObject := func() bool { return len(objects) > 0 && objects[len(objects)-1] }
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, ""
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			objects = append(objects, tok == json.Delim('{'))
+			expectKey = inObject()
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			objects = objects[:len(objects)-1]
+			expectKey = inObject()
+			continue
+		}
+		if !expectKey {
+			// A scalar value
+			expectKey = inObject()
+			continue
+		}
+
+		expectKey = false
+		if tok != "pageInfo" {
+			continue
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return false, ""
+		}
+		expectKey = true
+		var pageInfo struct {
+			HasNextPage bool   `json:"hasNextPage"`
+			EndCursor   string `json:"endCursor"`
+		}
+		if err := json.Unmarshal(raw, &pageInfo); err == nil && len(raw) > 0 && raw[0] == '{' {
+			return pageInfo.HasNextPage, pageInfo.EndCursor
+		}
+	}
+}
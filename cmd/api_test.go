@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+func TestParseAPIFields(t *testing.T) {
+	tempDir := t.TempDir()
+	bodyFile := filepath.Join(tempDir, "body.txt")
+	if err := os.WriteFile(bodyFile, []byte("from file"), 0600); err != nil {
+		t.Fatalf("Failed to write body file: %v", err)
+	}
+
+	params, err := parseAPIFields(
+		[]string{"title=123", "empty="},
+		[]string{"count=42", "draft=true", "closed=false", "milestone=null", "name=plain", "body=@" + bodyFile, "stdin=@-"},
+		strings.NewReader("from stdin"),
+	)
+	if err != nil {
+		t.Fatalf("parseAPIFields() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"title":     "123",
+		"empty":     "",
+		"count":     int64(42),
+		"draft":     true,
+		"closed":    false,
+		"milestone": nil,
+		"name":      "plain",
+		"body":      "from file",
+		"stdin":     "from stdin",
+	}
+	for key, wantValue := range want {
+		if got, ok := params[key]; !ok || got != wantValue {
+			t.Errorf("params[%q] = %#v, want %#v", key, got, wantValue)
+		}
+	}
+
+	if _, err := parseAPIFields([]string{"novalue"}, nil, nil); err == nil {
+		t.Error("Expected error for field without '='")
+	}
+	if _, err := parseAPIFields(nil, []string{"=value"}, nil); err == nil {
+		t.Error("Expected error for field without key")
+	}
+}
+
+func TestParseAPIHeaders(t *testing.T) {
+	headers, err := parseAPIHeaders([]string{"Accept: application/vnd.github.raw", "X-Custom:value"})
+	if err != nil {
+		t.Fatalf("parseAPIHeaders() error = %v", err)
+	}
+	if headers["Accept"] != "application/vnd.github.raw" {
+		t.Errorf("Accept = %q", headers["Accept"])
+	}
+	if headers["X-Custom"] != "value" {
+		t.Errorf("X-Custom = %q", headers["X-Custom"])
+	}
+
+	if _, err := parseAPIHeaders([]string{"missing-colon"}); err == nil {
+		t.Error("Expected error for header without ':'")
+	}
+}
+
+func TestBuildAPIURL(t *testing.T) {
+	tests := []struct {
+		base     string
+		endpoint string
+		want     string
+	}{
+		{"https://api.github.com", "/app", "https://api.github.com/app"},
+		{"https://api.github.com", "app/installations", "https://api.github.com/app/installations"},
+		{"https://ghes.example.com/api/v3", "/repos/o/r", "https://ghes.example.com/api/v3/repos/o/r"},
+		{"https://api.github.com", "https://api.github.com/app?page=2", "https://api.github.com/app?page=2"},
+	}
+
+	for _, tt := range tests {
+		if got, err := buildAPIURL(tt.base, tt.endpoint); err != nil || got != tt.want {
+			t.Errorf("buildAPIURL(%q, %q) = %q, %v; want %q", tt.base, tt.endpoint, got, err, tt.want)
+		}
+	}
+
+	// The app's token must not be sent to another host or over plain http
+	rejected := []string{
+		"https://evil.example.com/app",
+		"http://api.github.com/app",
+		"https://github.com/app",
+	}
+	for _, endpoint := range rejected {
+		if got, err := buildAPIURL("https://api.github.com", endpoint); err == nil {
+			t.Errorf("buildAPIURL(%q) = %q, want an error", endpoint, got)
+		}
+	}
+}
+
+func TestAppendQueryParams(t *testing.T) {
+	got := appendQueryParams("https://api.github.com/search?x=1", map[string]interface{}{"q": "a b"})
+	if got != "https://api.github.com/search?x=1&q=a+b" {
+		t.Errorf("appendQueryParams() = %q", got)
+	}
+}
+
+func TestRunRESTRequest_PaginateWithJQ(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, server.URL))
+			fmt.Fprint(w, `[{"name":"one"},{"name":"two"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"name":"three"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req := apiRequest{method: http.MethodGet, url: server.URL + "/items"}
+	opts := &apiOptions{paginate: true, jqFilter: ".[].name"}
+
+	if err := runRESTRequest(server.Client(), req, "test-token", opts, &out, io.Discard); err != nil {
+		t.Fatalf("runRESTRequest() error = %v", err)
+	}
+
+	if got := out.String(); got != "one\ntwo\nthree\n" {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestRunRESTRequest_PaginateRefusesOtherHosts(t *testing.T) {
+	// Given a first page linking to a next page on another host
+	var leaked bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = true
+		fmt.Fprint(w, `[]`)
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, other.URL))
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	// When paginating
+	var out bytes.Buffer
+	req := apiRequest{method: http.MethodGet, url: server.URL + "/items"}
+	err := runRESTRequest(server.Client(), req, "t", &apiOptions{paginate: true}, &out, io.Discard)
+
+	// Then the token is not sent to the other host
+	if err == nil || !strings.Contains(err.Error(), "refusing to follow next page") {
+		t.Errorf("runRESTRequest() error = %v, want refusal", err)
+	}
+	if leaked {
+		t.Error("Next page on another host was requested")
+	}
+}
+
+func TestRunRESTRequest_WithoutPaginateStopsAfterFirstPage(t *testing.T) {
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Link", fmt.Sprintf(`<%s/items?page=2>; rel="next"`, server.URL))
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req := apiRequest{method: http.MethodGet, url: server.URL + "/items"}
+	if err := runRESTRequest(server.Client(), req, "t", &apiOptions{}, &out, io.Discard); err != nil {
+		t.Fatalf("runRESTRequest() error = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRunRESTRequest_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var out, errOut bytes.Buffer
+	req := apiRequest{method: http.MethodGet, url: server.URL + "/missing"}
+	err := runRESTRequest(server.Client(), req, "t", &apiOptions{}, &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+	if !strings.Contains(errOut.String(), "Not Found") {
+		t.Errorf("error output = %q, want the response body", errOut.String())
+	}
+}
+
+func TestWriteAPIResponse_IncludeSortsHeaders(t *testing.T) {
+	resp := &apiResponse{
+		statusCode: http.StatusOK,
+		status:     "200 OK",
+		header: http.Header{
+			"X-Ratelimit-Remaining": {"4999"},
+			"Content-Type":          {"application/json"},
+			"Etag":                  {`"abc"`},
+		},
+		body: []byte("{}\n"),
+	}
+
+	var out bytes.Buffer
+	if err := writeAPIResponse(resp, &apiOptions{include: true}, &out, io.Discard); err != nil {
+		t.Fatalf("writeAPIResponse() error = %v", err)
+	}
+
+	want := "HTTP 200 OK\nContent-Type: application/json\nEtag: \"abc\"\nX-Ratelimit-Remaining: 4999\n\n{}\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestRunRESTRequest_SendsBodyAndHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if r.Header.Get("X-Custom") != "yes" {
+			t.Errorf("X-Custom header = %q", r.Header.Get("X-Custom"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	req := apiRequest{
+		method:  http.MethodPost,
+		url:     server.URL + "/repos/o/r/issues",
+		body:    []byte(`{"title":"hello"}`),
+		headers: map[string]string{"X-Custom": "yes"},
+	}
+	if err := runRESTRequest(server.Client(), req, "t", &apiOptions{jqFilter: ".title"}, &out, io.Discard); err != nil {
+		t.Fatalf("runRESTRequest() error = %v", err)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRunGraphQLRequest_Paginate(t *testing.T) {
+	var cursors []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		cursors = append(cursors, payload.Variables["endCursor"])
+
+		if payload.Variables["endCursor"] == nil {
+			fmt.Fprint(w, `{"data":{"org":{"repos":{"nodes":[{"n":"a"}],`+
+				`"pageInfo":{"hasNextPage":true,"endCursor":"C1"}}}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"org":{"repos":{"nodes":[{"n":"b"}],`+
+			`"pageInfo":{"hasNextPage":false,"endCursor":"C2"}}}}}`)
+	}))
+	defer server.Close()
+
+	payload := map[string]interface{}{
+		"query":     "query($endCursor: String) { ... }",
+		"variables": map[string]interface{}{},
+	}
+	opts := &apiOptions{paginate: true, jqFilter: ".data.org.repos.nodes[].n"}
+
+	var out bytes.Buffer
+	if err := runGraphQLRequest(server.Client(), server.URL, payload, nil, "t", opts, &out, io.Discard); err != nil {
+		t.Fatalf("runGraphQLRequest() error = %v", err)
+	}
+
+	if out.String() != "a\nb\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if len(cursors) != 2 || cursors[1] != "C1" {
+		t.Errorf("cursors = %v, want [nil C1]", cursors)
+	}
+}
+
+func TestRunGraphQLRequest_ErrorsFail(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":null,"errors":[{"message":"Field 'nope' doesn't exist on type 'Query'"}]}`)
+	}))
+	defer server.Close()
+
+	payload := map[string]interface{}{"query": "{ nope }", "variables": map[string]interface{}{}}
+
+	var out bytes.Buffer
+	err := runGraphQLRequest(server.Client(), server.URL, payload, nil, "t", &apiOptions{}, &out, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "doesn't exist") {
+		t.Errorf("runGraphQLRequest() error = %v, want the GraphQL error", err)
+	}
+	if !strings.Contains(out.String(), `"errors"`) {
+		t.Errorf("output = %q, want the response body", out.String())
+	}
+}
+
+func TestSelectAPIApp(t *testing.T) {
+	cfg := &config.Config{
+		GitHubApps: []config.GitHubApp{
+			{Name: "org1", AppID: 1, Patterns: []string{"github.com/org1/"}},
+			{Name: "org2", AppID: 2, Patterns: []string{"github.com/org2/"}},
+		},
+	}
+
+	app, err := selectAPIApp(cfg, 2, "")
+	if err != nil || app.Name != "org2" {
+		t.Errorf("selectAPIApp by ID = %v, %v", app, err)
+	}
+
+	app, err = selectAPIApp(cfg, 0, "github.com/org1/repo")
+	if err != nil || app.Name != "org1" {
+		t.Errorf("selectAPIApp by repo = %v, %v", app, err)
+	}
+
+	if _, err := selectAPIApp(cfg, 99, ""); err == nil {
+		t.Error("Expected error for unknown app ID")
+	}
+	if _, err := selectAPIApp(cfg, 0, "github.com/other/repo"); err == nil {
+		t.Error("Expected error for unmatched repository")
+	}
+	if _, err := selectAPIApp(cfg, 0, ""); err == nil {
+		t.Error("Expected error when several apps are configured")
+	}
+
+	single := &config.Config{GitHubApps: cfg.GitHubApps[:1]}
+	app, err = selectAPIApp(single, 0, "")
+	if err != nil || app.Name != "org1" {
+		t.Errorf("selectAPIApp with single app = %v, %v", app, err)
+	}
+}
+
+func TestFindPageInfo(t *testing.T) {
+	hasNext, cursor := findPageInfo([]byte(`{"data":{"a":{"pageInfo":{"hasNextPage":true,"endCursor":"X"}}}}`))
+	if !hasNext || cursor != "X" {
+		t.Errorf("findPageInfo() = %v, %q", hasNext, cursor)
+	}
+
+	// The first pageInfo in the response wins, whatever the other keys
+	body := []byte(`{"data":{"z":[{"pageInfo":"not an object"}],"b":{"pageInfo":{"hasNextPage":false,"endCursor":"B"}},` +
+		`"a":{"pageInfo":{"hasNextPage":true,"endCursor":"A"}}}}`)
+	for range 10 {
+		if hasNext, cursor := findPageInfo(body); hasNext || cursor != "B" {
+			t.Fatalf("findPageInfo() = %v, %q, want the first pageInfo", hasNext, cursor)
+		}
+	}
+
+	hasNext, cursor = findPageInfo([]byte(`{"data":{"viewer":{"login":"bot"}}}`))
+	if hasNext || cursor != "" {
+		t.Errorf("findPageInfo() without pageInfo = %v, %q", hasNext, cursor)
+	}
+}
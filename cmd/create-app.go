@@ -0,0 +1,376 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestFormTemplate posts the manifest to GitHub from the user's browser
+var manifestFormTemplate = template.Must(template.New("manifest").Parse(`<!DOCTYPE html>
+<html>
+<head><title>gh app-auth: create GitHub App</title></head>
+<body>
+<form id="manifest" action="{{.Action}}" method="post">
+<input type="hidden" name="manifest" value="{{.Manifest}}">
+<p>Redirecting to GitHub to create the app...</p>
+<noscript><button type="submit">Continue to GitHub</button></noscript>
+</form>
+<script>document.getElementById("manifest").submit();</script>
+</body>
+</html>
+`))
+
+type createAppOptions struct {
+	org       string
+	manifest  string
+	hostname  string
+	name      string
+	patterns  []string
+	priority  int
+	port      int
+	noBrowser bool
+	timeout   time.Duration
+}
+
+// appManifestConversion is the response of POST /app-manifests/{code}/conversions
+type appManifestConversion struct {
+	ID       int64  `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	ClientID string `json:"client_id"`
+	PEM      string `json:"pem"`
+	HTMLURL  string `json:"html_url"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// manifestCallbackServer serves the manifest form and receives GitHub's redirect
+type manifestCallbackServer struct {
+	state    string
+	action   string
+	manifest string
+	codes    chan string
+}
+
+func NewCreateAppCmd() *cobra.Command {
+	opts := &createAppOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "create-app",
+		Short: "Create a GitHub App from a manifest",
+		Long: `Create a GitHub App through the GitHub App manifest flow and configure it.
+
+A local callback server is started and your browser is sent to GitHub with the
+manifest. After you confirm the app on GitHub, the temporary code is exchanged
+for the app credentials. The private key is stored directly in the OS keyring
+and never written to disk, and a GitHub App entry is added to the configuration.
+
+The manifest is a YAML or JSON file using GitHub's manifest schema
+(name, url, default_permissions, ...). Its redirect_url is set by this command.
+
+Install the app on the organization afterwards using the URL printed at the end.`,
+		Example: `  # Create an organization app
+  gh app-auth create-app --org myorg --manifest app.yml
+
+  # GitHub Enterprise Server, custom patterns
+  gh app-auth create-app --hostname github.example.com --org corp --manifest app.yml \
+    --patterns "github.example.com/corp/*"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createAppRun(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.org, "org", "", "Organization that will own the app (default: your user account)")
+	cmd.Flags().StringVar(&opts.manifest, "manifest", "", "Path to the app manifest (YAML or JSON)")
+	cmd.Flags().StringVar(&opts.hostname, "hostname", gitHubAPIHost, "GitHub host")
+	cmd.Flags().StringVar(&opts.name, "name", "", "App name (overrides the manifest)")
+	cmd.Flags().StringSliceVar(&opts.patterns, "patterns", nil,
+		"Repository patterns to match (default: <hostname>/<org>/*)")
+	cmd.Flags().IntVar(&opts.priority, "priority", 5, "Priority for pattern matching (higher = more priority)")
+	cmd.Flags().IntVar(&opts.port, "port", 0, "Local callback port (default: random)")
+	cmd.Flags().BoolVar(&opts.noBrowser, "no-browser", false, "Print the URL instead of opening a browser")
+	cmd.Flags().DurationVar(&opts.timeout, "timeout", 10*time.Minute, "How long to wait for the app to be created")
+
+	_ = cmd.MarkFlagRequired("manifest")
+
+	return cmd
+}
+
+func createAppRun(ctx context.Context, opts *createAppOptions) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	patterns := opts.patterns
+	if len(patterns) == 0 {
+		if opts.org == "" {
+			return fmt.Errorf("--patterns is required when creating an app without --org")
+		}
+		patterns = []string{fmt.Sprintf("%s/%s/*", opts.hostname, opts.org)}
+	}
+
+	manifest, err := loadAppManifest(opts.manifest, opts.name)
+	if err != nil {
+		return err
+	}
+
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return err
+	}
+	// Check before creating anything: the private key can only be downloaded once
+	if !secretMgr.IsAvailable() {
+		return fmt.Errorf("OS keyring is unavailable; create-app stores the private key " +
+			"only in the keyring and never writes it to disk")
+	}
+
+	cfg, err := config.LoadOrCreate()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", opts.port))
+	if err != nil {
+		return fmt.Errorf("failed to start callback server: %w", err)
+	}
+
+	state, err := randomState()
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	baseURL := "http://" + listener.Addr().String()
+	manifest["redirect_url"] = baseURL + "/callback"
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	callback := &manifestCallbackServer{
+		state:    state,
+		action:   manifestCreateURL(opts.hostname, opts.org, state),
+		manifest: string(manifestJSON),
+		codes:    make(chan string, 1),
+	}
+	server := &http.Server{Handler: callback, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("🌐 Open %s to create the GitHub App\n", baseURL)
+	if !opts.noBrowser {
+		if err := openBrowser(ctx, baseURL); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Could not open a browser: %v\n", err)
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	var code string
+	select {
+	case code = <-callback.codes:
+	case <-waitCtx.Done():
+		return fmt.Errorf("timed out waiting for GitHub App creation")
+	}
+
+	conversion, err := convertAppManifest(waitCtx, auth.APIBaseURL(opts.hostname), code)
+	if err != nil {
+		return err
+	}
+
+	app, err := saveCreatedApp(cfg, secretMgr, conversion, patterns, opts.priority)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Created GitHub App '%s'\n", app.Name)
+	fmt.Printf("   App ID: %d\n", app.AppID)
+	fmt.Printf("   Patterns: %s\n", strings.Join(app.Patterns, ", "))
+	fmt.Println("   🔐 Storage: OS Keyring (encrypted)")
+	fmt.Println("\n💡 Next steps:")
+	fmt.Printf("   1. Install the app: %s/installations/new\n", conversion.HTMLURL)
+	fmt.Println("   2. Test authentication: gh app-auth test --repo <repository-url>")
+	fmt.Println("   The client secret and webhook secret are not stored; regenerate them in the app settings if needed.")
+
+	return nil
+}
+
+// loadAppManifest reads a YAML or JSON app manifest
+func loadAppManifest(path, nameOverride string) (map[string]interface{}, error) {
+	expanded, err := expandPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest path: %w", err)
+	}
+	data, err := os.ReadFile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	// YAML is a superset of JSON, so one decoder handles both
+	manifest := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if nameOverride != "" {
+		manifest["name"] = nameOverride
+	}
+	if name, _ := manifest["name"].(string); strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("manifest must define a name (or use --name)")
+	}
+	if homepage, _ := manifest["url"].(string); strings.TrimSpace(homepage) == "" {
+		return nil, fmt.Errorf("manifest must define url (the app's homepage)")
+	}
+
+	return manifest, nil
+}
+
+// manifestCreateURL returns the page the manifest form is posted to
+func manifestCreateURL(hostname, org, state string) string {
+	path := "/settings/apps/new"
+	if org != "" {
+		path = "/organizations/" + url.PathEscape(org) + "/settings/apps/new"
+	}
+	return "https://" + hostname + path + "?state=" + url.QueryEscape(state)
+}
+
+func (s *manifestCallbackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = manifestFormTemplate.Execute(w, struct{ Action, Manifest string }{s.action, s.manifest})
+
+	case "/callback":
+		query := r.URL.Query()
+		if query.Get("state") != s.state {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		}
+		code := query.Get("code")
+		if code == "" {
+			http.Error(w, "missing code", http.StatusBadRequest)
+			return
+		}
+		select {
+		case s.codes <- code:
+			fmt.Fprintln(w, "GitHub App created. You can close this window and return to the terminal.")
+		default:
+			http.Error(w, "callback already received", http.StatusConflict)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// convertAppManifest exchanges a manifest code for the app credentials
+func convertAppManifest(ctx context.Context, apiBaseURL, code string) (*appManifestConversion, error) {
+	apiURL := fmt.Sprintf("%s/app-manifests/%s/conversions", apiBaseURL, url.PathEscape(code))
+
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert app manifest: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var conversion appManifestConversion
+	if err := json.NewDecoder(resp.Body).Decode(&conversion); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if conversion.ID == 0 || conversion.PEM == "" {
+		return nil, errors.New("GitHub API response is missing the app ID or private key")
+	}
+
+	return &conversion, nil
+}
+
+// saveCreatedApp stores the private key in the keyring and adds the app to the configuration
+func saveCreatedApp(
+	cfg *config.Config, secretMgr *secrets.Manager, conversion *appManifestConversion,
+	patterns []string, priority int,
+) (*config.GitHubApp, error) {
+	app := createGitHubApp(conversion.ID, conversion.Name, 0, patterns, priority)
+	app.ClientID = conversion.ClientID
+
+	if err := secretMgr.StoreInKeyring(app.Name, secrets.SecretTypePrivateKey, conversion.PEM); err != nil {
+		return nil, fmt.Errorf("failed to store private key: %w", err)
+	}
+	app.PrivateKeySource = config.PrivateKeySourceKeyring
+
+	if err := app.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid app configuration: %w", err)
+	}
+	if err := saveAppConfiguration(cfg, &app); err != nil {
+		return nil, err
+	}
+
+	return &app, nil
+}
+
+// randomState returns an unguessable value for the manifest flow state parameter
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// openBrowser opens a URL with the platform's default handler
+func openBrowser(ctx context.Context, target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "open", target)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.CommandContext(ctx, "xdg-open", target)
+	}
+	return cmd.Start()
+}
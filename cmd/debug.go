@@ -1,13 +1,9 @@
 package cmd
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
@@ -34,10 +30,11 @@ func newListInstallationsCmd() *cobra.Command {
 	var appID int64
 
 	cmd := &cobra.Command{
-		Use:     "list-installations",
-		Short:   "List all installations for a GitHub App",
-		Long:    "Lists all installations for a GitHub App using the configured private key.",
-		Example: "  gh app-auth debug list-installations --app-id 2083241",
+		Use:        "list-installations",
+		Deprecated: "use 'gh app-auth installations list' instead",
+		Short:      "List all installations for a GitHub App",
+		Long:       "Lists all installations for a GitHub App using the configured private key.",
+		Example:    "  gh app-auth debug list-installations --app-id 2083241",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
@@ -69,8 +66,7 @@ func newListInstallationsCmd() *cobra.Command {
 				fmt.Printf("=== %s (App ID %d) ===\n", appDisplayName(app), app.AppID)
 
 				authenticator := auth.NewAuthenticator()
-				jwtToken, err := authenticator.GenerateJWTForApp(app)
-				if err != nil {
+				if _, err := authenticator.GenerateJWTForApp(app); err != nil {
 					if cmd.Flags().Changed("app-id") {
 						return fmt.Errorf("failed to generate JWT for app %d: %w", app.AppID, err)
 					}
@@ -80,7 +76,12 @@ func newListInstallationsCmd() *cobra.Command {
 
 				fmt.Println("  JWT generated")
 
-				installations, err := listInstallations(jwtToken)
+				host := gitHubAPIHost
+				if len(app.Patterns) > 0 {
+					host = extractHostFromPattern(app.Patterns[0])
+				}
+				client := &http.Client{Transport: authenticator.AppJWTTransport(app, nil)}
+				installations, err := listInstallations(cmd.Context(), client, auth.APIBaseURL(host))
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
 						return fmt.Errorf("failed to list installations for app %d: %w", app.AppID, err)
@@ -121,10 +122,11 @@ func newListInstallationReposCmd() *cobra.Command {
 	var appID int64
 
 	cmd := &cobra.Command{
-		Use:     "list-repositories",
-		Short:   "List repositories accessible to an installation",
-		Long:    "Lists repositories accessible to an installation using the configured GitHub App.",
-		Example: "  gh app-auth debug list-repositories --app-id 2083241",
+		Use:        "list-repositories",
+		Deprecated: "use 'gh app-auth installations show <installation-id>' instead",
+		Short:      "List repositories accessible to an installation",
+		Long:       "Lists repositories accessible to an installation using the configured GitHub App.",
+		Example:    "  gh app-auth debug list-repositories --app-id 2083241",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
@@ -203,7 +205,7 @@ func newListInstallationReposCmd() *cobra.Command {
 					continue
 				}
 
-				repos, err := listInstallationRepositories(installationToken, host)
+				repos, err := listInstallationRepositories(cmd.Context(), installationToken, auth.APIBaseURL(host))
 				if err != nil {
 					if cmd.Flags().Changed("app-id") {
 						return err
@@ -243,108 +245,6 @@ func newListInstallationReposCmd() *cobra.Command {
 	return cmd
 }
 
-type installation struct {
-	ID                  int64   `json:"id"`
-	Account             account `json:"account"`
-	RepositorySelection string  `json:"repository_selection"`
-	TargetType          string  `json:"target_type"`
-}
-
-type account struct {
-	Login string `json:"login"`
-	Type  string `json:"type"`
-}
-
-func listInstallations(jwtToken string) ([]installation, error) {
-	apiURL := "https://api.github.com/app/installations"
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+jwtToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			fmt.Printf("warning: failed to close response body: %v\n", closeErr)
-		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var installations []installation
-	if err := json.NewDecoder(resp.Body).Decode(&installations); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return installations, nil
-}
-
-type installationRepository struct {
-	ID          int64  `json:"id"`
-	Name        string `json:"name"`
-	FullName    string `json:"full_name"`
-	Private     bool   `json:"private"`
-	Description string `json:"description"`
-	HTMLURL     string `json:"html_url"`
-}
-
-func listInstallationRepositories(token, host string) ([]installationRepository, error) {
-	apiURL := fmt.Sprintf("https://%s/api/v3/installation/repositories", host)
-	if host == gitHubAPIHost {
-		apiURL = "https://api.github.com/installation/repositories"
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			fmt.Printf("warning: failed to close response body: %v\n", closeErr)
-		}
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var payload struct {
-		Repositories []installationRepository `json:"repositories"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return payload.Repositories, nil
-}
-
 func extractHostFromPattern(pattern string) string {
 	pattern = strings.TrimSpace(pattern)
 	pattern = strings.TrimPrefix(pattern, "https://")
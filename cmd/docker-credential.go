@@ -0,0 +1,438 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// dockerCredentialBinary is the executable name docker looks up for credsStore "gh-app-auth"
+	dockerCredentialBinary = "docker-credential-gh-app-auth"
+	// dockerCredentialsNotFound is the message docker expects on stdout when no credentials exist
+	dockerCredentialsNotFound = "credentials not found in native keychain"
+	// ghcrHost is the GitHub Container Registry host for github.com
+	ghcrHost = "ghcr.io"
+	// accessTokenUsername is the basic auth username paired with installation tokens and GitHub PATs
+	accessTokenUsername = "x-access-token"
+)
+
+// errDockerCredentialsNotFound signals a "not found" answer to the docker client
+var errDockerCredentialsNotFound = errors.New(dockerCredentialsNotFound)
+
+// dockerCredentials is the JSON payload of the docker credential helper protocol
+type dockerCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func NewDockerCredentialCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docker-credential <get|store|erase|list>",
+		Short: "Docker credential helper for GitHub container registries",
+		Long: `Docker credential helper that provides GitHub App and PAT authentication
+for ghcr.io and GitHub Enterprise Server container registries.
+
+This command implements the docker credential helper protocol and should not
+be called directly. Link it as docker-credential-gh-app-auth on your PATH:
+
+  ln -s "$(command -v gh-app-auth)" ~/.local/bin/docker-credential-gh-app-auth
+
+and configure docker to use it in ~/.docker/config.json:
+
+  { "credHelpers": { "ghcr.io": "gh-app-auth" } }
+
+Registry hosts are mapped back to their GitHub host (ghcr.io to github.com,
+containers.<host> to <host>) and resolved through the configured patterns.
+Patterns naming the registry host directly (e.g. "ghcr.io/myorg") take
+precedence.
+
+Docker only sends the registry host, so the app must be unambiguous: either
+the only app with a pattern on the host, or the only one of them pinned to an
+installation_id. An app without installation_id needs a pattern naming the
+owner (e.g. "github.com/myorg/") to find its installation. Credentials are
+generated on demand, so store and erase are accepted but do nothing.`,
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dockerCredentialRun(args[0], cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	return cmd
+}
+
+// dockerCredentialArgs rewrites the arguments when invoked as docker-credential-gh-app-auth
+func dockerCredentialArgs(argv0 string, args []string) ([]string, bool) {
+	name := strings.TrimSuffix(filepath.Base(argv0), ".exe")
+	if name != dockerCredentialBinary {
+		return nil, false
+	}
+	return append([]string{"docker-credential"}, args...), true
+}
+
+func dockerCredentialRun(operation string, in io.Reader, out io.Writer) error {
+	logger.FlowStart("docker_credential", map[string]interface{}{
+		"operation": operation,
+	})
+
+	var err error
+	switch operation {
+	case "get":
+		err = handleDockerCredentialGet(in, out)
+	case "store":
+		err = handleDockerCredentialStore(in)
+	case "erase":
+		err = handleDockerCredentialErase(in)
+	case "list":
+		err = handleDockerCredentialList(out)
+	default:
+		err = fmt.Errorf("unsupported docker credential operation: %s", operation)
+	}
+
+	if err != nil {
+		logger.FlowError("docker_credential", err, map[string]interface{}{
+			"operation": operation,
+		})
+	} else {
+		logger.FlowSuccess("docker_credential", map[string]interface{}{
+			"operation": operation,
+		})
+	}
+
+	return err
+}
+
+func handleDockerCredentialGet(in io.Reader, out io.Writer) error {
+	serverURL, err := readDockerServerURL(in)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+
+	app, pat, err := findRegistryCredential(cfg, serverURL)
+	if err != nil {
+		return err
+	}
+	if app == nil && pat == nil {
+		fmt.Fprintln(out, dockerCredentialsNotFound)
+		return errDockerCredentialsNotFound
+	}
+
+	creds := dockerCredentials{ServerURL: serverURL}
+	if pat != nil {
+		token, err := getPATToken(pat)
+		if err != nil {
+			return err
+		}
+		creds.Username = pat.Username
+		if creds.Username == "" {
+			creds.Username = accessTokenUsername
+		}
+		creds.Secret = token
+	} else {
+		repoURL, err := registryRepoURL(app, registryHost(serverURL))
+		if err != nil {
+			return err
+		}
+		token, _, err := auth.NewAuthenticator().GetCredentials(app, repoURL)
+		if err != nil {
+			return fmt.Errorf("failed to get credentials: %w", err)
+		}
+		creds.Username = accessTokenUsername
+		creds.Secret = token
+	}
+
+	logger.FlowStep("docker_credentials_generated", map[string]interface{}{
+		"server_url": serverURL,
+		"username":   creds.Username,
+		"token_hash": logger.HashToken(creds.Secret),
+	})
+
+	return json.NewEncoder(out).Encode(creds)
+}
+
+func handleDockerCredentialStore(in io.Reader) error {
+	// Credentials are generated dynamically; consume and ignore the payload
+	var creds dockerCredentials
+	if err := json.NewDecoder(in).Decode(&creds); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+	logger.FlowStep("docker_store_noop", map[string]interface{}{
+		"server_url": creds.ServerURL,
+		"reason":     "dynamic token generation",
+	})
+	return nil
+}
+
+func handleDockerCredentialErase(in io.Reader) error {
+	serverURL, err := readDockerServerURL(in)
+	if err != nil {
+		return err
+	}
+	logger.FlowStep("docker_erase_noop", map[string]interface{}{
+		"server_url": serverURL,
+		"reason":     "dynamic token generation",
+	})
+	return nil
+}
+
+func handleDockerCredentialList(out io.Writer) error {
+	result := make(map[string]string)
+
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, app := range cfg.GitHubApps {
+		for _, registry := range registriesForPatterns(app.Patterns) {
+			result[registry] = accessTokenUsername
+		}
+	}
+	for _, pat := range cfg.PATs {
+		username := pat.Username
+		if username == "" {
+			username = accessTokenUsername
+		}
+		for _, registry := range registriesForPatterns(pat.Patterns) {
+			result[registry] = username
+		}
+	}
+
+	return json.NewEncoder(out).Encode(result)
+}
+
+// readDockerServerURL reads the registry server URL sent on stdin
+func readDockerServerURL(in io.Reader) (string, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", fmt.Errorf("failed to read server URL: %w", err)
+	}
+	serverURL := strings.TrimSpace(string(data))
+	if serverURL == "" {
+		return "", fmt.Errorf("no server URL provided")
+	}
+	return serverURL, nil
+}
+
+// registryHost extracts the host from a docker server URL
+func registryHost(serverURL string) string {
+	host := strings.TrimPrefix(serverURL, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	if idx := strings.Index(host, "/"); idx >= 0 {
+		host = host[:idx]
+	}
+	return strings.ToLower(host)
+}
+
+// registryToGitHubHost maps a container registry host to the GitHub host it belongs to
+func registryToGitHubHost(host string) string {
+	switch {
+	case host == ghcrHost, host == "docker.pkg.github.com":
+		return gitHubAPIHost
+	case strings.HasPrefix(host, "containers."):
+		return strings.TrimPrefix(host, "containers.")
+	case strings.HasPrefix(host, "docker."):
+		return strings.TrimPrefix(host, "docker.")
+	default:
+		return host
+	}
+}
+
+// registriesForPatterns lists the registry hosts served by a set of patterns
+func registriesForPatterns(patterns []string) []string {
+	seen := make(map[string]bool)
+	var registries []string
+	for _, pattern := range patterns {
+		host := extractHostFromPattern(pattern)
+		if host == "" {
+			continue
+		}
+		registry := host
+		if host == gitHubAPIHost {
+			registry = ghcrHost
+		} else if !strings.HasPrefix(host, "containers.") && host != ghcrHost {
+			registry = "containers." + host
+		}
+		if !seen[registry] {
+			seen[registry] = true
+			registries = append(registries, registry)
+		}
+	}
+	return registries
+}
+
+// findRegistryCredential resolves a registry to an app or PAT.
+// Patterns naming the registry host win over patterns for the mapped GitHub host.
+// Several apps on a host are ambiguous unless exactly one is pinned to an installation.
+func findRegistryCredential(
+	cfg *config.Config, serverURL string,
+) (*config.GitHubApp, *config.PersonalAccessToken, error) {
+	registry := registryHost(serverURL)
+	hosts := []string{registry}
+	if githubHost := registryToGitHubHost(registry); githubHost != registry {
+		hosts = append(hosts, githubHost)
+	}
+
+	for _, host := range hosts {
+		pat := findPATForHost(cfg, host)
+		app, err := findAppForHost(cfg, host)
+		if err != nil && pat == nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case app != nil && pat != nil:
+			if pat.Priority > app.Priority {
+				return nil, pat, nil
+			}
+			return app, nil, nil
+		case app != nil:
+			return app, nil, nil
+		case pat != nil:
+			return nil, pat, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// findAppForHost returns the app serving a registry on host: the only app with a
+// pattern on the host, or else the only one of them pinned to an installation
+func findAppForHost(cfg *config.Config, host string) (*config.GitHubApp, error) {
+	var candidates, pinned []*config.GitHubApp
+	for i := range cfg.GitHubApps {
+		app := &cfg.GitHubApps[i]
+		if !hasHostPattern(app, host) {
+			continue
+		}
+		candidates = append(candidates, app)
+		if app.InstallationID != 0 {
+			pinned = append(pinned, app)
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return nil, nil
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case len(pinned) == 1:
+		return pinned[0], nil
+	}
+
+	names := make([]string, 0, len(candidates))
+	for _, app := range candidates {
+		names = append(names, fmt.Sprintf("%s (app %d, installation %d)", app.Name, app.AppID, app.InstallationID))
+	}
+	return nil, fmt.Errorf("several GitHub Apps match registry host %s and none is the only one "+
+		"pinned to an installation_id: %s", host, strings.Join(names, ", "))
+}
+
+// registryRepoURL returns the URL an app's registry token is minted for. Apps without
+// an installation_id discover their installation from its owner, so it must name one.
+func registryRepoURL(app *config.GitHubApp, registry string) (string, error) {
+	githubHost := registryToGitHubHost(registry)
+	if app.InstallationID != 0 {
+		return "https://" + githubHost, nil
+	}
+
+	owners := registryOwners(app, registry)
+	if registry != githubHost {
+		for _, owner := range registryOwners(app, githubHost) {
+			if !slices.Contains(owners, owner) {
+				owners = append(owners, owner)
+			}
+		}
+	}
+
+	switch len(owners) {
+	case 0:
+		return "", fmt.Errorf("app %s has no installation_id and no pattern naming an owner on %s: "+
+			"set installation_id or use a pattern such as %s/myorg/", app.Name, githubHost, githubHost)
+	case 1:
+		return "https://" + githubHost + "/" + owners[0], nil
+	default:
+		return "", fmt.Errorf("app %s has no installation_id and patterns for several owners on %s (%s): "+
+			"set installation_id", app.Name, githubHost, strings.Join(owners, ", "))
+	}
+}
+
+// registryOwners lists the distinct owners named by an app's patterns on host
+func registryOwners(app *config.GitHubApp, host string) []string {
+	var owners []string
+	for _, pattern := range app.Patterns {
+		if extractHostFromPattern(pattern) != host {
+			continue
+		}
+		owner := patternOwner(pattern)
+		if owner == "" || owner == "*" || slices.Contains(owners, owner) {
+			continue
+		}
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+// patternOwner returns the owner segment of a pattern such as github.com/myorg/, if any
+func patternOwner(pattern string) string {
+	pattern = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(pattern), "https://"), "http://")
+	_, rest, _ := strings.Cut(pattern, "/")
+	owner, _, _ := strings.Cut(rest, "/")
+	return owner
+}
+
+// hasHostPattern reports whether an app has a pattern on host
+func hasHostPattern(app *config.GitHubApp, host string) bool {
+	for _, pattern := range app.Patterns {
+		if extractHostFromPattern(pattern) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// findPATForHost returns the highest priority PAT with a pattern on the given host
+func findPATForHost(cfg *config.Config, host string) *config.PersonalAccessToken {
+	var best *config.PersonalAccessToken
+	for i := range cfg.PATs {
+		pat := &cfg.PATs[i]
+		for _, pattern := range pat.Patterns {
+			if extractHostFromPattern(pattern) == host {
+				if best == nil || pat.Priority > best.Priority {
+					best = pat
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+// getPATToken retrieves a PAT from secure storage
+func getPATToken(pat *config.PersonalAccessToken) (string, error) {
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return "", err
+	}
+	token, err := pat.GetPAT(secretMgr)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PAT: %w", err)
+	}
+	return token, nil
+}
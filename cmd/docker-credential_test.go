@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDockerCredentialArgs(t *testing.T) {
+	args, ok := dockerCredentialArgs("/usr/local/bin/docker-credential-gh-app-auth", []string{"get"})
+	if !ok {
+		t.Fatal("Expected docker credential invocation to be detected")
+	}
+	if !reflect.DeepEqual(args, []string{"docker-credential", "get"}) {
+		t.Errorf("args = %v", args)
+	}
+
+	if _, ok := dockerCredentialArgs("/opt/bin/docker-credential-gh-app-auth.exe", []string{"list"}); !ok {
+		t.Error("Expected .exe suffix to be ignored")
+	}
+
+	if _, ok := dockerCredentialArgs("/usr/local/bin/gh-app-auth", []string{"list"}); ok {
+		t.Error("Did not expect regular invocation to be rewritten")
+	}
+}
+
+func TestRegistryToGitHubHost(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io":                       "github.com",
+		"docker.pkg.github.com":         "github.com",
+		"containers.github.example.com": "github.example.com",
+		"docker.github.example.com":     "github.example.com",
+		"github.example.com":            "github.example.com",
+	}
+	for registry, want := range tests {
+		if got := registryToGitHubHost(registry); got != want {
+			t.Errorf("registryToGitHubHost(%q) = %q, want %q", registry, got, want)
+		}
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io":                      "ghcr.io",
+		"https://ghcr.io":              "ghcr.io",
+		"https://GHCR.io/v2/":          "ghcr.io",
+		"containers.ghes.example.com/": "containers.ghes.example.com",
+	}
+	for serverURL, want := range tests {
+		if got := registryHost(serverURL); got != want {
+			t.Errorf("registryHost(%q) = %q, want %q", serverURL, got, want)
+		}
+	}
+}
+
+func TestRegistriesForPatterns(t *testing.T) {
+	got := registriesForPatterns([]string{
+		"github.com/org1/", "github.com/org2/*", "ghes.example.com/corp", "ghcr.io/org3",
+	})
+	want := []string{"ghcr.io", "containers.ghes.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("registriesForPatterns() = %v, want %v", got, want)
+	}
+}
+
+func TestFindRegistryCredential(t *testing.T) {
+	cfg := &config.Config{
+		GitHubApps: []config.GitHubApp{
+			{Name: "public", AppID: 1, Patterns: []string{"github.com/myorg/"}, Priority: 5},
+			{Name: "ghes", AppID: 2, Patterns: []string{"ghes.example.com/corp/"}, Priority: 5},
+		},
+		PATs: []config.PersonalAccessToken{
+			{Name: "registry-pat", Patterns: []string{"ghcr.io/"}, Priority: 1},
+			{Name: "other-pat", Patterns: []string{"registry.example.com/"}, Priority: 1},
+		},
+	}
+
+	t.Run("registry host pattern wins over mapped host", func(t *testing.T) {
+		app, pat, _ := findRegistryCredential(cfg, "https://ghcr.io")
+		if app != nil || pat == nil || pat.Name != "registry-pat" {
+			t.Errorf("got app=%v pat=%v, want registry-pat", app, pat)
+		}
+	})
+
+	t.Run("GHES containers host maps to app", func(t *testing.T) {
+		app, pat, _ := findRegistryCredential(cfg, "containers.ghes.example.com")
+		if pat != nil || app == nil || app.Name != "ghes" {
+			t.Errorf("got app=%v pat=%v, want ghes app", app, pat)
+		}
+	})
+
+	t.Run("PAT for unrelated registry", func(t *testing.T) {
+		app, pat, _ := findRegistryCredential(cfg, "registry.example.com")
+		if app != nil || pat == nil || pat.Name != "other-pat" {
+			t.Errorf("got app=%v pat=%v, want other-pat", app, pat)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		app, pat, _ := findRegistryCredential(cfg, "quay.io")
+		if app != nil || pat != nil {
+			t.Errorf("got app=%v pat=%v, want no match", app, pat)
+		}
+	})
+
+	t.Run("higher priority PAT wins over app on same host", func(t *testing.T) {
+		withoutRegistryPAT := &config.Config{
+			GitHubApps: cfg.GitHubApps,
+			PATs: []config.PersonalAccessToken{
+				{Name: "gh-pat", Patterns: []string{"github.com/"}, Priority: 10},
+			},
+		}
+		app, pat, _ := findRegistryCredential(withoutRegistryPAT, "ghcr.io")
+		if app != nil || pat == nil || pat.Name != "gh-pat" {
+			t.Errorf("got app=%v pat=%v, want gh-pat", app, pat)
+		}
+	})
+}
+
+func TestFindRegistryCredential_Ambiguous(t *testing.T) {
+	apps := []config.GitHubApp{
+		{Name: "org1", AppID: 1, Patterns: []string{"github.com/org1/"}},
+		{Name: "org2", AppID: 2, Patterns: []string{"github.com/org2/"}},
+	}
+
+	// Given two apps on github.com, neither pinned to an installation
+	_, _, err := findRegistryCredential(&config.Config{GitHubApps: apps}, "ghcr.io")
+	if err == nil || !strings.Contains(err.Error(), "several GitHub Apps") {
+		t.Errorf("findRegistryCredential() error = %v, want an ambiguity error", err)
+	}
+
+	// When exactly one is pinned, it is used
+	apps[1].InstallationID = 42
+	app, _, err := findRegistryCredential(&config.Config{GitHubApps: apps}, "ghcr.io")
+	if err != nil || app == nil || app.Name != "org2" {
+		t.Errorf("findRegistryCredential() = %v, %v; want org2", app, err)
+	}
+}
+
+func TestRegistryRepoURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		app      config.GitHubApp
+		registry string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "pinned installation",
+			app:      config.GitHubApp{Name: "a", InstallationID: 7, Patterns: []string{"github.com/"}},
+			registry: "ghcr.io",
+			want:     "https://github.com",
+		},
+		{
+			name:     "discovered installation of the pattern owner",
+			app:      config.GitHubApp{Name: "a", Patterns: []string{"github.com/myorg/"}},
+			registry: "ghcr.io",
+			want:     "https://github.com/myorg",
+		},
+		{
+			name:     "registry pattern owner",
+			app:      config.GitHubApp{Name: "a", Patterns: []string{"containers.ghes.example.com/corp"}},
+			registry: "containers.ghes.example.com",
+			want:     "https://ghes.example.com/corp",
+		},
+		{
+			name:     "no owner to discover the installation of",
+			app:      config.GitHubApp{Name: "a", Patterns: []string{"github.com/"}},
+			registry: "ghcr.io",
+			wantErr:  true,
+		},
+		{
+			name:     "several owners",
+			app:      config.GitHubApp{Name: "a", Patterns: []string{"github.com/org1/", "github.com/org2/"}},
+			registry: "ghcr.io",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registryRepoURL(&tt.app, tt.registry)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("registryRepoURL() = %q, %v; want %q (error: %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDockerCredentialRun_StoreAndEraseAreNoops(t *testing.T) {
+	payload := `{"ServerURL":"ghcr.io","Username":"u","Secret":"s"}`
+	if err := dockerCredentialRun("store", strings.NewReader(payload), &bytes.Buffer{}); err != nil {
+		t.Errorf("store error = %v", err)
+	}
+	if err := dockerCredentialRun("erase", strings.NewReader("ghcr.io\n"), &bytes.Buffer{}); err != nil {
+		t.Errorf("erase error = %v", err)
+	}
+	if err := dockerCredentialRun("erase", strings.NewReader(""), &bytes.Buffer{}); err == nil {
+		t.Error("Expected error for erase without server URL")
+	}
+	if err := dockerCredentialRun("bogus", strings.NewReader(""), &bytes.Buffer{}); err == nil {
+		t.Error("Expected error for unsupported operation")
+	}
+}
+
+func TestDockerCredentialRun_ListAndGetNotFound(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yml")
+
+	cfg := &config.Config{
+		Version: "1",
+		GitHubApps: []config.GitHubApp{
+			{
+				Name:             "Test App",
+				AppID:            123,
+				InstallationID:   456,
+				Patterns:         []string{"github.com/myorg/"},
+				PrivateKeySource: config.PrivateKeySourceKeyring,
+			},
+		},
+		PATs: []config.PersonalAccessToken{
+			{Name: "ghes", Patterns: []string{"ghes.example.com/"}, Username: "builder"},
+		},
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+
+	var out bytes.Buffer
+	if err := dockerCredentialRun("list", strings.NewReader(""), &out); err != nil {
+		t.Fatalf("list error = %v", err)
+	}
+	var listed map[string]string
+	if err := json.Unmarshal(out.Bytes(), &listed); err != nil {
+		t.Fatalf("list output is not JSON: %v (%q)", err, out.String())
+	}
+	want := map[string]string{"ghcr.io": "x-access-token", "containers.ghes.example.com": "builder"}
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("list = %v, want %v", listed, want)
+	}
+
+	out.Reset()
+	err = dockerCredentialRun("get", strings.NewReader("quay.io"), &out)
+	if !errors.Is(err, errDockerCredentialsNotFound) {
+		t.Errorf("get error = %v, want not found", err)
+	}
+	if strings.TrimSpace(out.String()) != dockerCredentialsNotFound {
+		t.Errorf("get output = %q", out.String())
+	}
+}
+
+func TestDockerCredentialRun_GetWithoutInstallationID(t *testing.T) {
+	// Given an app without installation_id whose pattern names no owner
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	cfg := &config.Config{
+		Version: "1",
+		GitHubApps: []config.GitHubApp{{
+			Name:             "Host App",
+			AppID:            123,
+			Patterns:         []string{"github.com/"},
+			PrivateKeySource: config.PrivateKeySourceKeyring,
+		}},
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+
+	// When docker asks for ghcr.io credentials
+	var out bytes.Buffer
+	err = dockerCredentialRun("get", strings.NewReader("https://ghcr.io"), &out)
+
+	// Then it fails explaining how to pick the installation, before minting any token
+	if err == nil || !strings.Contains(err.Error(), "set installation_id") {
+		t.Errorf("get error = %v, want an error asking for installation_id", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("get output = %q, want none", out.String())
+	}
+}
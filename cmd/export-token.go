@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported export formats
+const (
+	exportFormatNetrc            = "netrc"
+	exportFormatEnv              = "env"
+	exportFormatJSON             = "json"
+	exportFormatK8sSecret        = "k8s-secret"
+	exportFormatDockerConfigJSON = "dockerconfigjson"
+)
+
+// Credential kinds reported in exports
+const (
+	credentialKindApp       = "github_app"
+	credentialKindPAT       = "pat"
+	credentialKindUserToken = "user_token"
+)
+
+// envVarUnsafeChars matches characters that cannot appear in environment variable names
+var envVarUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// exportedCredential is a resolved credential ready to be rendered
+type exportedCredential struct {
+	Pattern   string     `json:"pattern"`
+	Name      string     `json:"name"`
+	Kind      string     `json:"kind"`
+	Host      string     `json:"host"`
+	Username  string     `json:"username"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// k8sSecret is the subset of a Kubernetes Secret manifest we render
+type k8sSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+}
+
+type k8sMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type exportOptions struct {
+	patterns   []string
+	format     string
+	output     string
+	force      bool
+	envVar     string
+	secretName string
+	namespace  string
+}
+
+func NewExportTokenCmd() *cobra.Command {
+	opts := &exportOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "export-token",
+		Short: "Export credentials for tools that read them from files",
+		Long: `Render credentials for one or more patterns in a format other tools understand.
+
+Each --pattern (a repository URL or a configured pattern such as
+"github.com/myorg/") is resolved to a credential the same way git-credential
+resolves it: a GitHub App, a Personal Access Token or a GitHub App user token.
+App credentials are freshly minted installation tokens; PATs and user tokens
+are read from secure storage, user tokens being refreshed when they expire.
+
+Formats:
+  netrc             .netrc fragment (one machine entry per host)
+  env               shell export lines
+  json              JSON array including token expiry
+  k8s-secret        Kubernetes Opaque Secret manifest
+  dockerconfigjson  Kubernetes dockerconfigjson Secret for container registries
+
+Output goes to stdout unless --output is given; files are always written with
+0600 permissions. --output refuses to overwrite an existing file unless --force
+is given, in which case the whole file is replaced.`,
+		Example: `  # Write a netrc file for an organization, kept apart from ~/.netrc
+  gh app-auth export-token --pattern github.com/myorg/ --format netrc \
+    --output ~/.config/gh-app-auth/netrc
+
+  # Refresh that file on later runs
+  gh app-auth export-token --pattern github.com/myorg/ --format netrc \
+    --output ~/.config/gh-app-auth/netrc --force
+
+  # Export an environment variable
+  eval "$(gh app-auth export-token --pattern github.com/myorg/repo --format env)"
+
+  # Create an image pull secret for ghcr.io
+  gh app-auth export-token --pattern github.com/myorg/ --format dockerconfigjson \
+    --secret-name ghcr-pull --namespace ci | kubectl apply -f -`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportTokenRun(opts, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&opts.patterns, "pattern", "p", nil, "Repository URL or pattern to export (repeatable)")
+	cmd.Flags().StringVar(&opts.format, "format", exportFormatEnv,
+		"Output format: netrc, env, json, k8s-secret, dockerconfigjson")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "Write to this file (0600) instead of stdout")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Overwrite the --output file if it exists")
+	cmd.Flags().StringVar(&opts.envVar, "env-var", "GITHUB_TOKEN",
+		"Variable name for env format (suffixed with each pattern's host and path when exporting several)")
+	cmd.Flags().StringVar(&opts.secretName, "secret-name", "gh-app-auth", "Secret name for Kubernetes formats")
+	cmd.Flags().StringVar(&opts.namespace, "namespace", "", "Namespace for Kubernetes formats")
+
+	_ = cmd.MarkFlagRequired("pattern")
+
+	return cmd
+}
+
+func exportTokenRun(opts *exportOptions, stdout, stderr io.Writer) error {
+	if err := validateExportFormat(opts.format); err != nil {
+		return err
+	}
+
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+
+	creds := make([]exportedCredential, 0, len(opts.patterns))
+	for _, pattern := range opts.patterns {
+		cred, err := resolveExportCredential(cfg, pattern)
+		if err != nil {
+			return err
+		}
+		creds = append(creds, *cred)
+	}
+
+	rendered, warnings, err := renderExport(opts, creds)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(stderr, "⚠️  %s\n", warning)
+	}
+
+	if opts.output == "" {
+		_, err := stdout.Write(rendered)
+		return err
+	}
+
+	path, err := expandPath(opts.output)
+	if err != nil {
+		return fmt.Errorf("invalid output path: %w", err)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return fmt.Errorf("invalid output path: %w", err)
+	}
+	if opts.force {
+		err = writeSecretFile(path, rendered)
+	} else {
+		err = createSecretFile(path, rendered)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "✅ Wrote %d credential(s) to %s\n", len(creds), path)
+	return nil
+}
+
+// validateExportFormat checks the --format value
+func validateExportFormat(format string) error {
+	switch format {
+	case exportFormatNetrc, exportFormatEnv, exportFormatJSON, exportFormatK8sSecret, exportFormatDockerConfigJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s (supported: %s, %s, %s, %s, %s)", format,
+			exportFormatNetrc, exportFormatEnv, exportFormatJSON, exportFormatK8sSecret, exportFormatDockerConfigJSON)
+	}
+}
+
+// resolveExportCredential finds the credential for a pattern the way git-credential does
+// and retrieves its token
+func resolveExportCredential(cfg *config.Config, pattern string) (*exportedCredential, error) {
+	target := normalizeExportTarget(pattern)
+	app, pat, err := findMatchingCredential(cfg, target)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &exportedCredential{
+		Pattern:  pattern,
+		Host:     extractHostFromPattern(target),
+		Username: accessTokenUsername,
+	}
+
+	if userToken := findMatchingUserToken(cfg, target, app, pat); userToken != nil {
+		token, err := getUserToken(context.Background(), userToken, config.UserTokenRefreshMargin)
+		if err != nil {
+			return nil, err
+		}
+		cred.Name = userToken.Name
+		cred.Kind = credentialKindUserToken
+		cred.Token = token
+		cred.ExpiresAt = userToken.ExpiresAt
+		return cred, nil
+	}
+	if app == nil && pat == nil {
+		return nil, fmt.Errorf("no GitHub App or Personal Access Token configured for %s", pattern)
+	}
+
+	if pat != nil {
+		token, err := getPATToken(pat)
+		if err != nil {
+			return nil, err
+		}
+		cred.Name = pat.Name
+		cred.Kind = credentialKindPAT
+		cred.Token = token
+		if pat.Username != "" {
+			cred.Username = pat.Username
+		}
+		return cred, nil
+	}
+
+	token, _, expiresAt, err := auth.NewAuthenticator().GetCredentialsWithExpiry(app, "https://"+target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for %s: %w", pattern, err)
+	}
+	cred.Name = app.Name
+	cred.Kind = credentialKindApp
+	cred.Token = token
+	if !expiresAt.IsZero() {
+		cred.ExpiresAt = &expiresAt
+	}
+	return cred, nil
+}
+
+// normalizeExportTarget strips the scheme, wildcard and trailing slash from a pattern
+func normalizeExportTarget(pattern string) string {
+	target := strings.TrimSpace(pattern)
+	target = strings.TrimPrefix(target, "https://")
+	target = strings.TrimPrefix(target, "http://")
+	target = strings.TrimSuffix(target, "/*")
+	target = strings.TrimSuffix(target, ".git")
+	return strings.TrimSuffix(target, "/")
+}
+
+// renderExport renders credentials in the requested format, along with warnings about
+// credentials the format could not include
+func renderExport(opts *exportOptions, creds []exportedCredential) ([]byte, []string, error) {
+	var data []byte
+	var warnings []string
+	var err error
+	switch opts.format {
+	case exportFormatNetrc:
+		data, warnings = renderNetrc(creds)
+	case exportFormatEnv:
+		data, err = renderEnv(creds, opts.envVar)
+	case exportFormatJSON:
+		data, err = json.MarshalIndent(creds, "", "  ")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		data = append(data, '\n')
+	case exportFormatK8sSecret:
+		data, err = renderK8sSecret(opts, creds)
+	case exportFormatDockerConfigJSON:
+		data, err = renderDockerConfigSecret(opts, creds)
+	default:
+		err = validateExportFormat(opts.format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, warnings, nil
+}
+
+// renderNetrc renders one machine entry per host; the first credential for a host wins
+// and a warning is returned for each one skipped
+func renderNetrc(creds []exportedCredential) ([]byte, []string) {
+	var b strings.Builder
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, cred := range creds {
+		if seen[cred.Host] {
+			warnings = append(warnings, fmt.Sprintf("Skipping %s: netrc supports a single credential per host (%s)",
+				cred.Pattern, cred.Host))
+			continue
+		}
+		seen[cred.Host] = true
+		fmt.Fprintf(&b, "machine %s login %s password %s\n", cred.Host, cred.Username, cred.Token)
+	}
+	return []byte(b.String()), warnings
+}
+
+// renderEnv renders shell export lines
+func renderEnv(creds []exportedCredential, envVar string) ([]byte, error) {
+	var b strings.Builder
+	patterns := make(map[string]string, len(creds))
+	for _, cred := range creds {
+		name := envVar
+		if len(creds) > 1 {
+			name = envVar + "_" + envVarSuffix(cred.Pattern)
+		}
+		if err := claimExportName(patterns, name, "variable", cred.Pattern); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "export %s=%s\n", name, shellQuote(cred.Token))
+	}
+	return []byte(b.String()), nil
+}
+
+// envVarSuffix derives an environment variable suffix from a pattern, host included
+func envVarSuffix(pattern string) string {
+	target := normalizeExportTarget(pattern)
+	return strings.Trim(strings.ToUpper(envVarUnsafeChars.ReplaceAllString(target, "_")), "_")
+}
+
+// claimExportName records that pattern is exported under name, failing if another
+// pattern already is: its credential would be silently overwritten
+func claimExportName(patterns map[string]string, name, kind, pattern string) error {
+	if other, taken := patterns[name]; taken {
+		return fmt.Errorf("patterns %q and %q would both be exported as %s %s", other, pattern, kind, name)
+	}
+	patterns[name] = pattern
+	return nil
+}
+
+// shellQuote wraps a value in single quotes for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// renderK8sSecret renders an Opaque Secret with one token per pattern
+func renderK8sSecret(opts *exportOptions, creds []exportedCredential) ([]byte, error) {
+	secret := newK8sSecret(opts, "Opaque")
+	secret.StringData = make(map[string]string)
+	patterns := make(map[string]string, len(creds))
+	for _, cred := range creds {
+		key := "token"
+		usernameKey := "username"
+		if len(creds) > 1 {
+			suffix := strings.ToLower(strings.ReplaceAll(envVarSuffix(cred.Pattern), "_", "-"))
+			key = suffix + "-token"
+			usernameKey = suffix + "-username"
+		}
+		if err := claimExportName(patterns, key, "secret key", cred.Pattern); err != nil {
+			return nil, err
+		}
+		secret.StringData[key] = cred.Token
+		secret.StringData[usernameKey] = cred.Username
+	}
+	addExpiryAnnotation(&secret, creds)
+
+	return marshalK8sSecret(secret)
+}
+
+// renderDockerConfigSecret renders a kubernetes.io/dockerconfigjson Secret for the matching registries
+func renderDockerConfigSecret(opts *exportOptions, creds []exportedCredential) ([]byte, error) {
+	type dockerAuth struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	auths := make(map[string]dockerAuth)
+	for _, cred := range creds {
+		for _, registry := range registriesForPatterns([]string{normalizeExportTarget(cred.Pattern)}) {
+			if _, exists := auths[registry]; exists {
+				continue
+			}
+			auths[registry] = dockerAuth{
+				Username: cred.Username,
+				Password: cred.Token,
+				Auth:     base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Token)),
+			}
+		}
+	}
+
+	configJSON, err := json.Marshal(map[string]interface{}{"auths": auths})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode docker config: %w", err)
+	}
+
+	secret := newK8sSecret(opts, "kubernetes.io/dockerconfigjson")
+	secret.Data = map[string]string{
+		".dockerconfigjson": base64.StdEncoding.EncodeToString(configJSON),
+	}
+	addExpiryAnnotation(&secret, creds)
+
+	return marshalK8sSecret(secret)
+}
+
+func newK8sSecret(opts *exportOptions, secretType string) k8sSecret {
+	return k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: k8sMetadata{
+			Name:      opts.secretName,
+			Namespace: opts.namespace,
+		},
+		Type: secretType,
+	}
+}
+
+// addExpiryAnnotation records the earliest token expiry so operators know when to refresh
+func addExpiryAnnotation(secret *k8sSecret, creds []exportedCredential) {
+	var earliest *time.Time
+	for _, cred := range creds {
+		if cred.ExpiresAt != nil && (earliest == nil || cred.ExpiresAt.Before(*earliest)) {
+			earliest = cred.ExpiresAt
+		}
+	}
+	if earliest == nil {
+		return
+	}
+	secret.Metadata.Annotations = map[string]string{
+		"gh-app-auth/expires-at": earliest.UTC().Format(time.RFC3339),
+	}
+}
+
+func marshalK8sSecret(secret k8sSecret) ([]byte, error) {
+	data, err := yaml.Marshal(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode secret manifest: %w", err)
+	}
+	return data, nil
+}
+
+// createSecretFile writes sensitive data to a new file with 0600 permissions, refusing
+// to replace an existing one
+func createSecretFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists: use --force to overwrite it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	return nil
+}
+
+// writeSecretFile atomically writes sensitive data with 0600 permissions.
+// The data goes to a temporary file in the same directory which is then renamed,
+// so readers never observe a partially written file.
+func writeSecretFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+
+	if err := tmp.Chmod(0600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
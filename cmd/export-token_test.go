@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+)
+
+func TestResolveExportCredential(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GH_APP_ID", "")
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		t.Fatalf("newDefaultSecretsManager() error = %v", err)
+	}
+
+	// Given a PAT outranking an app, and a user token outranking both on one repository
+	pat := config.PersonalAccessToken{
+		Name: "org-pat", Patterns: []string{"github.com/myorg/"}, Priority: 10, Username: "builder",
+	}
+	if _, err := pat.SetPAT(secretMgr, "ghp_org"); err != nil {
+		t.Fatalf("SetPAT() error = %v", err)
+	}
+	userToken := config.AppUserToken{
+		Name: "dev", ClientID: "Iv1.abc", Patterns: []string{"github.com/myorg/special"}, Priority: 20,
+	}
+	if _, err := userToken.SetTokens(secretMgr, "ghu_dev", "ghr_dev", time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("SetTokens() error = %v", err)
+	}
+	cfg := &config.Config{
+		GitHubApps: []config.GitHubApp{
+			{Name: "org-app", AppID: 1, Patterns: []string{"github.com/myorg/*"}, Priority: 5},
+		},
+		PATs:       []config.PersonalAccessToken{pat},
+		UserTokens: []config.AppUserToken{userToken},
+	}
+
+	tests := []struct {
+		name      string
+		pattern   string
+		wantName  string
+		wantKind  string
+		wantToken string
+		wantUser  string
+	}{
+		{
+			name: "priority decides between app and PAT", pattern: "github.com/myorg/other",
+			wantName: "org-pat", wantKind: credentialKindPAT, wantToken: "ghp_org", wantUser: "builder",
+		},
+		{
+			name: "user token with higher priority", pattern: "https://github.com/myorg/special.git",
+			wantName: "dev", wantKind: credentialKindUserToken, wantToken: "ghu_dev", wantUser: accessTokenUsername,
+		},
+		{name: "no partial segment match", pattern: "github.com/myorganization/repo"},
+		{name: "no match", pattern: "gitlab.com/foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// When the pattern is resolved
+			cred, err := resolveExportCredential(cfg, tt.pattern)
+
+			// Then it gets the credential git-credential would use
+			if tt.wantName == "" {
+				if err == nil {
+					t.Fatalf("resolveExportCredential() = %+v, want error", cred)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveExportCredential() error = %v", err)
+			}
+			if cred.Name != tt.wantName || cred.Kind != tt.wantKind || cred.Token != tt.wantToken ||
+				cred.Username != tt.wantUser {
+				t.Errorf("resolveExportCredential() = %+v", cred)
+			}
+		})
+	}
+}
+
+func TestRenderExport(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	creds := []exportedCredential{
+		{
+			Pattern: "github.com/myorg/", Name: "app", Kind: credentialKindApp, Host: "github.com",
+			Username: accessTokenUsername, Token: "ghs_app", ExpiresAt: &expiresAt,
+		},
+		{
+			Pattern: "https://ghes.example.com/corp/tools", Name: "pat", Kind: credentialKindPAT,
+			Host: "ghes.example.com", Username: "builder", Token: "it's",
+		},
+	}
+
+	t.Run("netrc", func(t *testing.T) {
+		out, _, err := renderExport(&exportOptions{format: exportFormatNetrc}, creds)
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		want := "machine github.com login x-access-token password ghs_app\n" +
+			"machine ghes.example.com login builder password it's\n"
+		if string(out) != want {
+			t.Errorf("netrc = %q, want %q", out, want)
+		}
+	})
+
+	t.Run("netrc skips a second credential for a host", func(t *testing.T) {
+		duplicate := exportedCredential{
+			Pattern: "github.com/otherorg/", Host: "github.com", Username: accessTokenUsername, Token: "ghs_other",
+		}
+		out, warnings, err := renderExport(&exportOptions{format: exportFormatNetrc}, append(creds[:1:1], duplicate))
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		if string(out) != "machine github.com login x-access-token password ghs_app\n" {
+			t.Errorf("netrc = %q", out)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "github.com/otherorg/") {
+			t.Errorf("warnings = %q, want one for github.com/otherorg/", warnings)
+		}
+	})
+
+	t.Run("env with several patterns", func(t *testing.T) {
+		out, _, err := renderExport(&exportOptions{format: exportFormatEnv, envVar: "GITHUB_TOKEN"}, creds)
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		want := "export GITHUB_TOKEN_GITHUB_COM_MYORG='ghs_app'\n" +
+			"export GITHUB_TOKEN_GHES_EXAMPLE_COM_CORP_TOOLS='it'\\''s'\n"
+		if string(out) != want {
+			t.Errorf("env = %q, want %q", out, want)
+		}
+	})
+
+	t.Run("env keeps the same owner on different hosts apart", func(t *testing.T) {
+		other := exportedCredential{
+			Pattern: "ghe.example.com/myorg/", Host: "ghe.example.com", Username: accessTokenUsername, Token: "ghs_ghe",
+		}
+		out, _, err := renderExport(&exportOptions{format: exportFormatEnv, envVar: "GH_TOKEN"}, append(creds[:1:1], other))
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		want := "export GH_TOKEN_GITHUB_COM_MYORG='ghs_app'\n" +
+			"export GH_TOKEN_GHE_EXAMPLE_COM_MYORG='ghs_ghe'\n"
+		if string(out) != want {
+			t.Errorf("env = %q, want %q", out, want)
+		}
+	})
+
+	t.Run("colliding names are refused", func(t *testing.T) {
+		// Given two patterns that only differ by characters dropped from the name
+		colliding := exportedCredential{
+			Pattern: "github.com/myorg", Host: "github.com", Username: accessTokenUsername, Token: "ghs_other",
+		}
+		for _, format := range []string{exportFormatEnv, exportFormatK8sSecret} {
+			// When
+			_, _, err := renderExport(&exportOptions{format: format, envVar: "GH_TOKEN", secretName: "tokens"},
+				append(creds[:1:1], colliding))
+
+			// Then
+			if err == nil || !strings.Contains(err.Error(), "github.com/myorg/") {
+				t.Errorf("%s: renderExport() error = %v, want a collision error", format, err)
+			}
+		}
+	})
+
+	t.Run("env with single pattern", func(t *testing.T) {
+		out, _, err := renderExport(&exportOptions{format: exportFormatEnv, envVar: "GH_TOKEN"}, creds[:1])
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		if string(out) != "export GH_TOKEN='ghs_app'\n" {
+			t.Errorf("env = %q", out)
+		}
+	})
+
+	t.Run("json includes expiry", func(t *testing.T) {
+		out, _, err := renderExport(&exportOptions{format: exportFormatJSON}, creds)
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		var decoded []exportedCredential
+		if err := json.Unmarshal(out, &decoded); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if len(decoded) != 2 || decoded[0].ExpiresAt == nil || !decoded[0].ExpiresAt.Equal(expiresAt) {
+			t.Errorf("decoded = %+v", decoded)
+		}
+		if decoded[1].ExpiresAt != nil {
+			t.Errorf("PAT should not report expiry, got %v", decoded[1].ExpiresAt)
+		}
+	})
+
+	t.Run("k8s secret", func(t *testing.T) {
+		opts := &exportOptions{format: exportFormatK8sSecret, secretName: "tokens", namespace: "ci"}
+		out, _, err := renderExport(opts, creds)
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		var secret k8sSecret
+		if err := yaml.Unmarshal(out, &secret); err != nil {
+			t.Fatalf("invalid YAML: %v", err)
+		}
+		if secret.Kind != "Secret" || secret.Type != "Opaque" || secret.Metadata.Namespace != "ci" {
+			t.Errorf("unexpected secret header: %+v", secret)
+		}
+		if secret.StringData["github-com-myorg-token"] != "ghs_app" ||
+			secret.StringData["ghes-example-com-corp-tools-username"] != "builder" {
+			t.Errorf("stringData = %v", secret.StringData)
+		}
+		if secret.Metadata.Annotations["gh-app-auth/expires-at"] != "2030-01-02T03:04:05Z" {
+			t.Errorf("annotations = %v", secret.Metadata.Annotations)
+		}
+	})
+
+	t.Run("dockerconfigjson secret", func(t *testing.T) {
+		opts := &exportOptions{format: exportFormatDockerConfigJSON, secretName: "pull"}
+		out, _, err := renderExport(opts, creds)
+		if err != nil {
+			t.Fatalf("renderExport() error = %v", err)
+		}
+		var secret k8sSecret
+		if err := yaml.Unmarshal(out, &secret); err != nil {
+			t.Fatalf("invalid YAML: %v", err)
+		}
+		if secret.Type != "kubernetes.io/dockerconfigjson" {
+			t.Errorf("type = %q", secret.Type)
+		}
+		raw, err := base64.StdEncoding.DecodeString(secret.Data[".dockerconfigjson"])
+		if err != nil {
+			t.Fatalf("invalid base64: %v", err)
+		}
+		var dockerConfig struct {
+			Auths map[string]struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"auths"`
+		}
+		if err := json.Unmarshal(raw, &dockerConfig); err != nil {
+			t.Fatalf("invalid docker config: %v", err)
+		}
+		if dockerConfig.Auths[ghcrHost].Password != "ghs_app" ||
+			dockerConfig.Auths["containers.ghes.example.com"].Username != "builder" {
+			t.Errorf("auths = %+v", dockerConfig.Auths)
+		}
+	})
+}
+
+func TestValidateExportFormat(t *testing.T) {
+	if err := validateExportFormat(exportFormatNetrc); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateExportFormat("xml"); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestWriteSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "token")
+
+	if err := writeSecretFile(path, []byte("first")); err != nil {
+		t.Fatalf("writeSecretFile() error = %v", err)
+	}
+	if err := writeSecretFile(path, []byte("second")); err != nil {
+		t.Fatalf("writeSecretFile() overwrite error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "second" {
+		t.Errorf("content = %q, want %q", data, "second")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions = %o, want 600", perm)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("temporary file left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestCreateSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "netrc")
+
+	if err := createSecretFile(path, []byte("first")); err != nil {
+		t.Fatalf("createSecretFile() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions = %o, want 600", perm)
+	}
+
+	// An existing file is never replaced
+	if err := createSecretFile(path, []byte("second")); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("createSecretFile() on an existing file error = %v, want --force hint", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "first" {
+		t.Errorf("content = %q, want %q", data, "first")
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/url"
@@ -10,11 +11,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/matcher"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/scope"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/spf13/cobra"
 )
@@ -120,6 +123,9 @@ func handleCredentialGet() error {
 	if err != nil {
 		return err
 	}
+	if userToken := findMatchingUserToken(cfg, repoURL, matchedApp, matchedPAT); userToken != nil {
+		return generateAndOutputUserTokenCredentials(userToken)
+	}
 	if matchedApp == nil && matchedPAT == nil {
 		return nil // Exit silently if no match
 	}
@@ -249,6 +255,37 @@ func findMatchingCredential(
 	return bestApp, bestPAT, nil
 }
 
+// findMatchingUserToken finds the highest priority GitHub App user token matching the
+// repository URL whose priority beats the app or PAT found by findMatchingCredential
+func findMatchingUserToken(
+	cfg *config.Config, repoURL string, matchedApp *config.GitHubApp, matchedPAT *config.PersonalAccessToken,
+) *config.AppUserToken {
+	highestPriority := -1
+	switch {
+	case matchedPAT != nil:
+		highestPriority = matchedPAT.Priority
+	case matchedApp != nil:
+		highestPriority = matchedApp.Priority
+	}
+
+	var bestUserToken *config.AppUserToken
+	for i := range cfg.UserTokens {
+		userToken := &cfg.UserTokens[i]
+		if userToken.Priority <= highestPriority {
+			continue
+		}
+		for _, pattern := range userToken.Patterns {
+			// User tokens use PAT-style URL prefixes
+			if matchesPatternForPAT(pattern, repoURL) {
+				highestPriority = userToken.Priority
+				bestUserToken = userToken
+				break
+			}
+		}
+	}
+	return bestUserToken
+}
+
 // matchesPatternForPAT checks if a PAT pattern matches the repository URL
 func matchesPatternForPAT(pattern, repoURL string) bool {
 	// Normalize both strings for comparison
@@ -325,7 +362,11 @@ func findAppByURL(cfg *config.Config, repoURL string) (*config.GitHubApp, error)
 	})
 
 	m := matcher.NewMatcher(cfg.GitHubApps)
-	matchedApp, err := m.Match(repoURL)
+	matchedApp, misses, err := m.MatchWithScopeMisses(repoURL)
+	if err == nil && len(misses) > 0 && refreshMissedScopes(context.Background(), repoURL, misses) {
+		// The refreshed scopes are updated in place: match again against them
+		matchedApp, err = m.Match(repoURL)
+	}
 
 	if err != nil {
 		// If URL doesn't have a path (e.g., just host), exit silently
@@ -359,6 +400,65 @@ func findAppByURL(cfg *config.Config, repoURL string) (*config.GitHubApp, error)
 	return matchedApp, nil
 }
 
+// refreshMissedScopes refreshes the scope of apps whose patterns match repoURL but whose
+// cached scope does not include it, and persists the refreshed scopes. It reports whether
+// any scope was refreshed.
+func refreshMissedScopes(ctx context.Context, repoURL string, misses []*config.GitHubApp) bool {
+	mgr := scope.NewManager(auth.NewAuthenticator())
+	refreshed := false
+	for _, app := range misses {
+		attempted, err := mgr.RefreshOnMiss(ctx, app, time.Now())
+		if !attempted {
+			continue
+		}
+		if err != nil {
+			logger.FlowError("scope_refresh_on_miss", err, map[string]interface{}{
+				"url":    logger.SanitizeURL(repoURL),
+				"app_id": app.AppID,
+			})
+		} else {
+			logger.FlowStep("scope_refresh_on_miss", map[string]interface{}{
+				"url":    logger.SanitizeURL(repoURL),
+				"app_id": app.AppID,
+			})
+			refreshed = true
+		}
+
+		// Persist the attempt even when it failed, so that it rate limits the next one
+		if err := recordScope(app); err != nil {
+			logger.FlowError("scope_save", err, map[string]interface{}{
+				"app_id": app.AppID,
+			})
+		}
+	}
+	return refreshed
+}
+
+// recordScope saves the scope of app into the configuration. The configuration is
+// loaded again so that changes made by concurrent credential helpers are kept.
+func recordScope(app *config.GitHubApp) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	found := false
+	for i := range cfg.GitHubApps {
+		saved := &cfg.GitHubApps[i]
+		if saved.AppID == app.AppID && saved.InstallationID == app.InstallationID {
+			saved.Scope = app.Scope
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	return nil
+}
+
 // matchesPattern checks if a pattern matches the git credential pattern
 func matchesPattern(appPattern, gitCredPattern string) bool {
 	logger.FlowStep("match_by_pattern", map[string]interface{}{
@@ -408,8 +508,8 @@ func doAutomaticSetup(repoURL string) (*config.GitHubApp, error) {
 			"patterns":      patterns,
 		})
 		return setupGitHubApp(
-			cfg, appId, keyFile, "Auto setup", 0,
-			patterns, priority, useKeyring, useFileSystem, silent,
+			cfg, appId, "", keyFile, "Auto setup", 0,
+			patterns, priority, useKeyring, useFileSystem, false, silent,
 		)
 	}
 	return nil, nil
@@ -438,6 +538,8 @@ func generateAndOutputPATCredentials(matchedPAT *config.PersonalAccessToken) err
 		return fmt.Errorf("failed to get PAT: %w", err)
 	}
 
+	warnPATExpiry(os.Stderr, matchedPAT, time.Now())
+
 	logger.FlowStep("pat_retrieved", map[string]interface{}{
 		"pat_name":     matchedPAT.Name,
 		"token_hash":   logger.HashToken(token),
@@ -464,6 +566,33 @@ func generateAndOutputPATCredentials(matchedPAT *config.PersonalAccessToken) err
 	return nil
 }
 
+// generateAndOutputUserTokenCredentials outputs a GitHub App user token, refreshing it if needed
+func generateAndOutputUserTokenCredentials(userToken *config.AppUserToken) error {
+	logger.FlowStep("generate_user_token_credentials", map[string]interface{}{
+		"user_token_name": userToken.Name,
+		"login":           userToken.Login,
+	})
+
+	token, err := getUserToken(context.Background(), userToken, config.UserTokenRefreshMargin)
+	if err != nil {
+		logger.FlowError("get_user_token", err, map[string]interface{}{
+			"user_token_name": userToken.Name,
+		})
+		return fmt.Errorf("failed to get user token: %w", err)
+	}
+
+	// Output credentials in git credential format
+	fmt.Printf("username=%s\n", accessTokenUsername)
+	fmt.Printf("password=%s\n", token)
+
+	logger.FlowStep("output_user_token_credentials", map[string]interface{}{
+		"user_token_name": userToken.Name,
+		"token_hash":      logger.HashToken(token),
+	})
+
+	return nil
+}
+
 // generateAndOutputCredentials generates authentication credentials and outputs them
 func generateAndOutputCredentials(matchedApp *config.GitHubApp, repoURL string) error {
 	logger.FlowStep("generate_credentials", map[string]interface{}{
@@ -620,6 +749,9 @@ func buildRepositoryURL(input map[string]string) string {
 		return ""
 	}
 
+	// Git LFS uses its own endpoint paths and, on some hosts, dedicated endpoint hosts
+	host, path = normalizeLFSRequest(host, path)
+
 	// Git sometimes queries without path first
 	if path == "" {
 		// Return host-only format for matching
@@ -634,3 +766,35 @@ func buildRepositoryURL(input map[string]string) string {
 	// Return format: github.com/owner/repo
 	return fmt.Sprintf("%s/%s", host, path)
 }
+
+// lfsEndpointHosts maps dedicated Git LFS endpoint hosts to the GitHub host serving the repository
+var lfsEndpointHosts = map[string]string{
+	"lfs.github.com":              gitHubAPIHost,
+	"media.githubusercontent.com": gitHubAPIHost,
+}
+
+// normalizeLFSRequest maps a Git LFS credential request back to its repository.
+// LFS asks for credentials on "owner/repo.git/info/lfs[/objects/batch|/locks...]";
+// media hosts serve "media/owner/repo/..." paths and are mapped to their GitHub host.
+func normalizeLFSRequest(host, path string) (string, string) {
+	path = strings.Trim(path, "/")
+	if idx := strings.Index(path, "/info/lfs"); idx >= 0 {
+		path = path[:idx]
+	}
+
+	mapped, known := lfsEndpointHosts[strings.ToLower(host)]
+	isMediaHost := strings.HasPrefix(strings.ToLower(host), "media.") && strings.HasPrefix(path, "media/")
+	if !known && !isMediaHost {
+		return host, path
+	}
+	if !known {
+		// GHES with subdomain isolation serves LFS media from media.<host>
+		mapped = host[len("media."):]
+	}
+
+	path = strings.TrimPrefix(path, "media/")
+	if parts := strings.SplitN(path, "/", 3); len(parts) >= 2 {
+		path = parts[0] + "/" + parts[1]
+	}
+	return mapped, path
+}
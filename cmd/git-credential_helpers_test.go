@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 )
 
 func TestMatchesPattern(t *testing.T) {
@@ -113,6 +117,33 @@ func TestBuildRepositoryURL_EdgeCases(t *testing.T) {
 			},
 			expected: "github.com/myorg/myrepo",
 		},
+		{
+			name: "git lfs endpoint path",
+			input: map[string]string{
+				"protocol": "https",
+				"host":     "github.com",
+				"path":     "myorg/myrepo.git/info/lfs",
+			},
+			expected: "github.com/myorg/myrepo",
+		},
+		{
+			name: "git lfs batch API path",
+			input: map[string]string{
+				"protocol": "https",
+				"host":     "ghes.example.com",
+				"path":     "myorg/myrepo.git/info/lfs/objects/batch",
+			},
+			expected: "ghes.example.com/myorg/myrepo",
+		},
+		{
+			name: "git lfs media host",
+			input: map[string]string{
+				"protocol": "https",
+				"host":     "media.githubusercontent.com",
+				"path":     "media/myorg/myrepo/main/assets/logo.png",
+			},
+			expected: "github.com/myorg/myrepo",
+		},
 		{
 			name: "ssh protocol",
 			input: map[string]string{
@@ -146,3 +177,89 @@ func TestBuildRepositoryURL_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeLFSRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		wantHost string
+		wantPath string
+	}{
+		{
+			name: "regular git path untouched", host: "github.com", path: "myorg/myrepo.git",
+			wantHost: "github.com", wantPath: "myorg/myrepo.git",
+		},
+		{
+			name: "locks API", host: "github.com", path: "myorg/myrepo.git/info/lfs/locks/verify",
+			wantHost: "github.com", wantPath: "myorg/myrepo.git",
+		},
+		{
+			name: "legacy lfs.github.com endpoint", host: "lfs.github.com", path: "myorg/myrepo",
+			wantHost: "github.com", wantPath: "myorg/myrepo",
+		},
+		{
+			name: "GHES subdomain isolation media host", host: "media.ghes.example.com",
+			path:     "media/corp/assets/objects/abc",
+			wantHost: "ghes.example.com", wantPath: "corp/assets",
+		},
+		{
+			name: "media prefix host serving git", host: "media.example.com", path: "team/repo.git",
+			wantHost: "media.example.com", wantPath: "team/repo.git",
+		},
+		{
+			name: "host only query", host: "lfs.github.com", path: "",
+			wantHost: "github.com", wantPath: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, path := normalizeLFSRequest(tt.host, tt.path)
+			if host != tt.wantHost || path != tt.wantPath {
+				t.Errorf("normalizeLFSRequest(%q, %q) = %q, %q; want %q, %q",
+					tt.host, tt.path, host, path, tt.wantHost, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestRecordScope(t *testing.T) {
+	// Given a configuration whose app has no cached scope
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	cfg := &config.Config{Version: "1.0", GitHubApps: []config.GitHubApp{
+		{Name: "Org App", AppID: 1, InstallationID: 100, Patterns: []string{"github.com/myorg/"},
+			PrivateKeySource: config.PrivateKeySourceKeyring},
+		{Name: "Org App", AppID: 1, InstallationID: 200, Patterns: []string{"github.com/other/"},
+			PrivateKeySource: config.PrivateKeySourceKeyring},
+	}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// When the scope refreshed after a miss is recorded
+	app := cfg.GitHubApps[0]
+	refreshedAt := time.Now().UTC().Truncate(time.Second)
+	app.Scope = &config.InstallationScope{
+		RepositorySelection: "selected",
+		AccountLogin:        "myorg",
+		Repositories:        []config.RepositoryInfo{{FullName: "myorg/new-repo"}},
+		LastMissRefresh:     refreshedAt,
+	}
+	if err := recordScope(&app); err != nil {
+		t.Fatalf("recordScope() failed: %v", err)
+	}
+
+	// Then it is saved on the entry of the same installation only
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	scope := saved.GitHubApps[0].Scope
+	if scope == nil || len(scope.Repositories) != 1 || !scope.LastMissRefresh.Equal(refreshedAt) {
+		t.Errorf("Saved scope = %+v", scope)
+	}
+	if saved.GitHubApps[1].Scope != nil {
+		t.Errorf("Scope of installation 200 = %+v, want none", saved.GitHubApps[1].Scope)
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// goAuthSetting is the GOAUTH value running this command; the go command only accepts
+// off, netrc, git <dir> and command <cmd>
+const goAuthSetting = "command gh app-auth goauth"
+
+func NewGoAuthCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "goauth [url]",
+		Short: "GOAUTH credential provider for private Go modules",
+		Long: `GOAUTH credential provider that authenticates private Go module fetches
+with GitHub App installation tokens or Personal Access Tokens.
+
+This command implements the GOAUTH command protocol (see 'go help goauth')
+and should not be called directly. Configure the go command to use it:
+
+  export GOAUTH="` + goAuthSetting + `"
+  export GOPRIVATE="github.com/myorg/*"
+
+The go command first runs the provider without arguments, which prints
+nothing. When a fetch is rejected with a 4xx status, the go command runs it
+again with the URL; the URL is resolved through the configured patterns and
+an Authorization header is printed for the matching repository.`,
+		Hidden: true,
+		Args:   cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				// Initial invocation: no credentials are minted up front
+				return nil
+			}
+			return goAuthRun(args[0], cmd.OutOrStdout())
+		},
+	}
+
+	return cmd
+}
+
+func goAuthRun(rawURL string, out io.Writer) error {
+	logger.FlowStart("goauth", map[string]interface{}{
+		"url": logger.SanitizeURL(rawURL),
+	})
+
+	repoURL, prefix, err := goModuleRepository(rawURL)
+	if err != nil {
+		logger.FlowError("goauth", err, map[string]interface{}{
+			"url": logger.SanitizeURL(rawURL),
+		})
+		return err
+	}
+
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return err
+	}
+
+	matchedApp, matchedPAT, err := findMatchingCredential(cfg, repoURL)
+	if err != nil {
+		return err
+	}
+	matchedUserToken := findMatchingUserToken(cfg, repoURL, matchedApp, matchedPAT)
+	if matchedApp == nil && matchedPAT == nil && matchedUserToken == nil {
+		// No credentials: an empty response lets the go command try the next provider
+		logger.FlowStep("goauth_no_match", map[string]interface{}{
+			"repo_url": logger.SanitizeURL(repoURL),
+		})
+		return nil
+	}
+
+	var username, token string
+	if matchedUserToken != nil {
+		token, err = getUserToken(context.Background(), matchedUserToken, config.UserTokenRefreshMargin)
+		if err != nil {
+			return fmt.Errorf("failed to get user token: %w", err)
+		}
+		username = accessTokenUsername
+	} else if matchedPAT != nil {
+		token, err = getPATToken(matchedPAT)
+		if err != nil {
+			return err
+		}
+		username = matchedPAT.Username
+		if username == "" {
+			username = accessTokenUsername
+		}
+	} else {
+		token, _, err = auth.NewAuthenticator().GetCredentials(matchedApp, repoURL)
+		if err != nil {
+			return fmt.Errorf("failed to get credentials: %w", err)
+		}
+		username = accessTokenUsername
+	}
+
+	logger.FlowSuccess("goauth", map[string]interface{}{
+		"prefix":     prefix,
+		"username":   username,
+		"token_hash": logger.HashToken(token),
+	})
+
+	return writeGoAuthCredentials(out, prefix, username, token)
+}
+
+// goModuleRepository derives the repository URL used for matching and the URL
+// prefix the credentials apply to from a module fetch URL
+func goModuleRepository(rawURL string) (repoURL, prefix string, err error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", "", fmt.Errorf("unsupported URL %q: expected an https:// URL", rawURL)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("unable to determine repository from URL %q", rawURL)
+	}
+
+	owner := parts[0]
+	repo := strings.TrimSuffix(parts[1], ".git")
+	repoURL = fmt.Sprintf("%s/%s/%s", u.Host, owner, repo)
+	return repoURL, "https://" + repoURL, nil
+}
+
+// writeGoAuthCredentials prints a GOAUTH credential set for a URL prefix
+func writeGoAuthCredentials(out io.Writer, prefix, username, token string) error {
+	basic := base64.StdEncoding.EncodeToString([]byte(username + ":" + token))
+	_, err := fmt.Fprintf(out, "%s\n\nAuthorization: Basic %s\n\n", prefix, basic)
+	return err
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+func TestGoModuleRepository(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawURL     string
+		wantRepo   string
+		wantPrefix string
+		wantErr    bool
+	}{
+		{
+			name:       "go-get meta lookup",
+			rawURL:     "https://github.com/myorg/mymodule?go-get=1",
+			wantRepo:   "github.com/myorg/mymodule",
+			wantPrefix: "https://github.com/myorg/mymodule",
+		},
+		{
+			name:       "nested package path",
+			rawURL:     "https://github.com/myorg/mymodule/v2/pkg/util?go-get=1",
+			wantRepo:   "github.com/myorg/mymodule",
+			wantPrefix: "https://github.com/myorg/mymodule",
+		},
+		{
+			name:       "git URL with .git suffix",
+			rawURL:     "https://ghes.example.com/corp/lib.git/info/refs?service=git-upload-pack",
+			wantRepo:   "ghes.example.com/corp/lib",
+			wantPrefix: "https://ghes.example.com/corp/lib",
+		},
+		{
+			name:    "owner only",
+			rawURL:  "https://github.com/myorg",
+			wantErr: true,
+		},
+		{
+			name:    "non-https URL",
+			rawURL:  "http://github.com/myorg/mymodule",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, prefix, err := goModuleRepository(tt.rawURL)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.rawURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("goModuleRepository() error = %v", err)
+			}
+			if repo != tt.wantRepo || prefix != tt.wantPrefix {
+				t.Errorf("goModuleRepository() = %q, %q; want %q, %q", repo, prefix, tt.wantRepo, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestWriteGoAuthCredentials(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeGoAuthCredentials(&out, "https://github.com/myorg/mod", "x-access-token", "ghs_abc"); err != nil {
+		t.Fatalf("writeGoAuthCredentials() error = %v", err)
+	}
+
+	basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:ghs_abc"))
+	want := "https://github.com/myorg/mod\n\nAuthorization: Basic " + basic + "\n\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestGoAuthCmd_NoArgumentsPrintsNothing(t *testing.T) {
+	cmd := NewGoAuthCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output, got %q", out.String())
+	}
+}
+
+func TestGoAuthRun_NoMatchPrintsNothing(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yml")
+
+	cfg := &config.Config{
+		Version: "1",
+		PATs: []config.PersonalAccessToken{
+			{Name: "corp", Patterns: []string{"github.com/corp/"}},
+		},
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+	t.Setenv("GH_APP_PRIVATE_KEY_PATH", "")
+	t.Setenv("GH_APP_ID", "")
+
+	var out bytes.Buffer
+	if err := goAuthRun("https://github.com/other/module?go-get=1", &out); err != nil {
+		t.Fatalf("goAuthRun() error = %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "" {
+		t.Errorf("Expected no output, got %q", out.String())
+	}
+}
+
+func TestGoAuthCmd_HelpPrintsGOAUTHSetting(t *testing.T) {
+	cmd := NewGoAuthCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"--help"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	// go help goauth only runs providers given as "command <cmd>"
+	if want := `export GOAUTH="command gh app-auth goauth"`; !strings.Contains(out.String(), want) {
+		t.Errorf("help output does not contain %s:\n%s", want, out.String())
+	}
+}
+
+func TestGoAuthCmd_RespondsToRejectedFetch(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yml")
+
+	cfg := &config.Config{
+		Version: "1",
+		PATs: []config.PersonalAccessToken{{
+			Name: "corp", Patterns: []string{"github.com/corp/"}, Username: "builder",
+			SecretBackends: []secrets.BackendSpec{{Type: secrets.BackendTypeEnv, Variable: "CORP_PAT"}},
+		}},
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+	t.Setenv("GH_APP_PRIVATE_KEY_PATH", "")
+	t.Setenv("GH_APP_ID", "")
+	t.Setenv("CORP_PAT", "ghp_corp")
+
+	// The go command passes the rejected URL as argument and the response on stdin
+	cmd := NewGoAuthCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetIn(strings.NewReader("HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\n\r\n"))
+	cmd.SetArgs([]string{"https://github.com/corp/lib/v2?go-get=1"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte("builder:ghp_corp"))
+	want := "https://github.com/corp/lib\n\nAuthorization: Basic " + basic + "\n\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,779 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/cli/go-gh/v2/pkg/tableprinter"
+	"github.com/spf13/cobra"
+)
+
+// errInstallationNotFound is returned when an app has no installation with the requested ID
+var errInstallationNotFound = errors.New("installation not found")
+
+// Reconciliation states of an installation against the configuration
+const (
+	syncConfigured = "configured"
+	syncMissing    = "missing"
+	syncStale      = "stale"
+	syncUnchecked  = "unchecked"
+)
+
+type installation struct {
+	ID                  int64             `json:"id"`
+	Account             account           `json:"account"`
+	RepositorySelection string            `json:"repository_selection"`
+	TargetType          string            `json:"target_type"`
+	Permissions         map[string]string `json:"permissions,omitempty"`
+	Events              []string          `json:"events,omitempty"`
+	HTMLURL             string            `json:"html_url,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	SuspendedAt         *time.Time        `json:"suspended_at,omitempty"`
+}
+
+type account struct {
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+type installationRepository struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	FullName    string `json:"full_name"`
+	Private     bool   `json:"private"`
+	Description string `json:"description"`
+	HTMLURL     string `json:"html_url"`
+}
+
+// appHost is a configured GitHub App on one host. Apps configured once per account
+// have several entries; their installations are listed once.
+type appHost struct {
+	App  *config.GitHubApp
+	Host string
+}
+
+// appInstallations holds the installations of an app, or why they could not be listed
+type appInstallations struct {
+	appHost
+	Installations []installation
+	Err           error
+}
+
+// installationListItem is an installation as shown by 'installations list'
+type installationListItem struct {
+	AppName        string       `json:"app_name"`
+	AppID          int64        `json:"app_id"`
+	Host           string       `json:"host"`
+	Installation   installation `json:"installation"`
+	ConfiguredAs   string       `json:"configured_as,omitempty"`
+	ConfigPatterns []string     `json:"config_patterns,omitempty"`
+}
+
+// installationSyncItem is an installation, or a config entry, reconciled by 'installations sync'
+type installationSyncItem struct {
+	Status         string   `json:"status"`
+	AppName        string   `json:"app_name"`
+	AppID          int64    `json:"app_id"`
+	Host           string   `json:"host"`
+	InstallationID int64    `json:"installation_id"`
+	Account        string   `json:"account,omitempty"`
+	Patterns       []string `json:"patterns"`
+	// proposed is the entry serving a missing installation
+	proposed *config.GitHubApp
+}
+
+// installationDetails is an installation as shown by 'installations show'
+type installationDetails struct {
+	AppName      string                   `json:"app_name"`
+	AppID        int64                    `json:"app_id"`
+	Host         string                   `json:"host"`
+	Installation installation             `json:"installation"`
+	Repositories []installationRepository `json:"repositories"`
+}
+
+func NewInstallationsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "installations",
+		Aliases: []string{"installation"},
+		Short:   "Manage GitHub App installations",
+		Long: `List, inspect and configure the installations of the configured GitHub Apps.
+
+An app is installed once per organization or user account. Each installation
+is served by a config entry that pins its installation_id, or by an entry
+without one whose patterns cover the account.`,
+	}
+
+	cmd.AddCommand(newInstallationsListCmd())
+	cmd.AddCommand(newInstallationsSyncCmd())
+	cmd.AddCommand(newInstallationsShowCmd())
+
+	return cmd
+}
+
+func newInstallationsListCmd() *cobra.Command {
+	var (
+		appID  int64
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the installations of the configured apps",
+		Long: `List every installation of the configured GitHub Apps, as reported by GitHub,
+with the config entry serving each one.`,
+		Example: `  gh app-auth installations list
+  gh app-auth installations list --app-id 123456 --format json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, results, err := loadAppInstallations(cmd.Context(), appID, cmd.Flags().Changed("app-id"))
+			if err != nil || cfg == nil {
+				return err
+			}
+			return outputInstallationList(cmd.OutOrStdout(), format, installationListItems(cfg.GitHubApps, results))
+		},
+	}
+
+	cmd.Flags().Int64Var(&appID, "app-id", 0, "Only list the installations of this app")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format: table, json")
+
+	return cmd
+}
+
+func newInstallationsSyncCmd() *cobra.Command {
+	var (
+		appID  int64
+		format string
+		apply  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Reconcile the configuration with the apps' installations",
+		Long: `Compare the installations of every configured app with the configuration.
+
+Each installation is reported as:
+  configured  a config entry serves it
+  missing     no config entry serves it; an entry is proposed with the pattern
+              <host>/<account>/ and the app's key settings
+  stale       a config entry pins an installation that no longer exists
+  unchecked   a config entry pins an installation of an app whose
+              installations could not be listed, so it may be stale
+
+Proposed entries keep the app's name on purpose: the app's private key is
+stored under its name, so the new entries use the key already configured.
+
+With --apply, the proposed entries are added to the configuration. Stale and
+unchecked entries are only reported: remove one with
+'gh app-auth remove --app-id <app> --installation-id <installation>', which
+keeps the private key the app's other entries share, or fix it with
+'gh app-auth config'.`,
+		Example: `  # Show what would change
+  gh app-auth installations sync
+
+  # Add entries for every installation not configured yet
+  gh app-auth installations sync --apply`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, results, err := loadAppInstallations(cmd.Context(), appID, cmd.Flags().Changed("app-id"))
+			if err != nil || cfg == nil {
+				return err
+			}
+
+			var items []installationSyncItem
+			for _, result := range results {
+				if result.Err != nil {
+					items = append(items, planUncheckedSync(cfg.GitHubApps, result.appHost)...)
+					continue
+				}
+				items = append(items, planInstallationSync(cfg.GitHubApps, result.appHost, result.Installations)...)
+			}
+			if err := outputInstallationSync(cmd.OutOrStdout(), format, items, apply); err != nil {
+				return err
+			}
+			if apply {
+				return applyInstallationSync(cmd.OutOrStdout(), items)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Int64Var(&appID, "app-id", 0, "Only sync the installations of this app")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format: table, json")
+	cmd.Flags().BoolVar(&apply, "apply", false, "Add config entries for missing installations")
+
+	return cmd
+}
+
+func newInstallationsShowCmd() *cobra.Command {
+	var (
+		appID  int64
+		format string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show <installation-id>",
+		Short: "Show an installation and its repositories",
+		Long: `Show the account, permissions and repositories of an installation.
+
+The installation is looked up among the installations of every configured app,
+or only those of --app-id.`,
+		Example: `  gh app-auth installations show 12345678
+  gh app-auth installations show 12345678 --format json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installationID, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || installationID <= 0 {
+				return fmt.Errorf("invalid installation ID: %s", args[0])
+			}
+
+			details, err := showInstallation(cmd.Context(), installationID, appID, cmd.Flags().Changed("app-id"))
+			if err != nil {
+				return err
+			}
+			return outputInstallationDetails(cmd.OutOrStdout(), format, details)
+		},
+	}
+
+	cmd.Flags().Int64Var(&appID, "app-id", 0, "App the installation belongs to")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format: table, json")
+
+	return cmd
+}
+
+// loadAppInstallations lists the installations of the configured apps, or of the app with
+// appID when filtered. A nil config means there is nothing to list. Apps whose installations
+// cannot be listed are reported on stderr, unless the app was requested by ID.
+func loadAppInstallations(
+	ctx context.Context, appID int64, filtered bool,
+) (*config.Config, []appInstallations, error) {
+	cfg, err := config.Load()
+	if errors.Is(err, config.ErrConfigNotExists) {
+		fmt.Println("No GitHub Apps configured. Run 'gh app-auth setup' to add one.")
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	hosts := configuredAppHosts(cfg.GitHubApps, appID)
+	if len(hosts) == 0 {
+		if filtered {
+			return nil, nil, fmt.Errorf("app with ID %d not found in configuration", appID)
+		}
+		fmt.Println("No GitHub Apps configured. Run 'gh app-auth setup' to add one.")
+		return nil, nil, nil
+	}
+
+	results := fetchAppInstallations(ctx, hosts)
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		if filtered {
+			return nil, nil, result.Err
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v\n", result.Err)
+	}
+	return cfg, results, nil
+}
+
+// configuredAppHosts returns each configured app once per host, optionally only the app with appID
+func configuredAppHosts(apps []config.GitHubApp, appID int64) []appHost {
+	var hosts []appHost
+	seen := make(map[string]bool)
+	for i := range apps {
+		app := &apps[i]
+		if (appID != 0 && app.AppID != appID) || len(app.Patterns) == 0 {
+			continue
+		}
+		host := strings.ToLower(extractHostFromPattern(app.Patterns[0]))
+		key := fmt.Sprintf("%d@%s", app.AppID, host)
+		if host == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		hosts = append(hosts, appHost{App: app, Host: host})
+	}
+	return hosts
+}
+
+// fetchAppInstallations lists the installations of each app
+func fetchAppInstallations(ctx context.Context, hosts []appHost) []appInstallations {
+	authenticator := auth.NewAuthenticator()
+	results := make([]appInstallations, 0, len(hosts))
+	for _, ah := range hosts {
+		result := appInstallations{appHost: ah}
+		client := &http.Client{Transport: authenticator.AppJWTTransport(ah.App, nil)}
+		var err error
+		if result.Installations, err = listInstallations(ctx, client, auth.APIBaseURL(ah.Host)); err != nil {
+			result.Err = fmt.Errorf("app %s: failed to list installations: %w", appDisplayName(ah.App), err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// servingApp returns the config entry serving an installation of an app on host: the entry
+// pinned to it, else an entry without installation ID whose patterns cover its account
+func servingApp(apps []config.GitHubApp, appID int64, host string, inst installation) *config.GitHubApp {
+	for i := range apps {
+		if apps[i].AppID == appID && apps[i].InstallationID == inst.ID {
+			return &apps[i]
+		}
+	}
+
+	accountPrefix := strings.ToLower(host + "/" + inst.Account.Login + "/")
+	for i := range apps {
+		if apps[i].AppID != appID || apps[i].InstallationID != 0 {
+			continue
+		}
+		for _, pattern := range apps[i].Patterns {
+			prefix := strings.ToLower(strings.TrimSuffix(normalizeInstallationPattern(pattern), "*"))
+			if strings.HasPrefix(accountPrefix, prefix) || strings.HasPrefix(prefix, accountPrefix) {
+				return &apps[i]
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeInstallationPattern strips the scheme of a pattern
+func normalizeInstallationPattern(pattern string) string {
+	pattern = strings.TrimSpace(pattern)
+	pattern = strings.TrimPrefix(pattern, "https://")
+	return strings.TrimPrefix(pattern, "http://")
+}
+
+// installationListItems pairs each listed installation with the entry serving it
+func installationListItems(apps []config.GitHubApp, results []appInstallations) []installationListItem {
+	var items []installationListItem
+	for _, result := range results {
+		for _, inst := range result.Installations {
+			item := installationListItem{
+				AppName:      appDisplayName(result.App),
+				AppID:        result.App.AppID,
+				Host:         result.Host,
+				Installation: inst,
+			}
+			if entry := servingApp(apps, result.App.AppID, result.Host, inst); entry != nil {
+				item.ConfiguredAs = entry.Name
+				item.ConfigPatterns = entry.Patterns
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// planInstallationSync reconciles the installations of an app with the config entries:
+// installations without an entry get a proposed one, and entries pinned to an
+// installation that is gone are stale
+func planInstallationSync(apps []config.GitHubApp, ah appHost, installations []installation) []installationSyncItem {
+	items := make([]installationSyncItem, 0, len(installations))
+	existing := make(map[int64]bool, len(installations))
+	for _, inst := range installations {
+		existing[inst.ID] = true
+		item := installationSyncItem{
+			Status:         syncConfigured,
+			AppName:        appDisplayName(ah.App),
+			AppID:          ah.App.AppID,
+			Host:           ah.Host,
+			InstallationID: inst.ID,
+			Account:        inst.Account.Login,
+		}
+		if entry := servingApp(apps, ah.App.AppID, ah.Host, inst); entry != nil {
+			item.Patterns = entry.Patterns
+		} else {
+			item.Status = syncMissing
+			item.proposed = proposedInstallationApp(ah.App, ah.Host, inst)
+			item.Patterns = item.proposed.Patterns
+		}
+		items = append(items, item)
+	}
+
+	for _, app := range pinnedEntries(apps, ah) {
+		if !existing[app.InstallationID] {
+			items = append(items, pinnedEntrySyncItem(syncStale, app, ah.Host))
+		}
+	}
+	return items
+}
+
+// planUncheckedSync reports the entries pinned to an installation of an app whose
+// installations could not be listed: they cannot be told apart from stale ones
+func planUncheckedSync(apps []config.GitHubApp, ah appHost) []installationSyncItem {
+	var items []installationSyncItem
+	for _, app := range pinnedEntries(apps, ah) {
+		items = append(items, pinnedEntrySyncItem(syncUnchecked, app, ah.Host))
+	}
+	return items
+}
+
+// pinnedEntries returns the config entries of an app on host pinned to an installation
+func pinnedEntries(apps []config.GitHubApp, ah appHost) []*config.GitHubApp {
+	var entries []*config.GitHubApp
+	for i := range apps {
+		app := &apps[i]
+		if app.AppID != ah.App.AppID || app.InstallationID == 0 ||
+			len(app.Patterns) == 0 || !strings.EqualFold(extractHostFromPattern(app.Patterns[0]), ah.Host) {
+			continue
+		}
+		entries = append(entries, app)
+	}
+	return entries
+}
+
+// pinnedEntrySyncItem reports a config entry pinned to an installation
+func pinnedEntrySyncItem(status string, app *config.GitHubApp, host string) installationSyncItem {
+	item := installationSyncItem{
+		Status:         status,
+		AppName:        appDisplayName(app),
+		AppID:          app.AppID,
+		Host:           host,
+		InstallationID: app.InstallationID,
+		Patterns:       app.Patterns,
+	}
+	if app.Scope != nil {
+		item.Account = app.Scope.AccountLogin
+	}
+	return item
+}
+
+// proposedInstallationApp returns an entry pinned to an installation, sharing the name and
+// key settings of base: the private key is stored under the app's name, so entries with
+// the same name share it
+func proposedInstallationApp(base *config.GitHubApp, host string, inst installation) *config.GitHubApp {
+	return &config.GitHubApp{
+		Name:             base.Name,
+		AppID:            base.AppID,
+		ClientID:         base.ClientID,
+		InstallationID:   inst.ID,
+		PrivateKeyPath:   base.PrivateKeyPath,
+		PrivateKeySource: base.PrivateKeySource,
+		Patterns:         []string{host + "/" + inst.Account.Login + "/"},
+		Priority:         base.Priority,
+		PrivateKeys:      base.PrivateKeys,
+		Signer:           base.Signer,
+		SecretBackends:   base.SecretBackends,
+		PrivateKeyRef:    base.PrivateKeyRef,
+	}
+}
+
+// applyInstallationSync adds the proposed entries to the configuration
+func applyInstallationSync(w io.Writer, items []installationSyncItem) error {
+	// Reload: the configuration may have changed while installations were listed
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	added := 0
+	for _, item := range items {
+		if item.proposed != nil {
+			cfg.AddOrUpdateApp(item.proposed)
+			added++
+		}
+	}
+	if added == 0 {
+		return nil
+	}
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	_, _ = fmt.Fprintf(w, "✅ Added %d app entr%s to the configuration\n", added, pluralSuffix(added, "y", "ies"))
+	return nil
+}
+
+// showInstallation finds an installation among the configured apps' and lists its repositories
+func showInstallation(
+	ctx context.Context, installationID, appID int64, filtered bool,
+) (*installationDetails, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	hosts := configuredAppHosts(cfg.GitHubApps, appID)
+	if len(hosts) == 0 {
+		if filtered {
+			return nil, fmt.Errorf("app with ID %d not found in configuration", appID)
+		}
+		return nil, fmt.Errorf("no GitHub Apps configured")
+	}
+
+	authenticator := auth.NewAuthenticator()
+	for _, ah := range hosts {
+		apiBaseURL := auth.APIBaseURL(ah.Host)
+		client := &http.Client{Transport: authenticator.AppJWTTransport(ah.App, nil)}
+		inst, err := getInstallation(ctx, client, apiBaseURL, installationID)
+		if errors.Is(err, errInstallationNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("app %s: %w", appDisplayName(ah.App), err)
+		}
+
+		pinned := *ah.App
+		pinned.InstallationID = installationID
+		token, _, err := authenticator.GetCredentials(&pinned, "https://"+ah.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain installation token: %w", err)
+		}
+		repos, err := listInstallationRepositories(ctx, token, apiBaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &installationDetails{
+			AppName:      appDisplayName(ah.App),
+			AppID:        ah.App.AppID,
+			Host:         ah.Host,
+			Installation: *inst,
+			Repositories: repos,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: no configured app has installation %d", errInstallationNotFound, installationID)
+}
+
+func outputInstallationList(w io.Writer, format string, items []installationListItem) error {
+	switch format {
+	case "json":
+		return writeIndentedJSON(w, items)
+	case "table":
+	default:
+		return fmt.Errorf("unsupported format: %s (supported: table, json)", format)
+	}
+
+	if len(items) == 0 {
+		_, _ = fmt.Fprintln(w, "No installations found")
+		return nil
+	}
+
+	tp := tableprinter.New(w, false, 120)
+	for _, header := range []string{"APP", "APP ID", "INSTALLATION ID", "ACCOUNT", "REPOSITORIES", "CONFIG ENTRY"} {
+		tp.AddField(header, tableprinter.WithTruncate(nil))
+	}
+	tp.EndRow()
+
+	for _, item := range items {
+		inst := item.Installation
+		configuredAs := "-"
+		if item.ConfiguredAs != "" {
+			configuredAs = fmt.Sprintf("%s (%s)", item.ConfiguredAs, strings.Join(item.ConfigPatterns, ", "))
+		}
+		tp.AddField(item.AppName, tableprinter.WithTruncate(nil))
+		tp.AddField(strconv.FormatInt(item.AppID, 10), tableprinter.WithTruncate(nil))
+		tp.AddField(strconv.FormatInt(inst.ID, 10), tableprinter.WithTruncate(nil))
+		tp.AddField(fmt.Sprintf("%s (%s)", inst.Account.Login, inst.Account.Type), tableprinter.WithTruncate(nil))
+		tp.AddField(inst.RepositorySelection, tableprinter.WithTruncate(nil))
+		tp.AddField(configuredAs, tableprinter.WithTruncate(nil))
+		tp.EndRow()
+	}
+	return tp.Render()
+}
+
+func outputInstallationSync(w io.Writer, format string, items []installationSyncItem, apply bool) error {
+	switch format {
+	case "json":
+		return writeIndentedJSON(w, items)
+	case "table":
+	default:
+		return fmt.Errorf("unsupported format: %s (supported: table, json)", format)
+	}
+
+	if len(items) == 0 {
+		_, _ = fmt.Fprintln(w, "No installations found")
+		return nil
+	}
+
+	tp := tableprinter.New(w, false, 120)
+	for _, header := range []string{"STATUS", "APP", "INSTALLATION ID", "ACCOUNT", "PATTERNS"} {
+		tp.AddField(header, tableprinter.WithTruncate(nil))
+	}
+	tp.EndRow()
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Status]++
+		accountDisplay := item.Account
+		if accountDisplay == "" {
+			accountDisplay = "-"
+		}
+		tp.AddField(item.Status, tableprinter.WithTruncate(nil))
+		tp.AddField(item.AppName, tableprinter.WithTruncate(nil))
+		tp.AddField(strconv.FormatInt(item.InstallationID, 10), tableprinter.WithTruncate(nil))
+		tp.AddField(accountDisplay, tableprinter.WithTruncate(nil))
+		tp.AddField(strings.Join(item.Patterns, ", "), tableprinter.WithTruncate(nil))
+		tp.EndRow()
+	}
+	if err := tp.Render(); err != nil {
+		return err
+	}
+
+	if n := counts[syncMissing]; n > 0 && !apply {
+		_, _ = fmt.Fprintf(w, "\n%d installation(s) not configured. Run with --apply to add entries for them.\n", n)
+	}
+	if n := counts[syncStale]; n > 0 {
+		_, _ = fmt.Fprintf(w, "\n⚠️  %d config entr%s pin an installation that no longer exists.\n",
+			n, pluralSuffix(n, "y", "ies"))
+	}
+	if n := counts[syncUnchecked]; n > 0 {
+		_, _ = fmt.Fprintf(w, "\n⚠️  %d config entr%s could not be checked: listing the app's installations failed.\n",
+			n, pluralSuffix(n, "y", "ies"))
+	}
+	return nil
+}
+
+func outputInstallationDetails(w io.Writer, format string, details *installationDetails) error {
+	switch format {
+	case "json":
+		return writeIndentedJSON(w, details)
+	case "table":
+	default:
+		return fmt.Errorf("unsupported format: %s (supported: table, json)", format)
+	}
+
+	inst := details.Installation
+	_, _ = fmt.Fprintf(w, "Installation %d of %s (App ID %d)\n", inst.ID, details.AppName, details.AppID)
+	_, _ = fmt.Fprintf(w, "  Account:              %s (%s)\n", inst.Account.Login, inst.Account.Type)
+	_, _ = fmt.Fprintf(w, "  Repository selection: %s\n", inst.RepositorySelection)
+	_, _ = fmt.Fprintf(w, "  Permissions:          %s\n", formatPermissions(inst.Permissions))
+	if len(inst.Events) > 0 {
+		_, _ = fmt.Fprintf(w, "  Events:               %s\n", strings.Join(inst.Events, ", "))
+	}
+	if !inst.CreatedAt.IsZero() {
+		_, _ = fmt.Fprintf(w, "  Created:              %s\n", inst.CreatedAt.Format(time.RFC3339))
+	}
+	if inst.SuspendedAt != nil {
+		_, _ = fmt.Fprintf(w, "  ⚠️  Suspended:         %s\n", inst.SuspendedAt.Format(time.RFC3339))
+	}
+	if inst.HTMLURL != "" {
+		_, _ = fmt.Fprintf(w, "  URL:                  %s\n", inst.HTMLURL)
+	}
+
+	_, _ = fmt.Fprintf(w, "\nRepositories (%d):\n", len(details.Repositories))
+	for _, repo := range details.Repositories {
+		privacy := "public"
+		if repo.Private {
+			privacy = "private"
+		}
+		_, _ = fmt.Fprintf(w, "  - %s (%s)\n", repo.FullName, privacy)
+	}
+	return nil
+}
+
+func writeIndentedJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// pluralSuffix returns singular when n is 1, else plural
+func pluralSuffix(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// githubStatusError reports an unexpected GitHub API response status
+type githubStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *githubStatusError) Error() string {
+	return fmt.Sprintf("GitHub API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// listInstallations lists every installation of the app authenticated by jwtToken
+func listInstallations(ctx context.Context, client *http.Client, apiBaseURL string) ([]installation, error) {
+	var installations []installation
+	for apiURL := apiBaseURL + "/app/installations?per_page=100"; apiURL != ""; {
+		var page []installation
+		next, err := getGitHubJSON(ctx, client, apiURL, "", &page)
+		if err != nil {
+			return nil, err
+		}
+		installations = append(installations, page...)
+		apiURL = next
+	}
+	return installations, nil
+}
+
+// listInstallationRepositories lists every repository an installation token can access
+func listInstallationRepositories(ctx context.Context, token, apiBaseURL string) ([]installationRepository, error) {
+	var repos []installationRepository
+	for apiURL := apiBaseURL + "/installation/repositories?per_page=100"; apiURL != ""; {
+		var page struct {
+			Repositories []installationRepository `json:"repositories"`
+		}
+		next, err := getGitHubJSON(ctx, http.DefaultClient, apiURL, token, &page)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, page.Repositories...)
+		apiURL = next
+	}
+	return repos, nil
+}
+
+// getInstallation fetches one installation of the app authenticated by jwtToken
+func getInstallation(
+	ctx context.Context, client *http.Client, apiBaseURL string, installationID int64,
+) (*installation, error) {
+	var inst installation
+	_, err := getGitHubJSON(ctx, client, fmt.Sprintf("%s/app/installations/%d", apiBaseURL, installationID), "", &inst)
+	var statusErr *githubStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, errInstallationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// getGitHubJSON GETs a GitHub API URL with client and decodes the JSON response into v.
+// token is left to client when empty, e.g. one using auth.AppJWTTransport. It returns
+// the URL of the next page from the Link header, if any.
+func getGitHubJSON(ctx context.Context, client *http.Client, apiURL, token string, v any) (string, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", &githubStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return auth.FollowNextPage(resp.Header.Get("Link"), apiURL)
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+// bearerClient returns a client authenticating requests with a fixed bearer token, standing
+// in for one using auth.AppJWTTransport
+func bearerClient(token string) *http.Client {
+	return &http.Client{Transport: bearerTransport(token)}
+}
+
+type bearerTransport string
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestListInstallations_Pagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer jwt" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/app/installations?per_page=100&page=2>; rel="next"`, server.URL))
+			_ = json.NewEncoder(w).Encode([]installation{{ID: 1, Account: account{Login: "myorg"}}})
+		case "2":
+			_ = json.NewEncoder(w).Encode([]installation{{ID: 2, Account: account{Login: "octocat"}}})
+		}
+	}))
+	defer server.Close()
+
+	installations, err := listInstallations(context.Background(), bearerClient("jwt"), server.URL)
+	if err != nil {
+		t.Fatalf("listInstallations() failed: %v", err)
+	}
+	if len(installations) != 2 || installations[1].Account.Login != "octocat" {
+		t.Errorf("listInstallations() = %+v, want both pages", installations)
+	}
+
+	if _, err := listInstallations(context.Background(), bearerClient("wrong"), server.URL); err == nil {
+		t.Error("listInstallations() with a rejected JWT should fail")
+	}
+}
+
+func TestListInstallationRepositories_RefusesOtherHosts(t *testing.T) {
+	// Given a Link header pointing to another host
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = append(leaked, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"repositories":[]}`))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/installation/repositories?page=2>; rel="next"`, other.URL))
+		_, _ = w.Write([]byte(`{"repositories":[{"full_name":"myorg/repo"}]}`))
+	}))
+	defer server.Close()
+
+	// Then the installation token is not sent there
+	if _, err := listInstallationRepositories(context.Background(), "ghs_token", server.URL); err == nil {
+		t.Error("listInstallationRepositories() should refuse a next page on another host")
+	}
+	if len(leaked) != 0 {
+		t.Errorf("requests sent to the other host: %v", leaked)
+	}
+}
+
+func TestGetInstallation_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app/installations/42" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(installation{ID: 42, Account: account{Login: "myorg"}})
+	}))
+	defer server.Close()
+
+	inst, err := getInstallation(context.Background(), bearerClient("jwt"), server.URL, 42)
+	if err != nil || inst.Account.Login != "myorg" {
+		t.Errorf("getInstallation() = %+v, %v", inst, err)
+	}
+	_, err = getInstallation(context.Background(), bearerClient("jwt"), server.URL, 7)
+	if !errors.Is(err, errInstallationNotFound) {
+		t.Errorf("getInstallation() error = %v, want %v", err, errInstallationNotFound)
+	}
+}
+
+func TestPlanInstallationSync(t *testing.T) {
+	apps := []config.GitHubApp{
+		{Name: "Org App", AppID: 1, InstallationID: 100, Patterns: []string{"github.com/pinned/"},
+			PrivateKeySource: config.PrivateKeySourceKeyring, Priority: 5},
+		{Name: "Org App", AppID: 1, Patterns: []string{"github.com/discovered/"}},
+		{Name: "Org App", AppID: 1, InstallationID: 999, Patterns: []string{"github.com/gone/"},
+			Scope: &config.InstallationScope{AccountLogin: "gone"}},
+		{Name: "Other App", AppID: 2, InstallationID: 500, Patterns: []string{"github.com/other/"}},
+	}
+	installations := []installation{
+		{ID: 100, Account: account{Login: "pinned"}},
+		{ID: 200, Account: account{Login: "Discovered"}},
+		{ID: 300, Account: account{Login: "neworg"}},
+	}
+
+	items := planInstallationSync(apps, appHost{App: &apps[0], Host: "github.com"}, installations)
+
+	want := []struct {
+		status         string
+		installationID int64
+		pattern        string
+	}{
+		{syncConfigured, 100, "github.com/pinned/"},
+		{syncConfigured, 200, "github.com/discovered/"},
+		{syncMissing, 300, "github.com/neworg/"},
+		{syncStale, 999, "github.com/gone/"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("planInstallationSync() = %d items, want %d: %+v", len(items), len(want), items)
+	}
+	for i, w := range want {
+		item := items[i]
+		if item.Status != w.status || item.InstallationID != w.installationID || item.Patterns[0] != w.pattern {
+			t.Errorf("items[%d] = %s %d %v, want %s %d %s",
+				i, item.Status, item.InstallationID, item.Patterns, w.status, w.installationID, w.pattern)
+		}
+	}
+
+	// The proposed entry shares the app's name and key settings
+	proposed := items[2].proposed
+	if proposed == nil || proposed.Name != "Org App" || proposed.InstallationID != 300 ||
+		proposed.PrivateKeySource != config.PrivateKeySourceKeyring || proposed.Priority != 5 {
+		t.Errorf("Proposed entry = %+v", proposed)
+	}
+	if items[3].Account != "gone" {
+		t.Errorf("Stale account = %q, want gone", items[3].Account)
+	}
+}
+
+func TestApplyInstallationSync(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	// Given a configuration with one app entry and its stored key
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	secretMgr := secrets.NewManager(t.TempDir())
+	base := config.GitHubApp{
+		Name: "Org App", AppID: 1, InstallationID: 100, Patterns: []string{"github.com/myorg/"},
+	}
+	if _, err := base.SetPrivateKey(secretMgr, "app-key"); err != nil {
+		t.Fatalf("SetPrivateKey() failed: %v", err)
+	}
+	cfg := &config.Config{Version: "1.0", GitHubApps: []config.GitHubApp{base}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// When sync applies a missing installation
+	items := planInstallationSync(cfg.GitHubApps, appHost{App: &base, Host: "github.com"}, []installation{
+		{ID: 100, Account: account{Login: "myorg"}},
+		{ID: 200, Account: account{Login: "other"}},
+	})
+	var out bytes.Buffer
+	if err := applyInstallationSync(&out, items); err != nil {
+		t.Fatalf("applyInstallationSync() failed: %v", err)
+	}
+
+	// Then an entry pinned to it is saved
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(saved.GitHubApps) != 2 {
+		t.Fatalf("GitHubApps = %d, want 2", len(saved.GitHubApps))
+	}
+	added := saved.GitHubApps[1]
+	if added.InstallationID != 200 || added.Patterns[0] != "github.com/other/" || added.Name != "Org App" {
+		t.Errorf("Added entry = %+v", added)
+	}
+	// and shares the app's name, so it uses the key already stored for the app
+	if key, err := added.GetPrivateKey(secretMgr); err != nil || key != "app-key" {
+		t.Errorf("GetPrivateKey() of added entry = %q, %v; want the app's key", key, err)
+	}
+}
+
+func TestApplyInstallationSync_ThenRemoveKeepsSharedKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	// Given an app entry whose installation sync adds a second entry sharing its key
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	secretMgr := secrets.NewManager(t.TempDir())
+	base := config.GitHubApp{
+		Name: "Org App", AppID: 1, InstallationID: 100, Patterns: []string{"github.com/myorg/"},
+	}
+	if _, err := base.SetPrivateKey(secretMgr, "app-key"); err != nil {
+		t.Fatalf("SetPrivateKey() failed: %v", err)
+	}
+	cfg := &config.Config{Version: "1.0", GitHubApps: []config.GitHubApp{base}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	items := planInstallationSync(cfg.GitHubApps, appHost{App: &base, Host: "github.com"}, []installation{
+		{ID: 100, Account: account{Login: "myorg"}},
+		{ID: 200, Account: account{Login: "other"}},
+	})
+	if err := applyInstallationSync(&bytes.Buffer{}, items); err != nil {
+		t.Fatalf("applyInstallationSync() failed: %v", err)
+	}
+
+	// When the added entry is removed
+	cmd := NewRemoveCmd()
+	cmd.SetArgs([]string{"--app-id", "1", "--installation-id", "200", "--force"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	// Then only that entry is gone and the base entry still has its key
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(saved.GitHubApps) != 1 || saved.GitHubApps[0].InstallationID != 100 {
+		t.Fatalf("GitHubApps = %+v, want only the base entry", saved.GitHubApps)
+	}
+	if key, err := saved.GitHubApps[0].GetPrivateKey(secretMgr); err != nil || key != "app-key" {
+		t.Errorf("GetPrivateKey() of base entry = %q, %v; want the app's key", key, err)
+	}
+
+	// Removing the last entry of the app deletes the key
+	cmd = NewRemoveCmd()
+	cmd.SetArgs([]string{"--app-id", "1", "--force"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, err := base.GetPrivateKey(secretMgr); err == nil {
+		t.Error("GetPrivateKey() succeeded after the app's last entry was removed")
+	}
+}
+
+func TestPlanUncheckedSync(t *testing.T) {
+	apps := []config.GitHubApp{
+		{Name: "Org App", AppID: 1, InstallationID: 100, Patterns: []string{"github.com/pinned/"}},
+		{Name: "Org App", AppID: 1, Patterns: []string{"github.com/discovered/"}},
+		{Name: "Org App", AppID: 1, InstallationID: 300, Patterns: []string{"ghe.example.com/onprem/"}},
+		{Name: "Other App", AppID: 2, InstallationID: 500, Patterns: []string{"github.com/other/"}},
+	}
+
+	// When the app's installations could not be listed, its pinned entries on the host are
+	// reported rather than skipped
+	items := planUncheckedSync(apps, appHost{App: &apps[0], Host: "github.com"})
+	if len(items) != 1 || items[0].Status != syncUnchecked || items[0].InstallationID != 100 {
+		t.Fatalf("planUncheckedSync() = %+v, want the entry pinned to 100 unchecked", items)
+	}
+
+	var out bytes.Buffer
+	if err := outputInstallationSync(&out, "table", items, false); err != nil {
+		t.Fatalf("outputInstallationSync() failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 config entry could not be checked") {
+		t.Errorf("Output = %q, want the unchecked entry summarized", out.String())
+	}
+}
+
+func TestOutputInstallationSync_JSON(t *testing.T) {
+	items := []installationSyncItem{{
+		Status: syncMissing, AppName: "Org App", AppID: 1, Host: "github.com",
+		InstallationID: 300, Account: "neworg", Patterns: []string{"github.com/neworg/"},
+	}}
+
+	var out bytes.Buffer
+	if err := outputInstallationSync(&out, "json", items, false); err != nil {
+		t.Fatalf("outputInstallationSync() failed: %v", err)
+	}
+
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, out.String())
+	}
+	if len(decoded) != 1 || decoded[0]["status"] != "missing" || decoded[0]["account"] != "neworg" {
+		t.Errorf("Decoded output = %v", decoded)
+	}
+
+	if err := outputInstallationSync(&out, "yaml", items, false); err == nil {
+		t.Error("outputInstallationSync() with an unsupported format should fail")
+	}
+}
@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/cli/go-gh/v2/pkg/tableprinter"
 	"github.com/spf13/cobra"
@@ -20,8 +25,22 @@ const (
 	statusNotChecked = "⚠️  Not checked"
 	statusAccessible = "✅ Accessible"
 	statusNotFound   = "❌ Not found"
+	statusRejected   = "❌ Rejected by GitHub"
+	statusFailed     = "❌ Verification failed"
 )
 
+// fingerprintEncrypted is shown for encrypted keys, whose public half can't be read without the passphrase
+const fingerprintEncrypted = "🔒 encrypted"
+
+// appKeyCheck is the outcome of checking one private key of an app
+type appKeyCheck struct {
+	Label       string
+	Backend     secrets.StorageBackend // Secret backend that served the key, if any
+	Fingerprint string
+	Info        *appInfo // Set once GitHub accepted the key
+	Err         error
+}
+
 func NewListCmd() *cobra.Command {
 	var (
 		format     string
@@ -34,7 +53,15 @@ func NewListCmd() *cobra.Command {
 		Short: "List configured credentials",
 		Long: `List all configured GitHub Apps and Personal Access Tokens with their settings.
 
-Shows the configured credential sources, their patterns, priorities, and status.`,
+Shows the credential sources, their patterns and priorities, and the SHA-256
+fingerprint of each app's active private key. Fingerprints are computed locally
+and can be compared with the ones shown in the app's GitHub settings.
+
+With --verify-keys, every private key is also used to call the GitHub /app
+endpoint to confirm it still belongs to the app, reporting the app slug, owner
+and permissions. This catches keys deleted on GitHub before git starts failing.
+Client IDs GitHub reports for apps configured without one are saved to the
+configuration and used as JWT issuer, as 'gh app-auth test' does.`,
 		Aliases: []string{"ls"},
 		Example: `  # List all configured apps
   gh app-auth list
@@ -43,13 +70,16 @@ Shows the configured credential sources, their patterns, priorities, and status.
   gh app-auth list --format json
   
   # Quiet output (just app IDs)
-  gh app-auth list --quiet`,
+  gh app-auth list --quiet
+
+  # Check every private key against GitHub
+  gh app-auth list --verify-keys`,
 		RunE: listRun(&format, &quiet, &verifyKeys),
 	}
 
 	cmd.Flags().StringVar(&format, "format", "table", "Output format: table, json, yaml")
 	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only show app IDs")
-	cmd.Flags().BoolVar(&verifyKeys, "verify-keys", false, "Verify that private keys are accessible")
+	cmd.Flags().BoolVar(&verifyKeys, "verify-keys", false, "Verify private keys against GitHub and report app permissions")
 
 	return cmd
 }
@@ -68,22 +98,22 @@ func listRun(format *string, quiet *bool, verifyKeys *bool) func(*cobra.Command,
 
 		// Handle quiet mode
 		if *quiet {
-			return outputQuietMode(cfg.GitHubApps, cfg.PATs)
+			return outputQuietMode(cfg.GitHubApps, cfg.PATs, cfg.UserTokens)
 		}
 
 		// Initialize secrets manager if needed
-		secretMgr, err := initializeSecretsManagerIfNeeded(*verifyKeys)
+		secretMgr, err := initializeSecretsManagerIfNeeded(*format)
 		if err != nil {
 			return err
 		}
 
 		// Handle output format
-		return handleOutputFormat(*format, cfg.GitHubApps, cfg.PATs, secretMgr, *verifyKeys)
+		return handleOutputFormat(*format, cfg.GitHubApps, cfg.PATs, cfg.UserTokens, secretMgr, *verifyKeys)
 	}
 }
 
 func outputTable(
-	apps []config.GitHubApp, pats []config.PersonalAccessToken,
+	apps []config.GitHubApp, pats []config.PersonalAccessToken, userTokens []config.AppUserToken,
 	secretMgr *secrets.Manager, verifyKeys bool,
 ) error {
 	printedSection := false
@@ -107,6 +137,17 @@ func outputTable(
 		printedSection = true
 	}
 
+	if len(userTokens) > 0 {
+		if printedSection {
+			fmt.Println()
+		}
+		fmt.Println("GitHub App User Tokens")
+		if err := outputUserTokenTable(userTokens, secretMgr); err != nil {
+			return err
+		}
+		printedSection = true
+	}
+
 	if !printedSection {
 		fmt.Println("No GitHub Apps or Personal Access Tokens configured.")
 	}
@@ -127,13 +168,15 @@ func outputAppsTable(apps []config.GitHubApp, secretMgr *secrets.Manager, verify
 	tp.AddField("PATTERNS", tableprinter.WithTruncate(nil))
 	tp.AddField("PRIORITY", tableprinter.WithTruncate(nil))
 	tp.AddField("KEY SOURCE", tableprinter.WithTruncate(nil))
+	tp.AddField("FINGERPRINT", tableprinter.WithTruncate(nil))
 	if verifyKeys {
 		tp.AddField("KEY STATUS", tableprinter.WithTruncate(nil))
 	}
 	tp.EndRow()
 
 	// Add data rows
-	for _, app := range apps {
+	allChecks := make([][]appKeyCheck, len(apps))
+	for i, app := range apps {
 		tp.AddField(app.Name, tableprinter.WithTruncate(nil))
 		tp.AddField(fmt.Sprintf("%d", app.AppID), tableprinter.WithTruncate(nil))
 
@@ -146,20 +189,188 @@ func outputAppsTable(apps []config.GitHubApp, secretMgr *secrets.Manager, verify
 		tp.AddField(strings.Join(app.Patterns, ", "), tableprinter.WithTruncate(nil))
 		tp.AddField(fmt.Sprintf("%d", app.Priority), tableprinter.WithTruncate(nil))
 
-		// Display key source
-		keySource := getKeySourceDisplay(app)
-		tp.AddField(keySource, tableprinter.WithTruncate(nil))
-
-		// Verify key if requested
+		// Load each key once: to fingerprint it, name the backend that actually served
+		// the active key and, with --verify-keys, check it against GitHub
+		apiBaseURL := ""
+		if verifyKeys && len(app.Patterns) > 0 {
+			apiBaseURL = auth.APIBaseURL(extractHostFromPattern(app.Patterns[0]))
+		}
+		switch {
+		case app.Signer == nil && secretMgr != nil:
+			allChecks[i] = checkAppKeys(context.Background(), app, secretMgr, apiBaseURL)
+		case verifyKeys:
+			allChecks[i] = []appKeyCheck{checkAppSigner(context.Background(), app, apiBaseURL)}
+		}
+		tp.AddField(getKeySourceDisplay(app, activeKeyBackend(app, allChecks[i])), tableprinter.WithTruncate(nil))
+
+		fingerprint, keyStatus := "-", statusNotFound
+		if len(allChecks[i]) > 0 {
+			if allChecks[i][0].Fingerprint != "" {
+				fingerprint = allChecks[i][0].Fingerprint
+			}
+			keyStatus = getKeyCheckDisplay(allChecks[i][0])
+		}
+		tp.AddField(fingerprint, tableprinter.WithTruncate(nil))
 		if verifyKeys {
-			keyStatus := verifyKeyAccess(app, secretMgr)
 			tp.AddField(keyStatus, tableprinter.WithTruncate(nil))
 		}
 
 		tp.EndRow()
 	}
 
-	return tp.Render()
+	if err := tp.Render(); err != nil {
+		return err
+	}
+
+	if verifyKeys {
+		printKeyChecks(apps, allChecks)
+		learnClientIDs(apps, allChecks)
+	}
+	return nil
+}
+
+// activeKeyBackend returns the backend that served the app's active key, when it was loaded
+func activeKeyBackend(app config.GitHubApp, checks []appKeyCheck) secrets.StorageBackend {
+	if len(checks) == 0 {
+		return ""
+	}
+	if len(app.PrivateKeys) > 0 && checks[0].Label != app.PrivateKeys[0].Label {
+		// The active key could not be loaded; a fallback was
+		return ""
+	}
+	return checks[0].Backend
+}
+
+// learnClientIDs records the client IDs GitHub reported for apps configured without one,
+// like the test command does
+func learnClientIDs(apps []config.GitHubApp, allChecks [][]appKeyCheck) {
+	for i, app := range apps {
+		for _, check := range allChecks[i] {
+			if check.Info == nil || check.Info.ClientID == "" || check.Info.ClientID == app.ClientID {
+				continue
+			}
+			changed, err := recordClientID(app.AppID, check.Info.ClientID)
+			if err != nil {
+				fmt.Printf("⚠️  Could not save client ID for app %d: %v\n", app.AppID, err)
+			} else if changed {
+				fmt.Printf("📝 Saved client ID %s for app %d; JWTs now use it as issuer\n", check.Info.ClientID, app.AppID)
+			}
+			break
+		}
+	}
+}
+
+// checkAppKeys fingerprints each loadable key of an app and, when apiBaseURL is set,
+// confirms GitHub accepts the key for the app
+func checkAppKeys(
+	ctx context.Context, app config.GitHubApp, secretMgr *secrets.Manager, apiBaseURL string,
+) []appKeyCheck {
+	keys, err := app.GetPrivateKeys(secretMgr)
+	if err != nil {
+		return nil
+	}
+
+	checks := make([]appKeyCheck, 0, len(keys))
+	var passphrase []byte
+	var passphraseErr error
+	passphraseResolved := false
+	for _, key := range keys {
+		check := appKeyCheck{Label: key.Label, Backend: key.Backend}
+		privateKey := key.PEM
+		if jwt.IsEncryptedKey(privateKey) {
+			// The public key is encrypted too; only ask for the passphrase when verifying
+			if apiBaseURL == "" {
+				check.Fingerprint = fingerprintEncrypted
+				checks = append(checks, check)
+				continue
+			}
+			// Resolve the passphrase once for all keys of the app
+			if !passphraseResolved {
+				passphrase, passphraseErr = auth.KeyPassphrase(&app, secretMgr)
+				passphraseResolved = true
+			}
+			check.Err = passphraseErr
+			if check.Err == nil {
+				privateKey, check.Err = jwt.DecryptPrivateKey(privateKey, passphrase)
+			}
+			if check.Err != nil {
+				check.Fingerprint = fingerprintEncrypted
+				checks = append(checks, check)
+				continue
+			}
+		}
+
+		check.Fingerprint, check.Err = jwt.Fingerprint(privateKey)
+		if check.Err == nil && apiBaseURL != "" {
+			check.Info, check.Err = verifyAppKey(ctx, apiBaseURL, auth.JWTIssuer(&app), privateKey)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// checkAppSigner confirms GitHub accepts JWTs from the app's external signer
+func checkAppSigner(ctx context.Context, app config.GitHubApp, apiBaseURL string) appKeyCheck {
+	check := appKeyCheck{Label: string(app.Signer.Type) + " signer"}
+	if _, err := auth.NewSigner(&app); err != nil {
+		check.Err = err
+		return check
+	}
+	client := &http.Client{Transport: auth.NewAuthenticator().AppJWTTransport(&app, nil)}
+	check.Info, check.Err = verifyApp(ctx, client, apiBaseURL, app.AppID)
+	return check
+}
+
+// getKeyCheckDisplay summarizes a key check for the table
+func getKeyCheckDisplay(check appKeyCheck) string {
+	switch {
+	case check.Err == nil && check.Info != nil:
+		return fmt.Sprintf("✅ %s (%s)", check.Info.Slug, check.Info.Owner.Login)
+	case check.Err == nil:
+		return statusAccessible
+	case errors.Is(check.Err, errKeyRejected):
+		return statusRejected
+	default:
+		return statusFailed
+	}
+}
+
+// printKeyChecks prints the per-key verification details below the apps table
+func printKeyChecks(apps []config.GitHubApp, allChecks [][]appKeyCheck) {
+	fmt.Println()
+	fmt.Println("Key verification")
+	for i, app := range apps {
+		fmt.Printf("  %s (%d)\n", app.Name, app.AppID)
+		if len(allChecks[i]) == 0 {
+			fmt.Printf("    %s\n", statusNotFound)
+			continue
+		}
+		for _, check := range allChecks[i] {
+			fingerprint := check.Fingerprint
+			if fingerprint == "" {
+				fingerprint = "-"
+			}
+			if check.Err != nil {
+				fmt.Printf("    [%s] %s ❌ %v\n", check.Label, fingerprint, check.Err)
+				continue
+			}
+			fmt.Printf("    [%s] %s ✅ %s owned by %s\n", check.Label, fingerprint, check.Info.Slug, check.Info.Owner.Login)
+			fmt.Printf("      permissions: %s\n", formatPermissions(check.Info.Permissions))
+		}
+	}
+}
+
+// formatPermissions renders app permissions as sorted name:level pairs
+func formatPermissions(permissions map[string]string) string {
+	if len(permissions) == 0 {
+		return "none"
+	}
+	pairs := make([]string, 0, len(permissions))
+	for name, level := range permissions {
+		pairs = append(pairs, name+":"+level)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
 }
 
 func outputPATTable(pats []config.PersonalAccessToken, secretMgr *secrets.Manager, verifyTokens bool) error {
@@ -172,6 +383,7 @@ func outputPATTable(pats []config.PersonalAccessToken, secretMgr *secrets.Manage
 	tb.AddField("PRIORITY", tableprinter.WithTruncate(nil))
 	tb.AddField("USERNAME", tableprinter.WithTruncate(nil))
 	tb.AddField("TOKEN SOURCE", tableprinter.WithTruncate(nil))
+	tb.AddField("EXPIRES", tableprinter.WithTruncate(nil))
 	if verifyTokens {
 		tb.AddField("TOKEN STATUS", tableprinter.WithTruncate(nil))
 	}
@@ -187,10 +399,23 @@ func outputPATTable(pats []config.PersonalAccessToken, secretMgr *secrets.Manage
 			username = "x-access-token"
 		}
 		tb.AddField(username, tableprinter.WithTruncate(nil))
-		tb.AddField(getPATSourceDisplay(pat), tableprinter.WithTruncate(nil))
+
+		// Look the token up once, naming the backend that served it
+		var served secrets.StorageBackend
+		tokenStatus := statusNotChecked
+		if secretMgr != nil {
+			var err error
+			if _, served, err = pat.LocatePAT(secretMgr); err == nil {
+				tokenStatus = statusAccessible
+			} else {
+				tokenStatus = statusNotFound
+			}
+		}
+		tb.AddField(getPATSourceDisplay(pat, served), tableprinter.WithTruncate(nil))
+		tb.AddField(getPATExpiryDisplay(pat, time.Now()), tableprinter.WithTruncate(nil))
 
 		if verifyTokens {
-			tb.AddField(verifyPATAccess(pat, secretMgr), tableprinter.WithTruncate(nil))
+			tb.AddField(tokenStatus, tableprinter.WithTruncate(nil))
 		}
 
 		tb.EndRow()
@@ -199,25 +424,105 @@ func outputPATTable(pats []config.PersonalAccessToken, secretMgr *secrets.Manage
 	return tb.Render()
 }
 
+func outputUserTokenTable(userTokens []config.AppUserToken, secretMgr *secrets.Manager) error {
+	tb := tableprinter.New(os.Stdout, false, 120)
+
+	tb.AddField("NAME", tableprinter.WithTruncate(nil))
+	tb.AddField("LOGIN", tableprinter.WithTruncate(nil))
+	tb.AddField("CLIENT ID", tableprinter.WithTruncate(nil))
+	tb.AddField("PATTERNS", tableprinter.WithTruncate(nil))
+	tb.AddField("PRIORITY", tableprinter.WithTruncate(nil))
+	tb.AddField("TOKEN SOURCE", tableprinter.WithTruncate(nil))
+	tb.AddField("LOGIN EXPIRES", tableprinter.WithTruncate(nil))
+	tb.EndRow()
+
+	for _, userToken := range userTokens {
+		tb.AddField(userToken.Name, tableprinter.WithTruncate(nil))
+		login := userToken.Login
+		if login == "" {
+			login = "-"
+		}
+		tb.AddField(login, tableprinter.WithTruncate(nil))
+		tb.AddField(userToken.ClientID, tableprinter.WithTruncate(nil))
+		tb.AddField(strings.Join(userToken.Patterns, ", "), tableprinter.WithTruncate(nil))
+		tb.AddField(fmt.Sprintf("%d", userToken.Priority), tableprinter.WithTruncate(nil))
+		tb.AddField(getUserTokenSourceDisplay(userToken, secretMgr), tableprinter.WithTruncate(nil))
+		tb.AddField(getUserTokenExpiryDisplay(userToken), tableprinter.WithTruncate(nil))
+		tb.EndRow()
+	}
+
+	return tb.Render()
+}
+
+// getUserTokenSourceDisplay names the backend holding a user token, or reports it missing
+func getUserTokenSourceDisplay(userToken config.AppUserToken, secretMgr *secrets.Manager) string {
+	if secretMgr != nil {
+		if _, err := userToken.GetAccessToken(secretMgr); err != nil {
+			return statusNotFound
+		}
+	}
+	switch userToken.TokenSource {
+	case config.PrivateKeySourceKeyring, "":
+		return "🔐 Keyring (encrypted)"
+	case config.PrivateKeySourceFilesystem:
+		return getBackendDisplay(secrets.StorageBackendFilesystem)
+	default:
+		return getBackendDisplay(secrets.StorageBackend(userToken.TokenSource))
+	}
+}
+
 type listOutput struct {
 	GitHubApps []config.GitHubApp           `json:"github_apps" yaml:"github_apps"`
 	PATs       []config.PersonalAccessToken `json:"pats" yaml:"pats"`
+	UserTokens []config.AppUserToken        `json:"user_tokens,omitempty" yaml:"user_tokens,omitempty"`
 }
 
-func outputJSON(apps []config.GitHubApp, pats []config.PersonalAccessToken) error {
+func outputJSON(apps []config.GitHubApp, pats []config.PersonalAccessToken, userTokens []config.AppUserToken) error {
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(listOutput{GitHubApps: apps, PATs: pats})
+	return encoder.Encode(listOutput{GitHubApps: apps, PATs: pats, UserTokens: userTokens})
 }
 
-func outputYAML(apps []config.GitHubApp, pats []config.PersonalAccessToken) error {
+func outputYAML(apps []config.GitHubApp, pats []config.PersonalAccessToken, userTokens []config.AppUserToken) error {
 	encoder := yaml.NewEncoder(os.Stdout)
 	defer func() { _ = encoder.Close() }()
-	return encoder.Encode(listOutput{GitHubApps: apps, PATs: pats})
+	return encoder.Encode(listOutput{GitHubApps: apps, PATs: pats, UserTokens: userTokens})
 }
 
-// getKeySourceDisplay returns a human-readable display of the key source
-func getKeySourceDisplay(app config.GitHubApp) string {
+// getKeySourceDisplay returns a human-readable display of the key source.
+// served is the secret backend that served the active key, when known.
+func getKeySourceDisplay(app config.GitHubApp, served secrets.StorageBackend) string {
+	if app.Signer != nil {
+		return fmt.Sprintf("🔏 %s signer (%s)", app.Signer.Type, app.Signer.Command)
+	}
+
+	if app.PrivateKeyRef != "" {
+		return fmt.Sprintf("🔗 %s", app.PrivateKeyRef)
+	}
+
+	if len(app.PrivateKeys) > 0 {
+		active := app.PrivateKeys[0]
+		display := "🔐 Keyring (encrypted)"
+		switch {
+		case served != "":
+			display = getBackendDisplay(served)
+		case active.Source == config.PrivateKeySourceFilesystem:
+			display = "📁 Filesystem"
+			if active.Path != "" {
+				display = fmt.Sprintf("📁 %s", active.Path)
+			}
+		}
+		display = fmt.Sprintf("%s [%s]", display, active.Label)
+		if fallbacks := len(app.PrivateKeys) - 1; fallbacks > 0 {
+			display += fmt.Sprintf(" +%d fallback", fallbacks)
+		}
+		return display
+	}
+
+	if served != "" {
+		return getBackendDisplay(served)
+	}
+
 	switch app.PrivateKeySource {
 	case config.PrivateKeySourceKeyring:
 		return "🔐 Keyring (encrypted)"
@@ -239,7 +544,15 @@ func getKeySourceDisplay(app config.GitHubApp) string {
 	}
 }
 
-func getPATSourceDisplay(pat config.PersonalAccessToken) string {
+func getPATSourceDisplay(pat config.PersonalAccessToken, served secrets.StorageBackend) string {
+	if pat.TokenRef != "" {
+		return fmt.Sprintf("🔗 %s", pat.TokenRef)
+	}
+
+	if served != "" {
+		return getBackendDisplay(served)
+	}
+
 	switch pat.TokenSource {
 	case config.PrivateKeySourceKeyring, "":
 		return "🔐 Keyring (encrypted)"
@@ -250,29 +563,26 @@ func getPATSourceDisplay(pat config.PersonalAccessToken) string {
 	}
 }
 
-// verifyKeyAccess checks if the private key is accessible
-func verifyKeyAccess(app config.GitHubApp, secretMgr *secrets.Manager) string {
-	if secretMgr == nil {
-		return statusNotChecked
-	}
-
-	if app.HasPrivateKey(secretMgr) {
-		return statusAccessible
-	}
-
-	return statusNotFound
-}
-
-func verifyPATAccess(pat config.PersonalAccessToken, secretMgr *secrets.Manager) string {
-	if secretMgr == nil {
-		return statusNotChecked
-	}
-
-	if _, _, err := secretMgr.Get(pat.Name, secrets.SecretTypePAT); err == nil {
-		return statusAccessible
+// getBackendDisplay returns a human-readable name for a secret backend
+func getBackendDisplay(backend secrets.StorageBackend) string {
+	switch backend {
+	case secrets.BackendTypeKeyring:
+		return "🔐 Keyring (encrypted)"
+	case secrets.BackendTypeEncryptedFile:
+		return "🔒 Encrypted file"
+	case secrets.BackendTypeFile:
+		return "📁 File"
+	case secrets.BackendTypeEnv:
+		return "💲 Environment"
+	case secrets.BackendTypeCommand:
+		return "🧰 Command"
+	case secrets.BackendTypeMemory:
+		return "🧠 Memory"
+	case secrets.BackendTypeVault:
+		return "🏦 Vault"
+	default:
+		return fmt.Sprintf("🔌 %s", backend)
 	}
-
-	return statusNotFound
 }
 
 // loadListConfiguration loads and validates the configuration for listing
@@ -286,7 +596,7 @@ func loadListConfiguration() (*config.Config, error) {
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	if len(cfg.GitHubApps) == 0 && len(cfg.PATs) == 0 {
+	if len(cfg.GitHubApps) == 0 && len(cfg.PATs) == 0 && len(cfg.UserTokens) == 0 {
 		fmt.Printf("No GitHub Apps or Personal Access Tokens configured. Run 'gh app-auth setup' to add one.\n")
 		return nil, nil
 	}
@@ -295,42 +605,42 @@ func loadListConfiguration() (*config.Config, error) {
 }
 
 // outputQuietMode outputs app IDs in quiet mode
-func outputQuietMode(apps []config.GitHubApp, pats []config.PersonalAccessToken) error {
+func outputQuietMode(
+	apps []config.GitHubApp, pats []config.PersonalAccessToken, userTokens []config.AppUserToken,
+) error {
 	for _, app := range apps {
 		fmt.Printf("app:%d\n", app.AppID)
 	}
 	for _, pat := range pats {
 		fmt.Printf("pat:%s\n", pat.Name)
 	}
+	for _, userToken := range userTokens {
+		fmt.Printf("user:%s\n", userToken.Name)
+	}
 	return nil
 }
 
-// initializeSecretsManagerIfNeeded initializes secrets manager if key verification is needed
-func initializeSecretsManagerIfNeeded(verifyKeys bool) (*secrets.Manager, error) {
-	if !verifyKeys {
+// initializeSecretsManagerIfNeeded initializes secrets manager if the output format shows
+// fingerprints and secret sources
+func initializeSecretsManagerIfNeeded(format string) (*secrets.Manager, error) {
+	if format != "table" {
 		return nil, nil
 	}
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	return secrets.NewManager(configDir), nil
+	return newDefaultSecretsManager()
 }
 
 // handleOutputFormat handles different output formats
 func handleOutputFormat(
-	format string, apps []config.GitHubApp, pats []config.PersonalAccessToken,
+	format string, apps []config.GitHubApp, pats []config.PersonalAccessToken, userTokens []config.AppUserToken,
 	secretMgr *secrets.Manager, verifyKeys bool,
 ) error {
 	switch format {
 	case "json":
-		return outputJSON(apps, pats)
+		return outputJSON(apps, pats, userTokens)
 	case "yaml":
-		return outputYAML(apps, pats)
+		return outputYAML(apps, pats, userTokens)
 	case "table":
-		return outputTable(apps, pats, secretMgr, verifyKeys)
+		return outputTable(apps, pats, userTokens, secretMgr, verifyKeys)
 	default:
 		return fmt.Errorf("unsupported format: %s (supported: table, json, yaml)", format)
 	}
@@ -1,12 +1,28 @@
 package cmd
 
 import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
 	"gopkg.in/yaml.v3"
 )
 
@@ -68,11 +84,29 @@ func TestGetKeySourceDisplay(t *testing.T) {
 			},
 			want: "❓ custom",
 		},
+		{
+			name: "exec signer",
+			app: config.GitHubApp{
+				Signer: &config.SignerConfig{Type: config.SignerTypeExec, Command: "hsm-sign"},
+			},
+			want: "🔏 exec signer (hsm-sign)",
+		},
+		{
+			name: "multiple keys",
+			app: config.GitHubApp{
+				PrivateKeySource: config.PrivateKeySourceKeyring,
+				PrivateKeys: []config.PrivateKeyEntry{
+					{Label: "key-20240601-120000", Source: config.PrivateKeySourceKeyring},
+					{Label: "initial", Source: config.PrivateKeySourceFilesystem, Path: "/path/to/key.pem"},
+				},
+			},
+			want: "🔐 Keyring (encrypted) [key-20240601-120000] +1 fallback",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := getKeySourceDisplay(tt.app)
+			got := getKeySourceDisplay(tt.app, "")
 			if got != tt.want {
 				t.Errorf("getKeySourceDisplay() = %q, want %q", got, tt.want)
 			}
@@ -80,33 +114,190 @@ func TestGetKeySourceDisplay(t *testing.T) {
 	}
 }
 
-func TestVerifyKeyAccess(t *testing.T) {
-	app := config.GitHubApp{
-		AppID:            123456,
-		PrivateKeySource: config.PrivateKeySourceKeyring,
+func TestGetKeySourceDisplay_ServedBackend(t *testing.T) {
+	// The backend that served the key wins over the configured source
+	app := config.GitHubApp{PrivateKeySource: config.PrivateKeySourceKeyring}
+	if got, want := getKeySourceDisplay(app, secrets.StorageBackendFilesystem), "🔒 Encrypted file"; got != want {
+		t.Errorf("getKeySourceDisplay() = %q, want %q", got, want)
+	}
+
+	multi := config.GitHubApp{
+		PrivateKeys: []config.PrivateKeyEntry{
+			{Label: "new", Source: "command"},
+			{Label: "old", Source: config.PrivateKeySourceKeyring},
+		},
+	}
+	if got, want := getKeySourceDisplay(multi, secrets.BackendTypeCommand), "🧰 Command [new] +1 fallback"; got != want {
+		t.Errorf("getKeySourceDisplay() = %q, want %q", got, want)
+	}
+
+	pat := config.PersonalAccessToken{TokenSource: config.PrivateKeySourceKeyring}
+	if got, want := getPATSourceDisplay(pat, secrets.BackendTypeEnv), "💲 Environment"; got != want {
+		t.Errorf("getPATSourceDisplay() = %q, want %q", got, want)
+	}
+
+	// References are shown as written in the config
+	ref := config.GitHubApp{PrivateKeyRef: "cmd:op read op://vault/app/key"}
+	got := getKeySourceDisplay(ref, secrets.BackendTypeCommand)
+	if want := "🔗 cmd:op read op://vault/app/key"; got != want {
+		t.Errorf("getKeySourceDisplay() = %q, want %q", got, want)
+	}
+	patRef := config.PersonalAccessToken{TokenRef: "env:CI_TOKEN"}
+	if got, want := getPATSourceDisplay(patRef, secrets.BackendTypeEnv), "🔗 env:CI_TOKEN"; got != want {
+		t.Errorf("getPATSourceDisplay() = %q, want %q", got, want)
 	}
+	if got, want := getBackendDisplay("vault"), "🏦 Vault"; got != want {
+		t.Errorf("getBackendDisplay() = %q, want %q", got, want)
+	}
+	if got, want := getBackendDisplay("custom"), "🔌 custom"; got != want {
+		t.Errorf("getBackendDisplay() = %q, want %q", got, want)
+	}
+}
 
-	t.Run("nil secrets manager", func(t *testing.T) {
-		got := verifyKeyAccess(app, nil)
-		want := "⚠️  Not checked"
-		if got != want {
-			t.Errorf("verifyKeyAccess() = %q, want %q", got, want)
+func TestInitializeSecretsManagerIfNeeded(t *testing.T) {
+	t.Run("not needed for json output", func(t *testing.T) {
+		mgr, err := initializeSecretsManagerIfNeeded("json")
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if mgr != nil {
+			t.Error("Expected nil manager for json output")
 		}
 	})
 
-	t.Run("key not found", func(t *testing.T) {
-		// Create a temporary secrets manager
-		tempDir := t.TempDir()
-		secretMgr := secrets.NewManager(tempDir)
-
-		got := verifyKeyAccess(app, secretMgr)
-		want := "❌ Not found"
-		if got != want {
-			t.Errorf("verifyKeyAccess() = %q, want %q", got, want)
+	t.Run("needed for table output", func(t *testing.T) {
+		mgr, err := initializeSecretsManagerIfNeeded("table")
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if mgr == nil {
+			t.Error("Expected non-nil manager for table output")
 		}
 	})
 }
 
+func TestOutputTable_FingerprintsWithoutVerifying(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	key := generateRotateTestKey(t)
+	fingerprint, err := jwt.Fingerprint(key)
+	if err != nil {
+		t.Fatalf("Fingerprint() error = %v", err)
+	}
+	app := config.GitHubApp{Name: "CI Bot", AppID: 42, Patterns: []string{"github.com/myorg/*"}}
+	if _, err := app.SetPrivateKey(secretMgr, key); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	missing := config.GitHubApp{
+		Name: "Gone", AppID: 43, Patterns: []string{"github.com/other/*"},
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		PrivateKeyPath:   filepath.Join(t.TempDir(), "missing.pem"),
+	}
+
+	// When apps are listed without --verify-keys
+	output := captureListStdout(t, func() error {
+		return outputTable([]config.GitHubApp{app, missing}, nil, nil, secretMgr, false)
+	})
+
+	// Then each loadable key is fingerprinted locally and GitHub is not asked
+	if !strings.Contains(output, "FINGERPRINT") || !strings.Contains(output, fingerprint) {
+		t.Errorf("output does not show the key fingerprint %s:\n%s", fingerprint, output)
+	}
+	if strings.Contains(output, "KEY STATUS") {
+		t.Errorf("output shows key status without --verify-keys:\n%s", output)
+	}
+}
+
+func TestOutputTable_ServedBackendWithoutVerifying(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+	t.Setenv("CI_PAT", "ghp_from_env")
+
+	// Given a PAT configured for the keyring first that is only found in the environment
+	pats := []config.PersonalAccessToken{{
+		Name: "ci-pat", Patterns: []string{"github.com/org/"},
+		SecretBackends: []secrets.BackendSpec{
+			{Type: secrets.BackendTypeKeyring},
+			{Type: secrets.BackendTypeEnv, Variable: "CI_PAT"},
+		},
+	}}
+
+	// When it is listed without --verify-keys
+	output := captureListStdout(t, func() error {
+		return outputTable(nil, pats, nil, secretMgr, false)
+	})
+
+	// Then the backend that served it is shown, not the first configured one
+	if !strings.Contains(output, getBackendDisplay(secrets.BackendTypeEnv)) {
+		t.Errorf("output does not name the env backend:\n%s", output)
+	}
+	if strings.Contains(output, "TOKEN STATUS") {
+		t.Errorf("output shows token status without --verify-keys:\n%s", output)
+	}
+}
+
+func TestLearnClientIDs(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+
+	app := config.GitHubApp{
+		Name: "CI Bot", AppID: 42, Patterns: []string{"github.com/myorg/*"},
+		PrivateKeySource: config.PrivateKeySourceFilesystem, PrivateKeyPath: "/path/to/key.pem",
+	}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{app}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// When list --verify-keys learns the client ID from /app
+	checks := [][]appKeyCheck{{{Label: "initial", Info: &appInfo{ID: 42, ClientID: "Iv23liCIBOT"}}}}
+	output := captureListStdout(t, func() error {
+		learnClientIDs(cfg.GitHubApps, checks)
+		return nil
+	})
+
+	// Then it is saved as the app's JWT issuer, like test does
+	if !strings.Contains(output, "Saved client ID Iv23liCIBOT") {
+		t.Errorf("output does not report the saved client ID:\n%s", output)
+	}
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	if saved.GitHubApps[0].ClientID != "Iv23liCIBOT" {
+		t.Errorf("ClientID = %q, want Iv23liCIBOT", saved.GitHubApps[0].ClientID)
+	}
+}
+
+// captureListStdout returns what fn prints to stdout
+func captureListStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	oldStdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+
+	fnErr := fn()
+	_ = w.Close()
+	output := string(<-done)
+	if fnErr != nil {
+		t.Fatalf("unexpected error: %v", fnErr)
+	}
+	return output
+}
+
 func TestOutputQuietMode(t *testing.T) {
 	apps := []config.GitHubApp{
 		{AppID: 123456},
@@ -119,7 +310,7 @@ func TestOutputQuietMode(t *testing.T) {
 
 	// This will output to stdout, which is okay for tests
 	// In a more sophisticated test, we'd capture stdout
-	err := outputQuietMode(apps, pats)
+	err := outputQuietMode(apps, pats, nil)
 	if err != nil {
 		t.Errorf("outputQuietMode() error = %v", err)
 	}
@@ -179,7 +370,7 @@ func TestHandleOutputFormat(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := handleOutputFormat(tt.format, apps, pats, nil, tt.verifyKeys)
+			err := handleOutputFormat(tt.format, apps, pats, nil, nil, tt.verifyKeys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("handleOutputFormat() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -205,7 +396,7 @@ func TestOutputJSON(t *testing.T) {
 	}
 
 	// Output to stdout - actual output tested in integration tests
-	err := outputJSON(apps, pats)
+	err := outputJSON(apps, pats, nil)
 	if err != nil {
 		t.Errorf("outputJSON() error = %v", err)
 	}
@@ -229,34 +420,12 @@ func TestOutputYAML(t *testing.T) {
 	}
 
 	// Output to stdout - actual output tested in integration tests
-	err := outputYAML(apps, pats)
+	err := outputYAML(apps, pats, nil)
 	if err != nil {
 		t.Errorf("outputYAML() error = %v", err)
 	}
 }
 
-func TestInitializeSecretsManagerIfNeeded(t *testing.T) {
-	t.Run("not needed when verifyKeys is false", func(t *testing.T) {
-		mgr, err := initializeSecretsManagerIfNeeded(false)
-		if err != nil {
-			t.Errorf("Unexpected error: %v", err)
-		}
-		if mgr != nil {
-			t.Error("Expected nil manager when verifyKeys is false")
-		}
-	})
-
-	t.Run("needed when verifyKeys is true", func(t *testing.T) {
-		mgr, err := initializeSecretsManagerIfNeeded(true)
-		if err != nil {
-			t.Errorf("Unexpected error: %v", err)
-		}
-		if mgr == nil {
-			t.Error("Expected non-nil manager when verifyKeys is true")
-		}
-	})
-}
-
 func TestLoadListConfiguration(t *testing.T) {
 	tempDir := t.TempDir()
 	configPath := filepath.Join(tempDir, "config.yml")
@@ -358,3 +527,119 @@ func TestLoadListConfiguration(t *testing.T) {
 		}
 	})
 }
+
+func TestCheckAppKeys(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	activeKey := generateRotateTestKey(t)
+	deletedKey := generateRotateTestKey(t)
+	deletedFingerprint, err := jwt.Fingerprint(deletedKey)
+	if err != nil {
+		t.Fatalf("Fingerprint() error = %v", err)
+	}
+
+	app := config.GitHubApp{Name: "CI Bot", AppID: 42, Patterns: []string{"github.com/myorg/*"}}
+	if _, err := app.AddPrivateKey(secretMgr, "old", deletedKey, time.Now()); err != nil {
+		t.Fatalf("AddPrivateKey() error = %v", err)
+	}
+	if _, err := app.AddPrivateKey(secretMgr, "new", activeKey, time.Now()); err != nil {
+		t.Fatalf("AddPrivateKey() error = %v", err)
+	}
+
+	// GitHub only accepts JWTs signed with the active key
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 || !verifyTestJWT(t, activeKey, parts) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 42, "slug": "ci-bot", "owner": {"login": "myorg"},
+			"permissions": {"metadata": "read", "contents": "write"}}`))
+	}))
+	defer server.Close()
+
+	// Without an API URL the keys are only fingerprinted
+	checks := checkAppKeys(context.Background(), app, secretMgr, "")
+	if len(checks) != 2 || checks[1].Fingerprint != deletedFingerprint || checks[0].Err != nil {
+		t.Fatalf("checkAppKeys() = %+v", checks)
+	}
+	if got := getKeyCheckDisplay(checks[0]); got != statusAccessible {
+		t.Errorf("unverified status = %q, want %q", got, statusAccessible)
+	}
+
+	checks = checkAppKeys(context.Background(), app, secretMgr, server.URL)
+	if checks[0].Label != "new" || checks[0].Err != nil || checks[0].Info == nil {
+		t.Fatalf("active key check = %+v", checks[0])
+	}
+	if got := getKeyCheckDisplay(checks[0]); got != "✅ ci-bot (myorg)" {
+		t.Errorf("active key status = %q", got)
+	}
+	if got := formatPermissions(checks[0].Info.Permissions); got != "contents:write, metadata:read" {
+		t.Errorf("formatPermissions() = %q", got)
+	}
+	if !errors.Is(checks[1].Err, errKeyRejected) || getKeyCheckDisplay(checks[1]) != statusRejected {
+		t.Errorf("deleted key check = %+v", checks[1])
+	}
+}
+
+// verifyTestJWT checks a JWT signature against the public half of a PEM key
+func verifyTestJWT(t *testing.T, keyPEM string, parts []string) bool {
+	t.Helper()
+	block, _ := pem.Decode([]byte(keyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature) == nil
+}
+
+func TestCheckAppKeys_EncryptedKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+	t.Setenv(auth.KeyAskpassEnv, "")
+
+	encrypted, err := os.ReadFile(filepath.Join("..", "pkg", "jwt", "testdata", "encrypted-pkcs8-aes256.pem"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	app := config.GitHubApp{Name: "CI Bot", AppID: 42, Patterns: []string{"github.com/myorg/*"}}
+	if _, err := app.SetPrivateKey(secretMgr, string(encrypted)); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": 42, "slug": "ci-bot", "owner": {"login": "myorg"}}`))
+	}))
+	defer server.Close()
+
+	// Listing never asks for the passphrase
+	t.Setenv(auth.KeyPassphraseEnv, "")
+	checks := checkAppKeys(context.Background(), app, secretMgr, "")
+	if len(checks) != 1 || checks[0].Fingerprint != fingerprintEncrypted || checks[0].Err != nil {
+		t.Fatalf("checkAppKeys() = %+v", checks)
+	}
+
+	t.Setenv(auth.KeyPassphraseEnv, "correct-horse")
+	checks = checkAppKeys(context.Background(), app, secretMgr, server.URL)
+	if len(checks) != 1 || checks[0].Err != nil || checks[0].Info == nil {
+		t.Fatalf("checkAppKeys() = %+v", checks)
+	}
+	if checks[0].Fingerprint != "SHA256:P7m0ybRV6bgbVsseklFgad6UxTdzifhI+z3VD4EoAYg=" {
+		t.Errorf("Fingerprint = %s", checks[0].Fingerprint)
+	}
+
+	t.Setenv(auth.KeyPassphraseEnv, "wrong")
+	checks = checkAppKeys(context.Background(), app, secretMgr, server.URL)
+	if !errors.Is(checks[0].Err, jwt.ErrIncorrectPassphrase) || getKeyCheckDisplay(checks[0]) != statusFailed {
+		t.Errorf("checkAppKeys() with wrong passphrase = %+v", checks)
+	}
+}
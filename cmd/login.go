@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+type loginOptions struct {
+	clientID         string
+	hostname         string
+	name             string
+	patterns         []string
+	priority         int
+	withClientSecret bool
+	noBrowser        bool
+}
+
+func NewLoginCmd() *cobra.Command {
+	opts := &loginOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Authorize a GitHub App to act on your behalf",
+		Long: `Obtain a GitHub App user-to-server token with the OAuth device flow.
+
+Operations made with a user token go through the app, with the app's permissions,
+but are attributed to you; use it for pushes that must show who made them.
+Device flow must be enabled in the app settings.
+
+A one-time code is printed; enter it on GitHub to authorize the app. The access
+and refresh tokens are stored in the OS keyring (with encrypted filesystem
+fallback) and the access token is refreshed automatically when it expires.
+User tokens take part in pattern matching like Personal Access Tokens: the
+highest priority wins over apps and PATs matching the same repository.
+
+If the app requires its client secret to refresh tokens, pass
+--with-client-secret and provide the secret on stdin.`,
+		Example: `  # Authorize an app for your pushes to myorg
+  gh app-auth login --app-client-id Iv1.0123456789abcdef --patterns github.com/myorg/
+
+  # GitHub Enterprise Server, with the client secret from a password manager
+  op read op://ci/app/client-secret | gh app-auth login --app-client-id Iv1.0123456789abcdef \
+    --hostname github.example.com --with-client-secret`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return loginRun(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.clientID, "app-client-id", "", "Client ID of the GitHub App")
+	cmd.Flags().StringVar(&opts.hostname, "hostname", gitHubAPIHost, "GitHub host")
+	cmd.Flags().StringVar(&opts.name, "name", "", "Friendly name for the user token (default: <login>@<client-id>)")
+	cmd.Flags().StringSliceVar(&opts.patterns, "patterns", nil, "Repository patterns to match (default: <hostname>/)")
+	cmd.Flags().IntVar(&opts.priority, "priority", 5, "Priority for pattern matching (higher = more priority)")
+	cmd.Flags().BoolVar(&opts.withClientSecret, "with-client-secret", false,
+		"Read the app's client secret from stdin, for apps that require it to refresh tokens")
+	cmd.Flags().BoolVar(&opts.noBrowser, "no-browser", false, "Print the URL instead of opening a browser")
+
+	_ = cmd.MarkFlagRequired("app-client-id")
+
+	return cmd
+}
+
+func NewLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout <name>",
+		Short: "Remove a GitHub App user token",
+		Long: `Remove a user token obtained with 'gh app-auth login' from the configuration
+and delete its access token, refresh token and client secret from secure storage.
+
+The authorization is not revoked on GitHub; revoke it from your GitHub settings
+under Applications > Authorized GitHub Apps.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return logoutRun(args[0])
+		},
+	}
+}
+
+func loginRun(ctx context.Context, opts *loginOptions) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var clientSecret string
+	if opts.withClientSecret {
+		var err error
+		if clientSecret, err = readSecretInput(os.Stdin, "Client secret"); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := config.LoadOrCreate()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return err
+	}
+
+	userToken := &config.AppUserToken{ClientID: opts.clientID, Priority: opts.priority, Patterns: opts.patterns}
+	if opts.hostname != gitHubAPIHost {
+		userToken.Host = opts.hostname
+	}
+	if len(userToken.Patterns) == 0 {
+		userToken.Patterns = []string{opts.hostname + "/"}
+	}
+
+	flow := auth.NewDeviceFlow(opts.clientID, opts.hostname)
+	token, err := authorizeDevice(ctx, flow, opts.noBrowser, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	login := ""
+	if info, err := fetchPATInfo(ctx, auth.APIBaseURL(opts.hostname), token.AccessToken); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not look up the authorized user: %v\n", err)
+	} else {
+		login = info.Login
+	}
+	userToken.Login = login
+	userToken.Name = opts.name
+	if userToken.Name == "" {
+		userToken.Name = defaultUserTokenName(login, opts.clientID)
+	}
+	if existing := cfg.FindUserToken(userToken.Name); existing != nil {
+		// Keep where the tokens are stored when logging in again
+		userToken.SecretBackends = existing.SecretBackends
+	}
+
+	if err := userToken.Validate(); err != nil {
+		return fmt.Errorf("invalid user token configuration: %w", err)
+	}
+	backend, err := storeUserToken(userToken, secretMgr, token, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	cfg.AddOrUpdateUserToken(userToken)
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Printf("✅ Logged in")
+	if login != "" {
+		fmt.Printf(" as %s", login)
+	}
+	fmt.Printf(" through app %s\n", opts.clientID)
+	fmt.Printf("   Name: %s\n", userToken.Name)
+	fmt.Printf("   Patterns: %v\n", userToken.Patterns)
+	fmt.Printf("   Priority: %d\n", userToken.Priority)
+	fmt.Printf("   Storage: %s\n", getBackendDisplay(backend))
+	fmt.Printf("   Login expires: %s\n", getUserTokenExpiryDisplay(*userToken))
+	return nil
+}
+
+// authorizeDevice runs the device flow, printing the code for the user on w
+func authorizeDevice(ctx context.Context, flow *auth.DeviceFlow, noBrowser bool, w io.Writer) (*auth.UserToken, error) {
+	code, err := flow.RequestCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = fmt.Fprintf(w, "! First copy your one-time code: %s\n", code.UserCode)
+	_, _ = fmt.Fprintf(w, "🌐 Open %s and enter the code to authorize the app\n", code.VerificationURI)
+	if !noBrowser {
+		if err := openBrowser(ctx, code.VerificationURI); err != nil {
+			_, _ = fmt.Fprintf(w, "⚠️  Could not open a browser: %v\n", err)
+		}
+	}
+
+	token, err := flow.PollToken(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("authorization failed: %w", err)
+	}
+	return token, nil
+}
+
+// storeUserToken stores the tokens, and the client secret when given, of a user token entry
+func storeUserToken(
+	userToken *config.AppUserToken, secretMgr *secrets.Manager, token *auth.UserToken, clientSecret string,
+) (secrets.StorageBackend, error) {
+	backend, err := userToken.SetTokens(
+		secretMgr, token.AccessToken, token.RefreshToken, token.ExpiresAt, token.RefreshTokenExpiresAt)
+	if err != nil {
+		return "", err
+	}
+	if clientSecret != "" {
+		if err := userToken.SetClientSecret(secretMgr, clientSecret); err != nil {
+			return "", err
+		}
+	}
+	return backend, nil
+}
+
+func logoutRun(name string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	userToken := cfg.FindUserToken(name)
+	if userToken == nil {
+		return fmt.Errorf("no user token configured with name %q", name)
+	}
+
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return err
+	}
+	if err := userToken.DeleteTokens(secretMgr); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to delete stored tokens: %v\n", err)
+	}
+
+	cfg.RemoveUserToken(name)
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Printf("✅ Logged out '%s'\n", name)
+	return nil
+}
+
+// defaultUserTokenName names a user token after the user and the app
+func defaultUserTokenName(login, clientID string) string {
+	if login == "" {
+		return clientID
+	}
+	return login + "@" + clientID
+}
+
+// getUserToken returns the access token of a user token entry, refreshing it first when it
+// expires within refreshWithin
+func getUserToken(ctx context.Context, userToken *config.AppUserToken, refreshWithin time.Duration) (string, error) {
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return "", err
+	}
+
+	flow := auth.NewDeviceFlow(userToken.ClientID, userToken.GitHubHost())
+	// The client secret is optional; most apps refresh device flow tokens without it
+	flow.ClientSecret, _ = userToken.GetClientSecret(secretMgr)
+
+	return resolveUserToken(ctx, userToken, secretMgr, flow, time.Now(), refreshWithin)
+}
+
+// resolveUserToken returns the stored access token, refreshing it first when it expires within
+// refreshWithin of now. The refreshed tokens replace the stored ones and their expiry is saved
+// to the config.
+func resolveUserToken(
+	ctx context.Context, userToken *config.AppUserToken, secretMgr *secrets.Manager,
+	flow *auth.DeviceFlow, now time.Time, refreshWithin time.Duration,
+) (string, error) {
+	if !userToken.ExpiresWithin(now, refreshWithin) {
+		token, err := userToken.GetAccessToken(secretMgr)
+		if err != nil {
+			return "", fmt.Errorf("failed to get user token '%s': %w", userToken.Name, err)
+		}
+		return token, nil
+	}
+
+	refreshToken, err := userToken.GetRefreshToken(secretMgr)
+	if err != nil {
+		return "", fmt.Errorf("user token '%s' expired and cannot be refreshed, run 'gh app-auth login' again: %w",
+			userToken.Name, err)
+	}
+
+	token, err := flow.Refresh(ctx, refreshToken)
+	if err != nil {
+		// Refresh tokens are single-use: another process may have refreshed first
+		latest, latestErr := userToken.GetRefreshToken(secretMgr)
+		if errors.Is(err, auth.ErrBadRefreshToken) && latestErr == nil && latest != refreshToken {
+			return userToken.GetAccessToken(secretMgr)
+		}
+		return "", fmt.Errorf("user token '%s' could not be refreshed, run 'gh app-auth login' again: %w",
+			userToken.Name, err)
+	}
+
+	if _, err := userToken.SetTokens(
+		secretMgr, token.AccessToken, token.RefreshToken, token.ExpiresAt, token.RefreshTokenExpiresAt,
+	); err != nil {
+		return "", err
+	}
+	if err := recordUserTokenExpiry(userToken); err != nil {
+		// The stored token is valid; it is refreshed again on next use if the expiry was lost
+		fmt.Fprintf(os.Stderr, "⚠️  Could not save user token expiry: %v\n", err)
+	}
+	return token.AccessToken, nil
+}
+
+// recordUserTokenExpiry saves the expiry and storage of a refreshed user token to the config
+func recordUserTokenExpiry(userToken *config.AppUserToken) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	entry := cfg.FindUserToken(userToken.Name)
+	if entry == nil {
+		return nil
+	}
+	entry.ExpiresAt = userToken.ExpiresAt
+	entry.RefreshTokenExpiresAt = userToken.RefreshTokenExpiresAt
+	entry.TokenSource = userToken.TokenSource
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	return nil
+}
+
+// getUserTokenExpiryDisplay shows when the user has to log in again: when the refresh token
+// expires, as access tokens are refreshed automatically
+func getUserTokenExpiryDisplay(userToken config.AppUserToken) string {
+	switch {
+	case userToken.RefreshTokenExpiresAt != nil:
+		return userToken.RefreshTokenExpiresAt.Format("2006-01-02")
+	case userToken.ExpiresAt != nil:
+		return userToken.ExpiresAt.Format("2006-01-02")
+	default:
+		return "never"
+	}
+}
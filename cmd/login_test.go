@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+// newFakeOAuthServer mocks GitHub's device flow endpoints. The device code is authorized on
+// the first poll; refresh calls go to onRefresh, which returns the JSON response.
+func newFakeOAuthServer(t *testing.T, onRefresh func(refreshToken string) map[string]any) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "dc_123",
+			"user_code":        "WDJB-MJHT",
+			"verification_uri": "https://github.com/login/device",
+			"expires_in":       900,
+			"interval":         0,
+		})
+	})
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") == "refresh_token" {
+			_ = json.NewEncoder(w).Encode(onRefresh(r.FormValue("refresh_token")))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(userTokenResponse("ghu_first", "ghr_first"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func userTokenResponse(accessToken, refreshToken string) map[string]any {
+	return map[string]any{
+		"access_token":             accessToken,
+		"expires_in":               28800,
+		"refresh_token":            refreshToken,
+		"refresh_token_expires_in": 15897600,
+	}
+}
+
+func TestAuthorizeDevice(t *testing.T) {
+	server := newFakeOAuthServer(t, nil)
+	flow := &auth.DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+
+	var out bytes.Buffer
+	token, err := authorizeDevice(context.Background(), flow, true, &out)
+	if err != nil {
+		t.Fatalf("authorizeDevice() failed: %v", err)
+	}
+	if token.AccessToken != "ghu_first" || token.RefreshToken != "ghr_first" {
+		t.Errorf("authorizeDevice() = %+v", token)
+	}
+	if !strings.Contains(out.String(), "WDJB-MJHT") || !strings.Contains(out.String(), "https://github.com/login/device") {
+		t.Errorf("Output does not show the code and URL:\n%s", out.String())
+	}
+}
+
+// setupUserTokenConfig saves a config holding userToken and stores its tokens
+func setupUserTokenConfig(
+	t *testing.T, userToken *config.AppUserToken, secretMgr *secrets.Manager, expiresAt time.Time,
+) {
+	t.Helper()
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+
+	if _, err := userToken.SetTokens(secretMgr, "ghu_stored", "ghr_stored", expiresAt, time.Time{}); err != nil {
+		t.Fatalf("SetTokens() failed: %v", err)
+	}
+	cfg := &config.Config{Version: "1.0", UserTokens: []config.AppUserToken{*userToken}}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+}
+
+func TestResolveUserToken(t *testing.T) {
+	now := time.Now()
+
+	t.Run("fresh token is not refreshed", func(t *testing.T) {
+		keyring.MockInit()
+		secretMgr := secrets.NewManager(t.TempDir())
+		var refreshes atomic.Int32
+		server := newFakeOAuthServer(t, func(string) map[string]any {
+			refreshes.Add(1)
+			return userTokenResponse("ghu_new", "ghr_new")
+		})
+
+		userToken := &config.AppUserToken{Name: "me", ClientID: "Iv1.test", Patterns: []string{"github.com/"}}
+		setupUserTokenConfig(t, userToken, secretMgr, now.Add(time.Hour))
+
+		flow := &auth.DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+		token, err := resolveUserToken(context.Background(), userToken, secretMgr, flow, now, config.UserTokenRefreshMargin)
+		if err != nil || token != "ghu_stored" {
+			t.Errorf("resolveUserToken() = %q, %v; want ghu_stored", token, err)
+		}
+		if refreshes.Load() != 0 {
+			t.Errorf("Refreshes = %d, want 0", refreshes.Load())
+		}
+	})
+
+	t.Run("expiring token is refreshed and saved", func(t *testing.T) {
+		keyring.MockInit()
+		secretMgr := secrets.NewManager(t.TempDir())
+		server := newFakeOAuthServer(t, func(refreshToken string) map[string]any {
+			if refreshToken != "ghr_stored" {
+				return map[string]any{"error": "bad_refresh_token"}
+			}
+			return userTokenResponse("ghu_new", "ghr_new")
+		})
+
+		// Given a token expiring within the refresh margin
+		userToken := &config.AppUserToken{Name: "me", ClientID: "Iv1.test", Patterns: []string{"github.com/"}}
+		setupUserTokenConfig(t, userToken, secretMgr, now.Add(time.Minute))
+
+		// When it is resolved
+		flow := &auth.DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+		token, err := resolveUserToken(context.Background(), userToken, secretMgr, flow, now, config.UserTokenRefreshMargin)
+
+		// Then the refreshed tokens are returned, stored and their expiry saved
+		if err != nil || token != "ghu_new" {
+			t.Fatalf("resolveUserToken() = %q, %v; want ghu_new", token, err)
+		}
+		if refreshToken, _ := userToken.GetRefreshToken(secretMgr); refreshToken != "ghr_new" {
+			t.Errorf("Stored refresh token = %q, want ghr_new", refreshToken)
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			t.Fatalf("Load() failed: %v", err)
+		}
+		saved := cfg.FindUserToken("me")
+		if saved == nil || saved.ExpiresAt == nil || time.Until(*saved.ExpiresAt) < 7*time.Hour {
+			t.Errorf("Saved ExpiresAt = %v, want about 8h from now", saved.ExpiresAt)
+		}
+		if saved.RefreshTokenExpiresAt == nil {
+			t.Error("Saved RefreshTokenExpiresAt is not set")
+		}
+	})
+
+	t.Run("token refreshed by another process", func(t *testing.T) {
+		keyring.MockInit()
+		secretMgr := secrets.NewManager(t.TempDir())
+		userToken := &config.AppUserToken{Name: "me", ClientID: "Iv1.test", Patterns: []string{"github.com/"}}
+
+		// The other process wins the race: the refresh token is used up when ours arrives
+		server := newFakeOAuthServer(t, func(string) map[string]any {
+			other := *userToken
+			if _, err := other.SetTokens(secretMgr, "ghu_other", "ghr_other", now.Add(8*time.Hour), time.Time{}); err != nil {
+				t.Errorf("SetTokens() failed: %v", err)
+			}
+			return map[string]any{"error": "bad_refresh_token"}
+		})
+		setupUserTokenConfig(t, userToken, secretMgr, now.Add(-time.Minute))
+
+		flow := &auth.DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+		token, err := resolveUserToken(context.Background(), userToken, secretMgr, flow, now, config.UserTokenRefreshMargin)
+		if err != nil || token != "ghu_other" {
+			t.Errorf("resolveUserToken() = %q, %v; want the other process's ghu_other", token, err)
+		}
+	})
+
+	t.Run("revoked refresh token asks to log in again", func(t *testing.T) {
+		keyring.MockInit()
+		secretMgr := secrets.NewManager(t.TempDir())
+		server := newFakeOAuthServer(t, func(string) map[string]any {
+			return map[string]any{"error": "bad_refresh_token"}
+		})
+
+		userToken := &config.AppUserToken{Name: "me", ClientID: "Iv1.test", Patterns: []string{"github.com/"}}
+		setupUserTokenConfig(t, userToken, secretMgr, now.Add(-time.Minute))
+
+		flow := &auth.DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+		_, err := resolveUserToken(context.Background(), userToken, secretMgr, flow, now, config.UserTokenRefreshMargin)
+		if err == nil || !strings.Contains(err.Error(), "gh app-auth login") {
+			t.Errorf("resolveUserToken() error = %v, want a hint to log in again", err)
+		}
+	})
+}
+
+func TestFindMatchingUserToken(t *testing.T) {
+	cfg := &config.Config{
+		UserTokens: []config.AppUserToken{
+			{Name: "org", ClientID: "Iv1.a", Patterns: []string{"github.com/myorg/"}, Priority: 10},
+			{Name: "org-high", ClientID: "Iv1.b", Patterns: []string{"github.com/myorg/"}, Priority: 30},
+			{Name: "other", ClientID: "Iv1.c", Patterns: []string{"github.com/other/"}, Priority: 50},
+		},
+	}
+	app := &config.GitHubApp{Name: "app", Priority: 20}
+	pat := &config.PersonalAccessToken{Name: "pat", Priority: 40}
+
+	tests := []struct {
+		name string
+		app  *config.GitHubApp
+		pat  *config.PersonalAccessToken
+		want string
+	}{
+		{name: "no other match", want: "org-high"},
+		{name: "beats lower priority app", app: app, want: "org-high"},
+		{name: "loses to higher priority PAT", pat: pat, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findMatchingUserToken(cfg, "https://github.com/myorg/repo", tt.app, tt.pat)
+			name := ""
+			if got != nil {
+				name = got.Name
+			}
+			if name != tt.want {
+				t.Errorf("findMatchingUserToken() = %q, want %q", name, tt.want)
+			}
+		})
+	}
+}
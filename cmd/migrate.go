@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/spf13/cobra"
 )
@@ -17,22 +20,30 @@ const (
 
 func NewMigrateCmd() *cobra.Command {
 	var (
-		dryRun  bool
-		storage string
-		force   bool
+		dryRun         bool
+		storage        string
+		force          bool
+		encryptSecrets bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "migrate",
-		Short: "Migrate private keys to encrypted storage",
+		Short: "Migrate private keys and PATs to encrypted storage",
 		Long: `Migrate private keys from filesystem to encrypted keyring storage.
 
 This command helps you move your private keys from plain text files to 
 the OS-native encrypted keyring (Keychain on macOS, Credential Manager 
 on Windows, Secret Service on Linux).
 
+Personal Access Tokens are moved too: to the keyring, or with
+--storage filesystem to the encrypted filesystem fallback. Tokens read
+from another source, such as the environment, are copied into the target.
+
 The migration is safe and non-destructive - original key files are kept
-as a fallback unless you specify --force.`,
+as a fallback unless you specify --force.
+
+With --encrypt-secrets, secrets that an older version stored as plaintext
+files in the filesystem fallback are encrypted in place instead.`,
 		Example: `  # Preview migration (dry-run)
   gh app-auth migrate --dry-run
   
@@ -43,19 +54,32 @@ as a fallback unless you specify --force.`,
   gh app-auth migrate --storage filesystem
   
   # Migrate and remove original key files
-  gh app-auth migrate --force`,
-		RunE: migrateRun(&dryRun, &storage, &force),
+  gh app-auth migrate --force
+
+  # Encrypt plaintext secrets in the filesystem fallback
+  gh app-auth migrate --encrypt-secrets`,
+		RunE: migrateRun(&dryRun, &storage, &force, &encryptSecrets),
 	}
 
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview migration without making changes")
 	cmd.Flags().StringVar(&storage, "storage", storageKeyring, "Target storage: keyring or filesystem")
 	cmd.Flags().BoolVar(&force, "force", false, "Remove original key files after successful migration")
+	cmd.Flags().BoolVar(&encryptSecrets, "encrypt-secrets", false,
+		"Encrypt plaintext secrets in the filesystem fallback")
 
 	return cmd
 }
 
-func migrateRun(dryRun *bool, storage *string, force *bool) func(*cobra.Command, []string) error {
+func migrateRun(dryRun *bool, storage *string, force *bool, encryptSecrets *bool) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, args []string) error {
+		if *encryptSecrets {
+			secretMgr, err := newDefaultSecretsManager()
+			if err != nil {
+				return err
+			}
+			return encryptFilesystemSecrets(secretMgr, *dryRun)
+		}
+
 		// Validate storage option
 		if err := validateStorageOption(*storage); err != nil {
 			return err
@@ -70,18 +94,25 @@ func migrateRun(dryRun *bool, storage *string, force *bool) func(*cobra.Command,
 			return nil // Nothing to migrate
 		}
 
-		// Analyze apps to migrate
+		// Analyze apps and PATs to migrate
 		appsToMigrate, appsUpToDate, appsNeedAttention := analyzeAppsForMigration(cfg.GitHubApps, *storage)
+		patsToMigrate := analyzePATsForMigration(cfg.PATs, *storage)
 
 		// Display migration summary and handle dry-run
 		if shouldExit := displayMigrationSummary(
 			cfg.GitHubApps, appsToMigrate, appsUpToDate, appsNeedAttention, *storage, *dryRun,
-		); shouldExit {
+		); shouldExit && len(patsToMigrate) == 0 {
+			return nil
+		}
+		if shouldExit := displayPATMigrationSummary(cfg.PATs, patsToMigrate, *storage, *dryRun); shouldExit {
 			return nil
 		}
 
 		// Perform migration
 		migrated, failed := performMigration(cfg, appsToMigrate, secretMgr, *storage, *force)
+		patsMigrated, patsFailed := performPATMigration(cfg, patsToMigrate, secretMgr, *storage)
+		migrated += patsMigrated
+		failed += patsFailed
 
 		// Save configuration if needed
 		if err := saveConfigurationIfNeeded(cfg, migrated); err != nil {
@@ -111,8 +142,8 @@ func initializeMigration(storage *string) (*config.Config, *secrets.Manager, err
 		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	if len(cfg.GitHubApps) == 0 {
-		fmt.Printf("No GitHub Apps configured. Nothing to migrate.\n")
+	if len(cfg.GitHubApps) == 0 && len(cfg.PATs) == 0 {
+		fmt.Printf("No GitHub Apps or PATs configured. Nothing to migrate.\n")
 		return nil, nil, nil
 	}
 
@@ -135,13 +166,52 @@ func initializeMigration(storage *string) (*config.Config, *secrets.Manager, err
 	return cfg, secretMgr, nil
 }
 
+// encryptFilesystemSecrets encrypts the plaintext secrets left in the filesystem fallback
+func encryptFilesystemSecrets(secretMgr *secrets.Manager, dryRun bool) error {
+	plaintext, err := secretMgr.PlaintextFilesystemSecrets()
+	if err != nil {
+		return err
+	}
+	if len(plaintext) == 0 {
+		fmt.Printf("✅ All filesystem secrets are already encrypted.\n")
+		return nil
+	}
+
+	fmt.Printf("🔓 Plaintext filesystem secrets: %d\n", len(plaintext))
+	for _, name := range plaintext {
+		fmt.Printf("  • %s\n", name)
+	}
+
+	if dryRun {
+		fmt.Printf("\n🔍 Dry-run mode: No changes will be made.\n")
+		return nil
+	}
+
+	encrypted, err := secretMgr.EncryptFilesystemSecrets()
+	fmt.Printf("\n🔒 Encrypted: %d\n", len(encrypted))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt filesystem secrets: %w", err)
+	}
+	return nil
+}
+
 // analyzeAppsForMigration categorizes apps based on their migration needs
 func analyzeAppsForMigration(apps []config.GitHubApp, targetStorage string) (
 	toMigrate, upToDate, needAttention []config.GitHubApp,
 ) {
 	for _, app := range apps {
 		// Check current state
-		if app.PrivateKeySource == "" {
+		if app.Signer != nil || app.PrivateKeyRef != "" {
+			// Key is held by the external signer or resolved from its reference
+			upToDate = append(upToDate, app)
+		} else if len(app.PrivateKeys) > 0 {
+			// Rotated apps migrate every key entry, not only the active one
+			if app.PrivateKeysIn(config.PrivateKeySource(targetStorage)) {
+				upToDate = append(upToDate, app)
+			} else {
+				toMigrate = append(toMigrate, app)
+			}
+		} else if app.PrivateKeySource == "" {
 			// Legacy config
 			toMigrate = append(toMigrate, app)
 		} else if targetStorage == storageKeyring && app.PrivateKeySource != config.PrivateKeySourceKeyring {
@@ -161,6 +231,27 @@ func analyzeAppsForMigration(apps []config.GitHubApp, targetStorage string) (
 	return toMigrate, upToDate, needAttention
 }
 
+// analyzePATsForMigration selects the PATs not yet kept in the target storage. PATs with a
+// token_ref or their own secret_backends are managed there and left alone.
+func analyzePATsForMigration(pats []config.PersonalAccessToken, targetStorage string) []config.PersonalAccessToken {
+	var toMigrate []config.PersonalAccessToken
+	for _, pat := range pats {
+		if pat.TokenRef != "" || len(pat.SecretBackends) > 0 {
+			continue
+		}
+
+		source := pat.TokenSource
+		if source == "" {
+			// Empty defaults to keyring
+			source = config.PrivateKeySourceKeyring
+		}
+		if string(source) != targetStorage {
+			toMigrate = append(toMigrate, pat)
+		}
+	}
+	return toMigrate
+}
+
 // displayMigrationSummary shows migration summary and handles dry-run mode
 // Returns true if the function should exit early
 func displayMigrationSummary(
@@ -246,6 +337,16 @@ func performMigration(
 
 		fmt.Printf("  Migrating '%s' (ID: %d)...\n", app.Name, app.AppID)
 
+		if len(app.PrivateKeys) > 0 {
+			if err := migrateKeyEntries(app, secretMgr, storage, force); err != nil {
+				fmt.Printf("    ❌ %v\n", err)
+				failed++
+				continue
+			}
+			migrated++
+			continue
+		}
+
 		// Get current private key
 		privateKey, err := app.GetPrivateKey(secretMgr)
 		if err != nil {
@@ -254,6 +355,16 @@ func performMigration(
 			continue
 		}
 
+		// Encrypted keys are migrated as they are, once the passphrase is known to open them
+		if jwt.IsEncryptedKey(privateKey) {
+			if _, err := auth.DecryptPrivateKey(app, secretMgr, privateKey); err != nil {
+				fmt.Printf("    ❌ Failed to decrypt current key: %v\n", err)
+				failed++
+				continue
+			}
+			fmt.Printf("    🔒 Key is encrypted and stays encrypted in storage\n")
+		}
+
 		// Migrate based on target storage
 		if err := migrateAppToStorage(app, secretMgr, privateKey, storage, force); err != nil {
 			fmt.Printf("    ❌ %v\n", err)
@@ -267,6 +378,83 @@ func performMigration(
 	return migrated, failed
 }
 
+// displayPATMigrationSummary lists the PATs to migrate and handles dry-run mode.
+// Returns true if the function should exit early
+func displayPATMigrationSummary(
+	allPATs, patsToMigrate []config.PersonalAccessToken, storage string, dryRun bool,
+) bool {
+	if len(allPATs) == 0 {
+		return false
+	}
+
+	fmt.Printf("Total PATs: %d\n", len(allPATs))
+	fmt.Printf("  • Need migration: %d\n\n", len(patsToMigrate))
+
+	if len(patsToMigrate) > 0 {
+		fmt.Printf("🔄 PATs to migrate:\n")
+		for _, pat := range patsToMigrate {
+			currentSource := string(pat.TokenSource)
+			if currentSource == "" {
+				currentSource = storageKeyring
+			}
+			fmt.Printf("  • %s\n", pat.Name)
+			fmt.Printf("    From: %s → To: %s\n", currentSource, storage)
+		}
+		fmt.Printf("\n")
+	}
+
+	if dryRun {
+		fmt.Printf("🔍 Dry-run mode: No PAT changes will be made.\n")
+		return true
+	}
+	return false
+}
+
+// performPATMigration moves the selected PATs to the target storage
+func performPATMigration(
+	cfg *config.Config, patsToMigrate []config.PersonalAccessToken, secretMgr *secrets.Manager, storage string,
+) (int, int) {
+	migrated := 0
+	failed := 0
+
+	for i := range cfg.PATs {
+		pat := &cfg.PATs[i]
+		if !slices.ContainsFunc(patsToMigrate, func(p config.PersonalAccessToken) bool { return p.Name == pat.Name }) {
+			continue
+		}
+
+		fmt.Printf("  Migrating PAT '%s'...\n", pat.Name)
+		if err := migratePAT(pat, secretMgr, storage); err != nil {
+			fmt.Printf("    ❌ %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf("    ✅ Migrated to %s storage\n", storage)
+		migrated++
+	}
+
+	return migrated, failed
+}
+
+// migratePAT moves a PAT into the keyring or the encrypted filesystem fallback
+func migratePAT(pat *config.PersonalAccessToken, secretMgr *secrets.Manager, storage string) error {
+	token, err := pat.GetPAT(secretMgr)
+	if err != nil {
+		return err
+	}
+
+	target, source := secrets.StorageBackendKeyring, config.PrivateKeySourceKeyring
+	if storage == storageFilesystem {
+		target, source = secrets.StorageBackendFilesystem, config.PrivateKeySourceFilesystem
+	}
+	if err := secretMgr.StoreIn(target, pat.Name, secrets.SecretTypePAT, token); err != nil {
+		return err
+	}
+
+	pat.TokenSource = source
+	return nil
+}
+
 // needsMigration checks if an app needs migration
 func needsMigration(app *config.GitHubApp, appsToMigrate []config.GitHubApp) bool {
 	for _, migApp := range appsToMigrate {
@@ -305,6 +493,35 @@ func migrateToKeyring(app *config.GitHubApp, secretMgr *secrets.Manager, private
 	return nil
 }
 
+// migrateKeyEntries moves every key entry of a rotated app to the target storage: to the
+// keyring, or to the encrypted filesystem fallback. Key files copied into the keyring are
+// kept unless force is set.
+func migrateKeyEntries(app *config.GitHubApp, secretMgr *secrets.Manager, storage string, force bool) error {
+	target := secrets.StorageBackendKeyring
+	if storage == storageFilesystem {
+		target = secrets.StorageBackendFilesystem
+	}
+	files, err := app.MovePrivateKeys(secretMgr, target)
+	if err != nil {
+		return fmt.Errorf("failed to migrate keys: %w", err)
+	}
+
+	fmt.Printf("    ✅ Migrated %d key%s to %s storage\n",
+		len(app.PrivateKeys), pluralSuffix(len(app.PrivateKeys), "", "s"), storage)
+	for _, file := range files {
+		if !force {
+			fmt.Printf("    📝 Key file no longer used, kept: %s\n", file)
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			fmt.Printf("    ⚠️  Warning: Failed to remove key file %s: %v\n", file, err)
+		} else {
+			fmt.Printf("    🗑️  Removed key file %s\n", file)
+		}
+	}
+	return nil
+}
+
 // migrateToFilesystem migrates an app to filesystem storage
 func migrateToFilesystem(app *config.GitHubApp) error {
 	app.PrivateKeySource = config.PrivateKeySourceFilesystem
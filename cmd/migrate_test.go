@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
 )
 
 func TestValidateStorageOption(t *testing.T) {
@@ -133,6 +138,16 @@ func TestAnalyzeAppsForMigration(t *testing.T) {
 			wantUpToDateCount:      0,
 			wantNeedAttentionCount: 0,
 		},
+		{
+			name: "external signer has no key to migrate",
+			apps: []config.GitHubApp{
+				{Name: "App1", Signer: &config.SignerConfig{Type: config.SignerTypeExec, Command: "sign"}},
+			},
+			targetStorage:          "keyring",
+			wantToMigrateCount:     0,
+			wantUpToDateCount:      1,
+			wantNeedAttentionCount: 0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -240,6 +255,61 @@ func TestMigrateToFilesystem(t *testing.T) {
 	}
 }
 
+func TestMigrateKeyEntries(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	// Given a rotated app: its active key in the filesystem fallback, its old key in a file
+	keyFile := filepath.Join(t.TempDir(), "old.pem")
+	if err := os.WriteFile(keyFile, []byte("old-key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	app := &config.GitHubApp{
+		Name:             "rotated",
+		AppID:            1,
+		PrivateKeySource: config.PrivateKeySourceFilesystem,
+		PrivateKeys: []config.PrivateKeyEntry{
+			{Label: "new", Source: config.PrivateKeySourceFilesystem},
+			{Label: "initial", Source: config.PrivateKeySourceFilesystem, Path: keyFile},
+		},
+	}
+	if err := secretMgr.StoreIn(secrets.StorageBackendFilesystem, "rotated#new",
+		secrets.SecretTypePrivateKey, "new-key"); err != nil {
+		t.Fatalf("StoreIn() error = %v", err)
+	}
+	toMigrate, _, _ := analyzeAppsForMigration([]config.GitHubApp{*app}, storageKeyring)
+	if len(toMigrate) != 1 {
+		t.Fatalf("analyzeAppsForMigration() to migrate = %d, want 1", len(toMigrate))
+	}
+
+	// When it is migrated to the keyring
+	if err := migrateKeyEntries(app, secretMgr, storageKeyring, false); err != nil {
+		t.Fatalf("migrateKeyEntries() error = %v", err)
+	}
+
+	// Then every key entry is in the keyring, and read from there
+	for _, entry := range app.PrivateKeys {
+		if entry.Source != config.PrivateKeySourceKeyring || entry.Path != "" {
+			t.Errorf("entry %+v, want keyring", entry)
+		}
+	}
+	if app.PrivateKeySource != config.PrivateKeySourceKeyring {
+		t.Errorf("PrivateKeySource = %v, want keyring", app.PrivateKeySource)
+	}
+	for label, want := range map[string]string{"new": "new-key", "initial": "old-key"} {
+		if got, err := keyring.Get("gh-app-auth:rotated#"+label, "private_key"); err != nil || got != want {
+			t.Errorf("keyring %s = %q, %v; want %q", label, got, err, want)
+		}
+	}
+	if _, upToDate, _ := analyzeAppsForMigration([]config.GitHubApp{*app}, storageKeyring); len(upToDate) != 1 {
+		t.Error("analyzeAppsForMigration() should find the migrated app up to date")
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Errorf("Key file removed without --force: %v", err)
+	}
+}
+
 func TestHandleOriginalKeyFile(t *testing.T) {
 	t.Run("force false", func(t *testing.T) {
 		app := &config.GitHubApp{
@@ -307,3 +377,115 @@ func TestDisplayMigrationResults(t *testing.T) {
 		})
 	}
 }
+
+func TestEncryptFilesystemSecrets(t *testing.T) {
+	t.Setenv(secrets.MasterKeyEnv, "")
+	t.Setenv(secrets.SecretsPassphraseEnv, "")
+
+	tempDir := t.TempDir()
+	secretMgr := secrets.NewManager(tempDir)
+
+	// A plaintext PAT left by an older version
+	path := filepath.Join(tempDir, "secrets", "my-pat.pat")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("ghp_plaintext"), 0400); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Dry-run leaves the file alone
+	if err := encryptFilesystemSecrets(secretMgr, true); err != nil {
+		t.Fatalf("encryptFilesystemSecrets(dry-run) failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "ghp_plaintext" {
+		t.Fatalf("Dry-run modified the secret file")
+	}
+
+	if err := encryptFilesystemSecrets(secretMgr, false); err != nil {
+		t.Fatalf("encryptFilesystemSecrets() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) == "ghp_plaintext" {
+		t.Error("Secret file is still plaintext")
+	}
+	if remaining, err := secretMgr.PlaintextFilesystemSecrets(); err != nil || len(remaining) != 0 {
+		t.Errorf("PlaintextFilesystemSecrets() = %v, %v; want none", remaining, err)
+	}
+}
+
+func TestAnalyzePATsForMigration(t *testing.T) {
+	pats := []config.PersonalAccessToken{
+		{Name: "default"},
+		{Name: "keyring", TokenSource: config.PrivateKeySourceKeyring},
+		{Name: "filesystem", TokenSource: config.PrivateKeySourceFilesystem},
+		{Name: "env", TokenSource: "env"},
+		{Name: "ref", TokenRef: "env:TOKEN"},
+		{Name: "backends", SecretBackends: []secrets.BackendSpec{{Type: secrets.BackendTypeEnv}}},
+	}
+
+	names := func(pats []config.PersonalAccessToken) []string {
+		var names []string
+		for _, pat := range pats {
+			names = append(names, pat.Name)
+		}
+		return names
+	}
+
+	if got := names(analyzePATsForMigration(pats, storageKeyring)); !slices.Equal(got, []string{"filesystem", "env"}) {
+		t.Errorf("analyzePATsForMigration(keyring) = %v", got)
+	}
+	got := names(analyzePATsForMigration(pats, storageFilesystem))
+	if !slices.Equal(got, []string{"default", "keyring", "env"}) {
+		t.Errorf("analyzePATsForMigration(filesystem) = %v", got)
+	}
+}
+
+func TestMigratePAT(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv(secrets.MasterKeyEnv, "")
+	t.Setenv(secrets.SecretsPassphraseEnv, "")
+
+	tempDir := t.TempDir()
+	secretMgr := secrets.NewManager(tempDir)
+	pat := &config.PersonalAccessToken{Name: "moving-pat", Patterns: []string{"github.com/"}}
+	if _, err := pat.SetPAT(secretMgr, "ghp_move"); err != nil {
+		t.Fatalf("SetPAT() failed: %v", err)
+	}
+
+	// Keyring to filesystem
+	if err := migratePAT(pat, secretMgr, storageFilesystem); err != nil {
+		t.Fatalf("migratePAT(filesystem) failed: %v", err)
+	}
+	if pat.TokenSource != config.PrivateKeySourceFilesystem {
+		t.Errorf("TokenSource = %v, want filesystem", pat.TokenSource)
+	}
+	if _, err := keyring.Get("gh-app-auth:moving-pat", string(secrets.SecretTypePAT)); err == nil {
+		t.Error("Keyring copy not removed")
+	}
+	if token, served, err := pat.LocatePAT(secretMgr); err != nil || token != "ghp_move" ||
+		served != secrets.StorageBackendFilesystem {
+		t.Errorf("LocatePAT() = %q, %v, %v; want token from encrypted file", token, served, err)
+	}
+
+	// And back to the keyring
+	if err := migratePAT(pat, secretMgr, storageKeyring); err != nil {
+		t.Fatalf("migratePAT(keyring) failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "secrets", "moving-pat.pat")); !os.IsNotExist(err) {
+		t.Errorf("Filesystem copy not removed: %v", err)
+	}
+	if token, served, err := pat.LocatePAT(secretMgr); err != nil || token != "ghp_move" ||
+		served != secrets.StorageBackendKeyring {
+		t.Errorf("LocatePAT() = %q, %v, %v; want token from keyring", token, served, err)
+	}
+
+	// A token from the environment is copied into the target
+	envPAT := &config.PersonalAccessToken{Name: "env-pat", TokenSource: "env"}
+	t.Setenv("GH_APP_AUTH_ENV_PAT_PAT", "ghp_env")
+	if err := migratePAT(envPAT, secretMgr, storageKeyring); err != nil {
+		t.Fatalf("migratePAT(env) failed: %v", err)
+	}
+	if value, _ := keyring.Get("gh-app-auth:env-pat", string(secrets.SecretTypePAT)); value != "ghp_env" {
+		t.Errorf("Keyring value = %q, want ghp_env", value)
+	}
+}
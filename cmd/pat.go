@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	ghauth "github.com/cli/go-gh/v2/pkg/auth"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// errTokenRejected is returned when GitHub does not accept a PAT
+var errTokenRejected = errors.New("token rejected by GitHub")
+
+// patExpirationLayouts are the formats of the github-authentication-token-expiration header
+var patExpirationLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700",
+	time.RFC3339,
+}
+
+// patInfo is what GET /user reports about a PAT
+type patInfo struct {
+	Login     string
+	ExpiresAt *time.Time
+	Scopes    []string
+}
+
+func NewPATCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pat",
+		Short: "Manage Personal Access Tokens",
+		Long: `Manage the Personal Access Tokens configured with 'gh app-auth setup --pat'.
+
+The token's login, expiry and OAuth scopes are recorded when it is set up or
+rotated. 'gh app-auth list' shows the days left, and git operations warn when
+a token expires within a week.`,
+	}
+
+	cmd.AddCommand(newPATRotateCmd())
+
+	return cmd
+}
+
+func newPATRotateCmd() *cobra.Command {
+	var (
+		token    string
+		noVerify bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rotate <name>",
+		Short: "Replace the token of a configured PAT",
+		Long: `Replace the stored token of a configured PAT and refresh its metadata.
+
+On GitHub hosts (github.com, GHE.com and the hosts gh is logged in to) the new
+token is checked against the /user endpoint of the host's API before it is
+stored: a token rejected with 401 is not stored. Other hosts, such as Bitbucket,
+or --no-verify get the token stored unchecked, without login, expiry or scopes.
+
+Without --token the new token is read from stdin, or prompted for on a terminal.`,
+		Example: `  # Paste the new token at the prompt
+  gh app-auth pat rotate "My PAT"
+
+  # Read it from a password manager
+  op read op://ci/github/token | gh app-auth pat rotate ci-pat`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return patRotateRun(cmd.Context(), args[0], token, noVerify)
+		},
+	}
+
+	cmd.Flags().StringVar(&token, "token", "", "New token (default: read from stdin)")
+	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Store the token without checking it with GitHub")
+
+	return cmd
+}
+
+func patRotateRun(ctx context.Context, name, token string, noVerify bool) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	pat := cfg.FindPAT(name)
+	if pat == nil {
+		return fmt.Errorf("no PAT configured with name %q", name)
+	}
+
+	if token == "" {
+		if token, err = readSecretInput(os.Stdin, "New token"); err != nil {
+			return err
+		}
+	}
+
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return err
+	}
+
+	apiBaseURL := patVerifyURL(extractHostFromPattern(pat.Patterns[0]), noVerify)
+	backend, err := storeVerifiedPAT(ctx, pat, secretMgr, apiBaseURL, token)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	fmt.Printf("✅ Rotated PAT '%s'\n", pat.Name)
+	fmt.Printf("   Storage: %s\n", getBackendDisplay(backend))
+	printPATInfo(pat)
+	return nil
+}
+
+// patVerifyURL returns the API base URL to check a PAT for host against, or empty when
+// it is not checked: with noVerify, or when host is not known to be GitHub
+func patVerifyURL(host string, noVerify bool) string {
+	if noVerify || !isGitHubHost(host) {
+		return ""
+	}
+	return auth.APIBaseURL(host)
+}
+
+// isGitHubHost reports whether host is github.com, a GHE.com tenancy or a host gh is
+// logged in to, such as a GitHub Enterprise Server
+func isGitHubHost(host string) bool {
+	if host == "" || !ghauth.IsEnterprise(host) {
+		return true
+	}
+	for _, known := range ghauth.KnownHosts() {
+		if strings.EqualFold(known, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeVerifiedPAT checks a token with GitHub, stores it and records its metadata.
+// A token GitHub rejects is not stored; when GitHub cannot be asked, stale metadata is cleared.
+// An empty apiBaseURL stores the token unchecked.
+func storeVerifiedPAT(
+	ctx context.Context, pat *config.PersonalAccessToken, secretMgr *secrets.Manager, apiBaseURL, token string,
+) (secrets.StorageBackend, error) {
+	var info *patInfo
+	if apiBaseURL != "" {
+		var err error
+		info, err = fetchPATInfo(ctx, apiBaseURL, token)
+		if errors.Is(err, errTokenRejected) {
+			return "", fmt.Errorf("token verification failed: %w", err)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Could not read token details from GitHub: %v\n", err)
+		}
+	}
+
+	backend, err := pat.SetPAT(secretMgr, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to store PAT: %w", err)
+	}
+	recordPATInfo(pat, info)
+	return backend, nil
+}
+
+// readSecretInput reads a secret such as a token from stdin, prompting for it without echo
+// on a terminal. what names the secret in the prompt and errors.
+func readSecretInput(stdin *os.File, what string) (string, error) {
+	if term.IsTerminal(int(stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s: ", what)
+		data, err := term.ReadPassword(int(stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(what), err)
+		}
+		return validSecretInput(string(data), what)
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read %s from stdin: %w", strings.ToLower(what), err)
+	}
+	return validSecretInput(line, what)
+}
+
+func validSecretInput(value, what string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("no %s provided", strings.ToLower(what))
+	}
+	return value, nil
+}
+
+// fetchPATInfo calls GET /user with the token and reads its login, expiry and scopes
+func fetchPATInfo(ctx context.Context, apiBaseURL, token string) (*patInfo, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, apiBaseURL+"/user", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call GitHub API: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%w (status 401): %s", errTokenRejected, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	info := &patInfo{Login: user.Login, Scopes: parseOAuthScopes(resp.Header.Get("X-OAuth-Scopes"))}
+	if expiration := resp.Header.Get("github-authentication-token-expiration"); expiration != "" {
+		expiresAt, err := parseTokenExpiration(expiration)
+		if err != nil {
+			return nil, err
+		}
+		info.ExpiresAt = &expiresAt
+	}
+	return info, nil
+}
+
+// parseTokenExpiration parses the github-authentication-token-expiration header, e.g.
+// "2024-06-30 12:00:00 UTC"
+func parseTokenExpiration(value string) (time.Time, error) {
+	for _, layout := range patExpirationLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid token expiration %q", value)
+}
+
+// parseOAuthScopes splits the X-OAuth-Scopes header; fine-grained tokens have none
+func parseOAuthScopes(value string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// recordPATInfo saves the token metadata on the PAT entry; nil clears it
+func recordPATInfo(pat *config.PersonalAccessToken, info *patInfo) {
+	if info == nil {
+		info = &patInfo{}
+	}
+	pat.Login = info.Login
+	pat.ExpiresAt = info.ExpiresAt
+	pat.Scopes = info.Scopes
+}
+
+// printPATInfo shows the recorded token metadata
+func printPATInfo(pat *config.PersonalAccessToken) {
+	if pat.Login != "" {
+		fmt.Printf("   Login: %s\n", pat.Login)
+	}
+	if pat.ExpiresAt != nil {
+		fmt.Printf("   Expires: %s (%s)\n", pat.ExpiresAt.Format("2006-01-02"), getPATExpiryDisplay(*pat, time.Now()))
+	}
+	if len(pat.Scopes) > 0 {
+		fmt.Printf("   Scopes: %s\n", strings.Join(pat.Scopes, ", "))
+	}
+}
+
+// getPATExpiryDisplay returns the days left before a PAT expires
+func getPATExpiryDisplay(pat config.PersonalAccessToken, now time.Time) string {
+	days, ok := pat.DaysLeft(now)
+	left := fmt.Sprintf("%d days", days)
+	if days == 1 {
+		left = "1 day"
+	}
+
+	switch {
+	case !ok:
+		return "-"
+	case days < 0:
+		return "❌ expired"
+	case days == 0:
+		return "⚠️  today"
+	case pat.ExpiresWithin(now, config.PATExpiryWarning):
+		return "⚠️  " + left
+	default:
+		return left
+	}
+}
+
+// warnPATExpiry warns on w when a PAT expires within a week or has expired
+func warnPATExpiry(w io.Writer, pat *config.PersonalAccessToken, now time.Time) {
+	if !pat.ExpiresWithin(now, config.PATExpiryWarning) {
+		return
+	}
+	days, _ := pat.DaysLeft(now)
+	when := fmt.Sprintf("expires in %d days", days)
+	switch {
+	case days < 0:
+		when = "has expired"
+	case days == 0:
+		when = "expires today"
+	case days == 1:
+		when = "expires tomorrow"
+	}
+	_, _ = fmt.Fprintf(w, "gh-app-auth: warning: PAT '%s' %s (%s); rotate it with: gh app-auth pat rotate %q\n",
+		pat.Name, when, pat.ExpiresAt.Format("2006-01-02"), pat.Name)
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+// newFakeUserAPI serves GET /user for the token "ghp_good" and rejects any other token
+func newFakeUserAPI(t *testing.T, expiration string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer ghp_good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+		if expiration != "" {
+			w.Header().Set("github-authentication-token-expiration", expiration)
+		}
+		w.Header().Set("X-OAuth-Scopes", "repo, read:org")
+		_, _ = w.Write([]byte(`{"login":"octocat"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchPATInfo(t *testing.T) {
+	server := newFakeUserAPI(t, "2030-06-30 12:00:00 UTC")
+
+	info, err := fetchPATInfo(context.Background(), server.URL, "ghp_good")
+	if err != nil {
+		t.Fatalf("fetchPATInfo() failed: %v", err)
+	}
+	if info.Login != "octocat" {
+		t.Errorf("Login = %q, want octocat", info.Login)
+	}
+	if want := time.Date(2030, 6, 30, 12, 0, 0, 0, time.UTC); info.ExpiresAt == nil || !info.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", info.ExpiresAt, want)
+	}
+	if !slices.Equal(info.Scopes, []string{"repo", "read:org"}) {
+		t.Errorf("Scopes = %v", info.Scopes)
+	}
+
+	if _, err := fetchPATInfo(context.Background(), server.URL, "ghp_bad"); !errors.Is(err, errTokenRejected) {
+		t.Errorf("fetchPATInfo() error = %v, want %v", err, errTokenRejected)
+	}
+}
+
+func TestParseTokenExpiration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-06-30 12:00:00 UTC", want: time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)},
+		{value: "2024-06-30 00:00:00 -0800", want: time.Date(2024, 6, 30, 8, 0, 0, 0, time.UTC)},
+		{value: "2024-06-30T12:00:00Z", want: time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)},
+		{value: "next week", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTokenExpiration(tt.value)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseTokenExpiration(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestStoreVerifiedPAT(t *testing.T) {
+	keyring.MockInit()
+	secretMgr := secrets.NewManager(t.TempDir())
+	server := newFakeUserAPI(t, "")
+
+	expires := time.Now().Add(24 * time.Hour)
+	pat := &config.PersonalAccessToken{
+		Name:      "rotating-pat",
+		Patterns:  []string{"github.com/"},
+		Login:     "old-login",
+		ExpiresAt: &expires,
+	}
+	if _, err := pat.SetPAT(secretMgr, "ghp_old"); err != nil {
+		t.Fatalf("SetPAT() failed: %v", err)
+	}
+
+	// A token GitHub rejects is not stored
+	_, err := storeVerifiedPAT(context.Background(), pat, secretMgr, server.URL, "ghp_bad")
+	if !errors.Is(err, errTokenRejected) {
+		t.Fatalf("storeVerifiedPAT() error = %v, want %v", err, errTokenRejected)
+	}
+	if token, _ := pat.GetPAT(secretMgr); token != "ghp_old" {
+		t.Errorf("Token after rejected rotation = %q, want ghp_old", token)
+	}
+
+	// An accepted token replaces the secret and its metadata
+	backend, err := storeVerifiedPAT(context.Background(), pat, secretMgr, server.URL, "ghp_good")
+	if err != nil {
+		t.Fatalf("storeVerifiedPAT() failed: %v", err)
+	}
+	if backend != secrets.StorageBackendKeyring {
+		t.Errorf("Backend = %v, want keyring", backend)
+	}
+	if token, _ := pat.GetPAT(secretMgr); token != "ghp_good" {
+		t.Errorf("Token after rotation = %q, want ghp_good", token)
+	}
+	if pat.Login != "octocat" || pat.ExpiresAt != nil || len(pat.Scopes) != 2 {
+		t.Errorf("Metadata = %q, %v, %v; want octocat without expiry", pat.Login, pat.ExpiresAt, pat.Scopes)
+	}
+
+	// Without an API URL the token is stored unchecked, its stale metadata cleared
+	if _, err := storeVerifiedPAT(context.Background(), pat, secretMgr, "", "ghp_bad"); err != nil {
+		t.Fatalf("storeVerifiedPAT() without verification failed: %v", err)
+	}
+	if token, _ := pat.GetPAT(secretMgr); token != "ghp_bad" {
+		t.Errorf("Token stored unchecked = %q, want ghp_bad", token)
+	}
+	if pat.Login != "" || len(pat.Scopes) != 0 {
+		t.Errorf("Metadata = %q, %v; want none", pat.Login, pat.Scopes)
+	}
+}
+
+func TestPATVerifyURL(t *testing.T) {
+	t.Setenv("GH_HOST", "ghes.example.com")
+
+	tests := []struct {
+		name     string
+		host     string
+		noVerify bool
+		want     string
+	}{
+		{name: "github.com", host: "github.com", want: "https://api.github.com"},
+		{name: "host gh knows", host: "ghes.example.com", want: "https://ghes.example.com/api/v3"},
+		{name: "other host", host: "bitbucket.example.com", want: ""},
+		{name: "no verify", host: "github.com", noVerify: true, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := patVerifyURL(tt.host, tt.noVerify); got != tt.want {
+				t.Errorf("patVerifyURL(%q, %v) = %q, want %q", tt.host, tt.noVerify, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPATExpiryDisplay(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      string
+	}{
+		{name: "no expiry", want: "-"},
+		{name: "far", expiresAt: at(40 * 24 * time.Hour), want: "40 days"},
+		{name: "soon", expiresAt: at(3*24*time.Hour + time.Hour), want: "⚠️  3 days"},
+		{name: "tomorrow", expiresAt: at(25 * time.Hour), want: "⚠️  1 day"},
+		{name: "today", expiresAt: at(time.Hour), want: "⚠️  today"},
+		{name: "expired", expiresAt: at(-time.Hour), want: "❌ expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pat := config.PersonalAccessToken{ExpiresAt: tt.expiresAt}
+			if got := getPATExpiryDisplay(pat, now); got != tt.want {
+				t.Errorf("getPATExpiryDisplay() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarnPATExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var out bytes.Buffer
+	far := now.Add(30 * 24 * time.Hour)
+	warnPATExpiry(&out, &config.PersonalAccessToken{Name: "ci", ExpiresAt: &far}, now)
+	warnPATExpiry(&out, &config.PersonalAccessToken{Name: "ci"}, now)
+	if out.Len() != 0 {
+		t.Errorf("Unexpected warning: %q", out.String())
+	}
+
+	soon := now.Add(2*24*time.Hour + time.Hour)
+	warnPATExpiry(&out, &config.PersonalAccessToken{Name: "ci", ExpiresAt: &soon}, now)
+	if got := out.String(); !strings.Contains(got, "PAT 'ci' expires in 2 days (2024-06-03)") ||
+		!strings.Contains(got, `gh app-auth pat rotate "ci"`) {
+		t.Errorf("Warning = %q", got)
+	}
+}
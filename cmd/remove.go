@@ -19,11 +19,12 @@ const (
 
 func NewRemoveCmd() *cobra.Command {
 	var (
-		appID   int64
-		patName string
-		force   bool
-		allApps bool
-		allPATs bool
+		appID          int64
+		installationID int64
+		patName        string
+		force          bool
+		allApps        bool
+		allPATs        bool
 	)
 
 	cmd := &cobra.Command{
@@ -31,13 +32,19 @@ func NewRemoveCmd() *cobra.Command {
 		Short: "Remove credential configuration",
 		Long: `Remove a configured GitHub App or Personal Access Token.
 
-	This will remove the credential configuration and clear any cached secrets.`,
+	This will remove the credential configuration and clear any cached secrets.
+	An app's private key is only deleted once no other entry of the app uses it.
+	When an app has several entries, such as one per installation added by
+	'gh app-auth installations sync --apply', pick one with --installation-id.`,
 		Aliases: []string{"rm", "delete"},
 		Example: `  # Remove specific app
   gh app-auth remove --app-id 123456
   
   # Remove without confirmation
   gh app-auth remove --app-id 123456 --force
+
+  # Remove the entry of one installation of an app
+  gh app-auth remove --app-id 123456 --installation-id 789012
   
   # Remove all configured apps
   gh app-auth remove --all
@@ -47,10 +54,12 @@ func NewRemoveCmd() *cobra.Command {
 
   # Remove all Personal Access Tokens
   gh app-auth remove --all-pats`,
-		RunE: removeRun(&appID, &patName, &force, &allApps, &allPATs),
+		RunE: removeRun(&appID, &installationID, &patName, &force, &allApps, &allPATs),
 	}
 
 	cmd.Flags().Int64Var(&appID, "app-id", 0, "GitHub App ID to remove")
+	cmd.Flags().Int64Var(&installationID, "installation-id", 0,
+		"Installation ID of the app entry to remove, when the app has several")
 	cmd.Flags().StringVar(&patName, "pat-name", "", "Personal Access Token name to remove")
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "Skip confirmation prompt")
 	cmd.Flags().BoolVar(&allApps, "all", false, "Remove all configured GitHub Apps")
@@ -59,8 +68,14 @@ func NewRemoveCmd() *cobra.Command {
 	return cmd
 }
 
-func removeRun(appID *int64, patName *string, force, allApps, allPATs *bool) func(*cobra.Command, []string) error {
+func removeRun(
+	appID, installationID *int64, patName *string, force, allApps, allPATs *bool,
+) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, args []string) error {
+		if *installationID > 0 && *appID == 0 {
+			return fmt.Errorf("--installation-id requires --app-id")
+		}
+
 		targetCount := 0
 		if *allApps {
 			targetCount++
@@ -113,7 +128,7 @@ func removeRun(appID *int64, patName *string, force, allApps, allPATs *bool) fun
 				fmt.Printf("No GitHub Apps configured.\n")
 				return nil
 			}
-			return removeSingleApp(cfg, *appID, *force)
+			return removeSingleApp(cfg, *appID, *installationID, *force)
 		}
 
 		if *allPATs {
@@ -133,9 +148,9 @@ func removeRun(appID *int64, patName *string, force, allApps, allPATs *bool) fun
 	}
 }
 
-func removeSingleApp(cfg *config.Config, appID int64, force bool) error {
+func removeSingleApp(cfg *config.Config, appID, installationID int64, force bool) error {
 	// Find the app
-	appIndex, appToRemove, err := findAppByID(cfg, appID)
+	appIndex, appToRemove, err := findAppByID(cfg, appID, installationID)
 	if err != nil {
 		return err
 	}
@@ -214,14 +229,42 @@ func clearAllCachedTokens() error {
 	return nil
 }
 
-// findAppByID finds an app by ID and returns its index and the app itself
-func findAppByID(cfg *config.Config, appID int64) (int, config.GitHubApp, error) {
+// findAppByID finds an app entry by ID, and by installation ID when set, and returns its
+// index and the entry itself. An app with several entries needs an installation ID.
+func findAppByID(cfg *config.Config, appID, installationID int64) (int, config.GitHubApp, error) {
+	index, matches := -1, 0
 	for i, app := range cfg.GitHubApps {
-		if app.AppID == appID {
-			return i, app, nil
+		if app.AppID != appID || (installationID > 0 && app.InstallationID != installationID) {
+			continue
 		}
+		if matches == 0 {
+			index = i
+		}
+		matches++
+	}
+
+	switch {
+	case matches == 0 && installationID > 0:
+		return -1, config.GitHubApp{}, fmt.Errorf(
+			"GitHub App with ID %d and installation ID %d not found", appID, installationID)
+	case matches == 0:
+		return -1, config.GitHubApp{}, fmt.Errorf("GitHub App with ID %d not found", appID)
+	case matches > 1:
+		return -1, config.GitHubApp{}, fmt.Errorf(
+			"GitHub App with ID %d has %d entries: select one with --installation-id", appID, matches)
 	}
-	return -1, config.GitHubApp{}, fmt.Errorf("GitHub App with ID %d not found", appID)
+	return index, cfg.GitHubApps[index], nil
+}
+
+// appNameInUse reports whether an app entry is named name; entries with the same name
+// share the private key stored under it
+func appNameInUse(apps []config.GitHubApp, name string) bool {
+	for _, app := range apps {
+		if app.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // confirmAppRemoval prompts the user to confirm app removal
@@ -229,6 +272,9 @@ func confirmAppRemoval(appToRemove config.GitHubApp) bool {
 	fmt.Printf("This will remove the following GitHub App configuration:\n")
 	fmt.Printf("  Name: %s\n", appToRemove.Name)
 	fmt.Printf("  App ID: %d\n", appToRemove.AppID)
+	if appToRemove.InstallationID > 0 {
+		fmt.Printf("  Installation ID: %d\n", appToRemove.InstallationID)
+	}
 	fmt.Printf("  Patterns: %v\n", appToRemove.Patterns)
 	fmt.Printf("\nAre you sure? (y/N): ")
 
@@ -252,11 +298,6 @@ func performAppRemoval(cfg *config.Config, appIndex int, appToRemove config.GitH
 	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
 	secretMgr := secrets.NewManager(configDir)
 
-	// Delete private key from secure storage
-	if err := appToRemove.DeletePrivateKey(secretMgr); err != nil {
-		fmt.Printf("⚠️  Warning: failed to delete private key from storage: %v\n", err)
-	}
-
 	// Remove the app from configuration
 	cfg.GitHubApps = append(cfg.GitHubApps[:appIndex], cfg.GitHubApps[appIndex+1:]...)
 
@@ -265,13 +306,25 @@ func performAppRemoval(cfg *config.Config, appIndex int, appToRemove config.GitH
 		return fmt.Errorf("failed to save configuration: %w", err)
 	}
 
+	// Delete private key from secure storage, unless other entries of the app still use it
+	keyShared := appNameInUse(cfg.GitHubApps, appToRemove.Name)
+	if !keyShared {
+		if err := appToRemove.DeletePrivateKey(secretMgr); err != nil {
+			fmt.Printf("⚠️  Warning: failed to delete private key from storage: %v\n", err)
+		}
+	}
+
 	// Clear cached tokens for this app
 	if err := clearCachedTokens(appID); err != nil {
 		fmt.Printf("⚠️  Warning: failed to clear cached tokens: %v\n", err)
 	}
 
 	fmt.Printf("✅ Successfully removed GitHub App '%s' (ID: %d)\n", appToRemove.Name, appID)
-	fmt.Printf("   🗑️  Private key deleted from secure storage\n")
+	if keyShared {
+		fmt.Printf("   🔑 Private key kept: other entries named '%s' use it\n", appToRemove.Name)
+	} else {
+		fmt.Printf("   🗑️  Private key deleted from secure storage\n")
+	}
 	return nil
 }
 
@@ -303,8 +356,13 @@ func performAllAppsRemoval(cfg *config.Config) error {
 	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
 	secretMgr := secrets.NewManager(configDir)
 
-	// Delete all private keys from secure storage
+	// Delete all private keys from secure storage, once per name as entries share them
+	deleted := make(map[string]bool)
 	for _, app := range cfg.GitHubApps {
+		if deleted[app.Name] {
+			continue
+		}
+		deleted[app.Name] = true
 		if err := app.DeletePrivateKey(secretMgr); err != nil {
 			fmt.Printf("⚠️  Warning: failed to delete key for '%s': %v\n", app.Name, err)
 		}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
@@ -54,7 +55,7 @@ func TestFindAppByID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			index, app, err := findAppByID(cfg, tt.appID)
+			index, app, err := findAppByID(cfg, tt.appID, 0)
 
 			if tt.wantErr {
 				if err == nil {
@@ -86,6 +87,27 @@ func TestFindAppByID(t *testing.T) {
 	}
 }
 
+func TestFindAppByID_SeveralEntries(t *testing.T) {
+	cfg := &config.Config{
+		Version: "1.0",
+		GitHubApps: []config.GitHubApp{
+			{Name: "Org App", AppID: 111111, InstallationID: 100},
+			{Name: "Org App", AppID: 111111, InstallationID: 200},
+		},
+	}
+
+	if _, _, err := findAppByID(cfg, 111111, 0); err == nil || !strings.Contains(err.Error(), "--installation-id") {
+		t.Errorf("findAppByID() without installation ID error = %v, want --installation-id hint", err)
+	}
+	index, app, err := findAppByID(cfg, 111111, 200)
+	if err != nil || index != 1 || app.InstallationID != 200 {
+		t.Errorf("findAppByID() = %d, %+v, %v; want the second entry", index, app, err)
+	}
+	if _, _, err := findAppByID(cfg, 111111, 300); err == nil {
+		t.Error("Expected error for an unknown installation ID")
+	}
+}
+
 func TestClearCachedTokens(t *testing.T) {
 	// Test placeholder implementation
 	err := clearCachedTokens(123456)
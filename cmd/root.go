@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
@@ -31,6 +33,10 @@ Features:
 }
 
 func Execute() error {
+	// When installed as docker-credential-gh-app-auth, docker calls us with just the operation
+	if args, ok := dockerCredentialArgs(os.Args[0], os.Args[1:]); ok {
+		rootCmd.SetArgs(args)
+	}
 	return rootCmd.Execute()
 }
 
@@ -46,6 +52,18 @@ func init() {
 	rootCmd.AddCommand(NewScopeCmd())
 	rootCmd.AddCommand(NewDebugCmd())
 	rootCmd.AddCommand(NewConfigCmd())
+	rootCmd.AddCommand(NewAPICmd())
+	rootCmd.AddCommand(NewGraphQLCmd())
+	rootCmd.AddCommand(NewDockerCredentialCmd())
+	rootCmd.AddCommand(NewGoAuthCmd())
+	rootCmd.AddCommand(NewExportTokenCmd())
+	rootCmd.AddCommand(NewTokenFileCmd())
+	rootCmd.AddCommand(NewCreateAppCmd())
+	rootCmd.AddCommand(NewRotateKeyCmd())
+	rootCmd.AddCommand(NewPATCmd())
+	rootCmd.AddCommand(NewLoginCmd())
+	rootCmd.AddCommand(NewLogoutCmd())
+	rootCmd.AddCommand(NewInstallationsCmd())
 
 	// Global flags
 	rootCmd.PersistentFlags().Bool("debug", false, "Enable debug output")
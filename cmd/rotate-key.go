@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+type rotateKeyOptions struct {
+	appID   int64
+	keyFile string
+	label   string
+	retire  string
+}
+
+// errKeyRejected is returned when GitHub does not accept a JWT signed with the key
+var errKeyRejected = errors.New("key rejected by GitHub")
+
+// appInfo is the subset of GET /app used to confirm which app a key belongs to
+type appInfo struct {
+	ID       int64  `json:"id"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	ClientID string `json:"client_id"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	Permissions map[string]string `json:"permissions"`
+}
+
+func NewRotateKeyCmd() *cobra.Command {
+	opts := &rotateKeyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Add a new private key to a GitHub App and make it active",
+		Long: `Rotate the private key of a configured GitHub App.
+
+The new key is checked by minting a JWT and calling the GitHub /app endpoint
+before it is stored. It then becomes the active key, and the previous keys stay
+configured as fallbacks: when GitHub rejects a key, the next one is tried.
+
+Once the old key has been deleted in the app settings on GitHub, retire it with
+--retire so it is no longer tried.`,
+		Example: `  # Promote a newly generated key
+  gh app-auth rotate-key --app-id 123456 --key-file ~/Downloads/myapp.2024-06-01.private-key.pem
+
+  # Give the key a label
+  gh app-auth rotate-key --app-id 123456 --key-file new.pem --label 2024-q3
+
+  # Drop the key that was configured before rotation
+  gh app-auth rotate-key --app-id 123456 --retire initial`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rotateKeyRun(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().Int64Var(&opts.appID, "app-id", 0, "GitHub App ID")
+	cmd.Flags().StringVarP(&opts.keyFile, "key-file", "k", "", "Path to the new private key file")
+	cmd.Flags().StringVar(&opts.label, "label", "", "Label for the new key (default: key-<timestamp>)")
+	cmd.Flags().StringVar(&opts.retire, "retire", "", "Remove the key with this label instead of adding one")
+
+	_ = cmd.MarkFlagRequired("app-id")
+	cmd.MarkFlagsMutuallyExclusive("key-file", "retire")
+	cmd.MarkFlagsMutuallyExclusive("label", "retire")
+
+	return cmd
+}
+
+func rotateKeyRun(ctx context.Context, opts *rotateKeyOptions) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	apps := findAppsByID(cfg, opts.appID)
+	if len(apps) == 0 {
+		return fmt.Errorf("no GitHub App configured with ID %d", opts.appID)
+	}
+	for _, app := range apps {
+		if app.Signer != nil {
+			return fmt.Errorf("app '%s' uses an external signer; rotate the key in the signer instead", app.Name)
+		}
+	}
+
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return err
+	}
+
+	if opts.retire != "" {
+		return retireAppKey(cfg, apps, secretMgr, opts)
+	}
+
+	privateKey, _, err := getPrivateKey(opts.keyFile)
+	if err != nil {
+		return err
+	}
+
+	// An encrypted key is stored as is; it must open with the app's passphrase
+	signingKey, err := auth.DecryptPrivateKey(apps[0], secretMgr, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt new key: %w", err)
+	}
+
+	host := appsHost(apps)
+	if host == "" {
+		return fmt.Errorf("GitHub App %d has no patterns to tell its GitHub host", opts.appID)
+	}
+	info, err := verifyAppKey(ctx, auth.APIBaseURL(host), auth.JWTIssuer(apps[0]), signingKey)
+	if err != nil {
+		return fmt.Errorf("new key verification failed: %w", err)
+	}
+
+	label, backend, err := rotateAppKeys(apps, secretMgr, opts.label, privateKey, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	if err := deleteLegacyAppKeys(cfg, apps, secretMgr); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	fmt.Printf("✅ Private key '%s' verified for '%s' and promoted to active\n", label, info.Name)
+	if backend == secrets.StorageBackendKeyring {
+		fmt.Println("   🔐 Storage: OS Keyring (encrypted)")
+	} else {
+		fmt.Println("   ⚠️  Storage: Filesystem (keyring unavailable)")
+	}
+	fmt.Println("   Previous keys remain as fallbacks. Once deleted on GitHub, retire them with:")
+	fmt.Printf("   gh app-auth rotate-key --app-id %d --retire <label>\n", opts.appID)
+
+	return nil
+}
+
+// retireAppKey removes a key from every entry of an app. The configuration is saved
+// before the stored secrets are deleted, so it never references a deleted key.
+func retireAppKey(
+	cfg *config.Config, apps []*config.GitHubApp, secretMgr *secrets.Manager, opts *rotateKeyOptions,
+) error {
+	retired := make([]config.PrivateKeyEntry, len(apps))
+	for i, app := range apps {
+		entry, err := app.RetirePrivateKey(opts.retire)
+		if err != nil {
+			return fmt.Errorf("app '%s': %w", app.Name, err)
+		}
+		retired[i] = entry
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	for i, app := range apps {
+		if err := app.DeleteRetiredPrivateKey(secretMgr, retired[i]); err != nil {
+			return fmt.Errorf("app '%s': key retired from the configuration, but %w", app.Name, err)
+		}
+	}
+	fmt.Printf("✅ Retired private key '%s' of GitHub App %d\n", opts.retire, opts.appID)
+	return nil
+}
+
+// appsHost returns the GitHub host of the first app entry with a pattern
+func appsHost(apps []*config.GitHubApp) string {
+	for _, app := range apps {
+		for _, pattern := range app.Patterns {
+			if host := extractHostFromPattern(pattern); host != "" {
+				return host
+			}
+		}
+	}
+	return ""
+}
+
+// findAppsByID returns every configured entry for an app ID; setup may register one per organization
+func findAppsByID(cfg *config.Config, appID int64) []*config.GitHubApp {
+	var apps []*config.GitHubApp
+	for i := range cfg.GitHubApps {
+		if cfg.GitHubApps[i].AppID == appID {
+			apps = append(apps, &cfg.GitHubApps[i])
+		}
+	}
+	return apps
+}
+
+// deleteLegacyAppKeys deletes the single keys the rotated apps had before key entries,
+// once per name and only when no configured entry with that name still reads it. Call it
+// after the configuration is saved, so a failed save never loses the old key.
+func deleteLegacyAppKeys(cfg *config.Config, apps []*config.GitHubApp, secretMgr *secrets.Manager) error {
+	done := make(map[string]bool)
+	var errs []error
+	for _, app := range apps {
+		if done[app.Name] {
+			continue
+		}
+		done[app.Name] = true
+		if slices.ContainsFunc(cfg.GitHubApps, func(other config.GitHubApp) bool {
+			return other.Name == app.Name && other.UsesLegacyPrivateKey()
+		}) {
+			continue
+		}
+		if err := app.DeleteLegacyPrivateKey(secretMgr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rotateAppKeys adds the key as the active key of each app entry under a shared label
+func rotateAppKeys(
+	apps []*config.GitHubApp, secretMgr *secrets.Manager, label, privateKey string, now time.Time,
+) (string, secrets.StorageBackend, error) {
+	if label == "" {
+		label = "key-" + now.UTC().Format("20060102-150405")
+	}
+
+	var backend secrets.StorageBackend
+	for _, app := range apps {
+		var err error
+		backend, err = app.AddPrivateKey(secretMgr, label, privateKey, now)
+		if err != nil {
+			return "", "", fmt.Errorf("app '%s': %w", app.Name, err)
+		}
+	}
+	return label, backend, nil
+}
+
+// verifyAppKey signs a JWT with the key and checks GitHub accepts it for the app
+func verifyAppKey(ctx context.Context, apiBaseURL string, issuer jwt.Issuer, privateKey string) (*appInfo, error) {
+	if _, err := jwt.Fingerprint(privateKey); err != nil {
+		return nil, fmt.Errorf("failed to generate JWT: %w", err)
+	}
+	client := &http.Client{Transport: auth.NewAuthenticator().KeyJWTTransport(issuer, privateKey, nil)}
+	return verifyApp(ctx, client, apiBaseURL, issuer.AppID)
+}
+
+// recordClientID saves the client ID GitHub reported for an app to every config entry of
+// the app that lacks it, so later JWTs are issued with it. It reports whether config changed.
+func recordClientID(appID int64, clientID string) (bool, error) {
+	if clientID == "" {
+		return false, nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	changed := false
+	for _, app := range findAppsByID(cfg, appID) {
+		if app.ClientID != clientID {
+			app.ClientID = clientID
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := cfg.Save(); err != nil {
+		return false, fmt.Errorf("failed to save configuration: %w", err)
+	}
+	return true, nil
+}
+
+// verifyApp calls GET /app with a client authenticating with app JWTs, such as one using
+// auth.AppJWTTransport, and checks the JWTs identify the expected app
+func verifyApp(ctx context.Context, client *http.Client, apiBaseURL string, appID int64) (*appInfo, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, apiBaseURL+"/app", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call GitHub API: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%w (status 401): %s", errKeyRejected, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var info appInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if info.ID != appID {
+		return nil, fmt.Errorf("key belongs to app %d, not %d", info.ID, appID)
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+func generateRotateTestKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func TestVerifyAppKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 42, "slug": "ci-bot", "name": "CI Bot"}`))
+	}))
+	defer server.Close()
+
+	key := generateRotateTestKey(t)
+
+	info, err := verifyAppKey(context.Background(), server.URL, jwt.Issuer{AppID: 42}, key)
+	if err != nil {
+		t.Fatalf("verifyAppKey() error = %v", err)
+	}
+	if info.Name != "CI Bot" {
+		t.Errorf("Name = %q, want CI Bot", info.Name)
+	}
+
+	// A key accepted for another app must not be promoted
+	if _, err := verifyAppKey(context.Background(), server.URL, jwt.Issuer{AppID: 7}, key); err == nil {
+		t.Error("Expected error for mismatched app ID")
+	}
+
+	if _, err := verifyAppKey(context.Background(), server.URL, jwt.Issuer{AppID: 42}, "not a key"); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+}
+
+func TestVerifyAppKey_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message": "A JSON web token could not be decoded"}`))
+	}))
+	defer server.Close()
+
+	_, err := verifyAppKey(context.Background(), server.URL, jwt.Issuer{AppID: 42}, generateRotateTestKey(t))
+	if !errors.Is(err, errKeyRejected) || !strings.Contains(err.Error(), "401") {
+		t.Errorf("verifyAppKey() error = %v, want 401 rejection", err)
+	}
+}
+
+func TestRotateAppKeys_AllEntriesForAppID(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	cfg := &config.Config{Version: "1"}
+	for _, name := range []string{"bot-org1", "bot-org2", "other"} {
+		app := config.GitHubApp{Name: name, AppID: 42, Patterns: []string{"github.com/" + name + "/*"}}
+		if name == "other" {
+			app.AppID = 7
+		}
+		if _, err := app.SetPrivateKey(secretMgr, "old-key"); err != nil {
+			t.Fatalf("SetPrivateKey() error = %v", err)
+		}
+		cfg.GitHubApps = append(cfg.GitHubApps, app)
+	}
+
+	apps := findAppsByID(cfg, 42)
+	if len(apps) != 2 {
+		t.Fatalf("findAppsByID() returned %d apps, want 2", len(apps))
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	label, _, err := rotateAppKeys(apps, secretMgr, "", "new-key", now)
+	if err != nil {
+		t.Fatalf("rotateAppKeys() error = %v", err)
+	}
+	if label != "key-20240601-120000" {
+		t.Errorf("label = %q", label)
+	}
+
+	for _, app := range cfg.GitHubApps[:2] {
+		keys, err := app.GetPrivateKeys(secretMgr)
+		if err != nil {
+			t.Fatalf("%s: GetPrivateKeys() error = %v", app.Name, err)
+		}
+		if len(keys) != 2 || keys[0].PEM != "new-key" || keys[1].PEM != "old-key" {
+			t.Errorf("%s: keys = %+v, want new-key then old-key", app.Name, keys)
+		}
+	}
+	if len(cfg.GitHubApps[2].PrivateKeys) != 0 {
+		t.Errorf("other app was modified: %+v", cfg.GitHubApps[2].PrivateKeys)
+	}
+}
+
+func TestRotateAppKeys_SharedLegacyKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	// Given two entries of an app sharing a name and its single stored key, as setup and
+	// installations sync create them
+	cfg := &config.Config{Version: "1"}
+	for _, org := range []string{"org1", "org2"} {
+		app := config.GitHubApp{Name: "org-bot", AppID: 42, Patterns: []string{"github.com/" + org + "/*"}}
+		if _, err := app.SetPrivateKey(secretMgr, "old-key"); err != nil {
+			t.Fatalf("SetPrivateKey() error = %v", err)
+		}
+		cfg.GitHubApps = append(cfg.GitHubApps, app)
+	}
+	apps := findAppsByID(cfg, 42)
+
+	// When the key is rotated
+	if _, _, err := rotateAppKeys(apps, secretMgr, "next", "new-key", time.Now()); err != nil {
+		t.Fatalf("rotateAppKeys() error = %v", err)
+	}
+
+	// Then the old key is kept until the configuration is saved
+	if _, err := keyring.Get("gh-app-auth:org-bot", "private_key"); err != nil {
+		t.Errorf("legacy key deleted before saving: %v", err)
+	}
+	if err := deleteLegacyAppKeys(cfg, apps, secretMgr); err != nil {
+		t.Fatalf("deleteLegacyAppKeys() error = %v", err)
+	}
+	if _, err := keyring.Get("gh-app-auth:org-bot", "private_key"); err == nil {
+		t.Error("legacy key kept after saving")
+	}
+	for _, app := range apps {
+		keys, err := app.GetPrivateKeys(secretMgr)
+		if err != nil || len(keys) != 2 || keys[1].PEM != "old-key" {
+			t.Errorf("%v: GetPrivateKeys() = %+v, %v; want the old key as fallback", app.Patterns, keys, err)
+		}
+	}
+}
+
+func TestDeleteLegacyAppKeys_KeepsKeyStillInUse(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	// Given an entry with the rotated app's name that still reads the single stored key
+	rotated := config.GitHubApp{Name: "org-bot", AppID: 42, PrivateKeys: []config.PrivateKeyEntry{{Label: "next"}}}
+	unrotated := config.GitHubApp{Name: "org-bot", AppID: 7}
+	if _, err := unrotated.SetPrivateKey(secretMgr, "old-key"); err != nil {
+		t.Fatalf("SetPrivateKey() error = %v", err)
+	}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{rotated, unrotated}}
+
+	// Then its key is not deleted
+	if err := deleteLegacyAppKeys(cfg, []*config.GitHubApp{&cfg.GitHubApps[0]}, secretMgr); err != nil {
+		t.Fatalf("deleteLegacyAppKeys() error = %v", err)
+	}
+	if key, err := unrotated.GetPrivateKey(secretMgr); err != nil || key != "old-key" {
+		t.Errorf("GetPrivateKey() = %q, %v; want old-key", key, err)
+	}
+}
+
+func TestRetireAppKey_KeepsKeyWhenSaveFails(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	app := config.GitHubApp{Name: "bot", AppID: 42, Patterns: []string{"github.com/myorg/"}}
+	for _, label := range []string{"old", "new"} {
+		if _, err := app.AddPrivateKey(secretMgr, label, label+"-key", time.Now()); err != nil {
+			t.Fatalf("AddPrivateKey(%q) error = %v", label, err)
+		}
+	}
+	cfg := &config.Config{Version: "1", GitHubApps: []config.GitHubApp{app}}
+	opts := &rotateKeyOptions{appID: 42, retire: "old"}
+
+	// Given a configuration that cannot be saved
+	t.Setenv("GH_APP_AUTH_CONFIG", t.TempDir())
+
+	// When the key is retired, the stored key is kept
+	if err := retireAppKey(cfg, findAppsByID(cfg, 42), secretMgr, opts); err == nil {
+		t.Fatal("retireAppKey() should fail when the configuration cannot be saved")
+	}
+	if _, err := keyring.Get("gh-app-auth:bot#old", "private_key"); err != nil {
+		t.Errorf("Retired key was deleted although the configuration was not saved: %v", err)
+	}
+
+	// Then once the configuration can be saved, the key is deleted
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(t.TempDir(), "config.yml"))
+	cfg.GitHubApps = []config.GitHubApp{app}
+	if err := retireAppKey(cfg, findAppsByID(cfg, 42), secretMgr, opts); err != nil {
+		t.Fatalf("retireAppKey() error = %v", err)
+	}
+	if _, err := keyring.Get("gh-app-auth:bot#old", "private_key"); err == nil {
+		t.Error("Expected retired key to be deleted")
+	}
+}
+
+func TestAppsHost(t *testing.T) {
+	apps := []*config.GitHubApp{
+		{Name: "no-patterns", AppID: 42},
+		{Name: "ghes", AppID: 42, Patterns: []string{"ghes.example.com/corp/"}},
+	}
+	if got := appsHost(apps); got != "ghes.example.com" {
+		t.Errorf("appsHost() = %q, want ghes.example.com", got)
+	}
+	if got := appsHost(apps[:1]); got != "" {
+		t.Errorf("appsHost() without patterns = %q, want empty", got)
+	}
+}
+
+func TestRecordClientID(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	tempDir := t.TempDir()
+	t.Setenv("GH_APP_AUTH_CONFIG", filepath.Join(tempDir, "config.yml"))
+	secretMgr := secrets.NewManager(tempDir)
+
+	cfg := &config.Config{Version: "1"}
+	for _, name := range []string{"bot-org1", "bot-org2"} {
+		app := config.GitHubApp{Name: name, AppID: 42, Patterns: []string{"github.com/" + name + "/*"}}
+		if _, err := app.SetPrivateKey(secretMgr, "key"); err != nil {
+			t.Fatalf("SetPrivateKey() error = %v", err)
+		}
+		cfg.GitHubApps = append(cfg.GitHubApps, app)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	changed, err := recordClientID(42, "Iv23liCIBOT")
+	if err != nil || !changed {
+		t.Fatalf("recordClientID() = (%v, %v), want change", changed, err)
+	}
+	saved, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	for _, app := range saved.GitHubApps {
+		if app.ClientID != "Iv23liCIBOT" {
+			t.Errorf("%s: ClientID = %q", app.Name, app.ClientID)
+		}
+	}
+
+	if changed, err := recordClientID(42, "Iv23liCIBOT"); err != nil || changed {
+		t.Errorf("second recordClientID() = (%v, %v), want no change", changed, err)
+	}
+}
@@ -1,20 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
-	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/scope"
-	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/spf13/cobra"
 )
 
 func NewScopeCmd() *cobra.Command {
-	var refresh bool
+	var (
+		refresh bool
+		workers int
+	)
 
 	cmd := &cobra.Command{
 		Use:   "scope",
@@ -25,18 +26,21 @@ The scope determines which repositories an app can access:
 - "all": App has access to all repositories in the organization/account
 - "selected": App has access only to specific repositories
 
-Scope information is cached locally for 24 hours.`,
+Scope information is cached locally for 24 hours. Refreshes are conditional
+requests: a scope GitHub reports unchanged costs no API rate limit, so
+--refresh is cheap to run often. Apps are refreshed in parallel.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return scopeRun(refresh)
+			return scopeRun(cmd.Context(), refresh, workers)
 		},
 	}
 
 	cmd.Flags().BoolVar(&refresh, "refresh", false, "Force refresh scope from GitHub API")
+	cmd.Flags().IntVar(&workers, "workers", scope.DefaultWorkers, "Number of apps refreshed in parallel")
 
 	return cmd
 }
 
-func scopeRun(forceRefresh bool) error {
+func scopeRun(ctx context.Context, forceRefresh bool, workers int) error {
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
@@ -49,55 +53,40 @@ func scopeRun(forceRefresh bool) error {
 		return nil
 	}
 
-	// Initialize secrets manager
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
-	secretsMgr := secrets.NewManager(configDir)
-
-	// Initialize scope manager
-	scopeMgr := scope.NewManager()
-	jwtGen := jwt.NewGenerator()
-
-	updated := false
+	// JWTs come from the app's private key or external signer; installation tokens are cached
+	scopeMgr := scope.NewManager(auth.NewAuthenticator())
 
-	// Process each app
+	// Select the apps whose scope needs a refresh
+	var stale []*config.GitHubApp
 	for i := range cfg.GitHubApps {
 		app := &cfg.GitHubApps[i]
+		if forceRefresh || scopeMgr.NeedsRefresh(app) {
+			stale = append(stale, app)
+		}
+	}
 
-		// Check if refresh needed
-		needsRefresh := forceRefresh || scopeMgr.NeedsRefresh(app)
-
-		if needsRefresh {
-			fmt.Printf("Fetching scope for %q (App ID: %d)...\n", app.Name, app.AppID)
-
-			// Get private key
-			privateKey, err := app.GetPrivateKey(secretsMgr)
-			if err != nil {
-				fmt.Printf("  ⚠️  Failed to get private key: %v\n", err)
-				continue
-			}
-
-			// Generate JWT
-			jwtToken, err := jwtGen.GenerateTokenFromKey(app.AppID, privateKey)
-			if err != nil {
-				fmt.Printf("  ⚠️  Failed to generate JWT: %v\n", err)
-				continue
-			}
-
-			// Fetch scope
-			err = scopeMgr.FetchScope(app, jwtToken)
-			if err != nil {
-				fmt.Printf("  ⚠️  Failed to fetch scope: %v\n", err)
-				continue
-			}
-			updated = true
+	updated := false
+	if len(stale) > 0 {
+		fmt.Printf("Fetching scope for %d app(s)...\n", len(stale))
+	}
+	for _, result := range scopeMgr.RefreshAll(ctx, stale, workers) {
+		app := result.App
+		switch {
+		case result.Err != nil:
+			fmt.Printf("  ⚠️  %q (App ID: %d): failed to fetch scope: %v\n", app.Name, app.AppID, result.Err)
+			continue
+		case result.Changed:
+			fmt.Printf("  %q (App ID: %d): updated\n", app.Name, app.AppID)
+		default:
+			fmt.Printf("  %q (App ID: %d): unchanged\n", app.Name, app.AppID)
 		}
+		// Unchanged scopes are saved too: their cache expiry moved
+		updated = true
+	}
 
-		// Display scope
-		displayScope(app)
+	// Display scope
+	for i := range cfg.GitHubApps {
+		displayScope(&cfg.GitHubApps[i])
 	}
 
 	// Save updated config
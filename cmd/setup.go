@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
@@ -97,11 +98,14 @@ func NewSetupCmd() *cobra.Command {
 		patterns       []string
 		name           string
 		installationID int64
+		clientID       string
 		priority       int
 		useKeyring     bool
 		useFilesystem  bool
+		storePass      bool
 		pat            string
 		username       string
+		noVerify       bool
 	)
 
 	cmd := &cobra.Command{
@@ -110,7 +114,12 @@ func NewSetupCmd() *cobra.Command {
 		Long: `Configure GitHub App authentication for specific repository patterns.
 
 This command sets up a GitHub App for authentication with git operations.
-You'll need the App ID and private key file from your GitHub App settings.`,
+You'll need the App ID and private key file from your GitHub App settings.
+
+With --pat a Personal Access Token is set up instead. On GitHub hosts
+(github.com, GHE.com and the hosts gh is logged in to) it is checked against
+the /user endpoint first, and not stored if GitHub rejects it; --no-verify
+skips the check.`,
 		Example: `  # Basic setup
   gh app-auth setup --app-id 123456 --key-file ~/.ssh/my-app.pem --patterns "github.com/myorg/*"
   
@@ -128,6 +137,13 @@ You'll need the App ID and private key file from your GitHub App settings.`,
     --key-file ~/.ssh/my-app.pem \
     --patterns "github.com/myorg/*,github.example.com/corp/*"
 
+  # Encrypted private key, keeping its passphrase in the OS keyring
+  gh app-auth setup \
+    --app-id 123456 \
+    --key-file ~/.ssh/my-app.encrypted.pem \
+    --patterns "github.com/myorg/*" \
+    --store-passphrase
+
   # Setup a Personal Access Token for GitHub
   gh app-auth setup \
     --pat gh_your_token_here \
@@ -143,8 +159,8 @@ You'll need the App ID and private key file from your GitHub App settings.`,
     --name "Bitbucket PAT" \
     --priority 10`,
 		RunE: setupRun(
-			&appID, &keyFile, &patterns, &name, &installationID,
-			&priority, &useKeyring, &useFilesystem, &pat, &username,
+			&appID, &clientID, &keyFile, &patterns, &name, &installationID,
+			&priority, &useKeyring, &useFilesystem, &storePass, &pat, &username, &noVerify,
 		),
 	}
 
@@ -152,6 +168,7 @@ You'll need the App ID and private key file from your GitHub App settings.`,
 	cmd.Flags().Int64Var(&appID, "app-id", 0, "GitHub App ID (required for app setup)")
 	cmd.Flags().StringVar(&keyFile, "key-file", "", "Path to private key file (or use GH_APP_PRIVATE_KEY env var)")
 	cmd.Flags().Int64Var(&installationID, "installation-id", 0, "Installation ID (auto-detected if not provided)")
+	cmd.Flags().StringVar(&clientID, "client-id", "", "GitHub App client ID, used as the JWT issuer")
 
 	// PAT flags
 	cmd.Flags().StringVar(&pat, "pat", "", "Personal Access Token (for PAT setup)")
@@ -159,6 +176,7 @@ You'll need the App ID and private key file from your GitHub App settings.`,
 		&username, "username", "",
 		"Username for HTTP basic auth (optional, defaults to 'x-access-token' for GitHub)",
 	)
+	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Store the PAT without checking it with GitHub")
 
 	// Common flags
 	cmd.Flags().StringSliceVar(&patterns, "patterns", nil, "Repository patterns to match (required)")
@@ -169,6 +187,10 @@ You'll need the App ID and private key file from your GitHub App settings.`,
 	// Storage method flags
 	cmd.Flags().BoolVar(&useKeyring, "use-keyring", true, "Store private key in OS keyring (default)")
 	cmd.Flags().BoolVar(&useFilesystem, "use-filesystem", false, "Force filesystem storage instead of keyring")
+	cmd.Flags().BoolVar(
+		&storePass, "store-passphrase", false,
+		"Store the passphrase of an encrypted private key in the OS keyring",
+	)
 
 	// Mark required flags
 	_ = cmd.MarkFlagRequired("patterns")
@@ -177,9 +199,9 @@ You'll need the App ID and private key file from your GitHub App settings.`,
 }
 
 func setupRun(
-	appID *int64, keyFile *string, patterns *[]string,
+	appID *int64, clientID *string, keyFile *string, patterns *[]string,
 	name *string, installationID *int64, priority *int,
-	useKeyring *bool, useFilesystem *bool, pat *string, username *string,
+	useKeyring *bool, useFilesystem *bool, storePassphrase *bool, pat *string, username *string, noVerify *bool,
 ) func(*cobra.Command, []string) error {
 	return func(cmd *cobra.Command, args []string) error {
 		// Determine if this is PAT or App setup
@@ -202,20 +224,20 @@ func setupRun(
 		}
 
 		if isPATSetup {
-			return setupPAT(cfg, *pat, *name, *patterns, *priority, *username)
+			return setupPAT(cfg, *pat, *name, *patterns, *priority, *username, *noVerify)
 		}
 
 		_, err = setupGitHubApp(
-			cfg, *appID, *keyFile, *name, *installationID,
-			*patterns, *priority, *useKeyring, *useFilesystem, false,
+			cfg, *appID, *clientID, *keyFile, *name, *installationID,
+			*patterns, *priority, *useKeyring, *useFilesystem, *storePassphrase, false,
 		)
 		return err
 	}
 }
 
 func setupGitHubApp(
-	cfg *config.Config, appID int64, keyFile, name string, installationID int64,
-	patterns []string, priority int, useKeyring, useFilesystem bool, silent bool,
+	cfg *config.Config, appID int64, clientID, keyFile, name string, installationID int64,
+	patterns []string, priority int, useKeyring, useFilesystem, storePassphrase bool, silent bool,
 ) (*config.GitHubApp, error) {
 	// Validate inputs
 	if err := validateSetupInputs(appID, patterns, &useKeyring, &useFilesystem, keyFile); err != nil {
@@ -228,8 +250,18 @@ func setupGitHubApp(
 		return nil, err
 	}
 
+	// Encrypted keys are stored as they are; the passphrase is only needed to test the key
+	signingKey, passphrase, err := decryptSetupKey(privateKeyContent)
+	if err != nil {
+		return nil, err
+	}
+	if storePassphrase && passphrase == nil {
+		return nil, fmt.Errorf("--store-passphrase requires an encrypted private key")
+	}
+
 	// Test JWT generation to ensure key is valid
-	jwtToken, err := generateJWTForSetup(appID, privateKeyContent)
+	issuer := jwt.Issuer{AppID: appID, ClientID: clientID}
+	jwtToken, err := generateJWTForSetup(issuer, signingKey)
 	if err != nil {
 		return nil, err
 	}
@@ -260,6 +292,7 @@ func setupGitHubApp(
 
 		// Create the GitHub App entry for this org
 		app := createGitHubApp(appID, name, orgInstallationID, orgPatterns, priority)
+		app.ClientID = clientID
 
 		// Store private key and configure storage (only needed once, but we do it for each)
 		backend, err = configureAppStorage(&app, privateKeyContent, expandedKeyFile, useKeyring)
@@ -267,6 +300,12 @@ func setupGitHubApp(
 			return nil, err
 		}
 
+		if storePassphrase {
+			if err := storeSetupPassphrase(&app, passphrase); err != nil {
+				return nil, err
+			}
+		}
+
 		// Validate the complete app configuration after storage is configured
 		if err := app.Validate(); err != nil {
 			return nil, fmt.Errorf("invalid app configuration for org '%s': %w", org, err)
@@ -297,7 +336,7 @@ func setupGitHubApp(
 
 func setupPAT(
 	cfg *config.Config, token, name string, patterns []string,
-	priority int, username string,
+	priority int, username string, noVerify bool,
 ) error {
 	// Set default name if not provided
 	if name == "" {
@@ -320,10 +359,12 @@ func setupPAT(
 	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
 	secretMgr := secrets.NewManager(configDir)
 
-	// Store PAT
-	backend, err := pat.SetPAT(secretMgr, token)
+	// Store the PAT unless GitHub rejects it, recording its login, expiry and scopes;
+	// other hosts such as Bitbucket are not asked
+	apiBaseURL := patVerifyURL(extractHostFromPattern(patterns[0]), noVerify)
+	backend, err := storeVerifiedPAT(context.Background(), &pat, secretMgr, apiBaseURL, token)
 	if err != nil {
-		return fmt.Errorf("failed to store PAT: %w", err)
+		return err
 	}
 
 	// Validate the PAT configuration
@@ -344,6 +385,7 @@ func setupPAT(
 	if username != "" {
 		fmt.Printf("   Username: %s\n", username)
 	}
+	printPATInfo(&pat)
 	if backend == secrets.StorageBackendKeyring {
 		fmt.Println("   🔐 Storage: OS Keyring (encrypted)")
 	} else {
@@ -439,10 +481,37 @@ func getPrivateKey(keyFile string) (string, string, error) {
 	return privateKeyContent, expandedKeyFile, nil
 }
 
+// decryptSetupKey decrypts an encrypted private key, returning the key to sign with
+// and the passphrase (nil for unencrypted keys)
+func decryptSetupKey(privateKeyContent string) (string, []byte, error) {
+	if !jwt.IsEncryptedKey(privateKeyContent) {
+		return privateKeyContent, nil, nil
+	}
+
+	passphrase, err := auth.KeyPassphrase(nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	signingKey, err := jwt.DecryptPrivateKey(privateKeyContent, passphrase)
+	if err != nil {
+		return "", nil, err
+	}
+	return signingKey, passphrase, nil
+}
+
+// storeSetupPassphrase keeps an encrypted key's passphrase in the OS keyring
+func storeSetupPassphrase(app *config.GitHubApp, passphrase []byte) error {
+	secretMgr, err := newDefaultSecretsManager()
+	if err != nil {
+		return err
+	}
+	return app.SetKeyPassphrase(secretMgr, string(passphrase))
+}
+
 // generateJWTForSetup generates a JWT token and returns it for use in setup
-func generateJWTForSetup(appID int64, privateKeyContent string) (string, error) {
+func generateJWTForSetup(issuer jwt.Issuer, privateKeyContent string) (string, error) {
 	generator := jwt.NewGenerator()
-	token, err := generator.GenerateTokenFromKey(appID, privateKeyContent)
+	token, err := generator.GenerateTokenFromKeyForIssuer(issuer, privateKeyContent)
 	if err != nil {
 		return "", fmt.Errorf("JWT generation test failed: %w", err)
 	}
@@ -12,7 +12,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 )
 
@@ -419,7 +421,7 @@ func TestGenerateJWTForSetup(t *testing.T) {
 	validKey := generateTestRSAKey(t)
 
 	t.Run("valid JWT generation", func(t *testing.T) {
-		token, err := generateJWTForSetup(123456, validKey)
+		token, err := generateJWTForSetup(jwt.Issuer{AppID: 123456}, validKey)
 		if err != nil {
 			t.Errorf("Unexpected error: %v", err)
 		}
@@ -429,14 +431,14 @@ func TestGenerateJWTForSetup(t *testing.T) {
 	})
 
 	t.Run("invalid key format", func(t *testing.T) {
-		_, err := generateJWTForSetup(123456, "invalid-key-content")
+		_, err := generateJWTForSetup(jwt.Issuer{AppID: 123456}, "invalid-key-content")
 		if err == nil {
 			t.Error("Expected error for invalid key")
 		}
 	})
 
 	t.Run("empty key", func(t *testing.T) {
-		_, err := generateJWTForSetup(123456, "")
+		_, err := generateJWTForSetup(jwt.Issuer{AppID: 123456}, "")
 		if err == nil {
 			t.Error("Expected error for empty key")
 		}
@@ -1028,3 +1030,32 @@ func TestDisplaySetupSuccess(t *testing.T) {
 		})
 	}
 }
+
+func TestDecryptSetupKey(t *testing.T) {
+	plain := generateTestRSAKey(t)
+	signingKey, passphrase, err := decryptSetupKey(plain)
+	if err != nil || signingKey != plain || passphrase != nil {
+		t.Errorf("decryptSetupKey(unencrypted) = (changed=%v, %q, %v)", signingKey != plain, passphrase, err)
+	}
+
+	encrypted, err := os.ReadFile(filepath.Join("..", "pkg", "jwt", "testdata", "encrypted-legacy-aes256.pem"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	t.Setenv(auth.KeyPassphraseEnv, "correct-horse")
+	signingKey, passphrase, err = decryptSetupKey(string(encrypted))
+	if err != nil {
+		t.Fatalf("decryptSetupKey() error = %v", err)
+	}
+	if string(passphrase) != "correct-horse" || jwt.IsEncryptedKey(signingKey) {
+		t.Errorf("decryptSetupKey() = (encrypted=%v, %q)", jwt.IsEncryptedKey(signingKey), passphrase)
+	}
+	if _, err := generateJWTForSetup(jwt.Issuer{AppID: 42}, signingKey); err != nil {
+		t.Errorf("generateJWTForSetup() error = %v", err)
+	}
+
+	t.Setenv(auth.KeyPassphraseEnv, "wrong")
+	if _, _, err := decryptSetupKey(string(encrypted)); !errors.Is(err, jwt.ErrIncorrectPassphrase) {
+		t.Errorf("decryptSetupKey() error = %v, want ErrIncorrectPassphrase", err)
+	}
+}
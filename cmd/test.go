@@ -13,6 +13,7 @@ import (
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/spf13/cobra"
 )
@@ -226,7 +227,7 @@ func loadTestConfiguration() (*config.Config, error) {
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	if len(cfg.GitHubApps) == 0 && len(cfg.PATs) == 0 {
+	if len(cfg.GitHubApps) == 0 && len(cfg.PATs) == 0 && len(cfg.UserTokens) == 0 {
 		return nil, fmt.Errorf("no GitHub Apps or Personal Access Tokens configured. Run 'gh app-auth setup' first")
 	}
 
@@ -258,6 +259,16 @@ func runAuthenticationTests(cfg *config.Config, repoURL string, verbose bool) er
 	if err != nil {
 		return err
 	}
+	if matchedUserToken := findMatchingUserToken(cfg, repoURL, matchedApp, matchedPAT); matchedUserToken != nil {
+		if verbose {
+			fmt.Printf("✅ Found matching user token: %s\n", matchedUserToken.Name)
+			fmt.Printf("   Patterns: %v\n", matchedUserToken.Patterns)
+			fmt.Printf("   Priority: %d\n\n", matchedUserToken.Priority)
+		} else {
+			fmt.Printf("✅ Matched GitHub App user token: %s\n", matchedUserToken.Name)
+		}
+		return runUserTokenAuthenticationTests(matchedUserToken, repoURL, verbose)
+	}
 	if matchedApp == nil && matchedPAT == nil {
 		return fmt.Errorf("no matching GitHub App or Personal Access Token found for %s", repoURL)
 	}
@@ -285,6 +296,10 @@ func runAuthenticationTests(cfg *config.Config, repoURL string, verbose bool) er
 }
 
 func runGitHubAppAuthenticationTests(matchedApp *config.GitHubApp, repoURL string, verbose bool) error {
+	reportClockSkew(context.Background(), auth.APIBaseURL(extractHost(repoURL)))
+	// Look the app up first: a clock skew GitHub reports is corrected before the JWT steps
+	checkAppIdentity(context.Background(), matchedApp, auth.APIBaseURL(extractHost(repoURL)))
+
 	jwtToken, err := testJWTGeneration(matchedApp, verbose)
 	if err != nil {
 		return err
@@ -322,6 +337,59 @@ func runPATAuthenticationTests(matchedPAT *config.PersonalAccessToken, repoURL s
 	return testGitHubAPIAccess("Step 3: ", token, repoURL, verbose)
 }
 
+func runUserTokenAuthenticationTests(userToken *config.AppUserToken, repoURL string, verbose bool) error {
+	if verbose {
+		fmt.Printf("Step 2: Retrieving user token (refreshing it if expired)...\n")
+	}
+
+	token, err := getUserToken(context.Background(), userToken, config.UserTokenRefreshMargin)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve user token: %w", err)
+	}
+
+	if verbose {
+		fmt.Printf("✅ User token retrieved successfully\n\n")
+	} else {
+		fmt.Printf("✅ User token retrieved from secure storage\n")
+	}
+
+	return testGitHubAPIAccess("Step 3: ", token, repoURL, verbose)
+}
+
+// reportClockSkew prints how far the local clock is from GitHub's; failures are not fatal
+func reportClockSkew(ctx context.Context, apiBaseURL string) {
+	skew, err := auth.MeasureClockSkew(ctx, apiBaseURL)
+	if err != nil {
+		fmt.Printf("⚠️  Could not measure clock skew: %v\n", err)
+		return
+	}
+
+	if skew.Abs() > jwt.DefaultIssuedAtBackdate {
+		fmt.Printf("⚠️  Clock skew vs GitHub: %+ds (JWT times are corrected automatically)\n", int64(skew.Seconds()))
+		return
+	}
+	fmt.Printf("✅ Clock skew vs GitHub: %+ds\n", int64(skew.Seconds()))
+}
+
+// checkAppIdentity looks the app up with its JWT and records its client ID; failures are
+// reported but not fatal, as the installation token step shows whether the JWT works
+func checkAppIdentity(ctx context.Context, app *config.GitHubApp, apiBaseURL string) {
+	client := &http.Client{Transport: auth.NewAuthenticator().AppJWTTransport(app, nil)}
+	info, err := verifyApp(ctx, client, apiBaseURL, app.AppID)
+	if err != nil {
+		fmt.Printf("⚠️  Could not look up the app: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ JWT accepted for app '%s' (%s)\n", info.Slug, info.Owner.Login)
+
+	changed, err := recordClientID(app.AppID, info.ClientID)
+	if err != nil {
+		fmt.Printf("⚠️  Could not save client ID: %v\n", err)
+	} else if changed {
+		fmt.Printf("📝 Saved client ID %s; JWTs now use it as issuer\n", info.ClientID)
+	}
+}
+
 // testJWTGeneration tests JWT token generation
 func testJWTGeneration(matchedApp *config.GitHubApp, verbose bool) (string, error) {
 	if verbose {
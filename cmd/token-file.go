@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultRefreshBefore is how long before expiry a new token is minted
+	defaultRefreshBefore = 10 * time.Minute
+	// defaultRetryInterval is the delay between failed refresh attempts
+	defaultRetryInterval = 30 * time.Second
+	// maxRefreshBefore keeps refreshes within the one hour lifetime of installation tokens
+	maxRefreshBefore = 55 * time.Minute
+)
+
+type tokenFileOptions struct {
+	repo          string
+	out           string
+	refresh       bool
+	refreshBefore time.Duration
+	retryInterval time.Duration
+	hook          string
+}
+
+// tokenMinter returns a fresh token and its expiry (zero when the token does not expire)
+type tokenMinter func() (string, time.Time, error)
+
+// tokenFileRefresher keeps a token file up to date
+type tokenFileRefresher struct {
+	path          string
+	hook          string
+	refreshBefore time.Duration
+	retryInterval time.Duration
+	mint          tokenMinter
+	now           func() time.Time
+	errOut        io.Writer
+}
+
+func NewTokenFileCmd() *cobra.Command {
+	opts := &tokenFileOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "token-file",
+		Short: "Write a token to a file and keep it fresh",
+		Long: `Write the token for a repository to a file for tools that read credentials
+from a path, such as Argo CD, Flux or Renovate running as sidecars.
+
+The repository is resolved through the configured patterns. The file is
+replaced atomically and written with 0600 permissions.
+
+With --refresh the command keeps running and mints a new installation token
+--refresh-before the current one expires, based on the expires_at returned by
+GitHub. Failed refreshes are retried every --retry-interval; if no new token
+could be obtained by the time the current one expires, the command exits with
+a non-zero status so the orchestrator can restart it. Personal Access Tokens
+have no expiry and are written once.
+
+The optional --hook command runs through "sh -c" after every write with
+GH_APP_AUTH_TOKEN_FILE and GH_APP_AUTH_TOKEN_EXPIRES_AT set in its environment.
+Hook failures are reported but do not stop the refresher.`,
+		Example: `  # Write a token once
+  gh app-auth token-file --repo github.com/myorg/repo --out /var/run/gh/token
+
+  # Run as a sidecar, refreshing before expiry and signalling the consumer
+  gh app-auth token-file --repo github.com/myorg/repo --out /var/run/gh/token \
+    --refresh --hook 'kill -HUP $(cat /var/run/app.pid)'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tokenFileRun(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.repo, "repo", "R", "", "Repository URL to mint the token for")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Path of the token file")
+	cmd.Flags().BoolVar(&opts.refresh, "refresh", false, "Keep running and refresh the token before it expires")
+	cmd.Flags().DurationVar(&opts.refreshBefore, "refresh-before", defaultRefreshBefore,
+		"How long before expiry to refresh the token (less than 55m)")
+	cmd.Flags().DurationVar(&opts.retryInterval, "retry-interval", defaultRetryInterval,
+		"Delay between failed refresh attempts")
+	cmd.Flags().StringVar(&opts.hook, "hook", "", "Shell command to run after each token write")
+
+	_ = cmd.MarkFlagRequired("repo")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func tokenFileRun(opts *tokenFileOptions) error {
+	if opts.refreshBefore <= 0 || opts.refreshBefore >= maxRefreshBefore {
+		return fmt.Errorf("--refresh-before must be positive and less than %s", maxRefreshBefore)
+	}
+	if opts.retryInterval <= 0 {
+		return fmt.Errorf("--retry-interval must be positive")
+	}
+
+	path, err := expandPath(opts.out)
+	if err != nil {
+		return fmt.Errorf("invalid output path: %w", err)
+	}
+
+	mint, err := newRepoTokenMinter(opts.repo, opts.refreshBefore)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	refresher := &tokenFileRefresher{
+		path:          path,
+		hook:          opts.hook,
+		refreshBefore: opts.refreshBefore,
+		retryInterval: opts.retryInterval,
+		mint:          mint,
+		now:           time.Now,
+		errOut:        os.Stderr,
+	}
+	return refresher.run(ctx, opts.refresh)
+}
+
+// newRepoTokenMinter resolves the credential for a repository and returns a minter for it.
+// App tokens are re-minted on every call rather than served from the in-memory cache;
+// user tokens are refreshed once they expire within refreshBefore.
+func newRepoTokenMinter(repo string, refreshBefore time.Duration) (tokenMinter, error) {
+	cfg, err := loadCredentialConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	target := normalizeExportTarget(repo)
+	app, pat, err := findMatchingCredential(cfg, target)
+	if err != nil {
+		return nil, err
+	}
+	if userToken := findMatchingUserToken(cfg, target, app, pat); userToken != nil {
+		return func() (string, time.Time, error) {
+			token, err := getUserToken(context.Background(), userToken, refreshBefore)
+			if err != nil || userToken.ExpiresAt == nil {
+				return token, time.Time{}, err
+			}
+			return token, *userToken.ExpiresAt, nil
+		}, nil
+	}
+	if app == nil && pat == nil {
+		return nil, fmt.Errorf("no GitHub App or Personal Access Token configured for %s", repo)
+	}
+
+	if pat != nil {
+		return func() (string, time.Time, error) {
+			token, err := getPATToken(pat)
+			return token, time.Time{}, err
+		}, nil
+	}
+
+	authenticator := auth.NewAuthenticator()
+	return func() (string, time.Time, error) {
+		authenticator.InvalidateCredentials(app, "https://"+target)
+		token, _, expiresAt, err := authenticator.GetCredentialsWithExpiry(app, "https://"+target)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to get credentials: %w", err)
+		}
+		return token, expiresAt, nil
+	}, nil
+}
+
+// run writes the token and, when refresh is set, keeps it fresh until ctx is cancelled
+func (r *tokenFileRefresher) run(ctx context.Context, refresh bool) error {
+	token, expiresAt, err := r.mint()
+	if err != nil {
+		return err
+	}
+	if err := r.write(ctx, token, expiresAt); err != nil {
+		return err
+	}
+	if !refresh {
+		return nil
+	}
+
+	err = r.refreshLoop(ctx, expiresAt)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// Stopped by signal or caller
+		return nil
+	}
+	return err
+}
+
+// refreshLoop re-mints the token ahead of each expiry until ctx is cancelled
+func (r *tokenFileRefresher) refreshLoop(ctx context.Context, expiresAt time.Time) error {
+	var err error
+	for {
+		if expiresAt.IsZero() {
+			// Nothing to refresh; stay up until asked to stop
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		// A token already due for refresh, e.g. one shorter lived than --refresh-before,
+		// is refreshed after --retry-interval rather than in a tight loop
+		wait := max(expiresAt.Add(-r.refreshBefore).Sub(r.now()), r.retryInterval)
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+
+		expiresAt, err = r.refreshBeforeExpiry(ctx, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// refreshBeforeExpiry retries minting until it succeeds or the current token expires
+func (r *tokenFileRefresher) refreshBeforeExpiry(ctx context.Context, current time.Time) (time.Time, error) {
+	for {
+		token, expiresAt, err := r.mint()
+		if err == nil {
+			err = r.write(ctx, token, expiresAt)
+		}
+		if err == nil {
+			return expiresAt, nil
+		}
+
+		remaining := current.Sub(r.now())
+		if remaining <= 0 {
+			logger.FlowError("token_file_refresh", err, map[string]interface{}{
+				"path":       r.path,
+				"expired_at": current.UTC().Format(time.RFC3339),
+			})
+			return time.Time{}, fmt.Errorf("failed to refresh token before it expired at %s: %w",
+				current.UTC().Format(time.RFC3339), err)
+		}
+
+		wait := r.retryInterval
+		if remaining < wait {
+			wait = remaining
+		}
+		fmt.Fprintf(r.errOut, "⚠️  Token refresh failed, retrying in %s: %v\n", wait, err)
+		if err := sleepContext(ctx, wait); err != nil {
+			return time.Time{}, err
+		}
+	}
+}
+
+// write replaces the token file and runs the hook
+func (r *tokenFileRefresher) write(ctx context.Context, token string, expiresAt time.Time) error {
+	if err := writeSecretFile(r.path, []byte(token)); err != nil {
+		return err
+	}
+
+	expiry := ""
+	if !expiresAt.IsZero() {
+		expiry = expiresAt.UTC().Format(time.RFC3339)
+	}
+	logger.FlowStep("token_file_written", map[string]interface{}{
+		"path":       r.path,
+		"expires_at": expiry,
+		"token_hash": logger.HashToken(token),
+	})
+
+	if r.hook == "" {
+		return nil
+	}
+	hook := exec.CommandContext(ctx, "sh", "-c", r.hook)
+	hook.Env = append(os.Environ(),
+		"GH_APP_AUTH_TOKEN_FILE="+r.path,
+		"GH_APP_AUTH_TOKEN_EXPIRES_AT="+expiry,
+	)
+	hook.Stdout = r.errOut
+	hook.Stderr = r.errOut
+	if err := hook.Run(); err != nil {
+		fmt.Fprintf(r.errOut, "⚠️  Hook command failed: %v\n", err)
+	}
+	return nil
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMinter hands out numbered tokens and fails when told to
+type fakeMinter struct {
+	mu       sync.Mutex
+	calls    int
+	lifetime time.Duration
+	failFrom int
+}
+
+func (f *fakeMinter) mint() (string, time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.failFrom > 0 && f.calls >= f.failFrom {
+		return "", time.Time{}, errors.New("GitHub unavailable")
+	}
+	return fmt.Sprintf("token-%d", f.calls), time.Now().Add(f.lifetime), nil
+}
+
+func (f *fakeMinter) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newTestRefresher(t *testing.T, minter *fakeMinter) *tokenFileRefresher {
+	t.Helper()
+	return &tokenFileRefresher{
+		path:          filepath.Join(t.TempDir(), "token"),
+		refreshBefore: 40 * time.Millisecond,
+		retryInterval: 5 * time.Millisecond,
+		mint:          minter.mint,
+		now:           time.Now,
+		errOut:        &bytes.Buffer{},
+	}
+}
+
+func TestTokenFileRefresher_WritesOnce(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour}
+	r := newTestRefresher(t, minter)
+
+	if err := r.run(context.Background(), false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+	if string(data) != "token-1" {
+		t.Errorf("token file = %q, want token-1", data)
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		t.Fatalf("Failed to stat token file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions = %o, want 600", perm)
+	}
+}
+
+func TestTokenFileRefresher_RefreshesBeforeExpiry(t *testing.T) {
+	minter := &fakeMinter{lifetime: 60 * time.Millisecond}
+	r := newTestRefresher(t, minter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	if err := r.run(ctx, true); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	calls := minter.callCount()
+	if calls < 3 {
+		t.Fatalf("Expected several refreshes, got %d mint calls", calls)
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+	if string(data) != fmt.Sprintf("token-%d", calls) {
+		t.Errorf("token file = %q, want latest token-%d", data, calls)
+	}
+}
+
+func TestTokenFileRefresher_ShortLivedTokenWaitsRetryInterval(t *testing.T) {
+	// Given tokens that are already due for refresh when minted
+	minter := &fakeMinter{lifetime: 20 * time.Millisecond}
+	r := newTestRefresher(t, minter)
+	r.retryInterval = 25 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := r.run(ctx, true); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	// Then they are re-minted once per retry interval, not as fast as possible
+	if calls := minter.callCount(); calls < 2 || calls > 6 {
+		t.Errorf("mint calls = %d, want about one per retry interval", calls)
+	}
+}
+
+func TestTokenFileRun_RejectsRefreshBeforeTokenLifetime(t *testing.T) {
+	opts := &tokenFileOptions{refreshBefore: time.Hour, retryInterval: time.Second}
+	if err := tokenFileRun(opts); err == nil || !strings.Contains(err.Error(), "--refresh-before") {
+		t.Errorf("tokenFileRun() error = %v, want a --refresh-before error", err)
+	}
+}
+
+func TestTokenFileRefresher_FailsWhenTokenExpires(t *testing.T) {
+	minter := &fakeMinter{lifetime: 60 * time.Millisecond, failFrom: 2}
+	r := newTestRefresher(t, minter)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := r.run(ctx, true)
+	if err == nil {
+		t.Fatal("Expected error when refresh keeps failing past expiry")
+	}
+	if !strings.Contains(err.Error(), "before it expired") {
+		t.Errorf("error = %v", err)
+	}
+	if minter.callCount() < 3 {
+		t.Errorf("Expected retries before giving up, got %d mint calls", minter.callCount())
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+	if string(data) != "token-1" {
+		t.Errorf("token file = %q, want last good token", data)
+	}
+}
+
+func TestTokenFileRefresher_RunsHook(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour}
+	r := newTestRefresher(t, minter)
+	marker := filepath.Join(t.TempDir(), "hook-ran")
+	r.hook = `printf '%s %s' "$GH_APP_AUTH_TOKEN_FILE" "$GH_APP_AUTH_TOKEN_EXPIRES_AT" > ` + marker
+
+	if err := r.run(context.Background(), false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		t.Fatalf("Hook did not run: %v", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] != r.path {
+		t.Errorf("hook output = %q", data)
+	}
+	if _, err := time.Parse(time.RFC3339, fields[1]); err != nil {
+		t.Errorf("hook expiry %q is not RFC3339: %v", fields[1], err)
+	}
+}
+
+func TestTokenFileRefresher_HookFailureIsNotFatal(t *testing.T) {
+	minter := &fakeMinter{lifetime: time.Hour}
+	r := newTestRefresher(t, minter)
+	r.hook = "exit 3"
+
+	if err := r.run(context.Background(), false); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	out, ok := r.errOut.(*bytes.Buffer)
+	if !ok || !strings.Contains(out.String(), "Hook command failed") {
+		t.Errorf("Expected hook failure warning, got %q", r.errOut)
+	}
+}
+
+func TestTokenFileRefresher_NonExpiringTokenWaitsForCancel(t *testing.T) {
+	minter := &fakeMinter{}
+	r := newTestRefresher(t, minter)
+	r.mint = func() (string, time.Time, error) {
+		minter.calls++
+		return "ghp_pat", time.Time{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := r.run(ctx, true); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if minter.calls != 1 {
+		t.Errorf("Expected a single write for non-expiring tokens, got %d", minter.calls)
+	}
+}
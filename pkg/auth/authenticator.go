@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
@@ -23,6 +27,45 @@ const (
 	gitHubAPIHost = "github.com"
 )
 
+// ErrUnauthorized is matched by API errors for requests GitHub rejected with 401,
+// e.g. because the JWT was signed with a revoked key.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// clockSkewMessages are fragments of GitHub's errors for JWTs rejected because of clock skew.
+var clockSkewMessages = []string{"'Issued at' claim", "'Expiration time' claim"}
+
+// apiStatusError reports an unexpected GitHub API response status.
+type apiStatusError struct {
+	StatusCode int
+	Body       string
+	// Date is the server time from the response Date header, if present
+	Date time.Time
+}
+
+func newAPIStatusError(resp *http.Response) *apiStatusError {
+	body, _ := io.ReadAll(resp.Body)
+	apiErr := &apiStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		apiErr.Date = date
+	}
+	return apiErr
+}
+
+func (e *apiStatusError) Error() string {
+	return fmt.Sprintf("GitHub API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// Is reports 401 responses as ErrUnauthorized and 404 responses as ErrNotFound.
+func (e *apiStatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
 // Authenticator handles GitHub App authentication.
 type Authenticator struct {
 	jwtGenerator   *jwt.Generator
@@ -30,6 +73,13 @@ type Authenticator struct {
 	secretsManager *secrets.Manager
 	// clientFactory creates API clients (can be overridden for testing)
 	clientFactory func(api.ClientOptions) (*api.RESTClient, error)
+	// installations remembers the installations discovered for apps without an installation ID
+	installations *InstallationCache
+	// clockOffsetPath stores the measured offset to GitHub's clock (empty disables persistence)
+	clockOffsetPath string
+	// passphrases remembers the passphrase of each app's encrypted keys for the process lifetime
+	passphrases  map[string][]byte
+	passphraseMu sync.Mutex
 }
 
 // NewAuthenticator creates a new authenticator.
@@ -38,50 +88,142 @@ func NewAuthenticator() *Authenticator {
 	homeDir, _ := os.UserHomeDir()
 	configDir := filepath.Join(homeDir, ".config", "gh", "extensions", "gh-app-auth")
 
-	return &Authenticator{
-		jwtGenerator:   jwt.NewGenerator(),
-		tokenCache:     cache.NewTokenCache(),
-		secretsManager: secrets.NewManager(configDir),
-		clientFactory:  api.NewRESTClient,
+	a := &Authenticator{
+		jwtGenerator:    jwt.NewGenerator(),
+		tokenCache:      cache.NewTokenCache(),
+		secretsManager:  secrets.NewManager(configDir),
+		clientFactory:   api.NewRESTClient,
+		installations:   NewInstallationCache(filepath.Join(configDir, installationsFile)),
+		clockOffsetPath: filepath.Join(configDir, clockOffsetFile),
 	}
+	a.configureClock()
+	return a
 }
 
 // GetCredentials returns username and token for git credential helper.
 func (a *Authenticator) GetCredentials(app *config.GitHubApp, repoURL string) (token, username string, err error) {
+	token, username, _, err = a.GetCredentialsWithExpiry(app, repoURL)
+	return token, username, err
+}
+
+// GetCredentialsWithExpiry returns username and token along with the token expiry reported by GitHub.
+func (a *Authenticator) GetCredentialsWithExpiry(
+	app *config.GitHubApp, repoURL string,
+) (token, username string, expiresAt time.Time, err error) {
 	// Generate cache key
-	cacheKey := cache.CreateCacheKey(app.AppID, app.InstallationID)
+	cacheKey := tokenCacheKey(app, repoURL)
+	username = fmt.Sprintf("%s[bot]", app.Name)
 
 	// Check cache first
-	if cachedToken, found := a.tokenCache.Get(cacheKey); found {
-		username = fmt.Sprintf("%s[bot]", app.Name)
-		return cachedToken, username, nil
+	if cachedToken, cachedExpiry, found := a.tokenCache.GetWithExpiry(cacheKey); found {
+		return cachedToken, username, cachedExpiry, nil
 	}
 
-	// Get private key from secure storage
-	privateKey, err := app.GetPrivateKey(a.secretsManager)
+	var installationToken string
+	if app.Signer != nil {
+		installationToken, expiresAt, err = a.installationTokenWithSigner(app, repoURL)
+	} else {
+		installationToken, expiresAt, err = a.installationTokenWithKeys(app, repoURL)
+	}
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get private key: %w", err)
+		return "", "", time.Time{}, err
 	}
 
-	// Generate JWT token
-	jwtToken, err := a.jwtGenerator.GenerateTokenFromKey(app.AppID, privateKey)
+	// Cache the token for 55 minutes (GitHub tokens valid for 60 minutes, 5-min buffer)
+	// SECURITY: Token stored in memory only, not persisted to disk. See docs/TOKEN_CACHING.md
+	a.tokenCache.SetWithExpiry(cacheKey, installationToken, 55*time.Minute, expiresAt)
+
+	// Return credentials
+	return installationToken, username, expiresAt, nil
+}
+
+// installationTokenWithSigner mints an installation token with a JWT from the app's external signer
+func (a *Authenticator) installationTokenWithSigner(app *config.GitHubApp, repoURL string) (string, time.Time, error) {
+	mint := func() (string, error) {
+		jwtToken, err := a.GenerateJWTForApp(app)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate JWT: %w", err)
+		}
+		return jwtToken, nil
+	}
+	return a.exchangeJWT(mint, a.installationExchange(app, repoURL))
+}
+
+// installationExchange returns a function exchanging a JWT for an app's installation token
+func (a *Authenticator) installationExchange(
+	app *config.GitHubApp, repoURL string,
+) func(string) (string, time.Time, error) {
+	return func(jwtToken string) (string, time.Time, error) {
+		if app.InstallationID == 0 {
+			return a.ownerInstallationToken(jwtToken, app.AppID, repoURL)
+		}
+		return a.GetInstallationTokenWithExpiry(jwtToken, app.InstallationID, repoURL)
+	}
+}
+
+// installationTokenWithKeys mints an installation token trying each private key in turn;
+// a 401 means GitHub no longer accepts that key
+func (a *Authenticator) installationTokenWithKeys(app *config.GitHubApp, repoURL string) (string, time.Time, error) {
+	// Get private keys from secure storage, active key first
+	privateKeys, err := app.GetPrivateKeys(a.secretsManager)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to generate JWT: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to get private key: %w", err)
+	}
+
+	for i, key := range privateKeys {
+		mint := func() (string, error) { return a.keyJWT(app, key) }
+
+		token, expiresAt, err := a.exchangeJWT(mint, a.installationExchange(app, repoURL))
+		if err == nil {
+			return token, expiresAt, nil
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			// Don't reuse JWTs signed with a key GitHub rejected
+			a.invalidateKeyJWTs(app, key)
+		}
+		if !errors.Is(err, ErrUnauthorized) || i == len(privateKeys)-1 {
+			return "", time.Time{}, err
+		}
 	}
+	return "", time.Time{}, fmt.Errorf("no private key configured")
+}
 
-	// Get installation token from GitHub API
-	installationToken, err := a.GetInstallationToken(jwtToken, app.InstallationID, repoURL)
+// keyJWT mints a JWT for app signed with one of its private keys
+func (a *Authenticator) keyJWT(app *config.GitHubApp, key config.LabeledPrivateKey) (string, error) {
+	privateKey, err := a.decryptPrivateKey(app, key.PEM)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get installation token: %w", err)
+		return "", fmt.Errorf("failed to decrypt private key %q: %w", key.Label, err)
 	}
+	jwtToken, err := a.jwtGenerator.GenerateTokenFromKeyForIssuer(JWTIssuer(app), privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate JWT with key %q: %w", key.Label, err)
+	}
+	return jwtToken, nil
+}
 
-	// Cache the token for 55 minutes (GitHub tokens valid for 60 minutes, 5-min buffer)
-	// SECURITY: Token stored in memory only, not persisted to disk. See docs/TOKEN_CACHING.md
-	a.tokenCache.Set(cacheKey, installationToken, 55*time.Minute)
+// invalidateKeyJWTs drops the cached JWTs signed with a private key GitHub rejected
+func (a *Authenticator) invalidateKeyJWTs(app *config.GitHubApp, key config.LabeledPrivateKey) {
+	if privateKey, err := a.decryptPrivateKey(app, key.PEM); err == nil {
+		a.jwtGenerator.InvalidateKey(privateKey)
+	}
+}
 
-	// Return credentials
-	username = fmt.Sprintf("%s[bot]", app.Name)
-	return installationToken, username, nil
+// InvalidateCredentials drops the cached installation token for a repository and the JWTs
+// for an app so the next GetCredentials call mints new ones.
+func (a *Authenticator) InvalidateCredentials(app *config.GitHubApp, repoURL string) {
+	a.tokenCache.Delete(tokenCacheKey(app, repoURL))
+	a.jwtGenerator.InvalidateApp(app.AppID)
+}
+
+// tokenCacheKey keys an app's installation tokens by its installation or, for apps
+// without an installation ID, by the account owning the repository: each account
+// the app is installed on has its own installation.
+func tokenCacheKey(app *config.GitHubApp, repoURL string) string {
+	if app.InstallationID != 0 {
+		return cache.CreateCacheKey(app.AppID, app.InstallationID)
+	}
+	owner, _ := parseOwnerFromURL(repoURL)
+	return cache.CreateOwnerCacheKey(app.AppID, extractHostFromURL(repoURL), owner)
 }
 
 // GenerateJWT generates a JWT token for the GitHub App (legacy file-based method).
@@ -89,44 +231,84 @@ func (a *Authenticator) GenerateJWT(appID int64, privateKeyPath string) (string,
 	return a.jwtGenerator.GenerateToken(appID, privateKeyPath)
 }
 
-// GenerateJWTForApp generates a JWT token using the app's configured private key source.
+// GenerateJWTForApp generates a JWT token using the app's external signer or configured private key source.
 func (a *Authenticator) GenerateJWTForApp(app *config.GitHubApp) (string, error) {
+	if app.Signer != nil {
+		signer, err := NewSigner(app)
+		if err != nil {
+			return "", err
+		}
+		return a.jwtGenerator.GenerateTokenWithSignerForIssuer(JWTIssuer(app), signer)
+	}
+
 	// Get private key from secure storage
 	privateKey, err := app.GetPrivateKey(a.secretsManager)
 	if err != nil {
 		return "", fmt.Errorf("failed to get private key: %w", err)
 	}
 
+	privateKey, err = a.decryptPrivateKey(app, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+
 	// Generate JWT token
-	return a.jwtGenerator.GenerateTokenFromKey(app.AppID, privateKey)
+	return a.jwtGenerator.GenerateTokenFromKeyForIssuer(JWTIssuer(app), privateKey)
+}
+
+// JWTIssuer returns the JWT issuer of an app: its client ID when configured, else its app ID
+func JWTIssuer(app *config.GitHubApp) jwt.Issuer {
+	return jwt.Issuer{AppID: app.AppID, ClientID: app.ClientID}
+}
+
+// NewSigner creates the external JWT signer configured for an app.
+func NewSigner(app *config.GitHubApp) (jwt.Signer, error) {
+	if app.Signer == nil {
+		return nil, fmt.Errorf("no signer configured for app %q", app.Name)
+	}
+
+	switch app.Signer.Type {
+	case config.SignerTypeExec:
+		return jwt.NewExecSigner(app.Signer.Command, app.Signer.Args, app.AppID), nil
+	default:
+		return nil, fmt.Errorf("unsupported signer type: %s", app.Signer.Type)
+	}
 }
 
 // GetInstallationToken exchanges JWT for an installation access token.
 func (a *Authenticator) GetInstallationToken(jwtToken string, installationID int64, repoURL string) (string, error) {
+	token, _, err := a.GetInstallationTokenWithExpiry(jwtToken, installationID, repoURL)
+	return token, err
+}
+
+// GetInstallationTokenWithExpiry exchanges JWT for an installation access token and returns its expiry.
+func (a *Authenticator) GetInstallationTokenWithExpiry(
+	jwtToken string, installationID int64, repoURL string,
+) (string, time.Time, error) {
 	// Extract host from repository URL (default to github.com)
 	host := extractHostFromURL(repoURL)
 
-	// If installation ID is not provided, try to find it
+	// If installation ID is not provided, find the one serving the repository's owner
 	if installationID == 0 {
-		var err error
-		installationID, err = a.findInstallationIDHTTP(jwtToken, host, repoURL)
+		owner, err := parseOwnerFromURL(repoURL)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to find installation ID: %w", err)
+		}
+		installationID, err = discoverInstallationID(jwtToken, APIBaseURL(host), owner)
 		if err != nil {
-			return "", fmt.Errorf("failed to find installation ID: %w", err)
+			return "", time.Time{}, fmt.Errorf("failed to find installation ID: %w", err)
 		}
 	}
 
 	// Request installation access token using raw HTTP
-	apiURL := fmt.Sprintf("https://%s/api/v3/app/installations/%d/access_tokens", host, installationID)
-	if host == gitHubAPIHost {
-		apiURL = fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installationID)
-	}
+	apiURL := fmt.Sprintf("%s/app/installations/%d/access_tokens", APIBaseURL(host), installationID)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader([]byte("{}")))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
@@ -136,17 +318,16 @@ func (a *Authenticator) GetInstallationToken(jwtToken string, installationID int
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get installation token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to get installation token: %w", err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
-			fmt.Printf("warning: failed to close response body: %v\n", closeErr)
+			fmt.Fprintf(os.Stderr, "warning: failed to close response body: %v\n", closeErr)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+		return "", time.Time{}, newAPIStatusError(resp)
 	}
 
 	var tokenResponse struct {
@@ -155,62 +336,63 @@ func (a *Authenticator) GetInstallationToken(jwtToken string, installationID int
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return tokenResponse.Token, nil
+	return tokenResponse.Token, tokenResponse.ExpiresAt, nil
 }
 
-// findInstallationIDHTTP finds the installation ID for a repository using raw HTTP.
-func (a *Authenticator) findInstallationIDHTTP(jwtToken, host, repoURL string) (int64, error) {
-	// Extract owner and repo from URL
-	owner, repo, err := parseRepoURL(repoURL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse repository URL: %w", err)
+// APIBaseURL returns the REST API base URL for a GitHub host.
+// github.com is served from api.github.com; GHES hosts expose the API under /api/v3.
+func APIBaseURL(host string) string {
+	if host == "" || host == gitHubAPIHost {
+		return "https://api.github.com"
 	}
+	return fmt.Sprintf("https://%s/api/v3", host)
+}
 
-	// Construct API URL
-	apiURL := fmt.Sprintf("https://%s/api/v3/repos/%s/%s/installation", host, owner, repo)
-	if host == gitHubAPIHost {
-		apiURL = fmt.Sprintf("https://api.github.com/repos/%s/%s/installation", owner, repo)
+// GraphQLURL returns the GraphQL endpoint for a GitHub host.
+func GraphQLURL(host string) string {
+	if host == "" || host == gitHubAPIHost {
+		return "https://api.github.com/graphql"
 	}
+	return fmt.Sprintf("https://%s/api/graphql", host)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// linkNextPattern extracts the rel="next" URL from a Link header
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+// NextPageURL returns the rel="next" URL of a paginated API response's Link header,
+// or empty if there is none.
+func NextPageURL(linkHeader string) string {
+	match := linkNextPattern.FindStringSubmatch(linkHeader)
+	if len(match) < 2 {
+		return ""
 	}
+	return match[1]
+}
 
-	req.Header.Set("Authorization", "Bearer "+jwtToken)
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get installation: %w", err)
+// FollowNextPage returns the rel="next" URL of the Link header of the response for
+// pageURL, or empty if there is none. A next page on another scheme or host is refused:
+// requests for it would carry the same credentials.
+func FollowNextPage(linkHeader, pageURL string) (string, error) {
+	next := NextPageURL(linkHeader)
+	if next == "" {
+		return "", nil
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			fmt.Printf("warning: failed to close response body: %v\n", closeErr)
-		}
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+	current, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid page URL %q: %w", pageURL, err)
 	}
-
-	var installation struct {
-		ID int64 `json:"id"`
+	nextURL, err := url.Parse(next)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page URL %q: %w", next, err)
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&installation); err != nil {
-		return 0, fmt.Errorf("failed to decode response: %w", err)
+	if nextURL.Scheme != current.Scheme || !strings.EqualFold(nextURL.Host, current.Host) {
+		return "", fmt.Errorf("refusing to follow next page %s: it is not on %s://%s", next, current.Scheme, current.Host)
 	}
-
-	return installation.ID, nil
+	return next, nil
 }
 
 // extractHostFromURL extracts the host from a repository URL.
@@ -1,9 +1,15 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/cache"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
 )
 
 func TestNewAuthenticator(t *testing.T) {
@@ -161,6 +167,47 @@ func TestGenerateJWTForApp(t *testing.T) {
 	t.Skip("Requires properly formatted RSA key - tracked in TESTING_IMPROVEMENTS_TODO.md")
 }
 
+// TestNewSigner validates signer selection from the app configuration
+func TestNewSigner(t *testing.T) {
+	app := &config.GitHubApp{
+		Name:   "hsm-app",
+		AppID:  123,
+		Signer: &config.SignerConfig{Type: config.SignerTypeExec, Command: "hsm-sign", Args: []string{"--slot", "0"}},
+	}
+
+	signer, err := NewSigner(app)
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	execSigner, ok := signer.(*jwt.ExecSigner)
+	if !ok {
+		t.Fatalf("NewSigner() = %T, want *jwt.ExecSigner", signer)
+	}
+	if execSigner.Command != "hsm-sign" || len(execSigner.Args) != 2 || execSigner.AppID != 123 {
+		t.Errorf("exec signer = %+v", execSigner)
+	}
+
+	app.Signer.Type = "unknown"
+	if _, err := NewSigner(app); err == nil {
+		t.Error("Expected error for unsupported signer type")
+	}
+}
+
+// TestGenerateJWTForApp_SignerFailure validates that signer errors are surfaced without
+// falling back to a private key
+func TestGenerateJWTForApp_SignerFailure(t *testing.T) {
+	auth := NewAuthenticator()
+	app := &config.GitHubApp{
+		Name:   "hsm-app",
+		AppID:  123,
+		Signer: &config.SignerConfig{Type: config.SignerTypeExec, Command: "/nonexistent/hsm-sign"},
+	}
+
+	if _, err := auth.GenerateJWTForApp(app); err == nil {
+		t.Error("Expected error from failing signer")
+	}
+}
+
 // TestTokenCaching validates that tokens are properly cached
 func TestTokenCaching(t *testing.T) {
 	auth := NewAuthenticator()
@@ -192,6 +239,39 @@ func TestTokenCaching(t *testing.T) {
 	}
 }
 
+// TestInvalidateCredentials validates that invalidation drops the cached token
+func TestInvalidateCredentials(t *testing.T) {
+	auth := NewAuthenticator()
+	app := &config.GitHubApp{AppID: 123, InstallationID: 456}
+	cacheKey := cache.CreateCacheKey(app.AppID, app.InstallationID)
+
+	auth.tokenCache.Set(cacheKey, "ghs_test_token", time.Minute)
+	auth.InvalidateCredentials(app, "https://github.com/org/repo")
+
+	if _, found := auth.tokenCache.Get(cacheKey); found {
+		t.Error("Expected token to be removed from cache")
+	}
+}
+
+// TestAPIStatusErrorUnauthorized validates that only 401 responses trigger the key fallback
+func TestAPIStatusErrorUnauthorized(t *testing.T) {
+	err := fmt.Errorf("failed to find installation ID: %w",
+		&apiStatusError{StatusCode: http.StatusUnauthorized, Body: "Bad credentials"})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Error("Expected 401 to match ErrUnauthorized")
+	}
+	if got := err.Error(); got != "failed to find installation ID: GitHub API returned status 401: Bad credentials" {
+		t.Errorf("Error() = %q", got)
+	}
+
+	if errors.Is(&apiStatusError{StatusCode: http.StatusNotFound}, ErrUnauthorized) {
+		t.Error("Expected 404 not to match ErrUnauthorized")
+	}
+	if !errors.Is(&apiStatusError{StatusCode: http.StatusNotFound}, ErrNotFound) {
+		t.Error("Expected 404 to match ErrNotFound")
+	}
+}
+
 // TestAuthenticatorConcurrency tests concurrent access to the authenticator
 func TestAuthenticatorConcurrency(t *testing.T) {
 	t.Skip("Requires properly formatted RSA key - tracked in TESTING_IMPROVEMENTS_TODO.md")
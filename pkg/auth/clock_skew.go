@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+)
+
+const (
+	// JWTBackdateEnv overrides how far the JWT iat claim is backdated (e.g. "90s")
+	JWTBackdateEnv = "GH_APP_AUTH_JWT_BACKDATE"
+	// clockOffsetFile persists the measured offset to GitHub's clock between runs
+	clockOffsetFile = "clock-offset"
+	// dateResolution is the precision of the HTTP Date header
+	dateResolution = time.Second
+)
+
+// configureClock applies the iat backdate override and the last measured clock offset
+func (a *Authenticator) configureClock() {
+	if value := os.Getenv(JWTBackdateEnv); value != "" {
+		backdate, err := time.ParseDuration(value)
+		if err != nil || backdate < 0 {
+			fmt.Fprintf(os.Stderr, "warning: ignoring invalid %s=%q\n", JWTBackdateEnv, value)
+		} else {
+			a.jwtGenerator.SetIssuedAtBackdate(backdate)
+		}
+	}
+
+	if a.clockOffsetPath == "" {
+		return
+	}
+	data, err := os.ReadFile(a.clockOffsetPath)
+	if err != nil {
+		return
+	}
+	if offset, err := time.ParseDuration(strings.TrimSpace(string(data))); err == nil {
+		a.jwtGenerator.SetClockOffset(offset)
+	}
+}
+
+// setClockOffset makes JWTs use GitHub's clock and remembers the offset for later runs
+func (a *Authenticator) setClockOffset(offset time.Duration) {
+	a.jwtGenerator.SetClockOffset(offset)
+	if a.clockOffsetPath == "" {
+		return
+	}
+	// Best effort: the offset is measured again if GitHub rejects a JWT
+	_ = os.WriteFile(a.clockOffsetPath, []byte(offset.String()+"\n"), 0600)
+}
+
+// exchangeJWT mints a JWT and exchanges it for an installation token. If GitHub rejects
+// the JWT because of clock skew, the offset is read from the response Date header and
+// the JWT is minted again on GitHub's clock.
+func (a *Authenticator) exchangeJWT(
+	mint func() (string, error), exchange func(jwtToken string) (string, time.Time, error),
+) (string, time.Time, error) {
+	retried := false
+	for {
+		jwtToken, err := mint()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		token, expiresAt, err := exchange(jwtToken)
+		if err == nil {
+			return token, expiresAt, nil
+		}
+
+		offset, skewed := clockSkewFromError(err, time.Now())
+		if !skewed || retried {
+			return "", time.Time{}, fmt.Errorf("failed to get installation token: %w", err)
+		}
+		a.setClockOffset(offset)
+		retried = true
+	}
+}
+
+// AppJWTTransport returns a RoundTripper that authenticates requests with JWTs for app,
+// from its external signer or private keys. Like installation token exchanges, a request
+// whose JWT GitHub rejects for clock skew is sent once more with a JWT minted on GitHub's
+// clock, and a request GitHub rejects with 401 is sent again with the app's next private
+// key. base sends the requests; nil means http.DefaultTransport.
+func (a *Authenticator) AppJWTTransport(app *config.GitHubApp, base http.RoundTripper) http.RoundTripper {
+	return &jwtTransport{
+		authenticator: a,
+		keys:          func() ([]jwtKey, error) { return a.appJWTKeys(app) },
+		base:          base,
+	}
+}
+
+// KeyJWTTransport is like AppJWTTransport with JWTs signed by a given private key, e.g.
+// to verify a key before it is configured
+func (a *Authenticator) KeyJWTTransport(
+	issuer jwt.Issuer, privateKey string, base http.RoundTripper,
+) http.RoundTripper {
+	return &jwtTransport{
+		authenticator: a,
+		keys: singleJWTKey(func() (string, error) {
+			return a.jwtGenerator.GenerateTokenFromKeyForIssuer(issuer, privateKey)
+		}),
+		base: base,
+	}
+}
+
+// jwtKey mints the JWTs of one signing key
+type jwtKey struct {
+	mint func() (string, error)
+	// invalidate drops the cached JWTs of a key GitHub rejected; nil if there are none
+	invalidate func()
+}
+
+// singleJWTKey returns the keys of a transport signing with a single key
+func singleJWTKey(mint func() (string, error)) func() ([]jwtKey, error) {
+	return func() ([]jwtKey, error) {
+		return []jwtKey{{mint: mint}}, nil
+	}
+}
+
+// appJWTKeys returns the signing keys of an app: its external signer, or its private keys
+// with the active key first
+func (a *Authenticator) appJWTKeys(app *config.GitHubApp) ([]jwtKey, error) {
+	if app.Signer != nil {
+		return singleJWTKey(func() (string, error) { return a.GenerateJWTForApp(app) })()
+	}
+
+	privateKeys, err := app.GetPrivateKeys(a.secretsManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private key: %w", err)
+	}
+	keys := make([]jwtKey, 0, len(privateKeys))
+	for _, key := range privateKeys {
+		keys = append(keys, jwtKey{
+			mint:       func() (string, error) { return a.keyJWT(app, key) },
+			invalidate: func() { a.invalidateKeyJWTs(app, key) },
+		})
+	}
+	return keys, nil
+}
+
+// jwtTransport authenticates requests with JWTs, correcting the clock skew GitHub reports
+// and falling back to the next key when GitHub rejects one
+type jwtTransport struct {
+	authenticator *Authenticator
+	keys          func() ([]jwtKey, error)
+	base          http.RoundTripper
+}
+
+// RoundTrip sends req with a fresh JWT from each key in turn until GitHub accepts one
+func (t *jwtTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	keys, err := t.keys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT: %w", err)
+	}
+
+	sent := false
+	for i, key := range keys {
+		resp, err := t.roundTripWithKey(req, key, &sent)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || i == len(keys)-1 || !rewindable(req) {
+			return resp, err
+		}
+		// GitHub no longer accepts this key: don't reuse its JWTs and try the next one
+		_ = resp.Body.Close()
+		if key.invalidate != nil {
+			key.invalidate()
+		}
+	}
+	return nil, fmt.Errorf("failed to generate JWT: no private key configured")
+}
+
+// roundTripWithKey sends req with a fresh JWT from key, and once more after a clock skew
+// rejection. sent records whether req's body was already consumed by an earlier attempt.
+func (t *jwtTransport) roundTripWithKey(req *http.Request, key jwtKey, sent *bool) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	for retried := false; ; retried = true {
+		jwtToken, err := key.mint()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate JWT: %w", err)
+		}
+
+		attempt := req.Clone(req.Context())
+		if *sent && req.Body != nil {
+			if attempt.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+		}
+		attempt.Header.Set("Authorization", "Bearer "+jwtToken)
+
+		resp, err := base.RoundTrip(attempt)
+		*sent = true
+		if err != nil || retried || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+
+		// Read the rejection to look for clock skew, then hand it on unread if there is none
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		apiErr := &apiStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			apiErr.Date = date
+		}
+		offset, skewed := clockSkewFromError(apiErr, time.Now())
+		if !skewed || !rewindable(req) {
+			return resp, nil
+		}
+		t.authenticator.setClockOffset(offset)
+	}
+}
+
+// rewindable reports whether req can be sent again
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.GetBody != nil
+}
+
+// clockSkewFromError returns GitHub's clock minus the local clock when err reports
+// a JWT rejected for clock skew on a response that carried a Date header.
+func clockSkewFromError(err error, now time.Time) (time.Duration, bool) {
+	var apiErr *apiStatusError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Date.IsZero() {
+		return 0, false
+	}
+	for _, msg := range clockSkewMessages {
+		if strings.Contains(apiErr.Body, msg) {
+			return apiErr.Date.Add(dateResolution / 2).Sub(now).Round(time.Second), true
+		}
+	}
+	return 0, false
+}
+
+// MeasureClockSkew returns GitHub's clock minus the local clock, from the Date header
+// of an unauthenticated request to the API. The result has one second resolution.
+func MeasureClockSkew(ctx context.Context, apiBaseURL string) (time.Duration, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodHead, apiBaseURL+"/", nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	sent := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach GitHub API: %w", err)
+	}
+	received := time.Now()
+	_ = resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("response has no valid Date header")
+	}
+
+	// Compare the middle of the server's second against the middle of the round trip
+	local := sent.Add(received.Sub(sent) / 2)
+	return date.Add(dateResolution / 2).Sub(local).Round(time.Second), nil
+}
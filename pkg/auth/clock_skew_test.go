@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+func skewError(date time.Time) error {
+	return fmt.Errorf("failed to get installation token: %w", &apiStatusError{
+		StatusCode: http.StatusUnauthorized,
+		Body:       `{"message":"'Issued at' claim ('iat') must be an Integer representing a time in the past"}`,
+		Date:       date,
+	})
+}
+
+func TestClockSkewFromError(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantOffset time.Duration
+		wantSkewed bool
+	}{
+		{"server behind", skewError(now.Add(-90 * time.Second)), -90 * time.Second, true},
+		{"server ahead", skewError(now.Add(2 * time.Minute)), 121 * time.Second, true},
+		{"expiration claim", &apiStatusError{
+			StatusCode: http.StatusUnauthorized,
+			Body:       "'Expiration time' claim ('exp') is too far in the future",
+			Date:       now,
+		}, time.Second, true},
+		{"no date header", skewError(time.Time{}), 0, false},
+		{"bad credentials", &apiStatusError{
+			StatusCode: http.StatusUnauthorized, Body: "Bad credentials", Date: now,
+		}, 0, false},
+		{"not found", &apiStatusError{StatusCode: http.StatusNotFound, Body: "'Issued at' claim", Date: now}, 0, false},
+		{"other error", errors.New("connection refused"), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, skewed := clockSkewFromError(tt.err, now)
+			if skewed != tt.wantSkewed || offset != tt.wantOffset {
+				t.Errorf("clockSkewFromError() = (%v, %v), want (%v, %v)", offset, skewed, tt.wantOffset, tt.wantSkewed)
+			}
+		})
+	}
+}
+
+func TestExchangeJWT_RetriesOnClockSkew(t *testing.T) {
+	a := &Authenticator{
+		jwtGenerator:    jwt.NewGenerator(),
+		clockOffsetPath: filepath.Join(t.TempDir(), clockOffsetFile),
+	}
+
+	mints, exchanges := 0, 0
+	mint := func() (string, error) {
+		mints++
+		return fmt.Sprintf("jwt-%d", mints), nil
+	}
+	exchange := func(jwtToken string) (string, time.Time, error) {
+		exchanges++
+		if jwtToken == "jwt-1" {
+			return "", time.Time{}, skewError(time.Now().Add(-5 * time.Minute))
+		}
+		return "token", time.Now().Add(time.Hour), nil
+	}
+
+	token, _, err := a.exchangeJWT(mint, exchange)
+	if err != nil {
+		t.Fatalf("exchangeJWT() error = %v", err)
+	}
+	if token != "token" || mints != 2 || exchanges != 2 {
+		t.Errorf("token = %q, mints = %d, exchanges = %d", token, mints, exchanges)
+	}
+
+	offset := a.jwtGenerator.ClockOffset()
+	if offset > -4*time.Minute || offset < -6*time.Minute {
+		t.Errorf("ClockOffset() = %v, want about -5m", offset)
+	}
+	data, err := os.ReadFile(a.clockOffsetPath)
+	if err != nil {
+		t.Fatalf("offset was not persisted: %v", err)
+	}
+	if strings.TrimSpace(string(data)) != offset.String() {
+		t.Errorf("persisted offset = %q, want %q", data, offset)
+	}
+}
+
+func TestExchangeJWT_RetriesOnlyOnce(t *testing.T) {
+	a := &Authenticator{jwtGenerator: jwt.NewGenerator()}
+
+	exchanges := 0
+	mint := func() (string, error) { return "jwt", nil }
+	exchange := func(string) (string, time.Time, error) {
+		exchanges++
+		return "", time.Time{}, skewError(time.Now().Add(time.Hour))
+	}
+
+	_, _, err := a.exchangeJWT(mint, exchange)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("exchangeJWT() error = %v, want ErrUnauthorized", err)
+	}
+	if exchanges != 2 {
+		t.Errorf("exchanges = %d, want 2", exchanges)
+	}
+
+	exchanges = 0
+	_, _, err = a.exchangeJWT(mint, func(string) (string, time.Time, error) {
+		exchanges++
+		return "", time.Time{}, &apiStatusError{StatusCode: http.StatusUnauthorized, Body: "Bad credentials"}
+	})
+	if err == nil || exchanges != 1 {
+		t.Errorf("exchangeJWT() error = %v, exchanges = %d; want no retry", err, exchanges)
+	}
+}
+
+func TestJWTTransport_RetriesOnClockSkew(t *testing.T) {
+	// Given a server that rejects the first JWT for clock skew
+	var authorizations, bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		bodies = append(bodies, string(body))
+		if len(authorizations) == 1 {
+			w.Header().Set("Date", time.Now().Add(-5*time.Minute).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"'Expiration time' claim ('exp') is too far in the future"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer server.Close()
+
+	a := &Authenticator{
+		jwtGenerator:    jwt.NewGenerator(),
+		clockOffsetPath: filepath.Join(t.TempDir(), clockOffsetFile),
+	}
+	mints := 0
+	client := &http.Client{Transport: &jwtTransport{
+		authenticator: a,
+		keys: singleJWTKey(func() (string, error) {
+			mints++
+			return fmt.Sprintf("jwt-%d", mints), nil
+		}),
+	}}
+
+	// When a request with a body is sent
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Then it is resent once with a JWT minted after correcting the clock
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if strings.Join(authorizations, ",") != "Bearer jwt-1,Bearer jwt-2" {
+		t.Errorf("authorizations = %v", authorizations)
+	}
+	if strings.Join(bodies, ",") != "payload,payload" {
+		t.Errorf("bodies = %v", bodies)
+	}
+	if offset := a.jwtGenerator.ClockOffset(); offset > -4*time.Minute || offset < -6*time.Minute {
+		t.Errorf("ClockOffset() = %v, want about -5m", offset)
+	}
+}
+
+func TestJWTTransport_PassesOtherRejections(t *testing.T) {
+	// Given a server rejecting credentials for another reason
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.Header().Set("Date", time.Now().Add(-5*time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+	}))
+	defer server.Close()
+
+	a := &Authenticator{jwtGenerator: jwt.NewGenerator()}
+	client := &http.Client{Transport: &jwtTransport{
+		authenticator: a,
+		keys:          singleJWTKey(func() (string, error) { return "jwt", nil }),
+	}}
+
+	// When a request is sent
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Then the rejection is returned as is, without a retry
+	body, _ := io.ReadAll(resp.Body)
+	if requests != 1 || resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "Bad credentials") {
+		t.Errorf("requests = %d, status = %d, body = %q", requests, resp.StatusCode, body)
+	}
+	if offset := a.jwtGenerator.ClockOffset(); offset != 0 {
+		t.Errorf("ClockOffset() = %v, want 0", offset)
+	}
+}
+
+func TestAppJWTTransport_FallsBackToNextKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	// Given an app whose active key was revoked on GitHub but whose fallback key is valid
+	fallbackKey := generateTestRSAKey(t)
+	revokedKey := generateTestRSAKey(t)
+	app := &config.GitHubApp{Name: "CI Bot", AppID: 42, Patterns: []string{"github.com/myorg/*"}}
+	if _, err := app.AddPrivateKey(secretMgr, "fallback", fallbackKey, time.Now()); err != nil {
+		t.Fatalf("AddPrivateKey() error = %v", err)
+	}
+	if _, err := app.AddPrivateKey(secretMgr, "active", revokedKey, time.Now()); err != nil {
+		t.Fatalf("AddPrivateKey() error = %v", err)
+	}
+
+	var signers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !jwtSignedBy(t, fallbackKey, token) {
+			signers = append(signers, "revoked")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"A JSON web token could not be decoded"}`))
+			return
+		}
+		signers = append(signers, "fallback")
+		_, _ = w.Write([]byte(`{"id":42}`))
+	}))
+	defer server.Close()
+
+	a := &Authenticator{jwtGenerator: jwt.NewGenerator(), secretsManager: secretMgr}
+	client := &http.Client{Transport: a.AppJWTTransport(app, nil)}
+
+	// When a request is sent through the app's JWT transport
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// Then the 401 for the active key is retried with the fallback key
+	if resp.StatusCode != http.StatusOK || strings.Join(signers, ",") != "revoked,fallback" {
+		t.Errorf("status = %d, signers = %v; want 200 after revoked,fallback", resp.StatusCode, signers)
+	}
+}
+
+// jwtSignedBy reports whether a JWT's RS256 signature matches the public half of a PEM key
+func jwtSignedBy(t *testing.T, keyPEM, token string) bool {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	block, _ := pem.Decode([]byte(keyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature) == nil
+}
+
+func TestConfigureClock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), clockOffsetFile)
+	if err := os.WriteFile(path, []byte("-42s\n"), 0600); err != nil {
+		t.Fatalf("Failed to write offset: %v", err)
+	}
+	t.Setenv(JWTBackdateEnv, "90s")
+
+	a := &Authenticator{jwtGenerator: jwt.NewGenerator(), clockOffsetPath: path}
+	a.configureClock()
+
+	if got := a.jwtGenerator.ClockOffset(); got != -42*time.Second {
+		t.Errorf("ClockOffset() = %v, want -42s", got)
+	}
+
+	token, err := a.jwtGenerator.GenerateTokenFromKey(1, generateTestRSAKey(t))
+	if err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+	claims, err := a.jwtGenerator.GetTokenClaims(token)
+	if err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+	iat, _ := claims["iat"].(float64)
+	want := time.Now().Add(-42*time.Second - 90*time.Second).Unix()
+	if diff := int64(iat) - want; diff < -2 || diff > 2 {
+		t.Errorf("iat = %d, want about %d", int64(iat), want)
+	}
+}
+
+func TestMeasureClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-3*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	skew, err := MeasureClockSkew(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("MeasureClockSkew() error = %v", err)
+	}
+	if skew < -181*time.Second || skew > -179*time.Second {
+		t.Errorf("MeasureClockSkew() = %v, want about -3m", skew)
+	}
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Device flow errors reported by GitHub's OAuth endpoints
+var (
+	// ErrAccessDenied is returned when the user cancels the authorization
+	ErrAccessDenied = errors.New("authorization denied by the user")
+	// ErrDeviceCodeExpired is returned when the user did not enter the code in time
+	ErrDeviceCodeExpired = errors.New("device code expired")
+	// ErrBadRefreshToken is returned for refresh tokens that are expired, revoked or already used
+	ErrBadRefreshToken = errors.New("refresh token is invalid or expired")
+)
+
+const (
+	// deviceGrantType is the OAuth grant type of the device flow (RFC 8628)
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	// slowDownIncrement is added to the polling interval when GitHub asks to slow down
+	slowDownIncrement = 5 * time.Second
+)
+
+// DeviceCode is the code the user enters at VerificationURI to authorize the app
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// UserToken is a GitHub App user-to-server token. ExpiresAt and RefreshTokenExpiresAt are
+// zero, and RefreshToken empty, when the app has user token expiration disabled.
+type UserToken struct {
+	AccessToken           string
+	RefreshToken          string
+	ExpiresAt             time.Time
+	RefreshTokenExpiresAt time.Time
+}
+
+// DeviceFlow obtains and refreshes GitHub App user tokens with the OAuth device flow
+type DeviceFlow struct {
+	ClientID string
+	// ClientSecret is sent when refreshing tokens, if set
+	ClientSecret string
+	// BaseURL is the web URL of the GitHub host, e.g. https://github.com
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// oauthResponse is the body of GitHub's token endpoint, which reports errors with status 200
+type oauthResponse struct {
+	AccessToken           string `json:"access_token"`
+	ExpiresIn             int64  `json:"expires_in"`
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresIn int64  `json:"refresh_token_expires_in"`
+	Interval              int    `json:"interval"`
+	Error                 string `json:"error"`
+	ErrorDescription      string `json:"error_description"`
+}
+
+// OAuthBaseURL returns the web URL of a GitHub host, which serves the OAuth endpoints
+func OAuthBaseURL(host string) string {
+	if host == "" || host == gitHubAPIHost {
+		return "https://github.com"
+	}
+	return "https://" + host
+}
+
+// NewDeviceFlow creates a device flow client for an app's client ID on a GitHub host
+func NewDeviceFlow(clientID, host string) *DeviceFlow {
+	return &DeviceFlow{
+		ClientID:   clientID,
+		BaseURL:    OAuthBaseURL(host),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// RequestCode starts the device flow and returns the code for the user to enter
+func (f *DeviceFlow) RequestCode(ctx context.Context) (*DeviceCode, error) {
+	var code DeviceCode
+	resp, err := f.post(ctx, "/login/device/code", url.Values{"client_id": {f.ClientID}}, &code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request device code: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("failed to request device code: %s", describeOAuthError(resp))
+	}
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return nil, fmt.Errorf("failed to request device code: response has no code")
+	}
+	return &code, nil
+}
+
+// PollToken waits for the user to authorize the device code and returns the user token
+func (f *DeviceFlow) PollToken(ctx context.Context, code *DeviceCode) (*UserToken, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	var expired <-chan time.Time
+	if code.ExpiresIn > 0 {
+		timer := time.NewTimer(time.Duration(code.ExpiresIn) * time.Second)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	params := url.Values{
+		"client_id":   {f.ClientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {deviceGrantType},
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-expired:
+			return nil, ErrDeviceCodeExpired
+		case <-time.After(interval):
+		}
+
+		resp, err := f.post(ctx, "/login/oauth/access_token", params, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll for user token: %w", err)
+		}
+
+		switch resp.Error {
+		case "":
+			return newUserToken(resp, time.Now())
+		case "authorization_pending":
+		case "slow_down":
+			interval += slowDownIncrement
+			if resp.Interval > 0 {
+				interval = time.Duration(resp.Interval) * time.Second
+			}
+		case "expired_token":
+			return nil, ErrDeviceCodeExpired
+		case "access_denied":
+			return nil, ErrAccessDenied
+		default:
+			return nil, fmt.Errorf("failed to poll for user token: %s", describeOAuthError(resp))
+		}
+	}
+}
+
+// Refresh exchanges a refresh token for a new user token. GitHub rotates the refresh
+// token too, so the returned one replaces the old one, which can no longer be used.
+func (f *DeviceFlow) Refresh(ctx context.Context, refreshToken string) (*UserToken, error) {
+	params := url.Values{
+		"client_id":     {f.ClientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+	if f.ClientSecret != "" {
+		params.Set("client_secret", f.ClientSecret)
+	}
+
+	resp, err := f.post(ctx, "/login/oauth/access_token", params, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh user token: %w", err)
+	}
+	switch resp.Error {
+	case "":
+		return newUserToken(resp, time.Now())
+	case "bad_refresh_token":
+		return nil, ErrBadRefreshToken
+	default:
+		return nil, fmt.Errorf("failed to refresh user token: %s", describeOAuthError(resp))
+	}
+}
+
+// post sends a form to an OAuth endpoint and returns the decoded response; unless it
+// reports an error, the response is also decoded into out when set
+func (f *DeviceFlow) post(ctx context.Context, path string, params url.Values, out any) (*oauthResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(f.BaseURL, "/")+path,
+		strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result oauthResponse
+	if err := json.Unmarshal(body, &result); err != nil || (resp.StatusCode != http.StatusOK && result.Error == "") {
+		return nil, fmt.Errorf("GitHub returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if out != nil && result.Error == "" {
+		if err := json.Unmarshal(body, out); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return &result, nil
+}
+
+// newUserToken converts a token response, whose lifetimes are relative to now
+func newUserToken(resp *oauthResponse, now time.Time) (*UserToken, error) {
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token")
+	}
+	token := &UserToken{AccessToken: resp.AccessToken, RefreshToken: resp.RefreshToken}
+	if resp.ExpiresIn > 0 {
+		token.ExpiresAt = now.Add(time.Duration(resp.ExpiresIn) * time.Second).UTC()
+	}
+	if resp.RefreshTokenExpiresIn > 0 {
+		token.RefreshTokenExpiresAt = now.Add(time.Duration(resp.RefreshTokenExpiresIn) * time.Second).UTC()
+	}
+	return token, nil
+}
+
+// describeOAuthError formats an OAuth error response
+func describeOAuthError(resp *oauthResponse) string {
+	if resp.ErrorDescription != "" {
+		return fmt.Sprintf("%s (%s)", resp.ErrorDescription, resp.Error)
+	}
+	return resp.Error
+}
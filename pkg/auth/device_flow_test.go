@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOAuthServer mocks GitHub's device flow endpoints. pollResponses are returned in
+// order by the token endpoint for the device code grant; refresh tokens are rotated.
+type fakeOAuthServer struct {
+	*httptest.Server
+	mu            sync.Mutex
+	pollResponses []map[string]any
+	polls         int
+	refreshToken  string
+	clientSecrets []string
+}
+
+func newFakeOAuthServer(t *testing.T, pollResponses ...map[string]any) *fakeOAuthServer {
+	t.Helper()
+	f := &fakeOAuthServer{pollResponses: pollResponses, refreshToken: "ghr_initial"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "Iv1.test" {
+			writeJSON(w, map[string]any{"error": "incorrect_client_credentials"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"device_code":      "dc_123",
+			"user_code":        "ABCD-1234",
+			"verification_uri": "https://github.com/login/device",
+			"expires_in":       900,
+			"interval":         0,
+		})
+	})
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch r.FormValue("grant_type") {
+		case deviceGrantType:
+			if r.FormValue("device_code") != "dc_123" {
+				writeJSON(w, map[string]any{"error": "incorrect_device_code"})
+				return
+			}
+			resp := f.pollResponses[min(f.polls, len(f.pollResponses)-1)]
+			f.polls++
+			writeJSON(w, resp)
+		case "refresh_token":
+			f.clientSecrets = append(f.clientSecrets, r.FormValue("client_secret"))
+			if r.FormValue("refresh_token") != f.refreshToken {
+				writeJSON(w, map[string]any{"error": "bad_refresh_token"})
+				return
+			}
+			f.refreshToken = "ghr_" + time.Now().Format("150405.000000000")
+			writeJSON(w, tokenResponse("ghu_refreshed", f.refreshToken))
+		default:
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		}
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func tokenResponse(accessToken, refreshToken string) map[string]any {
+	return map[string]any{
+		"access_token":             accessToken,
+		"expires_in":               28800,
+		"refresh_token":            refreshToken,
+		"refresh_token_expires_in": 15897600,
+		"token_type":               "bearer",
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOAuthBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"":                   "https://github.com",
+		"github.com":         "https://github.com",
+		"github.example.com": "https://github.example.com",
+	}
+	for host, want := range tests {
+		if got := OAuthBaseURL(host); got != want {
+			t.Errorf("OAuthBaseURL(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestDeviceFlow_RequestCode(t *testing.T) {
+	server := newFakeOAuthServer(t)
+
+	flow := &DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+	code, err := flow.RequestCode(context.Background())
+	if err != nil {
+		t.Fatalf("RequestCode() failed: %v", err)
+	}
+	if code.UserCode != "ABCD-1234" || code.DeviceCode != "dc_123" || code.VerificationURI == "" {
+		t.Errorf("RequestCode() = %+v", code)
+	}
+
+	flow.ClientID = "Iv1.unknown"
+	if _, err := flow.RequestCode(context.Background()); err == nil {
+		t.Error("RequestCode() with an unknown client ID should fail")
+	}
+}
+
+func TestDeviceFlow_PollToken(t *testing.T) {
+	pending := map[string]any{"error": "authorization_pending"}
+
+	tests := []struct {
+		name      string
+		responses []map[string]any
+		wantErr   error
+		wantPolls int
+	}{
+		{
+			name:      "authorized after pending",
+			responses: []map[string]any{pending, pending, tokenResponse("ghu_new", "ghr_new")},
+			wantPolls: 3,
+		},
+		{
+			name:      "denied",
+			responses: []map[string]any{pending, {"error": "access_denied"}},
+			wantErr:   ErrAccessDenied,
+			wantPolls: 2,
+		},
+		{
+			name:      "expired",
+			responses: []map[string]any{{"error": "expired_token"}},
+			wantErr:   ErrDeviceCodeExpired,
+			wantPolls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeOAuthServer(t, tt.responses...)
+			flow := &DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+
+			// Given a device code the user acts on
+			code := &DeviceCode{DeviceCode: "dc_123", ExpiresIn: 900}
+
+			// When polling for the token
+			token, err := flow.PollToken(context.Background(), code)
+
+			// Then polling stops at the user's decision
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PollToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if server.polls != tt.wantPolls {
+				t.Errorf("Polls = %d, want %d", server.polls, tt.wantPolls)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if token.AccessToken != "ghu_new" || token.RefreshToken != "ghr_new" {
+				t.Errorf("PollToken() = %+v", token)
+			}
+			if until := time.Until(token.ExpiresAt); until < 7*time.Hour || until > 8*time.Hour {
+				t.Errorf("ExpiresAt in %v, want about 8h", until)
+			}
+			if token.RefreshTokenExpiresAt.Before(token.ExpiresAt) {
+				t.Errorf("RefreshTokenExpiresAt %v before ExpiresAt %v", token.RefreshTokenExpiresAt, token.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestDeviceFlow_PollTokenCancelled(t *testing.T) {
+	server := newFakeOAuthServer(t, map[string]any{"error": "authorization_pending"})
+	flow := &DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := flow.PollToken(ctx, &DeviceCode{DeviceCode: "dc_123", Interval: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PollToken() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDeviceFlow_Refresh(t *testing.T) {
+	server := newFakeOAuthServer(t)
+	flow := &DeviceFlow{ClientID: "Iv1.test", ClientSecret: "s3cret", BaseURL: server.URL}
+
+	token, err := flow.Refresh(context.Background(), "ghr_initial")
+	if err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	if token.AccessToken != "ghu_refreshed" || token.RefreshToken == "ghr_initial" || token.ExpiresAt.IsZero() {
+		t.Errorf("Refresh() = %+v, want a new access and refresh token", token)
+	}
+	if len(server.clientSecrets) != 1 || server.clientSecrets[0] != "s3cret" {
+		t.Errorf("Client secrets sent = %v, want [s3cret]", server.clientSecrets)
+	}
+
+	// Refresh tokens are single-use
+	if _, err := flow.Refresh(context.Background(), "ghr_initial"); !errors.Is(err, ErrBadRefreshToken) {
+		t.Errorf("Refresh() with a used token error = %v, want %v", err, ErrBadRefreshToken)
+	}
+}
+
+func TestDeviceFlow_HTTPError(t *testing.T) {
+	server := newFakeOAuthServer(t)
+	flow := &DeviceFlow{ClientID: "Iv1.test", BaseURL: server.URL + "/missing"}
+
+	if _, err := flow.RequestCode(context.Background()); err == nil {
+		t.Error("RequestCode() against a missing endpoint should fail")
+	}
+}
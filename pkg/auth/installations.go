@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// installationsFile persists the installation IDs discovered for apps configured without one
+const installationsFile = "installations.json"
+
+// ErrNotFound is matched by API errors for requests GitHub answered with 404,
+// e.g. because the app is not installed on the account.
+var ErrNotFound = errors.New("not found")
+
+// CachedInstallation is an installation discovered for an account
+type CachedInstallation struct {
+	ID           int64     `json:"id"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+}
+
+// InstallationCache remembers which installation of an app serves each account, so apps
+// configured without an installation ID look it up once per account rather than on every mint.
+type InstallationCache struct {
+	// path is the file the cache is kept in (empty keeps it in memory only)
+	path    string
+	mu      sync.Mutex
+	entries map[string]CachedInstallation
+}
+
+// NewInstallationCache creates a cache kept in path
+func NewInstallationCache(path string) *InstallationCache {
+	return &InstallationCache{path: path}
+}
+
+// Get returns the installation of an app on an account, if it has been discovered
+func (c *InstallationCache) Get(host string, appID int64, owner string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	entry, ok := c.entries[installationCacheKey(host, appID, owner)]
+	return entry.ID, ok
+}
+
+// Set records the installation of an app on an account
+func (c *InstallationCache) Set(host string, appID int64, owner string, installationID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	c.entries[installationCacheKey(host, appID, owner)] = CachedInstallation{
+		ID:           installationID,
+		DiscoveredAt: time.Now().UTC(),
+	}
+	c.save()
+}
+
+// Delete forgets the installation of an app on an account, e.g. after the app was reinstalled
+func (c *InstallationCache) Delete(host string, appID int64, owner string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.load()
+	key := installationCacheKey(host, appID, owner)
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	c.save()
+}
+
+// load reads the cache file. It is read again on every call so that installations
+// discovered by other processes, such as concurrent git credential helpers, are seen.
+func (c *InstallationCache) load() {
+	if c.path == "" {
+		if c.entries == nil {
+			c.entries = make(map[string]CachedInstallation)
+		}
+		return
+	}
+
+	c.entries = make(map[string]CachedInstallation)
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return
+	}
+	// A corrupt cache is discarded: installations are discovered again
+	_ = json.Unmarshal(data, &c.entries)
+}
+
+// save writes the cache file. Best effort: lost entries are discovered again.
+func (c *InstallationCache) save() {
+	if c.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(dir, "."+installationsFile+".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		return
+	}
+	_ = os.Rename(tmp.Name(), c.path)
+}
+
+// installationCacheKey identifies an account of an app. GitHub logins are case-insensitive.
+func installationCacheKey(host string, appID int64, owner string) string {
+	if host == "" {
+		host = gitHubAPIHost
+	}
+	return strings.ToLower(host) + "/" + strconv.FormatInt(appID, 10) + "/" + strings.ToLower(owner)
+}
+
+// ownerInstallationToken mints an installation token for an app configured without an
+// installation ID. The installation serving the repository's owner is looked up in the
+// installation cache, or discovered and cached; a cached installation GitHub no longer
+// knows, e.g. because the app was reinstalled, is discovered again.
+func (a *Authenticator) ownerInstallationToken(
+	jwtToken string, appID int64, repoURL string,
+) (string, time.Time, error) {
+	host := extractHostFromURL(repoURL)
+	owner, err := parseOwnerFromURL(repoURL)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to find installation ID: %w", err)
+	}
+
+	installationID, cached := a.installations.Get(host, appID, owner)
+	if cached {
+		token, expiresAt, err := a.GetInstallationTokenWithExpiry(jwtToken, installationID, repoURL)
+		if !errors.Is(err, ErrNotFound) {
+			return token, expiresAt, err
+		}
+		a.installations.Delete(host, appID, owner)
+	}
+
+	installationID, err = discoverInstallationID(jwtToken, APIBaseURL(host), owner)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to find installation ID for %s: %w", owner, err)
+	}
+	a.installations.Set(host, appID, owner, installationID)
+
+	return a.GetInstallationTokenWithExpiry(jwtToken, installationID, repoURL)
+}
+
+// discoverInstallationID finds the installation of the app authenticated by jwtToken on an
+// organization or, failing that, a user account
+func discoverInstallationID(jwtToken, apiBaseURL, owner string) (int64, error) {
+	installationID, err := getInstallationID(jwtToken, fmt.Sprintf("%s/orgs/%s/installation", apiBaseURL, owner))
+	if errors.Is(err, ErrNotFound) {
+		installationID, err = getInstallationID(jwtToken, fmt.Sprintf("%s/users/%s/installation", apiBaseURL, owner))
+	}
+	if errors.Is(err, ErrNotFound) {
+		return 0, fmt.Errorf("app is not installed on %s: %w", owner, err)
+	}
+	return installationID, err
+}
+
+// getInstallationID fetches an installation from one of GitHub's installation lookup endpoints
+func getInstallationID(jwtToken, apiURL string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get installation: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to close response body: %v\n", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newAPIStatusError(resp)
+	}
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&installation); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return installation.ID, nil
+}
+
+// parseOwnerFromURL extracts the account owning a repository from its URL.
+// Unlike parseRepoURL it accepts owner-only URLs such as https://github.com/myorg.
+func parseOwnerFromURL(repoURL string) (string, error) {
+	path := strings.TrimSuffix(repoURL, ".git")
+	path = strings.TrimPrefix(path, "https://")
+	path = strings.TrimPrefix(path, "http://")
+
+	if strings.HasPrefix(path, "git@") {
+		if _, rest, ok := strings.Cut(path, ":"); ok {
+			path = rest
+		}
+	} else {
+		_, path, _ = strings.Cut(path, "/")
+	}
+
+	owner, _, _ := strings.Cut(path, "/")
+	if owner == "" {
+		return "", fmt.Errorf("repository URL %q has no owner", repoURL)
+	}
+	return owner, nil
+}
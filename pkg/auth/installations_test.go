@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+// newFakeInstallationServer mocks GitHub's installation lookup endpoints for an app
+// installed on the organization myorg (installation 100) and the user octocat (200)
+func newFakeInstallationServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var requests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/{owner}/installation", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.PathValue("owner") != "myorg" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]any{"id": 100})
+	})
+	mux.HandleFunc("/users/{owner}/installation", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.PathValue("owner") != "octocat" {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]any{"id": 200})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestDiscoverInstallationID(t *testing.T) {
+	tests := []struct {
+		name         string
+		owner        string
+		wantID       int64
+		wantErr      error
+		wantRequests int
+	}{
+		{name: "organization", owner: "myorg", wantID: 100, wantRequests: 1},
+		{name: "user falls back after organization", owner: "octocat", wantID: 200, wantRequests: 2},
+		{name: "not installed", owner: "someone", wantErr: ErrNotFound, wantRequests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newFakeInstallationServer(t)
+
+			id, err := discoverInstallationID("fake.jwt.token", server.URL, tt.owner)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("discoverInstallationID() error = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID {
+				t.Errorf("discoverInstallationID() = %d, want %d", id, tt.wantID)
+			}
+			if len(*requests) != tt.wantRequests {
+				t.Errorf("Requests = %v, want %d", *requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestInstallationCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), installationsFile)
+
+	// Given an installation discovered by one process
+	NewInstallationCache(path).Set("github.com", 123, "MyOrg", 100)
+
+	// When another process looks it up
+	c := NewInstallationCache(path)
+
+	// Then it is found, whatever the case of the login
+	if id, ok := c.Get("github.com", 123, "myorg"); !ok || id != 100 {
+		t.Errorf("Get() = %d, %v, want 100", id, ok)
+	}
+	if _, ok := c.Get("github.com", 456, "myorg"); ok {
+		t.Error("Get() found the installation of another app")
+	}
+	if _, ok := c.Get("github.example.com", 123, "myorg"); ok {
+		t.Error("Get() found the installation on another host")
+	}
+
+	c.Delete("github.com", 123, "myorg")
+	if _, ok := NewInstallationCache(path).Get("github.com", 123, "myorg"); ok {
+		t.Error("Get() found a deleted installation")
+	}
+}
+
+func TestParseOwnerFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/myorg/repo.git": "myorg",
+		"https://github.com/myorg":          "myorg",
+		"github.example.com/myorg/repo":     "myorg",
+		"git@github.com:myorg/repo.git":     "myorg",
+	}
+	for repoURL, want := range tests {
+		if got, err := parseOwnerFromURL(repoURL); err != nil || got != want {
+			t.Errorf("parseOwnerFromURL(%q) = %q, %v, want %q", repoURL, got, err, want)
+		}
+	}
+
+	for _, repoURL := range []string{"https://github.com", "https://github.com/"} {
+		if _, err := parseOwnerFromURL(repoURL); err == nil {
+			t.Errorf("parseOwnerFromURL(%q) should fail", repoURL)
+		}
+	}
+}
+
+func TestTokenCacheKey(t *testing.T) {
+	app := &config.GitHubApp{AppID: 123}
+
+	// An app without an installation ID has one installation per account
+	if tokenCacheKey(app, "https://github.com/myorg/a") != tokenCacheKey(app, "https://github.com/MyOrg/b") {
+		t.Error("Repositories of the same owner should share a token")
+	}
+	if tokenCacheKey(app, "https://github.com/myorg/a") == tokenCacheKey(app, "https://github.com/other/a") {
+		t.Error("Repositories of different owners should not share a token")
+	}
+
+	app.InstallationID = 456
+	if tokenCacheKey(app, "https://github.com/myorg/a") != tokenCacheKey(app, "https://github.com/other/a") {
+		t.Error("A configured installation should serve every repository")
+	}
+}
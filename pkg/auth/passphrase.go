@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"golang.org/x/term"
+)
+
+const (
+	// KeyPassphraseEnv holds the passphrase of encrypted private keys
+	KeyPassphraseEnv = "GH_APP_AUTH_KEY_PASSPHRASE"
+	// KeyAskpassEnv names a command that prints the passphrase, like SSH_ASKPASS.
+	// It is run with the prompt as its only argument.
+	KeyAskpassEnv = "GH_APP_AUTH_ASKPASS"
+	// askpassTimeout bounds how long the askpass command may run
+	askpassTimeout = 2 * time.Minute
+)
+
+// promptPassphrase reads a passphrase from the controlling terminal (can be overridden for testing).
+// The terminal is opened directly because stdin is the git credential protocol.
+var promptPassphrase = func(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, jwt.ErrPassphraseRequired
+	}
+	defer func() {
+		_ = tty.Close()
+	}()
+	if !term.IsTerminal(int(tty.Fd())) {
+		return nil, jwt.ErrPassphraseRequired
+	}
+
+	fmt.Fprint(tty, prompt)
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
+
+// KeyPassphrase returns the passphrase for an app's encrypted private keys, trying in order
+// GH_APP_AUTH_KEY_PASSPHRASE, the GH_APP_AUTH_ASKPASS command, the OS keyring and a
+// terminal prompt. app and secretMgr may be nil for a key not yet configured.
+func KeyPassphrase(app *config.GitHubApp, secretMgr *secrets.Manager) ([]byte, error) {
+	if passphrase := os.Getenv(KeyPassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	prompt := "Passphrase for private key: "
+	if app != nil {
+		prompt = fmt.Sprintf("Passphrase for private key of '%s': ", app.Name)
+	}
+
+	if askpass := os.Getenv(KeyAskpassEnv); askpass != "" {
+		return runAskpass(askpass, prompt)
+	}
+
+	if app != nil && secretMgr != nil {
+		if passphrase, err := app.GetKeyPassphrase(secretMgr); err == nil {
+			return []byte(passphrase), nil
+		}
+	}
+
+	passphrase, err := promptPassphrase(prompt)
+	if errors.Is(err, jwt.ErrPassphraseRequired) {
+		return nil, fmt.Errorf("%w: set %s or %s, or store it with 'gh app-auth setup --store-passphrase'",
+			jwt.ErrPassphraseRequired, KeyPassphraseEnv, KeyAskpassEnv)
+	}
+	return passphrase, err
+}
+
+// runAskpass runs an askpass command and returns the first line it prints
+func runAskpass(command, prompt string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), askpassTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, prompt)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("askpass command %q failed: %w: %s", command, err, msg)
+		}
+		return nil, fmt.Errorf("askpass command %q failed: %w", command, err)
+	}
+
+	passphrase, _, _ := bytes.Cut(stdout.Bytes(), []byte("\n"))
+	return bytes.TrimSuffix(passphrase, []byte("\r")), nil
+}
+
+// DecryptPrivateKey returns the unencrypted PEM of an app private key, resolving the
+// passphrase with KeyPassphrase when the key is encrypted. Other keys are returned as is.
+func DecryptPrivateKey(app *config.GitHubApp, secretMgr *secrets.Manager, privateKey string) (string, error) {
+	if !jwt.IsEncryptedKey(privateKey) {
+		return privateKey, nil
+	}
+
+	passphrase, err := KeyPassphrase(app, secretMgr)
+	if err != nil {
+		return "", err
+	}
+	return jwt.DecryptPrivateKey(privateKey, passphrase)
+}
+
+// decryptPrivateKey decrypts an app key, remembering the passphrase so a process asks once per app
+func (a *Authenticator) decryptPrivateKey(app *config.GitHubApp, privateKey string) (string, error) {
+	if !jwt.IsEncryptedKey(privateKey) {
+		return privateKey, nil
+	}
+
+	a.passphraseMu.Lock()
+	defer a.passphraseMu.Unlock()
+
+	if passphrase, ok := a.passphrases[app.Name]; ok {
+		if decrypted, err := jwt.DecryptPrivateKey(privateKey, passphrase); err == nil {
+			return decrypted, nil
+		}
+	}
+
+	passphrase, err := KeyPassphrase(app, a.secretsManager)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := jwt.DecryptPrivateKey(privateKey, passphrase)
+	if err != nil {
+		return "", err
+	}
+	if a.passphrases == nil {
+		a.passphrases = make(map[string][]byte)
+	}
+	a.passphrases[app.Name] = passphrase
+	return decrypted, nil
+}
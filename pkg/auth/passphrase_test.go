@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/jwt"
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+// encryptedTestKey is an openssl fixture encrypted with "correct-horse"
+func encryptedTestKey(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "jwt", "testdata", "encrypted-pkcs8-aes256.pem"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return string(data)
+}
+
+// stubPrompt replaces the terminal prompt and counts how often it is used
+func stubPrompt(t *testing.T, passphrase string, err error) *int {
+	t.Helper()
+	calls := 0
+	original := promptPassphrase
+	promptPassphrase = func(string) ([]byte, error) {
+		calls++
+		return []byte(passphrase), err
+	}
+	t.Cleanup(func() { promptPassphrase = original })
+	return &calls
+}
+
+func TestKeyPassphrase_Sources(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := &config.GitHubApp{Name: "ci-bot"}
+	t.Setenv(KeyPassphraseEnv, "")
+	t.Setenv(KeyAskpassEnv, "")
+
+	prompts := stubPrompt(t, "from-prompt", nil)
+	got, err := KeyPassphrase(app, secretMgr)
+	if err != nil || string(got) != "from-prompt" || *prompts != 1 {
+		t.Errorf("prompt: KeyPassphrase() = (%q, %v), prompts = %d", got, err, *prompts)
+	}
+
+	if err := app.SetKeyPassphrase(secretMgr, "from-keyring"); err != nil {
+		t.Fatalf("SetKeyPassphrase() error = %v", err)
+	}
+	if got, err := KeyPassphrase(app, secretMgr); err != nil || string(got) != "from-keyring" {
+		t.Errorf("keyring: KeyPassphrase() = (%q, %v)", got, err)
+	}
+	// Setup has no app yet, so the keyring is skipped
+	if got, _ := KeyPassphrase(nil, nil); string(got) != "from-prompt" {
+		t.Errorf("no app: KeyPassphrase() = %q, want from-prompt", got)
+	}
+
+	if runtime.GOOS != "windows" {
+		script := filepath.Join(t.TempDir(), "askpass.sh")
+		if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"from-askpass\"\n"), 0700); err != nil {
+			t.Fatalf("Failed to write askpass script: %v", err)
+		}
+		t.Setenv(KeyAskpassEnv, script)
+		if got, err := KeyPassphrase(app, secretMgr); err != nil || string(got) != "from-askpass" {
+			t.Errorf("askpass: KeyPassphrase() = (%q, %v)", got, err)
+		}
+	}
+
+	t.Setenv(KeyPassphraseEnv, "from-env")
+	if got, err := KeyPassphrase(app, secretMgr); err != nil || string(got) != "from-env" {
+		t.Errorf("env: KeyPassphrase() = (%q, %v)", got, err)
+	}
+}
+
+func TestKeyPassphrase_NoSource(t *testing.T) {
+	t.Setenv(KeyPassphraseEnv, "")
+	t.Setenv(KeyAskpassEnv, "")
+	stubPrompt(t, "", jwt.ErrPassphraseRequired)
+
+	_, err := KeyPassphrase(nil, nil)
+	if !errors.Is(err, jwt.ErrPassphraseRequired) || !strings.Contains(err.Error(), KeyPassphraseEnv) {
+		t.Errorf("KeyPassphrase() error = %v, want ErrPassphraseRequired naming %s", err, KeyPassphraseEnv)
+	}
+}
+
+func TestDecryptPrivateKey_AsksOncePerApp(t *testing.T) {
+	t.Setenv(KeyPassphraseEnv, "")
+	t.Setenv(KeyAskpassEnv, "")
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	prompts := stubPrompt(t, "correct-horse", nil)
+
+	a := &Authenticator{jwtGenerator: jwt.NewGenerator(), secretsManager: secrets.NewManager(t.TempDir())}
+	app := &config.GitHubApp{Name: "ci-bot", AppID: 42}
+	encrypted := encryptedTestKey(t)
+
+	for i := 0; i < 3; i++ {
+		decrypted, err := a.decryptPrivateKey(app, encrypted)
+		if err != nil {
+			t.Fatalf("decryptPrivateKey() error = %v", err)
+		}
+		if _, err := a.jwtGenerator.GenerateTokenFromKey(app.AppID, decrypted); err != nil {
+			t.Fatalf("GenerateTokenFromKey() error = %v", err)
+		}
+	}
+	if *prompts != 1 {
+		t.Errorf("prompted %d times, want 1", *prompts)
+	}
+
+	*prompts = 0
+	other := &config.GitHubApp{Name: "other", AppID: 7}
+	stubPrompt(t, "wrong", nil)
+	if _, err := a.decryptPrivateKey(other, encrypted); !errors.Is(err, jwt.ErrIncorrectPassphrase) {
+		t.Errorf("decryptPrivateKey() error = %v, want ErrIncorrectPassphrase", err)
+	}
+}
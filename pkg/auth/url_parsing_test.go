@@ -154,3 +154,54 @@ func TestGetInstallationToken_InputValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		host        string
+		wantREST    string
+		wantGraphQL string
+	}{
+		{"github.com", "https://api.github.com", "https://api.github.com/graphql"},
+		{"", "https://api.github.com", "https://api.github.com/graphql"},
+		{"github.example.com", "https://github.example.com/api/v3", "https://github.example.com/api/graphql"},
+	}
+
+	for _, tt := range tests {
+		if got := APIBaseURL(tt.host); got != tt.wantREST {
+			t.Errorf("APIBaseURL(%q) = %q, want %q", tt.host, got, tt.wantREST)
+		}
+		if got := GraphQLURL(tt.host); got != tt.wantGraphQL {
+			t.Errorf("GraphQLURL(%q) = %q, want %q", tt.host, got, tt.wantGraphQL)
+		}
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	header := `<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`
+	if got := NextPageURL(header); got != "https://api.github.com/x?page=2" {
+		t.Errorf("NextPageURL() = %q", got)
+	}
+
+	lastPage := `<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=1>; rel="first"`
+	if got := NextPageURL(lastPage); got != "" {
+		t.Errorf("NextPageURL() on last page = %q, want empty", got)
+	}
+}
+
+func TestFollowNextPage(t *testing.T) {
+	const page = "https://api.github.com/x?page=1"
+	if got, err := FollowNextPage(`<https://API.github.com/x?page=2>; rel="next"`, page); err != nil ||
+		got != "https://API.github.com/x?page=2" {
+		t.Errorf("FollowNextPage() = %q, %v", got, err)
+	}
+	if got, err := FollowNextPage("", page); err != nil || got != "" {
+		t.Errorf("FollowNextPage() on last page = %q, %v; want empty", got, err)
+	}
+
+	// Requests for the next page carry the same credentials: it must stay on the same host
+	for _, next := range []string{"https://evil.example.com/x?page=2", "http://api.github.com/x?page=2"} {
+		if got, err := FollowNextPage(`<`+next+`>; rel="next"`, page); err == nil {
+			t.Errorf("FollowNextPage() followed %s to %q", next, got)
+		}
+	}
+}
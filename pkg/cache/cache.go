@@ -3,6 +3,7 @@ package cache
 import (
 	"fmt"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,9 +31,10 @@ type TokenCache struct {
 // - Installation tokens require API calls to GitHub and have 1-hour validity
 // - Caching reduces GitHub API load and improves performance
 type CachedToken struct {
-	Token     string    // GitHub installation token (ghs_...)
-	ExpiresAt time.Time // When this token expires (55-min from creation)
-	CreatedAt time.Time // When this token was cached
+	Token          string    // GitHub installation token (ghs_...)
+	ExpiresAt      time.Time // When this token expires (55-min from creation)
+	CreatedAt      time.Time // When this token was cached
+	TokenExpiresAt time.Time // When GitHub expires the token (zero if unknown)
 }
 
 // NewTokenCache creates a new token cache.
@@ -67,16 +69,37 @@ func (c *TokenCache) Get(key string) (string, bool) {
 	return cached.Token, true
 }
 
+// GetWithExpiry retrieves a token and the expiry reported by GitHub when it was cached.
+// The returned expiry is zero if it was not recorded.
+func (c *TokenCache) GetWithExpiry(key string) (string, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, exists := c.cache[key]
+	if !exists || time.Now().After(cached.ExpiresAt) {
+		return "", time.Time{}, false
+	}
+
+	return cached.Token, cached.TokenExpiresAt, true
+}
+
 // Set stores a token in the cache with the specified TTL
 func (c *TokenCache) Set(key, token string, ttl time.Duration) {
+	c.SetWithExpiry(key, token, ttl, time.Time{})
+}
+
+// SetWithExpiry stores a token in the cache with the specified TTL,
+// recording the expiry reported by GitHub alongside it
+func (c *TokenCache) SetWithExpiry(key, token string, ttl time.Duration, tokenExpiresAt time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	now := time.Now()
 	c.cache[key] = &CachedToken{
-		Token:     token,
-		ExpiresAt: now.Add(ttl),
-		CreatedAt: now,
+		Token:          token,
+		ExpiresAt:      now.Add(ttl),
+		CreatedAt:      now,
+		TokenExpiresAt: tokenExpiresAt,
 	}
 }
 
@@ -197,3 +220,9 @@ func (c *TokenCache) zeroToken(token string) {
 func CreateCacheKey(appID, installationID int64) string {
 	return fmt.Sprintf("app_%d_inst_%d", appID, installationID)
 }
+
+// CreateOwnerCacheKey creates a cache key for an app whose installation is discovered
+// per account, for the account owning a repository
+func CreateOwnerCacheKey(appID int64, host, owner string) string {
+	return fmt.Sprintf("app_%d_owner_%s/%s", appID, strings.ToLower(host), strings.ToLower(owner))
+}
@@ -315,3 +315,13 @@ func TestTokenCache_DeleteNonExistent(t *testing.T) {
 		t.Errorf("Expected cache size 0, got %d", size)
 	}
 }
+
+func TestCreateOwnerCacheKey(t *testing.T) {
+	key := CreateOwnerCacheKey(12345, "github.com", "MyOrg")
+	if key != "app_12345_owner_github.com/myorg" {
+		t.Errorf("CreateOwnerCacheKey() = %v", key)
+	}
+	if key == CreateOwnerCacheKey(12345, "github.com", "other") {
+		t.Error("Different owners should have different keys")
+	}
+}
@@ -8,11 +8,16 @@ import (
 	"sort"
 	"strings"
 	"time"
+	"unicode"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 )
 
 // Common errors returned by config
 var (
-	ErrNoGitHubAppDefined = errors.New("at least one github_app or pat is required")
+	ErrNoGitHubAppDefined = errors.New("at least one github_app, pat or user_token is required")
+	// ErrReferencedSecret is returned when storing a secret that the config references elsewhere
+	ErrReferencedSecret = errors.New("secret is referenced from the config and managed outside gh-app-auth")
 )
 
 // CurrentConfigVersion is the latest configuration schema version
@@ -23,6 +28,7 @@ type Config struct {
 	Version    string                `yaml:"version" json:"version"`
 	GitHubApps []GitHubApp           `yaml:"github_apps" json:"github_apps"`
 	PATs       []PersonalAccessToken `yaml:"pats,omitempty" json:"pats,omitempty"`
+	UserTokens []AppUserToken        `yaml:"user_tokens,omitempty" json:"user_tokens,omitempty"`
 }
 
 // PrivateKeySource indicates where the private key is stored
@@ -51,6 +57,22 @@ type InstallationScope struct {
 	LastFetched time.Time `yaml:"last_fetched" json:"last_fetched"`
 	LastUpdated time.Time `yaml:"last_updated" json:"last_updated"` // From GitHub API
 	CacheExpiry time.Time `yaml:"cache_expiry" json:"cache_expiry"`
+
+	// Validators for conditional requests: refreshing an unchanged scope is
+	// answered with 304 Not Modified, which costs no API rate limit
+	ETag            string      `yaml:"etag,omitempty" json:"etag,omitempty"`
+	RepositoryPages []ScopePage `yaml:"repository_pages,omitempty" json:"repository_pages,omitempty"`
+
+	// LastMissRefresh is when the scope was last refreshed because a repository
+	// matching the app's patterns was out of scope; it rate limits such refreshes
+	LastMissRefresh time.Time `yaml:"last_miss_refresh,omitempty" json:"last_miss_refresh,omitzero"`
+}
+
+// ScopePage records one page of an installation's repository list
+type ScopePage struct {
+	URL   string `yaml:"url" json:"url"`
+	ETag  string `yaml:"etag" json:"etag"`
+	Count int    `yaml:"count" json:"count"` // Repositories on the page, in Repositories order
 }
 
 // RepositoryInfo represents a cached repository
@@ -63,12 +85,51 @@ type RepositoryInfo struct {
 type GitHubApp struct {
 	Name             string             `yaml:"name" json:"name"`
 	AppID            int64              `yaml:"app_id" json:"app_id"`
+	ClientID         string             `yaml:"client_id,omitempty" json:"client_id,omitempty"` // JWT issuer when set
 	InstallationID   int64              `yaml:"installation_id" json:"installation_id"`
 	PrivateKeyPath   string             `yaml:"private_key_path,omitempty" json:"private_key_path,omitempty"`
 	PrivateKeySource PrivateKeySource   `yaml:"private_key_source,omitempty" json:"private_key_source,omitempty"`
 	Patterns         []string           `yaml:"patterns" json:"patterns"`
 	Priority         int                `yaml:"priority" json:"priority"` // Deprecated: Ignored in favor of longest prefix
 	Scope            *InstallationScope `yaml:"scope,omitempty" json:"scope,omitempty"`
+	// PrivateKeys lists the app's keys in order of preference; the first is active.
+	// When empty, the single key described by PrivateKeySource/PrivateKeyPath is used.
+	PrivateKeys []PrivateKeyEntry `yaml:"private_keys,omitempty" json:"private_keys,omitempty"`
+	// Signer delegates JWT signing to an external signer; no private key is then loaded.
+	Signer *SignerConfig `yaml:"signer,omitempty" json:"signer,omitempty"`
+	// SecretBackends lists where the app's secrets are kept, tried in order.
+	// When empty, the OS keyring is used with an encrypted filesystem fallback.
+	SecretBackends []secrets.BackendSpec `yaml:"secret_backends,omitempty" json:"secret_backends,omitempty"`
+	// PrivateKeyRef references a key kept outside gh-app-auth, e.g. env:GH_APP_KEY or
+	// cmd:op read op://vault/app/key. It is resolved each time the key is needed.
+	PrivateKeyRef string `yaml:"private_key_ref,omitempty" json:"private_key_ref,omitempty"`
+	// RefreshScopeOnMiss refreshes the cached scope when a repository matches the app's
+	// patterns but not its scope, e.g. because it was added to the installation since.
+	// Defaults to true.
+	RefreshScopeOnMiss *bool `yaml:"refresh_scope_on_miss,omitempty" json:"refresh_scope_on_miss,omitempty"`
+}
+
+// SignerType selects how JWTs are signed for an app
+type SignerType string
+
+const (
+	// SignerTypeExec runs a command that signs the JWT input read from stdin
+	SignerTypeExec SignerType = "exec"
+)
+
+// SignerConfig configures an external JWT signer, e.g. a PKCS#11 token, HSM or KMS client
+type SignerConfig struct {
+	Type    SignerType `yaml:"type" json:"type"`
+	Command string     `yaml:"command" json:"command"`
+	Args    []string   `yaml:"args,omitempty" json:"args,omitempty"`
+}
+
+// PrivateKeyEntry describes one of several private keys registered for an app
+type PrivateKeyEntry struct {
+	Label     string           `yaml:"label" json:"label"`
+	Source    PrivateKeySource `yaml:"source" json:"source"`
+	Path      string           `yaml:"path,omitempty" json:"path,omitempty"` // User-managed key file
+	CreatedAt time.Time        `yaml:"created_at" json:"created_at"`
 }
 
 type PersonalAccessToken struct {
@@ -78,6 +139,35 @@ type PersonalAccessToken struct {
 	Priority    int              `yaml:"priority" json:"priority"`
 	// Username for HTTP basic auth (optional, defaults to "x-access-token" for GitHub)
 	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	// SecretBackends lists where the token is kept, tried in order (see GitHubApp)
+	SecretBackends []secrets.BackendSpec `yaml:"secret_backends,omitempty" json:"secret_backends,omitempty"`
+	// TokenRef references a token kept outside gh-app-auth (see GitHubApp.PrivateKeyRef)
+	TokenRef string `yaml:"token_ref,omitempty" json:"token_ref,omitempty"`
+	// Login, ExpiresAt and Scopes are recorded from GitHub's /user response when the token
+	// is set up or rotated. ExpiresAt is nil for tokens that do not expire.
+	Login     string     `yaml:"login,omitempty" json:"login,omitempty"`
+	ExpiresAt *time.Time `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Scopes    []string   `yaml:"scopes,omitempty" json:"scopes,omitempty"`
+}
+
+// AppUserToken is a GitHub App user-to-server token obtained with the OAuth device flow
+// ('gh app-auth login'). Requests made with it go through the app but are attributed to
+// the user who authorized it. The access and refresh tokens are kept in secure storage.
+type AppUserToken struct {
+	Name     string `yaml:"name" json:"name"`
+	ClientID string `yaml:"client_id" json:"client_id"`
+	// Host is the GitHub host the app lives on, github.com when empty
+	Host        string           `yaml:"host,omitempty" json:"host,omitempty"`
+	Login       string           `yaml:"login,omitempty" json:"login,omitempty"`
+	TokenSource PrivateKeySource `yaml:"token_source,omitempty" json:"token_source,omitempty"`
+	Patterns    []string         `yaml:"patterns" json:"patterns"`
+	Priority    int              `yaml:"priority" json:"priority"`
+	// SecretBackends lists where the tokens are kept, tried in order (see GitHubApp)
+	SecretBackends []secrets.BackendSpec `yaml:"secret_backends,omitempty" json:"secret_backends,omitempty"`
+	// ExpiresAt is when the access token expires and RefreshTokenExpiresAt when the refresh
+	// token does; both are nil when the app has user token expiration disabled.
+	ExpiresAt             *time.Time `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+	RefreshTokenExpiresAt *time.Time `yaml:"refresh_token_expires_at,omitempty" json:"refresh_token_expires_at,omitempty"`
 }
 
 // Validate validates the configuration
@@ -86,7 +176,7 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("version is required")
 	}
 
-	if len(c.GitHubApps) == 0 && len(c.PATs) == 0 {
+	if len(c.GitHubApps) == 0 && len(c.PATs) == 0 && len(c.UserTokens) == 0 {
 		return ErrNoGitHubAppDefined
 	}
 
@@ -102,9 +192,21 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for i, userToken := range c.UserTokens {
+		if err := userToken.Validate(); err != nil {
+			return fmt.Errorf("user_tokens[%d]: %w", i, err)
+		}
+	}
+
 	return nil
 }
 
+// ScopeRefreshOnMiss reports whether a repository matching the app's patterns but not its
+// cached scope triggers a scope refresh
+func (g *GitHubApp) ScopeRefreshOnMiss() bool {
+	return g.RefreshScopeOnMiss == nil || *g.RefreshScopeOnMiss
+}
+
 // Validate validates a single GitHub App configuration
 func (g *GitHubApp) Validate() error {
 	// Validate basic fields
@@ -112,8 +214,16 @@ func (g *GitHubApp) Validate() error {
 		return err
 	}
 
-	// Validate private key configuration
-	if err := g.validatePrivateKeyConfig(); err != nil {
+	if err := validateSecretBackends(g.SecretBackends); err != nil {
+		return err
+	}
+
+	// Validate private key or external signer configuration
+	if g.Signer != nil {
+		if err := g.Signer.Validate(); err != nil {
+			return fmt.Errorf("signer: %w", err)
+		}
+	} else if err := g.validatePrivateKeyConfig(); err != nil {
 		return err
 	}
 
@@ -182,6 +292,10 @@ func (g *GitHubApp) validateBasicFields() error {
 		return fmt.Errorf("app_id must be positive")
 	}
 
+	if g.ClientID != "" && strings.ContainsFunc(g.ClientID, unicode.IsSpace) {
+		return fmt.Errorf("client_id must not contain whitespace")
+	}
+
 	// InstallationID can be 0 (auto-detected at runtime via GitHub API)
 	if g.InstallationID < 0 {
 		return fmt.Errorf("installation_id cannot be negative")
@@ -192,6 +306,26 @@ func (g *GitHubApp) validateBasicFields() error {
 
 // validatePrivateKeyConfig validates the private key configuration
 func (g *GitHubApp) validatePrivateKeyConfig() error {
+	if g.PrivateKeyRef != "" {
+		if _, err := secrets.ParseReference(g.PrivateKeyRef); err != nil {
+			return fmt.Errorf("private_key_ref: %w", err)
+		}
+		if len(g.PrivateKeys) > 0 || g.PrivateKeyPath != "" {
+			return fmt.Errorf("private_key_ref cannot be combined with private_key_path or private_keys")
+		}
+		return nil
+	}
+
+	if len(g.PrivateKeys) > 0 {
+		return g.validatePrivateKeyEntries()
+	}
+
+	// With secret backends the key is looked up through them; the source only
+	// records which backend last stored it
+	if len(g.SecretBackends) > 0 && g.PrivateKeyPath == "" {
+		return nil
+	}
+
 	// Handle legacy config without source specified
 	if g.PrivateKeySource == "" {
 		if g.PrivateKeyPath == "" {
@@ -214,6 +348,53 @@ func (g *GitHubApp) validatePrivateKeyConfig() error {
 	}
 }
 
+// validatePrivateKeyEntries validates a multi-key configuration
+func (g *GitHubApp) validatePrivateKeyEntries() error {
+	seen := make(map[string]bool)
+	for i := range g.PrivateKeys {
+		entry := &g.PrivateKeys[i]
+		if strings.TrimSpace(entry.Label) == "" {
+			return fmt.Errorf("private_keys[%d]: label is required", i)
+		}
+		if seen[entry.Label] {
+			return fmt.Errorf("private_keys[%d]: duplicate label %q", i, entry.Label)
+		}
+		seen[entry.Label] = true
+
+		switch entry.Source {
+		case PrivateKeySourceKeyring, PrivateKeySourceFilesystem:
+		default:
+			if len(g.SecretBackends) == 0 || entry.Path != "" {
+				return fmt.Errorf("private_keys[%d]: invalid source: %s", i, entry.Source)
+			}
+		}
+
+		if entry.Path != "" {
+			expandedPath, err := expandPath(entry.Path)
+			if err != nil {
+				return fmt.Errorf("private_keys[%d]: invalid path: %w", i, err)
+			}
+			entry.Path = expandedPath
+		}
+	}
+	return nil
+}
+
+// Validate validates an external signer configuration
+func (s *SignerConfig) Validate() error {
+	switch s.Type {
+	case SignerTypeExec:
+		if strings.TrimSpace(s.Command) == "" {
+			return fmt.Errorf("command is required for exec signer")
+		}
+		return nil
+	case "":
+		return fmt.Errorf("type is required")
+	default:
+		return fmt.Errorf("unsupported signer type: %s", s.Type)
+	}
+}
+
 // validateFilesystemKeyConfig validates filesystem-based private key configuration
 func (g *GitHubApp) validateFilesystemKeyConfig() error {
 	if g.PrivateKeyPath == "" {
@@ -259,9 +440,38 @@ func (p *PersonalAccessToken) Validate() error {
 		}
 	}
 
-	if p.TokenSource != "" && p.TokenSource != PrivateKeySourceKeyring && p.TokenSource != PrivateKeySourceFilesystem {
-		return fmt.Errorf("invalid private_key_source: %s", p.TokenSource)
+	if err := validateSecretBackends(p.SecretBackends); err != nil {
+		return err
+	}
+
+	if p.TokenRef != "" {
+		if _, err := secrets.ParseReference(p.TokenRef); err != nil {
+			return fmt.Errorf("token_ref: %w", err)
+		}
+		return nil
+	}
+
+	// Without secret backends, a source other than keyring or filesystem names the backend
+	// type holding the token; it must work without further settings, like env
+	switch p.TokenSource {
+	case "", PrivateKeySourceKeyring, PrivateKeySourceFilesystem:
+	default:
+		spec := secrets.BackendSpec{Type: string(p.TokenSource)}
+		if err := spec.Validate(); err != nil && len(p.SecretBackends) == 0 {
+			return fmt.Errorf("invalid private_key_source %s (configure it in secret_backends or "+
+				"use token_ref): %w", p.TokenSource, err)
+		}
 	}
 
 	return nil
 }
+
+// validateSecretBackends validates the secret backend chain of an app or PAT
+func validateSecretBackends(specs []secrets.BackendSpec) error {
+	for i, spec := range specs {
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("secret_backends[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -54,7 +54,7 @@ func TestConfig_Validate(t *testing.T) {
 				GitHubApps: []GitHubApp{},
 			},
 			wantErr: true,
-			errMsg:  "at least one github_app or pat is required",
+			errMsg:  "at least one github_app, pat or user_token is required",
 		},
 		{
 			name: "invalid github app",
@@ -134,6 +134,18 @@ func TestGitHubApp_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "app_id must be positive",
 		},
+		{
+			name: "client_id with whitespace",
+			app: GitHubApp{
+				Name:           "test-app",
+				AppID:          12345,
+				ClientID:       "Iv23li abc",
+				PrivateKeyPath: "/tmp/key.pem",
+				Patterns:       []string{"github.com/org/*"},
+			},
+			wantErr: true,
+			errMsg:  "client_id must not contain whitespace",
+		},
 		{
 			name: "valid app with auto-detect installation_id",
 			app: GitHubApp{
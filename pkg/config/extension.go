@@ -130,6 +130,48 @@ func (c *Config) AddOrUpdatePAT(pat *PersonalAccessToken) {
 	c.PATs = append(c.PATs, *pat)
 }
 
+// FindPAT returns the PAT with the given name, or nil
+func (c *Config) FindPAT(name string) *PersonalAccessToken {
+	for i := range c.PATs {
+		if c.PATs[i].Name == name {
+			return &c.PATs[i]
+		}
+	}
+	return nil
+}
+
+// AddOrUpdateUserToken adds a new user token or updates the one with the same name
+func (c *Config) AddOrUpdateUserToken(userToken *AppUserToken) {
+	for i := range c.UserTokens {
+		if c.UserTokens[i].Name == userToken.Name {
+			c.UserTokens[i] = *userToken
+			return
+		}
+	}
+	c.UserTokens = append(c.UserTokens, *userToken)
+}
+
+// FindUserToken returns the user token with the given name, or nil
+func (c *Config) FindUserToken(name string) *AppUserToken {
+	for i := range c.UserTokens {
+		if c.UserTokens[i].Name == name {
+			return &c.UserTokens[i]
+		}
+	}
+	return nil
+}
+
+// RemoveUserToken removes a user token by name
+func (c *Config) RemoveUserToken(name string) bool {
+	for i, userToken := range c.UserTokens {
+		if userToken.Name == name {
+			c.UserTokens = append(c.UserTokens[:i], c.UserTokens[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // RemoveApp removes an app by ID
 func (c *Config) RemoveApp(appID int64) bool {
 	for i, app := range c.GitHubApps {
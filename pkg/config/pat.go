@@ -2,46 +2,131 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 )
 
+// PATExpiryWarning is how long before its expiry a PAT is reported as expiring soon
+const PATExpiryWarning = 7 * 24 * time.Hour
+
 // GetPAT retrieves the Personal Access Token from the appropriate source
 func (p *PersonalAccessToken) GetPAT(secretMgr *secrets.Manager) (string, error) {
-	switch p.TokenSource {
-	case PrivateKeySourceKeyring, "": // Empty defaults to keyring
-		token, _, err := secretMgr.Get(p.Name, secrets.SecretTypePAT)
-		if err == nil {
-			return token, nil
-		}
-		return "", fmt.Errorf("failed to get PAT from keyring: %w", err)
+	token, _, err := p.LocatePAT(secretMgr)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PAT from %s: %w", p.sourceDisplay(), err)
+	}
+	return token, nil
+}
 
-	case PrivateKeySourceFilesystem:
-		return "", fmt.Errorf("filesystem storage for PATs is not yet implemented")
+// LocatePAT retrieves the Personal Access Token along with the secret backend that served it.
+// A token file referenced by token_ref must not be readable by others, like a private key.
+func (p *PersonalAccessToken) LocatePAT(secretMgr *secrets.Manager) (string, secrets.StorageBackend, error) {
+	if p.TokenRef != "" {
+		ref, err := secrets.ParseReference(p.TokenRef)
+		if err != nil {
+			return "", "", err
+		}
+		if err := ref.CheckPrivate(); err != nil {
+			return "", "", fmt.Errorf("token_ref: %w", err)
+		}
+		token, err := ref.Resolve(p.Name, secrets.SecretTypePAT)
+		if err != nil {
+			return "", "", err
+		}
+		return token, ref.Backend(), nil
+	}
 
-	default:
-		return "", fmt.Errorf("unknown token source: %s", p.TokenSource)
+	store, err := p.secretStore(secretMgr)
+	if err != nil {
+		return "", "", err
 	}
+	return store.Get(p.Name, secrets.SecretTypePAT)
 }
 
 // SetPAT stores the Personal Access Token securely
 func (p *PersonalAccessToken) SetPAT(secretMgr *secrets.Manager, token string) (secrets.StorageBackend, error) {
-	backend, err := secretMgr.Store(p.Name, secrets.SecretTypePAT, token)
+	if p.TokenRef != "" {
+		return "", fmt.Errorf("token of %s: %w", p.Name, ErrReferencedSecret)
+	}
+
+	store, err := p.secretStore(secretMgr)
+	if err != nil {
+		return "", err
+	}
+	backend, err := store.Store(p.Name, secrets.SecretTypePAT, token)
 	if err != nil {
 		return "", fmt.Errorf("failed to store PAT: %w", err)
 	}
 
 	// Update the PAT's configuration based on storage backend used
-	if backend == secrets.StorageBackendKeyring {
-		p.TokenSource = PrivateKeySourceKeyring
-	} else {
-		p.TokenSource = PrivateKeySourceFilesystem
-	}
+	p.TokenSource = sourceForBackend(backend, p.SecretBackends)
 
 	return backend, nil
 }
 
 // DeletePAT removes the PAT from secure storage
 func (p *PersonalAccessToken) DeletePAT(secretMgr *secrets.Manager) error {
-	return secretMgr.Delete(p.Name, secrets.SecretTypePAT)
+	if p.TokenRef != "" {
+		// The referenced token is managed outside gh-app-auth
+		return nil
+	}
+
+	store, err := p.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+	return store.Delete(p.Name, secrets.SecretTypePAT)
+}
+
+// secretStore returns the secrets manager holding the token
+func (p *PersonalAccessToken) secretStore(secretMgr *secrets.Manager) (*secrets.Manager, error) {
+	return tokenSecretStore(secretMgr, p.SecretBackends, p.TokenSource)
+}
+
+// tokenSecretStore returns the secrets manager holding a token. Keyring and filesystem sources
+// share the default keyring chain with its encrypted filesystem fallback; any other source
+// names the backend type that holds the token, e.g. env.
+func tokenSecretStore(
+	secretMgr *secrets.Manager, backends []secrets.BackendSpec, source PrivateKeySource,
+) (*secrets.Manager, error) {
+	if len(backends) > 0 {
+		return secretMgr.WithBackends(backends)
+	}
+	switch source {
+	case PrivateKeySourceKeyring, PrivateKeySourceFilesystem, "":
+		return secretMgr, nil
+	default:
+		return secretMgr.WithBackends([]secrets.BackendSpec{{Type: string(source)}})
+	}
+}
+
+// sourceDisplay names where the token is looked up, for error messages
+func (p *PersonalAccessToken) sourceDisplay() string {
+	switch {
+	case p.TokenRef != "":
+		return "token_ref"
+	case len(p.SecretBackends) > 0:
+		return "secret_backends"
+	case p.TokenSource == "":
+		return string(PrivateKeySourceKeyring)
+	default:
+		return string(p.TokenSource)
+	}
+}
+
+// ExpiresWithin reports whether the token expires within d of now, or has expired.
+// Tokens without a recorded expiry never do.
+func (p *PersonalAccessToken) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return p.ExpiresAt != nil && p.ExpiresAt.Sub(now) < d
+}
+
+// DaysLeft returns the whole days until the token expires, negative once it has expired.
+// ok is false for tokens without a recorded expiry.
+func (p *PersonalAccessToken) DaysLeft(now time.Time) (days int, ok bool) {
+	if p.ExpiresAt == nil {
+		return 0, false
+	}
+	return int(math.Floor(p.ExpiresAt.Sub(now).Hours() / 24)), true
 }
@@ -0,0 +1,298 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// LegacyKeyLabel labels the single key of an app configured before multi-key support
+const LegacyKeyLabel = "initial"
+
+// LabeledPrivateKey is a loaded private key and the label of its entry
+type LabeledPrivateKey struct {
+	Label string
+	PEM   string
+	// Backend is the secret backend that served the key, empty for a key file
+	Backend secrets.StorageBackend
+}
+
+// GetPrivateKeys loads the app's private keys in order of preference.
+// Keys that cannot be loaded are skipped; an error is returned only if none can be loaded.
+func (app *GitHubApp) GetPrivateKeys(secretMgr *secrets.Manager) ([]LabeledPrivateKey, error) {
+	if len(app.PrivateKeys) == 0 {
+		key, backend, err := app.getSinglePrivateKey(secretMgr)
+		if err != nil {
+			return nil, err
+		}
+		return []LabeledPrivateKey{{Label: LegacyKeyLabel, PEM: key, Backend: backend}}, nil
+	}
+
+	keys := make([]LabeledPrivateKey, 0, len(app.PrivateKeys))
+	var errs []error
+	for _, entry := range app.PrivateKeys {
+		key, backend, err := app.getPrivateKeyEntry(secretMgr, entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %q: %w", entry.Label, err))
+			continue
+		}
+		keys = append(keys, LabeledPrivateKey{Label: entry.Label, PEM: key, Backend: backend})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("failed to load any private key: %w", errors.Join(errs...))
+	}
+	return keys, nil
+}
+
+// AddPrivateKey stores a new private key and makes it the active key.
+// Existing keys are kept as fallbacks; a legacy single key is converted to an entry first.
+// The legacy secret is copied, not moved: delete it with DeleteLegacyPrivateKey once the
+// configuration is saved.
+func (app *GitHubApp) AddPrivateKey(
+	secretMgr *secrets.Manager, label, privateKey string, createdAt time.Time,
+) (secrets.StorageBackend, error) {
+	if app.PrivateKeyRef != "" {
+		return "", fmt.Errorf("private key of %s: %w", app.Name, ErrReferencedSecret)
+	}
+	if label == "" {
+		label = "key-" + createdAt.UTC().Format("20060102-150405")
+	}
+	if app.findPrivateKeyEntry(label) >= 0 {
+		return "", fmt.Errorf("private key %q already exists", label)
+	}
+
+	if err := app.adoptLegacyPrivateKey(secretMgr); err != nil {
+		return "", err
+	}
+
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return "", err
+	}
+	backend, err := store.Store(app.privateKeySecretName(label), secrets.SecretTypePrivateKey, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to store private key: %w", err)
+	}
+
+	entry := PrivateKeyEntry{Label: label, Source: app.sourceForBackend(backend), CreatedAt: createdAt.UTC()}
+	app.PrivateKeys = append([]PrivateKeyEntry{entry}, app.PrivateKeys...)
+	app.syncActivePrivateKeySource()
+
+	return backend, nil
+}
+
+// RetirePrivateKey removes a key entry from the app. The last key cannot be retired.
+// The stored secret is kept so that the configuration can be saved first: delete it
+// afterwards with DeleteRetiredPrivateKey, so a failed save never leaves the
+// configuration referencing a deleted key.
+func (app *GitHubApp) RetirePrivateKey(label string) (PrivateKeyEntry, error) {
+	idx := app.findPrivateKeyEntry(label)
+	if idx < 0 {
+		return PrivateKeyEntry{}, fmt.Errorf("private key %q not found", label)
+	}
+	if len(app.PrivateKeys) == 1 {
+		return PrivateKeyEntry{}, fmt.Errorf("cannot retire %q: it is the only private key", label)
+	}
+
+	entry := app.PrivateKeys[idx]
+	app.PrivateKeys = append(app.PrivateKeys[:idx], app.PrivateKeys[idx+1:]...)
+	app.syncActivePrivateKeySource()
+	return entry, nil
+}
+
+// DeleteRetiredPrivateKey deletes the stored secret of a key entry retired with
+// RetirePrivateKey. User-managed key files are left in place.
+func (app *GitHubApp) DeleteRetiredPrivateKey(secretMgr *secrets.Manager, entry PrivateKeyEntry) error {
+	if entry.Path != "" {
+		return nil
+	}
+
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+	name := app.privateKeySecretName(entry.Label)
+	deleteErr := store.Delete(name, secrets.SecretTypePrivateKey)
+	if _, _, err := store.Get(name, secrets.SecretTypePrivateKey); err == nil {
+		return fmt.Errorf("failed to delete private key %q: %w", entry.Label, deleteErr)
+	}
+	return nil
+}
+
+// MovePrivateKeys stores every key entry in backend, the keyring or the encrypted
+// filesystem fallback, and records it as the entry's source. Key files referenced by
+// entries are copied into the keyring and returned, as the entries no longer use them;
+// moving to the filesystem leaves them referenced. Secrets are copied, not deleted.
+func (app *GitHubApp) MovePrivateKeys(
+	secretMgr *secrets.Manager, backend secrets.StorageBackend,
+) ([]string, error) {
+	source := sourceForBackend(backend, nil)
+	var files []string
+	for i, entry := range app.PrivateKeys {
+		if entry.Path == "" && entry.Source == source {
+			continue
+		}
+		if entry.Path != "" && backend != secrets.StorageBackendKeyring {
+			continue
+		}
+
+		key, _, err := app.getPrivateKeyEntry(secretMgr, entry)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", entry.Label, err)
+		}
+		if err := secretMgr.StoreIn(backend, app.privateKeySecretName(entry.Label),
+			secrets.SecretTypePrivateKey, key); err != nil {
+			return nil, fmt.Errorf("key %q: failed to store private key: %w", entry.Label, err)
+		}
+		if entry.Path != "" {
+			files = append(files, entry.Path)
+		}
+		app.PrivateKeys[i].Path = ""
+		app.PrivateKeys[i].Source = source
+	}
+	app.syncActivePrivateKeySource()
+	return files, nil
+}
+
+// PrivateKeysIn reports whether every key entry is stored in the given source: for the
+// filesystem, entries may also reference a key file
+func (app *GitHubApp) PrivateKeysIn(source PrivateKeySource) bool {
+	for _, entry := range app.PrivateKeys {
+		if entry.Path != "" && source == PrivateKeySourceFilesystem {
+			continue
+		}
+		if entry.Path != "" || entry.Source != source {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteLegacyPrivateKey deletes the single key stored under the app's name, once adopted
+// as a key entry by AddPrivateKey and the configuration saved. Entries sharing the name
+// share the secret: only delete it when none of them still uses it.
+func (app *GitHubApp) DeleteLegacyPrivateKey(secretMgr *secrets.Manager) error {
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(app.Name, secrets.SecretTypePrivateKey); err != nil && !errors.Is(err, secrets.ErrNotFound) {
+		return fmt.Errorf("failed to delete legacy private key of %s: %w", app.Name, err)
+	}
+	return nil
+}
+
+// UsesLegacyPrivateKey reports whether the app may read its key from the single secret
+// stored under its name, rather than from key entries, a reference or a signer
+func (app *GitHubApp) UsesLegacyPrivateKey() bool {
+	return len(app.PrivateKeys) == 0 && app.PrivateKeyRef == "" && app.Signer == nil
+}
+
+// adoptLegacyPrivateKey converts the single legacy key into the first key entry. The
+// legacy secret is copied under the entry's name and left in place; entries sharing the
+// app's name share the copy, so it is made only once.
+func (app *GitHubApp) adoptLegacyPrivateKey(secretMgr *secrets.Manager) error {
+	if len(app.PrivateKeys) > 0 || (app.PrivateKeySource == "" && app.PrivateKeyPath == "") {
+		return nil
+	}
+
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+
+	entry := PrivateKeyEntry{Label: LegacyKeyLabel}
+	entryName := app.privateKeySecretName(LegacyKeyLabel)
+	if _, backend, err := store.Get(entryName, secrets.SecretTypePrivateKey); err == nil && app.PrivateKeyPath == "" {
+		// Another entry with the same name adopted the shared key already
+		entry.Source = app.sourceForBackend(backend)
+		app.PrivateKeys = []PrivateKeyEntry{entry}
+		app.PrivateKeyPath = ""
+		return nil
+	}
+
+	key, _, err := store.Get(app.Name, secrets.SecretTypePrivateKey)
+	switch {
+	case err == nil:
+		backend, err := store.Store(entryName, secrets.SecretTypePrivateKey, key)
+		if err != nil {
+			return fmt.Errorf("failed to store existing private key: %w", err)
+		}
+		entry.Source = app.sourceForBackend(backend)
+	case app.PrivateKeyPath != "":
+		// Keep referencing the user's key file
+		entry.Source = PrivateKeySourceFilesystem
+		entry.Path = app.PrivateKeyPath
+	default:
+		return fmt.Errorf("failed to read existing private key: %w", err)
+	}
+
+	app.PrivateKeys = []PrivateKeyEntry{entry}
+	app.PrivateKeyPath = ""
+	return nil
+}
+
+// getPrivateKeyEntry loads the key for a single entry and the backend that served it
+func (app *GitHubApp) getPrivateKeyEntry(
+	secretMgr *secrets.Manager, entry PrivateKeyEntry,
+) (string, secrets.StorageBackend, error) {
+	if entry.Path != "" {
+		expandedPath, err := expandPath(entry.Path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to expand path: %w", err)
+		}
+		keyData, err := os.ReadFile(expandedPath)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read private key: %w", err)
+		}
+		return string(keyData), "", nil
+	}
+
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return "", "", err
+	}
+	key, backend, err := store.Get(app.privateKeySecretName(entry.Label), secrets.SecretTypePrivateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get private key from %s: %w", entry.Source, err)
+	}
+	return key, backend, nil
+}
+
+// findPrivateKeyEntry returns the index of the entry with the given label, or -1
+func (app *GitHubApp) findPrivateKeyEntry(label string) int {
+	for i, entry := range app.PrivateKeys {
+		if entry.Label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// syncActivePrivateKeySource mirrors the active key's source into PrivateKeySource for display
+func (app *GitHubApp) syncActivePrivateKeySource() {
+	if len(app.PrivateKeys) > 0 {
+		app.PrivateKeySource = app.PrivateKeys[0].Source
+	}
+}
+
+// privateKeySecretName names the stored secret of a key entry
+func (app *GitHubApp) privateKeySecretName(label string) string {
+	return app.Name + "#" + label
+}
+
+// sourceForBackend maps the backend that stored a secret to the source recorded in the config
+func sourceForBackend(backend secrets.StorageBackend, specs []secrets.BackendSpec) PrivateKeySource {
+	switch {
+	case backend == secrets.StorageBackendKeyring:
+		return PrivateKeySourceKeyring
+	case len(specs) > 0:
+		return PrivateKeySource(backend)
+	default:
+		return PrivateKeySourceFilesystem
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+)
+
+func TestGitHubApp_AddPrivateKey_AdoptsLegacyKeyringKey(t *testing.T) {
+	// Given: An app with a single key in the keyring
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := &GitHubApp{Name: "test-app", AppID: 12345, Patterns: []string{"github.com/org/*"}}
+	if _, err := app.SetPrivateKey(secretMgr, "old-key"); err != nil {
+		t.Fatalf("SetPrivateKey() failed: %v", err)
+	}
+
+	// When: A new key is added
+	createdAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	backend, err := app.AddPrivateKey(secretMgr, "", "new-key", createdAt)
+	if err != nil {
+		t.Fatalf("AddPrivateKey() failed: %v", err)
+	}
+
+	// Then: The new key is active and the old key is kept as a fallback
+	if backend != secrets.StorageBackendKeyring {
+		t.Errorf("AddPrivateKey() backend = %v, want %v", backend, secrets.StorageBackendKeyring)
+	}
+	if len(app.PrivateKeys) != 2 {
+		t.Fatalf("len(PrivateKeys) = %d, want 2", len(app.PrivateKeys))
+	}
+	if app.PrivateKeys[0].Label != "key-20240601-120000" || !app.PrivateKeys[0].CreatedAt.Equal(createdAt) {
+		t.Errorf("active entry = %+v", app.PrivateKeys[0])
+	}
+	if app.PrivateKeys[1].Label != LegacyKeyLabel {
+		t.Errorf("fallback label = %q, want %q", app.PrivateKeys[1].Label, LegacyKeyLabel)
+	}
+	if err := app.Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+
+	keys, err := app.GetPrivateKeys(secretMgr)
+	if err != nil {
+		t.Fatalf("GetPrivateKeys() failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0].PEM != "new-key" || keys[1].PEM != "old-key" {
+		t.Errorf("GetPrivateKeys() = %+v, want new-key then old-key", keys)
+	}
+	if key, err := app.GetPrivateKey(secretMgr); err != nil || key != "new-key" {
+		t.Errorf("GetPrivateKey() = %q, %v, want new-key", key, err)
+	}
+
+	// And: The legacy secret is copied under the entry's name, and kept until deleted
+	// once the configuration is saved
+	if _, err := keyring.Get("gh-app-auth:test-app", "private_key"); err != nil {
+		t.Errorf("Expected legacy keyring entry to be kept: %v", err)
+	}
+	if err := app.DeleteLegacyPrivateKey(secretMgr); err != nil {
+		t.Fatalf("DeleteLegacyPrivateKey() failed: %v", err)
+	}
+	if _, err := keyring.Get("gh-app-auth:test-app", "private_key"); err == nil {
+		t.Error("Expected legacy keyring entry to be removed")
+	}
+	if keys, err := app.GetPrivateKeys(secretMgr); err != nil || len(keys) != 2 {
+		t.Errorf("GetPrivateKeys() after deleting the legacy key = %+v, %v", keys, err)
+	}
+}
+
+func TestGitHubApp_AddPrivateKey_SharedLegacyKey(t *testing.T) {
+	// Given: Two entries of an app sharing one name, and so one stored key
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	first := &GitHubApp{Name: "org-bot", AppID: 12345, Patterns: []string{"github.com/org1/*"}}
+	if _, err := first.SetPrivateKey(secretMgr, "old-key"); err != nil {
+		t.Fatalf("SetPrivateKey() failed: %v", err)
+	}
+	second := &GitHubApp{Name: "org-bot", AppID: 12345, Patterns: []string{"github.com/org2/*"},
+		PrivateKeySource: first.PrivateKeySource}
+
+	// When: The key is rotated on both
+	for _, app := range []*GitHubApp{first, second} {
+		if _, err := app.AddPrivateKey(secretMgr, "next", "new-key", time.Now()); err != nil {
+			t.Fatalf("AddPrivateKey() on %v failed: %v", app.Patterns, err)
+		}
+	}
+
+	// Then: Both keep the shared old key as a fallback
+	for _, app := range []*GitHubApp{first, second} {
+		keys, err := app.GetPrivateKeys(secretMgr)
+		if err != nil || len(keys) != 2 || keys[0].PEM != "new-key" || keys[1].PEM != "old-key" {
+			t.Errorf("GetPrivateKeys() on %v = %+v, %v; want new-key then old-key", app.Patterns, keys, err)
+		}
+	}
+}
+
+func TestGitHubApp_AddPrivateKey_KeepsUserKeyFile(t *testing.T) {
+	// Given: An app whose key is a user-managed file
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	tempDir := t.TempDir()
+	keyPath := filepath.Join(tempDir, "app.pem")
+	if err := os.WriteFile(keyPath, []byte("file-key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	secretMgr := secrets.NewManager(tempDir)
+	app := &GitHubApp{
+		Name:             "test-app",
+		AppID:            12345,
+		PrivateKeySource: PrivateKeySourceFilesystem,
+		PrivateKeyPath:   keyPath,
+	}
+
+	// When: A new key is added
+	if _, err := app.AddPrivateKey(secretMgr, "next", "new-key", time.Now()); err != nil {
+		t.Fatalf("AddPrivateKey() failed: %v", err)
+	}
+
+	// Then: The file is referenced by the fallback entry and left on disk
+	if app.PrivateKeyPath != "" {
+		t.Errorf("PrivateKeyPath = %q, want empty", app.PrivateKeyPath)
+	}
+	if app.PrivateKeys[1].Path != keyPath {
+		t.Errorf("fallback path = %q, want %q", app.PrivateKeys[1].Path, keyPath)
+	}
+	if app.PrivateKeySource != PrivateKeySourceKeyring {
+		t.Errorf("PrivateKeySource = %v, want active key source %v", app.PrivateKeySource, PrivateKeySourceKeyring)
+	}
+
+	retired, err := app.RetirePrivateKey(LegacyKeyLabel)
+	if err != nil {
+		t.Fatalf("RetirePrivateKey() failed: %v", err)
+	}
+	if err := app.DeleteRetiredPrivateKey(secretMgr, retired); err != nil {
+		t.Fatalf("DeleteRetiredPrivateKey() failed: %v", err)
+	}
+	if _, err := os.Stat(keyPath); err != nil {
+		t.Errorf("Expected user key file to be kept: %v", err)
+	}
+}
+
+func TestGitHubApp_AddPrivateKey_DuplicateLabel(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := &GitHubApp{Name: "test-app", AppID: 12345}
+	if _, err := app.AddPrivateKey(secretMgr, "a", "key-a", time.Now()); err != nil {
+		t.Fatalf("AddPrivateKey() failed: %v", err)
+	}
+	if _, err := app.AddPrivateKey(secretMgr, "a", "key-b", time.Now()); err == nil {
+		t.Error("Expected error for duplicate label")
+	}
+}
+
+func TestGitHubApp_RetirePrivateKey(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := &GitHubApp{Name: "test-app", AppID: 12345}
+	for _, label := range []string{"old", "new"} {
+		if _, err := app.AddPrivateKey(secretMgr, label, label+"-key", time.Now()); err != nil {
+			t.Fatalf("AddPrivateKey(%q) failed: %v", label, err)
+		}
+	}
+
+	if _, err := app.RetirePrivateKey("missing"); err == nil {
+		t.Error("Expected error for unknown label")
+	}
+	retired, err := app.RetirePrivateKey("old")
+	if err != nil {
+		t.Fatalf("RetirePrivateKey() failed: %v", err)
+	}
+	if len(app.PrivateKeys) != 1 || app.PrivateKeys[0].Label != "new" {
+		t.Errorf("PrivateKeys = %+v, want only new", app.PrivateKeys)
+	}
+
+	// The secret is kept until it is explicitly deleted
+	if _, err := keyring.Get("gh-app-auth:test-app#old", "private_key"); err != nil {
+		t.Errorf("Expected retired key to be kept until deleted: %v", err)
+	}
+	if err := app.DeleteRetiredPrivateKey(secretMgr, retired); err != nil {
+		t.Fatalf("DeleteRetiredPrivateKey() failed: %v", err)
+	}
+	if _, err := keyring.Get("gh-app-auth:test-app#old", "private_key"); err == nil {
+		t.Error("Expected retired key to be deleted from keyring")
+	}
+
+	// The last key cannot be retired
+	if _, err := app.RetirePrivateKey("new"); err == nil {
+		t.Error("Expected error when retiring the only key")
+	}
+}
+
+func TestGitHubApp_GetPrivateKeys_SkipsUnavailableKeys(t *testing.T) {
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+
+	tempDir := t.TempDir()
+	secretMgr := secrets.NewManager(tempDir)
+	app := &GitHubApp{
+		Name: "test-app",
+		PrivateKeys: []PrivateKeyEntry{
+			{Label: "gone", Source: PrivateKeySourceFilesystem, Path: filepath.Join(tempDir, "missing.pem")},
+			{Label: "stored", Source: PrivateKeySourceKeyring},
+		},
+	}
+
+	if _, err := app.GetPrivateKeys(secretMgr); err == nil {
+		t.Error("Expected error when no key can be loaded")
+	}
+
+	if _, err := secretMgr.Store("test-app#stored", secrets.SecretTypePrivateKey, "stored-key"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	keys, err := app.GetPrivateKeys(secretMgr)
+	if err != nil {
+		t.Fatalf("GetPrivateKeys() failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Label != "stored" {
+		t.Errorf("GetPrivateKeys() = %+v, want only stored", keys)
+	}
+}
+
+func TestGitHubApp_Validate_PrivateKeyEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []PrivateKeyEntry
+		wantErr bool
+	}{
+		{
+			name: "valid entries",
+			entries: []PrivateKeyEntry{
+				{Label: "a", Source: PrivateKeySourceKeyring},
+				{Label: "b", Source: PrivateKeySourceFilesystem},
+			},
+		},
+		{
+			name:    "missing label",
+			entries: []PrivateKeyEntry{{Source: PrivateKeySourceKeyring}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate label",
+			entries: []PrivateKeyEntry{
+				{Label: "a", Source: PrivateKeySourceKeyring},
+				{Label: "a", Source: PrivateKeySourceKeyring},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "inline source",
+			entries: []PrivateKeyEntry{{Label: "a", Source: PrivateKeySourceInline}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &GitHubApp{Name: "test-app", AppID: 1, Patterns: []string{"github.com/org/*"}, PrivateKeys: tt.entries}
+			if err := app.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
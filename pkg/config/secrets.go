@@ -10,27 +10,115 @@ import (
 // GetPrivateKey retrieves the private key from the appropriate source
 // based on the PrivateKeySource configuration
 func (app *GitHubApp) GetPrivateKey(secretMgr *secrets.Manager) (string, error) {
+	if app.PrivateKeyRef != "" {
+		return app.resolvePrivateKeyRef()
+	}
+
+	if len(app.PrivateKeys) > 0 {
+		keys, err := app.GetPrivateKeys(secretMgr)
+		if err != nil {
+			return "", err
+		}
+		return keys[0].PEM, nil
+	}
+
+	key, _, err := app.locatePrivateKey(secretMgr)
+	return key, err
+}
+
+// LocatePrivateKey reports the secret backend serving the app's active private key.
+// It is empty when the key is read from a user-managed key file.
+func (app *GitHubApp) LocatePrivateKey(secretMgr *secrets.Manager) (secrets.StorageBackend, error) {
+	if len(app.PrivateKeys) > 0 && app.PrivateKeyRef == "" {
+		entry := app.PrivateKeys[0]
+		if entry.Path != "" {
+			return "", nil
+		}
+		store, err := app.secretStore(secretMgr)
+		if err != nil {
+			return "", err
+		}
+		_, backend, err := store.Get(app.privateKeySecretName(entry.Label), secrets.SecretTypePrivateKey)
+		return backend, err
+	}
+
+	_, backend, err := app.getSinglePrivateKey(secretMgr)
+	return backend, err
+}
+
+// getSinglePrivateKey loads the key of an app without key entries, through its
+// private_key_ref when set, and the backend that served it
+func (app *GitHubApp) getSinglePrivateKey(secretMgr *secrets.Manager) (string, secrets.StorageBackend, error) {
+	if app.PrivateKeyRef == "" {
+		return app.locatePrivateKey(secretMgr)
+	}
+	key, err := app.resolvePrivateKeyRef()
+	if err != nil {
+		return "", "", err
+	}
+	ref, err := secrets.ParseReference(app.PrivateKeyRef)
+	if err != nil {
+		return "", "", err
+	}
+	return key, ref.Backend(), nil
+}
+
+// locatePrivateKey loads the single private key of an app without key entries
+func (app *GitHubApp) locatePrivateKey(secretMgr *secrets.Manager) (string, secrets.StorageBackend, error) {
+	// Secret backends, when configured, hold the key unless it is in a user-managed file
+	if len(app.SecretBackends) > 0 && app.PrivateKeyPath == "" {
+		return app.getStoredPrivateKey(secretMgr)
+	}
+
 	switch app.PrivateKeySource {
 	case PrivateKeySourceKeyring:
-		key, _, err := secretMgr.Get(app.Name, secrets.SecretTypePrivateKey)
+		key, backend, err := app.getStoredPrivateKey(secretMgr)
 		if err == nil {
-			return key, nil
+			return key, backend, nil
 		}
 		// If keyring fails and we have a path, try filesystem as fallback
 		if app.PrivateKeyPath != "" {
-			return app.getPrivateKeyFromFilesystem()
+			key, err := app.getPrivateKeyFromFilesystem()
+			return key, "", err
 		}
-		return "", fmt.Errorf("failed to get private key from keyring: %w", err)
+		return "", "", fmt.Errorf("failed to get private key from keyring: %w", err)
 
 	case PrivateKeySourceFilesystem:
-		return app.getPrivateKeyFromFilesystem()
+		key, err := app.getPrivateKeyFromFilesystem()
+		return key, "", err
 
 	case PrivateKeySourceInline:
-		return "", fmt.Errorf("inline private keys should be migrated to secure storage")
+		return "", "", fmt.Errorf("inline private keys should be migrated to secure storage")
 
 	default:
-		return "", fmt.Errorf("unknown private key source: %s", app.PrivateKeySource)
+		return "", "", fmt.Errorf("unknown private key source: %s", app.PrivateKeySource)
+	}
+}
+
+// resolvePrivateKeyRef reads the private key through the app's private_key_ref. A key file
+// it references must not be readable by others, like one in private_key_path.
+func (app *GitHubApp) resolvePrivateKeyRef() (string, error) {
+	ref, err := secrets.ParseReference(app.PrivateKeyRef)
+	if err != nil {
+		return "", err
+	}
+	if err := ref.CheckPrivate(); err != nil {
+		return "", fmt.Errorf("private_key_ref: %w", err)
 	}
+	key, err := ref.Resolve(app.Name, secrets.SecretTypePrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve private_key_ref: %w", err)
+	}
+	return key, nil
+}
+
+// getStoredPrivateKey reads the app's private key from its secret backends
+func (app *GitHubApp) getStoredPrivateKey(secretMgr *secrets.Manager) (string, secrets.StorageBackend, error) {
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return "", "", err
+	}
+	return store.Get(app.Name, secrets.SecretTypePrivateKey)
 }
 
 // getPrivateKeyFromFilesystem reads the private key from the filesystem
@@ -55,34 +143,99 @@ func (app *GitHubApp) getPrivateKeyFromFilesystem() (string, error) {
 // SetPrivateKey stores the private key securely
 // It attempts to use keyring first, falling back to filesystem if unavailable
 func (app *GitHubApp) SetPrivateKey(secretMgr *secrets.Manager, privateKey string) (secrets.StorageBackend, error) {
-	backend, err := secretMgr.Store(app.Name, secrets.SecretTypePrivateKey, privateKey)
+	if app.PrivateKeyRef != "" {
+		return "", fmt.Errorf("private key of %s: %w", app.Name, ErrReferencedSecret)
+	}
+
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return "", err
+	}
+	backend, err := store.Store(app.Name, secrets.SecretTypePrivateKey, privateKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to store private key: %w", err)
 	}
 
 	// Update the app's configuration based on storage backend used
-	if backend == secrets.StorageBackendKeyring {
-		app.PrivateKeySource = PrivateKeySourceKeyring
-		// Clear path since key is in keyring (but keep it as fallback if already set)
-		// app.PrivateKeyPath = ""
-	} else {
-		app.PrivateKeySource = PrivateKeySourceFilesystem
-		// Filesystem backend has stored the key, path is managed by secrets manager
-	}
+	app.PrivateKeySource = app.sourceForBackend(backend)
 
 	return backend, nil
 }
 
+// SetKeyPassphrase stores the passphrase of the app's encrypted private keys.
+// It is kept in the OS keyring only: on disk next to the key it would defeat the encryption.
+func (app *GitHubApp) SetKeyPassphrase(secretMgr *secrets.Manager, passphrase string) error {
+	if err := secretMgr.StoreInKeyring(app.Name, secrets.SecretTypeKeyPassphrase, passphrase); err != nil {
+		return fmt.Errorf("failed to store key passphrase: %w", err)
+	}
+	return nil
+}
+
+// GetKeyPassphrase retrieves the stored passphrase of the app's encrypted private keys,
+// from the app's secret backends or the OS keyring
+func (app *GitHubApp) GetKeyPassphrase(secretMgr *secrets.Manager) (string, error) {
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return "", err
+	}
+	passphrase, _, err := store.Get(app.Name, secrets.SecretTypeKeyPassphrase)
+	if err != nil && store != secretMgr {
+		passphrase, _, err = secretMgr.Get(app.Name, secrets.SecretTypeKeyPassphrase)
+	}
+	if err != nil {
+		return "", err
+	}
+	return passphrase, nil
+}
+
 // DeletePrivateKey removes the private key from secure storage
 func (app *GitHubApp) DeletePrivateKey(secretMgr *secrets.Manager) error {
-	return secretMgr.Delete(app.Name, secrets.SecretTypePrivateKey)
+	store, err := app.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range app.PrivateKeys {
+		if entry.Path == "" {
+			_ = store.Delete(app.privateKeySecretName(entry.Label), secrets.SecretTypePrivateKey)
+		}
+	}
+	_ = store.Delete(app.Name, secrets.SecretTypeKeyPassphrase)
+	if store != secretMgr {
+		_ = secretMgr.Delete(app.Name, secrets.SecretTypeKeyPassphrase)
+	}
+	if app.PrivateKeyRef != "" {
+		// The referenced key is managed outside gh-app-auth
+		return nil
+	}
+	err = store.Delete(app.Name, secrets.SecretTypePrivateKey)
+	if len(app.PrivateKeys) > 0 {
+		// The legacy slot is usually empty once multiple keys are in use
+		return nil
+	}
+	return err
 }
 
 // HasPrivateKey checks if the app has a private key configured
 func (app *GitHubApp) HasPrivateKey(secretMgr *secrets.Manager) bool {
+	if app.PrivateKeyRef != "" {
+		_, err := app.resolvePrivateKeyRef()
+		return err == nil
+	}
+
+	if len(app.PrivateKeys) > 0 {
+		_, err := app.GetPrivateKeys(secretMgr)
+		return err == nil
+	}
+
+	if len(app.SecretBackends) > 0 && app.PrivateKeyPath == "" {
+		_, _, err := app.getStoredPrivateKey(secretMgr)
+		return err == nil
+	}
+
 	switch app.PrivateKeySource {
 	case PrivateKeySourceKeyring:
-		_, _, err := secretMgr.Get(app.Name, secrets.SecretTypePrivateKey)
+		_, _, err := app.getStoredPrivateKey(secretMgr)
 		return err == nil
 	case PrivateKeySourceFilesystem:
 		if app.PrivateKeyPath == "" {
@@ -98,3 +251,14 @@ func (app *GitHubApp) HasPrivateKey(secretMgr *secrets.Manager) bool {
 		return false
 	}
 }
+
+// secretStore returns the secrets manager for the app's secret backends
+func (app *GitHubApp) secretStore(secretMgr *secrets.Manager) (*secrets.Manager, error) {
+	return secretMgr.WithBackends(app.SecretBackends)
+}
+
+// sourceForBackend records the backend that stored a secret as the key source. Apps with
+// their own secret backends record any backend; others only know keyring and filesystem.
+func (app *GitHubApp) sourceForBackend(backend secrets.StorageBackend) PrivateKeySource {
+	return sourceForBackend(backend, app.SecretBackends)
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
 	"github.com/zalando/go-keyring"
@@ -349,3 +352,313 @@ func TestGitHubApp_Validate_WithPrivateKeySource(t *testing.T) {
 		})
 	}
 }
+
+func TestGitHubApp_SecretBackends(t *testing.T) {
+	// Given: Keyring is unavailable and the app keeps its key in an env var then memory
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := &GitHubApp{
+		Name:     "backends-app",
+		AppID:    12345,
+		Patterns: []string{"github.com/org/*"},
+		SecretBackends: []secrets.BackendSpec{
+			{Type: secrets.BackendTypeEnv},
+			{Type: secrets.BackendTypeMemory},
+		},
+	}
+	defer func() { _ = app.DeletePrivateKey(secretMgr) }()
+
+	// Then: No private key source or path is needed
+	if err := app.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	// When: The key is stored, it lands in the first writable backend
+	backend, err := app.SetPrivateKey(secretMgr, "memory-key")
+	if err != nil {
+		t.Fatalf("SetPrivateKey() failed: %v", err)
+	}
+	if backend != secrets.BackendTypeMemory || app.PrivateKeySource != "memory" {
+		t.Errorf("SetPrivateKey() = %v, source %v; want memory", backend, app.PrivateKeySource)
+	}
+	if err := app.Validate(); err != nil {
+		t.Fatalf("Validate() with recorded source failed: %v", err)
+	}
+
+	key, err := app.GetPrivateKey(secretMgr)
+	if err != nil || key != "memory-key" {
+		t.Errorf("GetPrivateKey() = %q, %v; want memory-key", key, err)
+	}
+	if served, err := app.LocatePrivateKey(secretMgr); err != nil || served != secrets.BackendTypeMemory {
+		t.Errorf("LocatePrivateKey() = %v, %v; want memory", served, err)
+	}
+
+	// When: The environment provides the key, it is served from there first
+	t.Setenv("GH_APP_AUTH_BACKENDS_APP_PRIVATE_KEY", "env-key")
+	if key, _ := app.GetPrivateKey(secretMgr); key != "env-key" {
+		t.Errorf("GetPrivateKey() = %q, want env-key", key)
+	}
+	if served, _ := app.LocatePrivateKey(secretMgr); served != secrets.BackendTypeEnv {
+		t.Errorf("LocatePrivateKey() = %v, want env", served)
+	}
+}
+
+func TestGitHubApp_Validate_SecretBackends(t *testing.T) {
+	app := &GitHubApp{
+		Name:           "bad-backends",
+		AppID:          12345,
+		Patterns:       []string{"github.com/org/*"},
+		SecretBackends: []secrets.BackendSpec{{Type: "keyring"}, {Type: "vaultish"}},
+	}
+	if err := app.Validate(); err == nil {
+		t.Error("Validate() expected error for an unknown backend type")
+	}
+
+	pat := &PersonalAccessToken{
+		Name:           "bad-pat",
+		Patterns:       []string{"github.com/"},
+		SecretBackends: []secrets.BackendSpec{{Type: "command"}},
+	}
+	if err := pat.Validate(); err == nil {
+		t.Error("Validate() expected error for a command backend without command")
+	}
+}
+
+func TestGitHubApp_PrivateKeyRef(t *testing.T) {
+	// Given: An app referencing its key from the environment
+	keyring.MockInit()
+	secretMgr := secrets.NewManager(t.TempDir())
+	app := &GitHubApp{
+		Name:          "ref-app",
+		AppID:         12345,
+		Patterns:      []string{"github.com/org/*"},
+		PrivateKeyRef: "env:REF_APP_KEY",
+	}
+
+	// Then: No private key source or path is needed
+	if err := app.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	// When: The variable is unset, the key is missing
+	t.Setenv("REF_APP_KEY", "")
+	if app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() = true for an unset variable")
+	}
+
+	// When: The variable is set, it is read on each lookup
+	t.Setenv("REF_APP_KEY", "env-key")
+	if key, err := app.GetPrivateKey(secretMgr); err != nil || key != "env-key" {
+		t.Errorf("GetPrivateKey() = %q, %v; want env-key", key, err)
+	}
+	if served, err := app.LocatePrivateKey(secretMgr); err != nil || served != secrets.BackendTypeEnv {
+		t.Errorf("LocatePrivateKey() = %v, %v; want env", served, err)
+	}
+
+	// Then: The key cannot be stored or rotated through gh-app-auth, and removal leaves it alone
+	if _, err := app.SetPrivateKey(secretMgr, "other"); !errors.Is(err, ErrReferencedSecret) {
+		t.Errorf("SetPrivateKey() error = %v, want %v", err, ErrReferencedSecret)
+	}
+	if _, err := app.AddPrivateKey(secretMgr, "next", "other", time.Now()); !errors.Is(err, ErrReferencedSecret) {
+		t.Errorf("AddPrivateKey() error = %v, want %v", err, ErrReferencedSecret)
+	}
+	if err := app.DeletePrivateKey(secretMgr); err != nil {
+		t.Errorf("DeletePrivateKey() failed: %v", err)
+	}
+}
+
+func TestGitHubApp_PrivateKeyRef_FilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions work differently on Windows")
+	}
+
+	// Given: An app referencing a key file that others can read
+	secretMgr := secrets.NewManager(t.TempDir())
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	app := &GitHubApp{Name: "ref-app", AppID: 12345, PrivateKeyRef: "file:" + keyFile}
+
+	// Then: The key is refused, like a private_key_path file with the same permissions
+	if _, err := app.GetPrivateKey(secretMgr); err == nil || !strings.Contains(err.Error(), "overly permissive") {
+		t.Errorf("GetPrivateKey() error = %v, want permissions error", err)
+	}
+	if _, err := app.LocatePrivateKey(secretMgr); err == nil {
+		t.Error("LocatePrivateKey() should fail for a key file others can read")
+	}
+	if app.HasPrivateKey(secretMgr) {
+		t.Error("HasPrivateKey() = true for a key file others can read")
+	}
+
+	// When: The file is made private, the key is read
+	if err := os.Chmod(keyFile, 0600); err != nil {
+		t.Fatalf("Chmod() failed: %v", err)
+	}
+	if key, err := app.GetPrivateKey(secretMgr); err != nil || key != "file-key" {
+		t.Errorf("GetPrivateKey() = %q, %v; want file-key", key, err)
+	}
+}
+
+func TestPersonalAccessToken_TokenRef_FilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions work differently on Windows")
+	}
+
+	// Given: A PAT referencing a token file that others can read
+	secretMgr := secrets.NewManager(t.TempDir())
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("ghp_file\n"), 0644); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	pat := &PersonalAccessToken{Name: "ref-pat", Patterns: []string{"github.com/org/"}, TokenRef: "file:" + tokenFile}
+
+	// Then: The token is refused, like a private key file with the same permissions
+	if _, err := pat.GetPAT(secretMgr); err == nil || !strings.Contains(err.Error(), "overly permissive") {
+		t.Errorf("GetPAT() error = %v, want permissions error", err)
+	}
+
+	// When: The file is made private, the token is read
+	if err := os.Chmod(tokenFile, 0600); err != nil {
+		t.Fatalf("Chmod() failed: %v", err)
+	}
+	if token, err := pat.GetPAT(secretMgr); err != nil || token != "ghp_file" {
+		t.Errorf("GetPAT() = %q, %v; want ghp_file", token, err)
+	}
+}
+
+func TestPersonalAccessToken_TokenRef(t *testing.T) {
+	keyring.MockInit()
+	secretMgr := secrets.NewManager(t.TempDir())
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("ghp_file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	pat := &PersonalAccessToken{
+		Name:     "ref-pat",
+		Patterns: []string{"github.com/"},
+		TokenRef: "file:" + tokenFile,
+	}
+
+	if err := pat.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if token, err := pat.GetPAT(secretMgr); err != nil || token != "ghp_file" {
+		t.Errorf("GetPAT() = %q, %v; want ghp_file", token, err)
+	}
+	if _, served, err := pat.LocatePAT(secretMgr); err != nil || served != secrets.BackendTypeFile {
+		t.Errorf("LocatePAT() = %v, %v; want file", served, err)
+	}
+	if _, err := pat.SetPAT(secretMgr, "ghp_other"); !errors.Is(err, ErrReferencedSecret) {
+		t.Errorf("SetPAT() error = %v, want %v", err, ErrReferencedSecret)
+	}
+	if err := pat.DeletePAT(secretMgr); err != nil {
+		t.Errorf("DeletePAT() failed: %v", err)
+	}
+	if _, err := os.Stat(tokenFile); err != nil {
+		t.Errorf("DeletePAT() removed the referenced file: %v", err)
+	}
+}
+
+func TestValidate_SecretReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     GitHubApp
+		wantErr bool
+	}{
+		{name: "cmd", app: GitHubApp{PrivateKeyRef: "cmd:op read op://vault/app/key"}},
+		{name: "keyring", app: GitHubApp{PrivateKeyRef: "keyring:shared-app"}},
+		{name: "unknown scheme", app: GitHubApp{PrivateKeyRef: "vault:secret/app"}, wantErr: true},
+		{name: "no scheme", app: GitHubApp{PrivateKeyRef: "GH_APP_KEY"}, wantErr: true},
+		{name: "with path", app: GitHubApp{PrivateKeyRef: "env:KEY", PrivateKeyPath: "/tmp/key.pem"}, wantErr: true},
+		{name: "with keys", app: GitHubApp{
+			PrivateKeyRef: "env:KEY",
+			PrivateKeys:   []PrivateKeyEntry{{Label: "a", Source: PrivateKeySourceKeyring}},
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := tt.app
+			app.Name, app.AppID, app.Patterns = "app", 1, []string{"github.com/"}
+			if err := app.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	pat := &PersonalAccessToken{Name: "pat", Patterns: []string{"github.com/"}, TokenRef: "env"}
+	if err := pat.Validate(); err == nil {
+		t.Error("Validate() expected error for a token_ref without scheme")
+	}
+}
+
+func TestPersonalAccessToken_Sources(t *testing.T) {
+	// Given: The keyring is unavailable, so a stored PAT lands in the filesystem fallback
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+	t.Setenv(secrets.MasterKeyEnv, "")
+	t.Setenv(secrets.SecretsPassphraseEnv, "")
+
+	secretMgr := secrets.NewManager(t.TempDir())
+	pat := &PersonalAccessToken{Name: "fs-pat", Patterns: []string{"github.com/"}}
+	if _, err := pat.SetPAT(secretMgr, "ghp_fs"); err != nil {
+		t.Fatalf("SetPAT() failed: %v", err)
+	}
+
+	// Then: The recorded filesystem source can be read back
+	if pat.TokenSource != PrivateKeySourceFilesystem {
+		t.Fatalf("TokenSource = %v, want filesystem", pat.TokenSource)
+	}
+	if token, err := pat.GetPAT(secretMgr); err != nil || token != "ghp_fs" {
+		t.Errorf("GetPAT() = %q, %v; want ghp_fs", token, err)
+	}
+
+	// When: The source names the env backend
+	envPAT := &PersonalAccessToken{Name: "ci-pat", Patterns: []string{"github.com/"}, TokenSource: "env"}
+	if err := envPAT.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if _, err := envPAT.GetPAT(secretMgr); err == nil {
+		t.Error("GetPAT() expected error while the variable is unset")
+	}
+	t.Setenv("GH_APP_AUTH_CI_PAT_PAT", "ghp_env")
+	if token, err := envPAT.GetPAT(secretMgr); err != nil || token != "ghp_env" {
+		t.Errorf("GetPAT() = %q, %v; want ghp_env", token, err)
+	}
+
+	// Then: Sources that need settings must be configured in secret_backends
+	cmdPAT := &PersonalAccessToken{Name: "cmd-pat", Patterns: []string{"github.com/"}, TokenSource: "command"}
+	if err := cmdPAT.Validate(); err == nil {
+		t.Error("Validate() expected error for a command source without secret_backends")
+	}
+	cmdPAT.SecretBackends = []secrets.BackendSpec{{Type: secrets.BackendTypeCommand, Command: "pass"}}
+	if err := cmdPAT.Validate(); err != nil {
+		t.Errorf("Validate() with secret_backends failed: %v", err)
+	}
+}
+
+func TestPersonalAccessToken_Expiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	pat := &PersonalAccessToken{Name: "pat"}
+
+	if _, ok := pat.DaysLeft(now); ok || pat.ExpiresWithin(now, PATExpiryWarning) {
+		t.Error("A PAT without expiry reported an expiry")
+	}
+
+	expires := now.Add(10*24*time.Hour + time.Hour)
+	pat.ExpiresAt = &expires
+	if days, ok := pat.DaysLeft(now); !ok || days != 10 {
+		t.Errorf("DaysLeft() = %d, %v; want 10", days, ok)
+	}
+	if pat.ExpiresWithin(now, PATExpiryWarning) {
+		t.Error("ExpiresWithin() = true ten days ahead")
+	}
+	if !pat.ExpiresWithin(now.Add(4*24*time.Hour), PATExpiryWarning) {
+		t.Error("ExpiresWithin() = false six days ahead")
+	}
+	if days, _ := pat.DaysLeft(expires.Add(time.Hour)); days >= 0 {
+		t.Errorf("DaysLeft() after expiry = %d, want negative", days)
+	}
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+)
+
+// UserTokenRefreshMargin is how long before its expiry an access token is refreshed
+const UserTokenRefreshMargin = 5 * time.Minute
+
+// defaultUserTokenHost is the GitHub host of user tokens configured without one
+const defaultUserTokenHost = "github.com"
+
+// Validate validates a GitHub App user token configuration
+func (u *AppUserToken) Validate() error {
+	if strings.TrimSpace(u.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if u.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if strings.ContainsFunc(u.ClientID, unicode.IsSpace) {
+		return fmt.Errorf("client_id must not contain whitespace")
+	}
+
+	if len(u.Patterns) == 0 {
+		return fmt.Errorf("at least one pattern is required")
+	}
+	for i, pattern := range u.Patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("patterns[%d] cannot be empty", i)
+		}
+	}
+
+	if err := validateSecretBackends(u.SecretBackends); err != nil {
+		return err
+	}
+
+	switch u.TokenSource {
+	case "", PrivateKeySourceKeyring, PrivateKeySourceFilesystem:
+	default:
+		if len(u.SecretBackends) == 0 {
+			return fmt.Errorf("invalid token_source: %s", u.TokenSource)
+		}
+	}
+
+	return nil
+}
+
+// GitHubHost returns the GitHub host the app lives on
+func (u *AppUserToken) GitHubHost() string {
+	if u.Host == "" {
+		return defaultUserTokenHost
+	}
+	return u.Host
+}
+
+// GetAccessToken retrieves the stored access token, which may have expired (see ExpiresWithin)
+func (u *AppUserToken) GetAccessToken(secretMgr *secrets.Manager) (string, error) {
+	return u.getSecret(secretMgr, secrets.SecretTypeAccessToken)
+}
+
+// GetRefreshToken retrieves the stored refresh token
+func (u *AppUserToken) GetRefreshToken(secretMgr *secrets.Manager) (string, error) {
+	return u.getSecret(secretMgr, secrets.SecretTypeRefreshToken)
+}
+
+// GetClientSecret retrieves the app's client secret, stored only when refreshing tokens needs it
+func (u *AppUserToken) GetClientSecret(secretMgr *secrets.Manager) (string, error) {
+	return u.getSecret(secretMgr, secrets.SecretTypeClientSecret)
+}
+
+// SetClientSecret stores the app's client secret, sent when refreshing tokens
+func (u *AppUserToken) SetClientSecret(secretMgr *secrets.Manager, clientSecret string) error {
+	store, err := u.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+	if _, err := store.Store(u.Name, secrets.SecretTypeClientSecret, clientSecret); err != nil {
+		return fmt.Errorf("failed to store client secret: %w", err)
+	}
+	return nil
+}
+
+// SetTokens stores a new access token and refresh token and records when they expire.
+// A zero expiry means the token does not expire; an empty refresh token removes the old one.
+func (u *AppUserToken) SetTokens(
+	secretMgr *secrets.Manager, accessToken, refreshToken string, expiresAt, refreshExpiresAt time.Time,
+) (secrets.StorageBackend, error) {
+	store, err := u.secretStore(secretMgr)
+	if err != nil {
+		return "", err
+	}
+
+	// GitHub revokes the old refresh token once it is used, so the new one is stored first:
+	// should the access token fail to store, the next refresh still works
+	if refreshToken != "" {
+		if _, err := store.Store(u.Name, secrets.SecretTypeRefreshToken, refreshToken); err != nil {
+			return "", fmt.Errorf("failed to store refresh token: %w", err)
+		}
+	}
+	backend, err := store.Store(u.Name, secrets.SecretTypeAccessToken, accessToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to store access token: %w", err)
+	}
+	if refreshToken == "" {
+		_ = store.Delete(u.Name, secrets.SecretTypeRefreshToken)
+	}
+
+	u.ExpiresAt = optionalTime(expiresAt)
+	u.RefreshTokenExpiresAt = optionalTime(refreshExpiresAt)
+	u.TokenSource = sourceForBackend(backend, u.SecretBackends)
+
+	return backend, nil
+}
+
+// DeleteTokens removes the access token, refresh token and client secret from secure storage
+func (u *AppUserToken) DeleteTokens(secretMgr *secrets.Manager) error {
+	store, err := u.secretStore(secretMgr)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, secretType := range []secrets.SecretType{
+		secrets.SecretTypeAccessToken, secrets.SecretTypeRefreshToken, secrets.SecretTypeClientSecret,
+	} {
+		if err := store.Delete(u.Name, secretType); err != nil && !errors.Is(err, secrets.ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ExpiresWithin reports whether the access token expires within d of now, or has expired.
+// Tokens without a recorded expiry never do.
+func (u *AppUserToken) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return u.ExpiresAt != nil && u.ExpiresAt.Sub(now) < d
+}
+
+func (u *AppUserToken) getSecret(secretMgr *secrets.Manager, secretType secrets.SecretType) (string, error) {
+	store, err := u.secretStore(secretMgr)
+	if err != nil {
+		return "", err
+	}
+	value, _, err := store.Get(u.Name, secretType)
+	return value, err
+}
+
+// secretStore returns the secrets manager holding the tokens
+func (u *AppUserToken) secretStore(secretMgr *secrets.Manager) (*secrets.Manager, error) {
+	return tokenSecretStore(secretMgr, u.SecretBackends, u.TokenSource)
+}
+
+// optionalTime returns nil for the zero time
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
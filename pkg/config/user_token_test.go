@@ -0,0 +1,220 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/secrets"
+	"github.com/zalando/go-keyring"
+	"gopkg.in/yaml.v3"
+)
+
+func validUserToken() AppUserToken {
+	return AppUserToken{
+		Name:     "octocat@Iv1.test",
+		ClientID: "Iv1.test",
+		Patterns: []string{"github.com/myorg/"},
+		Priority: 10,
+	}
+}
+
+func TestAppUserToken_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(u *AppUserToken)
+		wantErr string
+	}{
+		{name: "valid", modify: func(u *AppUserToken) {}},
+		{name: "missing name", modify: func(u *AppUserToken) { u.Name = " " }, wantErr: "name is required"},
+		{name: "missing client id", modify: func(u *AppUserToken) { u.ClientID = "" }, wantErr: "client_id is required"},
+		{
+			name:    "client id with space",
+			modify:  func(u *AppUserToken) { u.ClientID = "Iv1 test" },
+			wantErr: "client_id must not contain whitespace",
+		},
+		{
+			name:    "no patterns",
+			modify:  func(u *AppUserToken) { u.Patterns = nil },
+			wantErr: "at least one pattern is required",
+		},
+		{
+			name:    "empty pattern",
+			modify:  func(u *AppUserToken) { u.Patterns = []string{""} },
+			wantErr: "patterns[0] cannot be empty",
+		},
+		{
+			name:    "unknown source",
+			modify:  func(u *AppUserToken) { u.TokenSource = "vault" },
+			wantErr: "invalid token_source: vault",
+		},
+		{
+			name: "backend source with secret backends",
+			modify: func(u *AppUserToken) {
+				u.TokenSource = "memory"
+				u.SecretBackends = []secrets.BackendSpec{{Type: secrets.BackendTypeMemory}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userToken := validUserToken()
+			tt.modify(&userToken)
+
+			err := userToken.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateUserTokensOnly(t *testing.T) {
+	cfg := &Config{Version: "1.0", UserTokens: []AppUserToken{validUserToken()}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() with only user tokens failed: %v", err)
+	}
+
+	cfg.UserTokens[0].ClientID = ""
+	if err := cfg.Validate(); err == nil || err.Error() != "user_tokens[0]: client_id is required" {
+		t.Errorf("Validate() error = %v, want user_tokens[0] error", err)
+	}
+}
+
+func TestAppUserToken_Tokens(t *testing.T) {
+	// Given: Keyring is available
+	keyring.MockInit()
+	defer keyring.MockInitWithError(nil)
+	secretMgr := secrets.NewManager(t.TempDir())
+
+	userToken := validUserToken()
+	expiresAt := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	refreshExpiresAt := expiresAt.Add(180 * 24 * time.Hour)
+
+	// When: Tokens are stored
+	backend, err := userToken.SetTokens(secretMgr, "ghu_access", "ghr_refresh", expiresAt, refreshExpiresAt)
+	if err != nil {
+		t.Fatalf("SetTokens() failed: %v", err)
+	}
+
+	// Then: Both tokens are readable and their expiry is recorded
+	if backend != secrets.StorageBackendKeyring || userToken.TokenSource != PrivateKeySourceKeyring {
+		t.Errorf("Backend = %v, source = %v, want keyring", backend, userToken.TokenSource)
+	}
+	if token, err := userToken.GetAccessToken(secretMgr); err != nil || token != "ghu_access" {
+		t.Errorf("GetAccessToken() = %q, %v", token, err)
+	}
+	if token, err := userToken.GetRefreshToken(secretMgr); err != nil || token != "ghr_refresh" {
+		t.Errorf("GetRefreshToken() = %q, %v", token, err)
+	}
+	if userToken.ExpiresAt == nil || !userToken.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %v, want %v", userToken.ExpiresAt, expiresAt)
+	}
+	if userToken.RefreshTokenExpiresAt == nil || !userToken.RefreshTokenExpiresAt.Equal(refreshExpiresAt) {
+		t.Errorf("RefreshTokenExpiresAt = %v, want %v", userToken.RefreshTokenExpiresAt, refreshExpiresAt)
+	}
+
+	// Tokens without expiry drop the old refresh token and expiry
+	if _, err := userToken.SetTokens(secretMgr, "ghu_forever", "", time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("SetTokens() failed: %v", err)
+	}
+	if _, err := userToken.GetRefreshToken(secretMgr); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("GetRefreshToken() error = %v, want %v", err, secrets.ErrNotFound)
+	}
+	if userToken.ExpiresAt != nil || userToken.RefreshTokenExpiresAt != nil {
+		t.Errorf("Expiry = %v, %v, want none", userToken.ExpiresAt, userToken.RefreshTokenExpiresAt)
+	}
+
+	// DeleteTokens removes everything, including the client secret
+	if err := userToken.SetClientSecret(secretMgr, "s3cret"); err != nil {
+		t.Fatalf("SetClientSecret() failed: %v", err)
+	}
+	if err := userToken.DeleteTokens(secretMgr); err != nil {
+		t.Fatalf("DeleteTokens() failed: %v", err)
+	}
+	if _, err := userToken.GetAccessToken(secretMgr); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("GetAccessToken() after delete error = %v, want %v", err, secrets.ErrNotFound)
+	}
+	if _, err := userToken.GetClientSecret(secretMgr); !errors.Is(err, secrets.ErrNotFound) {
+		t.Errorf("GetClientSecret() after delete error = %v, want %v", err, secrets.ErrNotFound)
+	}
+}
+
+func TestAppUserToken_TokenSourceKey(t *testing.T) {
+	// Given: A user token stored in the keyring
+	userToken := validUserToken()
+	userToken.TokenSource = PrivateKeySourceKeyring
+
+	// When: It is serialized
+	data, err := yaml.Marshal(userToken)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() failed: %v", err)
+	}
+
+	// Then: The source has its own key, as tokens are not private keys
+	if !strings.Contains(string(data), "token_source: keyring") || strings.Contains(string(data), "private_key") {
+		t.Errorf("yaml.Marshal() = %s, want token_source key", data)
+	}
+}
+
+func TestAppUserToken_ExpiresWithin(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{name: "no expiry", want: false},
+		{name: "fresh", expiresAt: at(time.Hour), want: false},
+		{name: "within margin", expiresAt: at(2 * time.Minute), want: true},
+		{name: "expired", expiresAt: at(-time.Minute), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userToken := AppUserToken{ExpiresAt: tt.expiresAt}
+			if got := userToken.ExpiresWithin(now, UserTokenRefreshMargin); got != tt.want {
+				t.Errorf("ExpiresWithin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_UserTokens(t *testing.T) {
+	cfg := &Config{Version: "1.0"}
+
+	userToken := validUserToken()
+	cfg.AddOrUpdateUserToken(&userToken)
+	userToken.Priority = 20
+	cfg.AddOrUpdateUserToken(&userToken)
+
+	if len(cfg.UserTokens) != 1 {
+		t.Fatalf("UserTokens = %d, want 1 after update", len(cfg.UserTokens))
+	}
+	found := cfg.FindUserToken(userToken.Name)
+	if found == nil || found.Priority != 20 {
+		t.Errorf("FindUserToken() = %+v, want the updated entry", found)
+	}
+	if cfg.FindUserToken("other") != nil {
+		t.Error("FindUserToken() found an unknown name")
+	}
+
+	if !cfg.RemoveUserToken(userToken.Name) || len(cfg.UserTokens) != 0 {
+		t.Errorf("RemoveUserToken() left %d entries", len(cfg.UserTokens))
+	}
+	if cfg.RemoveUserToken(userToken.Name) {
+		t.Error("RemoveUserToken() of a removed entry returned true")
+	}
+}
@@ -106,6 +106,36 @@ func TestGitHubApp_Validate_EdgeCases(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "exec signer without private key",
+			app: GitHubApp{
+				Name:     "Test",
+				AppID:    123,
+				Patterns: []string{"github.com/org/*"},
+				Signer:   &SignerConfig{Type: SignerTypeExec, Command: "/usr/local/bin/hsm-sign"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "exec signer without command",
+			app: GitHubApp{
+				Name:     "Test",
+				AppID:    123,
+				Patterns: []string{"github.com/org/*"},
+				Signer:   &SignerConfig{Type: SignerTypeExec},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown signer type",
+			app: GitHubApp{
+				Name:     "Test",
+				AppID:    123,
+				Patterns: []string{"github.com/org/*"},
+				Signer:   &SignerConfig{Type: "pkcs11", Command: "x"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
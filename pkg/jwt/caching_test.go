@@ -1,11 +1,18 @@
 package jwt
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func generateTestKeyPEM(t *testing.T) string {
@@ -38,7 +45,7 @@ func TestKeyCache(t *testing.T) {
 		t.Fatalf("Second call failed: %v", err)
 	}
 
-	// Both tokens should be valid (though different due to timestamps)
+	// Both tokens should be valid (the second is the cached JWT)
 	if token1 == "" || token2 == "" {
 		t.Error("Expected non-empty tokens")
 	}
@@ -105,6 +112,38 @@ func TestMultipleApps(t *testing.T) {
 	}
 }
 
+func TestMultipleKeysSameApp(t *testing.T) {
+	gen := NewGenerator()
+	appID := int64(123456)
+
+	oldKey := generateTestKeyPEM(t)
+	newKey := generateTestKeyPEM(t)
+
+	if _, err := gen.GenerateTokenFromKey(appID, oldKey); err != nil {
+		t.Fatalf("Old key token generation failed: %v", err)
+	}
+	token, err := gen.GenerateTokenFromKey(appID, newKey)
+	if err != nil {
+		t.Fatalf("New key token generation failed: %v", err)
+	}
+
+	// The token must be signed with the new key, not the key cached first for the app
+	block, _ := pem.Decode([]byte(newKey))
+	parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse new key: %v", err)
+	}
+	parts := strings.Split(token, ".")
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&parsed.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+		t.Errorf("Token not signed with the new key: %v", err)
+	}
+}
+
 func TestTokenClaimsStructure(t *testing.T) {
 	gen := NewGenerator()
 	key := generateTestKeyPEM(t)
@@ -234,3 +273,224 @@ func TestNewGenerator(t *testing.T) {
 		t.Errorf("New generator should be functional: %v", err)
 	}
 }
+
+func TestJWTReuse(t *testing.T) {
+	gen := NewGenerator()
+	key := generateTestKeyPEM(t)
+
+	token1, err := gen.GenerateTokenFromKey(123456, key)
+	if err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+	token2, err := gen.GenerateTokenFromKey(123456, key)
+	if err != nil {
+		t.Fatalf("Second call failed: %v", err)
+	}
+	if token1 != token2 {
+		t.Error("Expected the cached JWT to be reused")
+	}
+
+	// Another app with the same key gets its own JWT
+	other, err := gen.GenerateTokenFromKey(654321, key)
+	if err != nil {
+		t.Fatalf("Other app call failed: %v", err)
+	}
+	if other == token1 {
+		t.Error("Expected a different JWT for another app ID")
+	}
+
+	// A JWT within the reuse margin of expiry is replaced
+	gen.mu.Lock()
+	for cacheKey, cached := range gen.jwtCache {
+		cached.expiresAt = time.Now().Add(JWTReuseMargin / 2)
+		cached.token = "stale"
+		gen.jwtCache[cacheKey] = cached
+	}
+	gen.mu.Unlock()
+	token3, err := gen.GenerateTokenFromKey(123456, key)
+	if err != nil {
+		t.Fatalf("Third call failed: %v", err)
+	}
+	if token3 == "stale" {
+		t.Error("Expected a JWT close to expiry to be re-signed")
+	}
+}
+
+func TestJWTReuse_ClockChangesInvalidate(t *testing.T) {
+	gen := NewGenerator()
+	key := generateTestKeyPEM(t)
+
+	if _, err := gen.GenerateTokenFromKey(1, key); err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+	gen.SetClockOffset(-time.Hour)
+	token, err := gen.GenerateTokenFromKey(1, key)
+	if err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+
+	claims, err := gen.GetTokenClaims(token)
+	if err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+	iat, _ := claims["iat"].(float64)
+	if int64(iat) > time.Now().Add(-50*time.Minute).Unix() {
+		t.Errorf("iat = %d, want a JWT timed on the new clock offset", int64(iat))
+	}
+}
+
+func TestKeyCacheByFingerprint(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	pkcs1PEM := string(pem.EncodeToMemory(&pem.Block{
+		Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}))
+	pkcs8PEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+
+	gen := NewGenerator()
+	token1, err := gen.GenerateTokenFromKey(42, pkcs1PEM)
+	if err != nil {
+		t.Fatalf("PKCS#1 call failed: %v", err)
+	}
+	token2, err := gen.GenerateTokenFromKey(42, pkcs8PEM)
+	if err != nil {
+		t.Fatalf("PKCS#8 call failed: %v", err)
+	}
+
+	if len(gen.keyCache) != 1 {
+		t.Errorf("keyCache has %d entries, want 1 for the same key in two encodings", len(gen.keyCache))
+	}
+	if token1 != token2 {
+		t.Error("Expected the JWT to be shared across encodings of the same key")
+	}
+	fingerprint, err := Fingerprint(pkcs8PEM)
+	if err != nil {
+		t.Fatalf("Fingerprint() error = %v", err)
+	}
+	if _, ok := gen.keyCache[fingerprint]; !ok {
+		t.Errorf("keyCache is not keyed by fingerprint %s", fingerprint)
+	}
+
+	// Invalidating one encoding drops the key and its JWTs
+	gen.InvalidateKey(pkcs1PEM)
+	if len(gen.keyCache) != 0 || len(gen.fingerprints) != 0 || len(gen.jwtCache) != 0 {
+		t.Errorf("caches not empty after InvalidateKey: %d keys, %d fingerprints, %d JWTs",
+			len(gen.keyCache), len(gen.fingerprints), len(gen.jwtCache))
+	}
+}
+
+func TestInvalidateApp(t *testing.T) {
+	gen := NewGenerator()
+	key := generateTestKeyPEM(t)
+
+	if _, err := gen.GenerateTokenFromKey(1, key); err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+	otherApp, err := gen.GenerateTokenFromKey(2, key)
+	if err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+
+	gen.InvalidateApp(1)
+	fingerprint := gen.fingerprints[sha256.Sum256([]byte(key))]
+	if _, ok := gen.jwtCache[jwtCacheKey{issuer: Issuer{AppID: 1}, fingerprint: fingerprint}]; ok {
+		t.Error("Expected app 1 JWT to be dropped")
+	}
+	if len(gen.keyCache) != 1 {
+		t.Error("Expected parsed key to be kept")
+	}
+	if again, _ := gen.GenerateTokenFromKey(2, key); again != otherApp {
+		t.Error("Expected app 2 JWT to be kept")
+	}
+
+	gen.ClearCache()
+	if len(gen.keyCache) != 0 || len(gen.jwtCache) != 0 {
+		t.Error("Expected caches to be empty after ClearCache")
+	}
+}
+
+// TestGeneratorConcurrency exercises the caches from many goroutines; run with -race
+func TestGeneratorConcurrency(t *testing.T) {
+	gen := NewGenerator()
+	keys := []string{generateTestKeyPEM(t), generateTestKeyPEM(t)}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := keys[i%len(keys)]
+			appID := int64(i % 3)
+			token, err := gen.GenerateTokenFromKey(appID, key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := gen.ValidateToken(token); err != nil {
+				errs <- fmt.Errorf("app %d: %w", appID, err)
+			}
+			switch i % 8 {
+			case 1:
+				gen.InvalidateKey(key)
+			case 3:
+				gen.InvalidateApp(appID)
+			case 5:
+				gen.SetClockOffset(time.Duration(i) * time.Second)
+			case 7:
+				gen.ClearCache()
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestGenerateTokenFromKeyForIssuer(t *testing.T) {
+	gen := NewGenerator()
+	key := generateTestKeyPEM(t)
+
+	byClientID, err := gen.GenerateTokenFromKeyForIssuer(Issuer{AppID: 42, ClientID: "Iv23liExample"}, key)
+	if err != nil {
+		t.Fatalf("GenerateTokenFromKeyForIssuer() error = %v", err)
+	}
+	claims, err := gen.GetTokenClaims(byClientID)
+	if err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+	if claims["iss"] != "Iv23liExample" {
+		t.Errorf("iss = %v, want the client ID", claims["iss"])
+	}
+
+	// Without a client ID the numeric app ID is the issuer, in a separately cached JWT
+	byAppID, err := gen.GenerateTokenFromKey(42, key)
+	if err != nil {
+		t.Fatalf("GenerateTokenFromKey() error = %v", err)
+	}
+	if byAppID == byClientID {
+		t.Error("Expected a separate JWT for the app ID issuer")
+	}
+	claims, err = gen.GetTokenClaims(byAppID)
+	if err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+	if iss, ok := claims["iss"].(float64); !ok || int64(iss) != 42 {
+		t.Errorf("iss = %v, want 42", claims["iss"])
+	}
+
+	// Invalidating the app drops JWTs for both issuers
+	gen.InvalidateApp(42)
+	if len(gen.jwtCache) != 0 {
+		t.Errorf("jwtCache has %d entries after InvalidateApp", len(gen.jwtCache))
+	}
+}
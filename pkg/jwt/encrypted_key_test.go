@@ -0,0 +1,80 @@
+package jwt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Fixtures in testdata were made with openssl from one key, encrypted with "correct-horse"
+const (
+	testPassphrase  = "correct-horse"
+	testFingerprint = "SHA256:P7m0ybRV6bgbVsseklFgad6UxTdzifhI+z3VD4EoAYg="
+)
+
+func readTestdata(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	return string(data)
+}
+
+func TestDecryptPrivateKey(t *testing.T) {
+	for _, name := range []string{
+		"encrypted-pkcs8-aes256.pem",
+		"encrypted-pkcs8-des3.pem",
+		"encrypted-legacy-aes256.pem",
+	} {
+		t.Run(name, func(t *testing.T) {
+			encrypted := readTestdata(t, name)
+			if !IsEncryptedKey(encrypted) {
+				t.Fatal("IsEncryptedKey() = false")
+			}
+
+			if _, err := NewGenerator().GenerateTokenFromKey(42, encrypted); !errors.Is(err, ErrPassphraseRequired) {
+				t.Errorf("GenerateTokenFromKey() error = %v, want ErrPassphraseRequired", err)
+			}
+
+			decrypted, err := DecryptPrivateKey(encrypted, []byte(testPassphrase))
+			if err != nil {
+				t.Fatalf("DecryptPrivateKey() error = %v", err)
+			}
+			if IsEncryptedKey(decrypted) {
+				t.Error("decrypted key is still encrypted")
+			}
+			fingerprint, err := Fingerprint(decrypted)
+			if err != nil {
+				t.Fatalf("Fingerprint() error = %v", err)
+			}
+			if fingerprint != testFingerprint {
+				t.Errorf("Fingerprint() = %s, want %s", fingerprint, testFingerprint)
+			}
+
+			if _, err := DecryptPrivateKey(encrypted, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+				t.Errorf("DecryptPrivateKey(wrong) error = %v, want ErrIncorrectPassphrase", err)
+			}
+		})
+	}
+}
+
+func TestDecryptPrivateKey_Unsupported(t *testing.T) {
+	_, err := DecryptPrivateKey(readTestdata(t, "encrypted-pkcs8-scrypt.pem"), []byte(testPassphrase))
+	if err == nil || !strings.Contains(err.Error(), "scrypt") {
+		t.Errorf("DecryptPrivateKey() error = %v, want scrypt not supported", err)
+	}
+}
+
+func TestDecryptPrivateKey_Unencrypted(t *testing.T) {
+	key := generateTestKeyPEM(t)
+	if IsEncryptedKey(key) {
+		t.Error("IsEncryptedKey() = true for an unencrypted key")
+	}
+	got, err := DecryptPrivateKey(key, nil)
+	if err != nil || got != key {
+		t.Errorf("DecryptPrivateKey() = (%q, %v), want the key unchanged", got, err)
+	}
+}
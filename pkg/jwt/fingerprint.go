@@ -0,0 +1,31 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of the public half of a PEM-encoded private key,
+// in the "SHA256:<base64>" form GitHub shows next to an app's private keys
+func Fingerprint(privateKeyContent string) (string, error) {
+	privateKey, err := NewGenerator().parsePrivateKey([]byte(privateKeyContent))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return publicKeyFingerprint(&privateKey.PublicKey)
+}
+
+// publicKeyFingerprint hashes the PKIX (SubjectPublicKeyInfo) DER encoding of a public key
+func publicKeyFingerprint(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,52 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	key, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal PKCS8 key: %v", err)
+	}
+	pkcs8 := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes}))
+
+	fp1, err := Fingerprint(pkcs1)
+	if err != nil {
+		t.Fatalf("Fingerprint(PKCS1) error = %v", err)
+	}
+	if !strings.HasPrefix(fp1, "SHA256:") || len(fp1) != len("SHA256:")+44 {
+		t.Errorf("Fingerprint() = %q, want SHA256:<base64 digest>", fp1)
+	}
+
+	// The fingerprint identifies the key pair, not its encoding
+	fp2, err := Fingerprint(pkcs8)
+	if err != nil {
+		t.Fatalf("Fingerprint(PKCS8) error = %v", err)
+	}
+	if fp1 != fp2 {
+		t.Errorf("PKCS1 fingerprint %q != PKCS8 fingerprint %q", fp1, fp2)
+	}
+
+	other := generateTestKeyPEM(t)
+	fp3, err := Fingerprint(other)
+	if err != nil {
+		t.Fatalf("Fingerprint(other) error = %v", err)
+	}
+	if fp3 == fp1 {
+		t.Error("Expected different fingerprints for different keys")
+	}
+
+	if _, err := Fingerprint("not a key"); err == nil {
+		t.Error("Expected error for invalid key")
+	}
+}
@@ -1,8 +1,6 @@
 package jwt
 
 import (
-	"crypto"
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
@@ -17,20 +15,91 @@ import (
 	"time"
 )
 
+const (
+	// DefaultIssuedAtBackdate is how far iat is set in the past to tolerate small clock drift
+	DefaultIssuedAtBackdate = 30 * time.Second
+	// jwtLifetime is the maximum JWT lifetime GitHub accepts
+	jwtLifetime = 10 * time.Minute
+	// JWTReuseMargin is how long before expiry a cached JWT is replaced by a new one
+	JWTReuseMargin = time.Minute
+)
+
+// Issuer identifies a GitHub App in the JWT iss claim. GitHub recommends the app's
+// client ID; the numeric app ID is used when no client ID is known.
+type Issuer struct {
+	AppID    int64
+	ClientID string
+}
+
+// claim returns the iss claim value: the client ID string or the numeric app ID
+func (i Issuer) claim() interface{} {
+	if i.ClientID != "" {
+		return i.ClientID
+	}
+	return i.AppID
+}
+
+// jwtCacheKey identifies a JWT by issuer and signing key
+type jwtCacheKey struct {
+	issuer      Issuer
+	fingerprint string
+}
+
+// cachedJWT is a signed JWT and its expiry on the local clock
+type cachedJWT struct {
+	token     string
+	expiresAt time.Time
+}
+
 type Generator struct {
-	// keyCache stores loaded keys in memory for the session
+	// keyCache stores parsed keys in memory for the session, by public key fingerprint
 	keyCache map[string]*rsa.PrivateKey
-	// mu protects keyCache from concurrent access
+	// fingerprints maps the SHA-256 of key content to its fingerprint, to skip re-parsing
+	fingerprints map[[sha256.Size]byte]string
+	// jwtCache stores signed JWTs for reuse until shortly before they expire
+	jwtCache map[jwtCacheKey]cachedJWT
+	// issuedAtBackdate is subtracted from the current time for the iat claim
+	issuedAtBackdate time.Duration
+	// clockOffset is GitHub's clock minus the local clock, added to the current time
+	clockOffset time.Duration
+	// mu protects the caches and the clock settings from concurrent access
 	mu sync.RWMutex
 }
 
 // NewGenerator creates a new JWT token generator
 func NewGenerator() *Generator {
 	return &Generator{
-		keyCache: make(map[string]*rsa.PrivateKey),
+		keyCache:         make(map[string]*rsa.PrivateKey),
+		fingerprints:     make(map[[sha256.Size]byte]string),
+		jwtCache:         make(map[jwtCacheKey]cachedJWT),
+		issuedAtBackdate: DefaultIssuedAtBackdate,
 	}
 }
 
+// SetIssuedAtBackdate sets how far the iat claim is backdated and drops cached JWTs
+func (g *Generator) SetIssuedAtBackdate(backdate time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.issuedAtBackdate = backdate
+	clear(g.jwtCache)
+}
+
+// SetClockOffset sets the offset between GitHub's clock and the local clock and drops
+// cached JWTs, which were timed on the previous offset
+func (g *Generator) SetClockOffset(offset time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clockOffset = offset
+	clear(g.jwtCache)
+}
+
+// ClockOffset returns the offset between GitHub's clock and the local clock
+func (g *Generator) ClockOffset() time.Duration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.clockOffset
+}
+
 // GenerateToken generates a GitHub App JWT token from a private key file path
 func (g *Generator) GenerateToken(appID int64, privateKeyPath string) (string, error) {
 	// Load private key
@@ -40,42 +109,133 @@ func (g *Generator) GenerateToken(appID int64, privateKeyPath string) (string, e
 	}
 
 	// Create JWT token
-	token, err := g.createJWT(appID, privateKey)
+	token, _, err := g.createJWT(Issuer{AppID: appID}, NewRSASigner(privateKey))
 	if err != nil {
 		return "", fmt.Errorf("failed to create JWT: %w", err)
 	}
 	return token, nil
 }
 
-// GenerateTokenFromKey generates a GitHub App JWT token from private key content
+// GenerateTokenWithSigner generates a GitHub App JWT token signed by an external signer
+func (g *Generator) GenerateTokenWithSigner(appID int64, signer Signer) (string, error) {
+	return g.GenerateTokenWithSignerForIssuer(Issuer{AppID: appID}, signer)
+}
+
+// GenerateTokenWithSignerForIssuer generates a JWT for an issuer signed by an external signer
+func (g *Generator) GenerateTokenWithSignerForIssuer(issuer Issuer, signer Signer) (string, error) {
+	token, _, err := g.createJWT(issuer, signer)
+	if err != nil {
+		return "", fmt.Errorf("failed to create JWT: %w", err)
+	}
+	return token, nil
+}
+
+// GenerateTokenFromKey generates a GitHub App JWT token from private key content.
+// Parsed keys are cached by fingerprint, and the JWT is reused until JWTReuseMargin
+// before it expires, so each app and key pair is signed about once per 10 minutes.
 func (g *Generator) GenerateTokenFromKey(appID int64, privateKeyContent string) (string, error) {
-	// Check cache first (read lock)
-	cacheKey := fmt.Sprintf("%d", appID)
+	return g.GenerateTokenFromKeyForIssuer(Issuer{AppID: appID}, privateKeyContent)
+}
+
+// GenerateTokenFromKeyForIssuer generates a JWT for an issuer from private key content,
+// with the same caching as GenerateTokenFromKey
+func (g *Generator) GenerateTokenFromKeyForIssuer(issuer Issuer, privateKeyContent string) (string, error) {
+	fingerprint, privateKey, err := g.cachedKey(privateKeyContent)
+	if err != nil {
+		return "", err
+	}
+
+	cacheKey := jwtCacheKey{issuer: issuer, fingerprint: fingerprint}
 	g.mu.RLock()
-	cachedKey, exists := g.keyCache[cacheKey]
+	cached, exists := g.jwtCache[cacheKey]
 	g.mu.RUnlock()
-
-	if exists {
-		return g.createJWT(appID, cachedKey)
+	if exists && time.Now().Before(cached.expiresAt.Add(-JWTReuseMargin)) {
+		return cached.token, nil
 	}
 
-	// Parse private key from content
-	privateKey, err := g.parsePrivateKey([]byte(privateKeyContent))
+	// Concurrent callers may both sign here; either JWT is valid and the last one is kept
+	token, expiresAt, err := g.createJWT(issuer, NewRSASigner(privateKey))
 	if err != nil {
-		return "", fmt.Errorf("failed to parse private key: %w", err)
+		return "", fmt.Errorf("failed to create JWT: %w", err)
 	}
 
-	// Cache the parsed key (write lock)
 	g.mu.Lock()
-	g.keyCache[cacheKey] = privateKey
+	g.jwtCache[cacheKey] = cachedJWT{token: token, expiresAt: expiresAt}
 	g.mu.Unlock()
+	return token, nil
+}
 
-	// Create JWT token
-	token, err := g.createJWT(appID, privateKey)
+// InvalidateKey drops a private key and the JWTs signed with it from the caches,
+// e.g. after GitHub rejected it. The next call parses the key and signs again.
+func (g *Generator) InvalidateKey(privateKeyContent string) {
+	digest := sha256.Sum256([]byte(privateKeyContent))
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fingerprint, exists := g.fingerprints[digest]
+	if !exists {
+		return
+	}
+	delete(g.fingerprints, digest)
+	for content, fp := range g.fingerprints {
+		if fp == fingerprint {
+			delete(g.fingerprints, content)
+		}
+	}
+	delete(g.keyCache, fingerprint)
+	for key := range g.jwtCache {
+		if key.fingerprint == fingerprint {
+			delete(g.jwtCache, key)
+		}
+	}
+}
+
+// InvalidateApp drops the cached JWTs of an app; parsed keys are kept
+func (g *Generator) InvalidateApp(appID int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key := range g.jwtCache {
+		if key.issuer.AppID == appID {
+			delete(g.jwtCache, key)
+		}
+	}
+}
+
+// ClearCache drops all cached keys and JWTs
+func (g *Generator) ClearCache() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	clear(g.keyCache)
+	clear(g.fingerprints)
+	clear(g.jwtCache)
+}
+
+// cachedKey returns the fingerprint and parsed key for PEM content, parsing it on first use.
+// The same key in PKCS#1 and PKCS#8 form shares one cache entry.
+func (g *Generator) cachedKey(privateKeyContent string) (string, *rsa.PrivateKey, error) {
+	digest := sha256.Sum256([]byte(privateKeyContent))
+	g.mu.RLock()
+	fingerprint, exists := g.fingerprints[digest]
+	privateKey := g.keyCache[fingerprint]
+	g.mu.RUnlock()
+	if exists && privateKey != nil {
+		return fingerprint, privateKey, nil
+	}
+
+	privateKey, err := g.parsePrivateKey([]byte(privateKeyContent))
 	if err != nil {
-		return "", fmt.Errorf("failed to create JWT: %w", err)
+		return "", nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
-	return token, nil
+	fingerprint, err = publicKeyFingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	g.mu.Lock()
+	g.fingerprints[digest] = fingerprint
+	g.keyCache[fingerprint] = privateKey
+	g.mu.Unlock()
+	return fingerprint, privateKey, nil
 }
 
 // loadPrivateKey loads and parses an RSA private key from a PEM file
@@ -117,6 +277,10 @@ func (g *Generator) parsePrivateKey(keyData []byte) (*rsa.PrivateKey, error) {
 	if block == nil {
 		return nil, fmt.Errorf("failed to parse PEM block")
 	}
+	// Encrypted keys must be decrypted with DecryptPrivateKey first
+	if IsEncryptedKey(string(keyData)) {
+		return nil, ErrPassphraseRequired
+	}
 
 	// Parse private key based on type
 	var privateKey *rsa.PrivateKey
@@ -144,31 +308,36 @@ func (g *Generator) parsePrivateKey(keyData []byte) (*rsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// createJWT creates a GitHub App JWT token
-func (g *Generator) createJWT(appID int64, privateKey *rsa.PrivateKey) (string, error) {
+// createJWT creates a GitHub App JWT token and returns it with its expiry on the local clock
+func (g *Generator) createJWT(issuer Issuer, signer Signer) (string, time.Time, error) {
 	// JWT Header
 	header := map[string]interface{}{
 		"alg": "RS256",
 		"typ": "JWT",
 	}
 
-	// JWT Payload
-	now := time.Now()
+	// JWT Payload, timed on GitHub's clock. exp is relative to the backdated iat
+	// so it never exceeds GitHub's 10 minute maximum.
+	g.mu.RLock()
+	offset := g.clockOffset
+	issuedAt := time.Now().Add(offset - g.issuedAtBackdate)
+	g.mu.RUnlock()
+	expiresAt := issuedAt.Add(jwtLifetime) // GitHub Apps tokens expire in 10 minutes max
 	payload := map[string]interface{}{
-		"iss": appID,
-		"iat": now.Unix(),
-		"exp": now.Add(10 * time.Minute).Unix(), // GitHub Apps tokens expire in 10 minutes max
+		"iss": issuer.claim(),
+		"iat": issuedAt.Unix(),
+		"exp": expiresAt.Unix(),
 	}
 
 	// Encode header and payload
 	headerJSON, err := json.Marshal(header)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal header: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to marshal header: %w", err)
 	}
 
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// Base64 URL encode
@@ -179,32 +348,15 @@ func (g *Generator) createJWT(appID int64, privateKey *rsa.PrivateKey) (string,
 	signingInput := headerB64 + "." + payloadB64
 
 	// Sign the token
-	signature, err := g.signRS256(signingInput, privateKey)
+	signature, err := signer.Sign([]byte(signingInput))
 	if err != nil {
-		return "", fmt.Errorf("failed to sign JWT: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to sign JWT: %w", err)
 	}
 
 	// Create final JWT
-	token := signingInput + "." + signature
-
-	return token, nil
-}
-
-// signRS256 signs data using RS256 algorithm
-func (g *Generator) signRS256(data string, privateKey *rsa.PrivateKey) (string, error) {
-	// Create hash
-	hasher := sha256.New()
-	hasher.Write([]byte(data))
-	hash := hasher.Sum(nil)
-
-	// Sign hash
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash)
-	if err != nil {
-		return "", fmt.Errorf("failed to sign: %w", err)
-	}
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
 
-	// Base64 URL encode the signature
-	return base64.RawURLEncoding.EncodeToString(signature), nil
+	return token, expiresAt.Add(-offset), nil
 }
 
 // ValidateToken validates a JWT token structure (for testing)
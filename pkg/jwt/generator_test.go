@@ -489,3 +489,36 @@ func TestTokenExpiration(t *testing.T) {
 		t.Errorf("Token expiration = %v, want %v (10 minutes after iat)", exp, expectedExp)
 	}
 }
+
+func TestCreateJWT_ClockAdjustments(t *testing.T) {
+	key, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	gen := NewGenerator()
+	gen.SetIssuedAtBackdate(2 * time.Minute)
+	gen.SetClockOffset(-time.Hour)
+	if gen.ClockOffset() != -time.Hour {
+		t.Errorf("ClockOffset() = %v, want -1h", gen.ClockOffset())
+	}
+
+	token, err := gen.GenerateTokenWithSigner(42, NewRSASigner(key))
+	if err != nil {
+		t.Fatalf("GenerateTokenWithSigner() error = %v", err)
+	}
+	claims, err := gen.GetTokenClaims(token)
+	if err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	want := time.Now().Add(-time.Hour - 2*time.Minute).Unix()
+	if diff := int64(iat) - want; diff < -2 || diff > 2 {
+		t.Errorf("iat = %d, want about %d", int64(iat), want)
+	}
+	if int64(exp-iat) != 600 {
+		t.Errorf("exp - iat = %d, want 600", int64(exp-iat))
+	}
+}
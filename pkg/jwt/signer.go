@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecSignerTimeout bounds how long an external signing command may run
+const DefaultExecSignerTimeout = 30 * time.Second
+
+// Signer produces the RS256 (RSASSA-PKCS1-v1_5 with SHA-256) signature of a JWT signing input.
+// Implementations let the private key live outside the process, e.g. in an HSM or KMS.
+type Signer interface {
+	Sign(signingInput []byte) ([]byte, error)
+}
+
+// RSASigner signs with an in-memory RSA private key
+type RSASigner struct {
+	key *rsa.PrivateKey
+}
+
+// NewRSASigner creates a signer for an RSA private key
+func NewRSASigner(key *rsa.PrivateKey) *RSASigner {
+	return &RSASigner{key: key}
+}
+
+// Sign signs the input using RS256
+func (s *RSASigner) Sign(signingInput []byte) ([]byte, error) {
+	hash := sha256.Sum256(signingInput)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	return signature, nil
+}
+
+// ExecSigner delegates signing to an external command.
+//
+// The command receives the JWT signing input on stdin and must print the RS256
+// signature to stdout, base64-encoded (standard or URL-safe alphabet, padding optional).
+// GH_APP_AUTH_APP_ID is set in its environment so one command can serve several apps.
+// This is enough to front PKCS#11 tokens (pkcs11-tool), cloud KMS CLIs or a custom HSM client.
+type ExecSigner struct {
+	Command string
+	Args    []string
+	AppID   int64
+	Timeout time.Duration
+}
+
+// NewExecSigner creates a signer that runs command with args for each JWT
+func NewExecSigner(command string, args []string, appID int64) *ExecSigner {
+	return &ExecSigner{
+		Command: command,
+		Args:    args,
+		AppID:   appID,
+		Timeout: DefaultExecSignerTimeout,
+	}
+}
+
+// Sign runs the signing command and decodes the signature it prints
+func (s *ExecSigner) Sign(signingInput []byte) ([]byte, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExecSignerTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Stdin = bytes.NewReader(signingInput)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), fmt.Sprintf("GH_APP_AUTH_APP_ID=%d", s.AppID))
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("signing command %q failed: %w: %s", s.Command, err, msg)
+		}
+		return nil, fmt.Errorf("signing command %q failed: %w", s.Command, err)
+	}
+
+	signature, err := decodeSignature(stdout.String())
+	if err != nil {
+		return nil, fmt.Errorf("signing command %q returned an invalid signature: %w", s.Command, err)
+	}
+	return signature, nil
+}
+
+// decodeSignature accepts standard or URL-safe base64, with or without padding
+func decodeSignature(output string) ([]byte, error) {
+	encoded := strings.Join(strings.Fields(output), "")
+	if encoded == "" {
+		return nil, fmt.Errorf("empty output")
+	}
+	encoded = strings.TrimRight(encoded, "=")
+	encoded = strings.NewReplacer("+", "-", "/", "_").Replace(encoded)
+	return base64.RawURLEncoding.DecodeString(encoded)
+}
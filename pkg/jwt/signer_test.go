@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestExecSignerHelperProcess is not a real test: it is the signing command run by the
+// ExecSigner tests, re-executing the test binary
+func TestExecSignerHelperProcess(t *testing.T) {
+	mode := os.Getenv("GH_APP_AUTH_TEST_SIGNER")
+	if mode == "" {
+		return
+	}
+
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	switch mode {
+	case "fail":
+		fmt.Fprintln(os.Stderr, "token not present")
+		os.Exit(1)
+	case "garbage":
+		fmt.Println("!!! not base64 !!!")
+		os.Exit(0)
+	}
+
+	if os.Getenv("GH_APP_AUTH_APP_ID") != "42" {
+		fmt.Fprintln(os.Stderr, "unexpected app ID")
+		os.Exit(1)
+	}
+	keyData, err := os.ReadFile(os.Getenv("GH_APP_AUTH_TEST_SIGNER_KEY"))
+	if err != nil {
+		os.Exit(2)
+	}
+	key, err := NewGenerator().parsePrivateKey(keyData)
+	if err != nil {
+		os.Exit(2)
+	}
+	signature, err := NewRSASigner(key).Sign(input)
+	if err != nil {
+		os.Exit(2)
+	}
+	// Wrapped standard base64, as printed by openssl or cloud CLIs
+	fmt.Println(base64.StdEncoding.EncodeToString(signature))
+	os.Exit(0)
+}
+
+func newHelperSigner(t *testing.T, mode, keyPath string) *ExecSigner {
+	t.Helper()
+	t.Setenv("GH_APP_AUTH_TEST_SIGNER", mode)
+	t.Setenv("GH_APP_AUTH_TEST_SIGNER_KEY", keyPath)
+	return NewExecSigner(os.Args[0], []string{"-test.run=^TestExecSignerHelperProcess$"}, 42)
+}
+
+// verifyJWTSignature checks an RS256 JWT against a public key
+func verifyJWTSignature(t *testing.T, token string, publicKey *rsa.PublicKey) {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("invalid JWT: %q", token)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature); err != nil {
+		t.Errorf("JWT signature does not verify: %v", err)
+	}
+}
+
+func TestGenerateTokenWithSigner_RSASigner(t *testing.T) {
+	key, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	gen := NewGenerator()
+	token, err := gen.GenerateTokenWithSigner(42, NewRSASigner(key))
+	if err != nil {
+		t.Fatalf("GenerateTokenWithSigner() error = %v", err)
+	}
+	if err := gen.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+	verifyJWTSignature(t, token, &key.PublicKey)
+}
+
+func TestExecSigner(t *testing.T) {
+	key, err := generateTestKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyPath := writeTestKeyFile(t, key, "pkcs1")
+
+	gen := NewGenerator()
+	token, err := gen.GenerateTokenWithSigner(42, newHelperSigner(t, "sign", keyPath))
+	if err != nil {
+		t.Fatalf("GenerateTokenWithSigner() error = %v", err)
+	}
+	verifyJWTSignature(t, token, &key.PublicKey)
+
+	claims, err := gen.GetTokenClaims(token)
+	if err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+	if iss, ok := claims["iss"].(float64); !ok || int64(iss) != 42 {
+		t.Errorf("iss = %v, want 42", claims["iss"])
+	}
+}
+
+func TestExecSigner_Errors(t *testing.T) {
+	_, err := newHelperSigner(t, "fail", "").Sign([]byte("input"))
+	if err == nil || !strings.Contains(err.Error(), "token not present") {
+		t.Errorf("Sign() error = %v, want command stderr", err)
+	}
+
+	_, err = newHelperSigner(t, "garbage", "").Sign([]byte("input"))
+	if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("Sign() error = %v, want invalid signature", err)
+	}
+
+	_, err = NewExecSigner("/nonexistent/signer", nil, 42).Sign([]byte("input"))
+	if err == nil {
+		t.Error("Expected error for missing command")
+	}
+}
+
+func TestDecodeSignature(t *testing.T) {
+	raw := []byte{0xfb, 0xff, 0xfe, 0x01, 0x02}
+	for _, output := range []string{
+		base64.StdEncoding.EncodeToString(raw) + "\n",
+		base64.RawStdEncoding.EncodeToString(raw),
+		base64.URLEncoding.EncodeToString(raw),
+		base64.RawURLEncoding.EncodeToString(raw),
+	} {
+		got, err := decodeSignature(output)
+		if err != nil {
+			t.Errorf("decodeSignature(%q) error = %v", output, err)
+			continue
+		}
+		if !bytes.Equal(got, raw) {
+			t.Errorf("decodeSignature(%q) = %x, want %x", output, got, raw)
+		}
+	}
+
+	if _, err := decodeSignature(" \n"); err == nil {
+		t.Error("Expected error for empty output")
+	}
+}
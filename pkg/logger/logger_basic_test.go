@@ -2,7 +2,7 @@ package logger
 
 import (
 	"errors"
-	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -94,22 +94,15 @@ func TestInitializeAndClose(t *testing.T) {
 }
 
 func TestInitialize_WithEnvVar(t *testing.T) {
-	// Save original env
-	originalEnv := os.Getenv("GH_APP_AUTH_DEBUG_LOG")
 	defer func() {
-		if originalEnv != "" {
-			os.Setenv("GH_APP_AUTH_DEBUG_LOG", originalEnv)
-		} else {
-			os.Unsetenv("GH_APP_AUTH_DEBUG_LOG")
-		}
 		// Clean up global logger
 		if globalLogger != nil && globalLogger.enabled && globalLogger.file != nil {
 			globalLogger.file.Close()
 		}
 	}()
 
-	// Test with debug log enabled
-	os.Setenv("GH_APP_AUTH_DEBUG_LOG", "1")
+	// Test with debug log enabled, written to a temporary file
+	t.Setenv("GH_APP_AUTH_DEBUG_LOG", filepath.Join(t.TempDir(), "debug.log"))
 	Initialize()
 
 	if globalLogger == nil {
@@ -127,16 +120,8 @@ func TestInitialize_WithEnvVar(t *testing.T) {
 
 func TestFlowFunctions_WithInitializedLogger(t *testing.T) {
 	// Initialize with env var
-	originalEnv := os.Getenv("GH_APP_AUTH_DEBUG_LOG")
-	os.Setenv("GH_APP_AUTH_DEBUG_LOG", "1")
-	defer func() {
-		if originalEnv != "" {
-			os.Setenv("GH_APP_AUTH_DEBUG_LOG", originalEnv)
-		} else {
-			os.Unsetenv("GH_APP_AUTH_DEBUG_LOG")
-		}
-		Close()
-	}()
+	t.Setenv("GH_APP_AUTH_DEBUG_LOG", filepath.Join(t.TempDir(), "debug.log"))
+	defer Close()
 
 	Initialize()
 
@@ -37,8 +37,16 @@ type RepositoryInfo struct {
 // Uses longest prefix matching - the app with the longest matching path prefix wins
 // If scope information is available, validates that the repo is within the app's installation scope
 func (m *Matcher) Match(repositoryURL string) (*config.GitHubApp, error) {
+	app, _, err := m.MatchWithScopeMisses(repositoryURL)
+	return app, err
+}
+
+// MatchWithScopeMisses works like Match and also returns the apps skipped because the
+// repository is not in their cached scope although a pattern matches it, and that would
+// have been a better match. Their cached scope may predate the repository being added.
+func (m *Matcher) MatchWithScopeMisses(repositoryURL string) (*config.GitHubApp, []*config.GitHubApp, error) {
 	if len(m.apps) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Parse repository information to get the path
@@ -48,9 +56,9 @@ func (m *Matcher) Match(repositoryURL string) (*config.GitHubApp, error) {
 		// This is intentional - we silently fall back to host matching for partial inputs
 		app := m.matchByHost(repositoryURL)
 		if app == nil {
-			return nil, fmt.Errorf("failed to parse repository URL: %w", err)
+			return nil, nil, fmt.Errorf("failed to parse repository URL: %w", err)
 		}
-		return app, nil
+		return app, nil, nil
 	}
 
 	repoPath := repoInfo.FullPath // e.g., "github.com/org/repo"
@@ -58,6 +66,7 @@ func (m *Matcher) Match(repositoryURL string) (*config.GitHubApp, error) {
 	// Find the app with the longest matching prefix
 	var bestMatch *config.GitHubApp
 	longestPrefixLen := 0
+	missPrefixLens := make(map[*config.GitHubApp]int)
 
 	for i := range m.apps {
 		app := &m.apps[i]
@@ -75,6 +84,7 @@ func (m *Matcher) Match(repositoryURL string) (*config.GitHubApp, error) {
 			if strings.HasPrefix(repoPath, prefix) {
 				// If scope info is available, validate repo is in scope
 				if app.Scope != nil && !isInScope(repoPath, app.Scope) {
+					missPrefixLens[app] = max(missPrefixLens[app], len(prefix))
 					continue // Skip - repo not in installation scope
 				}
 
@@ -87,7 +97,15 @@ func (m *Matcher) Match(repositoryURL string) (*config.GitHubApp, error) {
 		}
 	}
 
-	return bestMatch, nil
+	// Only misses that would have beaten the best match matter
+	var misses []*config.GitHubApp
+	for i := range m.apps {
+		if prefixLen, ok := missPrefixLens[&m.apps[i]]; ok && prefixLen > longestPrefixLen {
+			misses = append(misses, &m.apps[i])
+		}
+	}
+
+	return bestMatch, misses, nil
 }
 
 // matchByHost matches apps when only a host is provided (e.g., "github.com")
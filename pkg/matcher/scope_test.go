@@ -338,3 +338,53 @@ func TestMatcher_ScopeValidation_SkipsOutOfScope(t *testing.T) {
 		t.Errorf("Expected no match for org3, got app %q", app.Name)
 	}
 }
+
+func TestMatcher_MatchWithScopeMisses(t *testing.T) {
+	apps := []config.GitHubApp{
+		{
+			Name:     "fallback-app",
+			AppID:    1,
+			Patterns: []string{"github.com/"},
+		},
+		{
+			Name:     "selected-app",
+			AppID:    2,
+			Patterns: []string{"github.com/myorg/"},
+			Scope: &config.InstallationScope{
+				RepositorySelection: "selected",
+				AccountLogin:        "myorg",
+				Repositories:        []config.RepositoryInfo{{FullName: "myorg/repo1"}},
+			},
+		},
+		{
+			Name:     "other-org-app",
+			AppID:    3,
+			Patterns: []string{"github.com/"},
+			Scope: &config.InstallationScope{
+				RepositorySelection: "all",
+				AccountLogin:        "otherorg",
+			},
+		},
+	}
+	matcher := NewMatcher(apps)
+
+	// Given a repository added to the installation after its scope was cached
+	app, misses, err := matcher.MatchWithScopeMisses("https://github.com/myorg/new-repo")
+	if err != nil {
+		t.Fatalf("MatchWithScopeMisses() error = %v", err)
+	}
+
+	// Then the fallback matches and the app with the longer pattern is reported as a miss
+	if app == nil || app.Name != "fallback-app" {
+		t.Errorf("Expected 'fallback-app', got %v", app)
+	}
+	if len(misses) != 1 || misses[0] != &apps[1] {
+		t.Errorf("Expected 'selected-app' as the only miss, got %v", misses)
+	}
+
+	// When the repository is in scope there is no miss
+	app, misses, err = matcher.MatchWithScopeMisses("https://github.com/myorg/repo1")
+	if err != nil || app == nil || app.Name != "selected-app" || len(misses) != 0 {
+		t.Errorf("MatchWithScopeMisses() = %v, %v, %v; want selected-app without misses", app, misses, err)
+	}
+}
@@ -1,158 +1,289 @@
 package scope
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/auth"
 	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
-	"github.com/cli/go-gh/v2/pkg/api"
 )
 
+const (
+	// cacheTTL is how long a fetched scope is used before it is refreshed
+	cacheTTL = 24 * time.Hour
+	// DefaultWorkers is how many apps RefreshAll refreshes in parallel by default
+	DefaultWorkers = 4
+	// repositoriesPerPage is the largest page GitHub serves
+	repositoriesPerPage = 100
+	// MissRefreshInterval is the least time between two refreshes of an app's scope
+	// triggered by out of scope repositories
+	MissRefreshInterval = 5 * time.Minute
+)
+
+// Credentials authenticates scope requests with JWTs and installation tokens. It is
+// satisfied by *auth.Authenticator, whose installation tokens are cached.
+type Credentials interface {
+	AppJWTTransport(app *config.GitHubApp, base http.RoundTripper) http.RoundTripper
+	GetCredentials(app *config.GitHubApp, repoURL string) (token, username string, err error)
+}
+
 // Manager handles installation scope detection and caching
 type Manager struct {
-	clientFactory func(api.ClientOptions) (*api.RESTClient, error)
+	credentials Credentials
+	httpClient  *http.Client
+	// baseURL overrides the API base URL of the app's host (can be overridden for testing)
+	baseURL string
+}
+
+// RefreshResult is the outcome of refreshing one app's scope
+type RefreshResult struct {
+	App *config.GitHubApp
+	// Changed reports whether GitHub returned a different scope than the cached one
+	Changed bool
+	Err     error
 }
 
 // NewManager creates a new scope manager
-func NewManager() *Manager {
+func NewManager(credentials Credentials) *Manager {
 	return &Manager{
-		clientFactory: api.NewRESTClient,
+		credentials: credentials,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
 	}
 }
 
-// FetchScope retrieves and caches installation scope information
-func (m *Manager) FetchScope(app *config.GitHubApp, jwtToken string) error {
-	// Create API client with JWT
-	client, err := m.clientFactory(api.ClientOptions{
-		Headers: map[string]string{
-			"Authorization": "Bearer " + jwtToken,
-			"Accept":        "application/vnd.github+json",
-		},
-		Host: "api.github.com",
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create API client: %w", err)
+// RefreshAll refreshes the scope of apps with a pool of workers, in parallel across apps.
+// Results are in the order of apps; each app's Scope is updated in place.
+func (m *Manager) RefreshAll(ctx context.Context, apps []*config.GitHubApp, workers int) []RefreshResult {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+
+	results := make([]RefreshResult, len(apps))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(apps)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				changed, err := m.FetchScope(ctx, apps[i])
+				results[i] = RefreshResult{App: apps[i], Changed: changed, Err: err}
+			}
+		}()
+	}
+
+	for i := range apps {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// FetchScope retrieves and caches installation scope information. Requests are
+// conditional on the cached scope's ETags, so an unchanged scope is cheap to refresh.
+// It reports whether the scope changed.
+func (m *Manager) FetchScope(ctx context.Context, app *config.GitHubApp) (bool, error) {
+	if app.InstallationID == 0 {
+		return false, fmt.Errorf("scope requires an installation_id")
+	}
+	host := appHost(app)
+
+	jwtClient := &http.Client{
+		Transport: m.credentials.AppJWTTransport(app, m.httpClient.Transport),
+		Timeout:   m.httpClient.Timeout,
+	}
+
+	cached := app.Scope
+	if cached == nil {
+		cached = &config.InstallationScope{}
 	}
 
 	// Fetch installation details
-	installation, err := m.getInstallation(client, app.InstallationID)
+	var installation InstallationResponse
+	apiURL := fmt.Sprintf("%s/app/installations/%d", m.apiBaseURL(host), app.InstallationID)
+	etag, notModified, _, err := m.get(ctx, jwtClient, apiURL, "", cached.ETag, &installation)
 	if err != nil {
-		return fmt.Errorf("failed to get installation: %w", err)
+		return false, fmt.Errorf("failed to get installation: %w", err)
 	}
 
 	// Build scope object
-	scope := &config.InstallationScope{
-		RepositorySelection: installation.RepositorySelection,
-		AccountLogin:        installation.Account.Login,
-		AccountType:         installation.Account.Type,
-		LastFetched:         time.Now(),
-		LastUpdated:         installation.UpdatedAt,
-		CacheExpiry:         time.Now().Add(24 * time.Hour), // 24-hour cache
+	scope := *cached
+	if !notModified {
+		scope.RepositorySelection = installation.RepositorySelection
+		scope.AccountLogin = installation.Account.Login
+		scope.AccountType = installation.Account.Type
+		scope.LastUpdated = installation.UpdatedAt
+		scope.ETag = etag
 	}
 
 	// If "selected", fetch repository list
-	if installation.RepositorySelection == "selected" {
-		repos, err := m.getRepositories(app.InstallationID, jwtToken)
+	reposChanged := false
+	if scope.RepositorySelection == "selected" {
+		token, _, err := m.credentials.GetCredentials(app, "https://"+host)
 		if err != nil {
-			return fmt.Errorf("failed to get repositories: %w", err)
+			return false, fmt.Errorf("failed to get installation token: %w", err)
 		}
-		scope.Repositories = repos
+		reposChanged, err = m.getRepositories(ctx, host, token, &scope)
+		if err != nil {
+			return false, fmt.Errorf("failed to get repositories: %w", err)
+		}
+	} else {
+		reposChanged = len(scope.Repositories) > 0
+		scope.Repositories = nil
+		scope.RepositoryPages = nil
 	}
 
-	app.Scope = scope
-	return nil
-}
+	now := time.Now()
+	scope.LastFetched = now
+	scope.CacheExpiry = now.Add(cacheTTL)
+	app.Scope = &scope
 
-// getInstallation fetches installation metadata
-func (m *Manager) getInstallation(client *api.RESTClient, installationID int64) (*InstallationResponse, error) {
-	var installation InstallationResponse
-	err := client.Get(fmt.Sprintf("app/installations/%d", installationID), &installation)
-	if err != nil {
-		return nil, err
-	}
-	return &installation, nil
+	return !notModified || reposChanged, nil
 }
 
-// getRepositories fetches repository list for "selected" installations
-func (m *Manager) getRepositories(installationID int64, jwtToken string) ([]config.RepositoryInfo, error) {
-	// This requires an installation access token, not JWT
-	// We need to generate one first
-	installToken, err := m.getInstallationToken(jwtToken, installationID)
-	if err != nil {
-		return nil, err
+// RefreshOnMiss refreshes the scope of an app a repository was matched against but found
+// out of scope, as the cached scope may predate the repository being added. Refreshes are
+// rate limited to one per MissRefreshInterval, failed ones included, and skipped for apps
+// with refresh_scope_on_miss disabled. It reports whether a refresh was attempted; the
+// attempt is recorded in the app's scope, which should be saved either way.
+func (m *Manager) RefreshOnMiss(ctx context.Context, app *config.GitHubApp, now time.Time) (bool, error) {
+	if !app.ScopeRefreshOnMiss() || app.Scope == nil {
+		return false, nil
+	}
+	if now.Sub(app.Scope.LastMissRefresh) < MissRefreshInterval {
+		return false, nil
 	}
 
-	// Create client with installation token
-	client, err := m.clientFactory(api.ClientOptions{
-		Headers: map[string]string{
-			"Authorization": "token " + installToken,
-			"Accept":        "application/vnd.github+json",
-		},
-		Host: "api.github.com",
-	})
-	if err != nil {
-		return nil, err
+	app.Scope.LastMissRefresh = now
+	_, err := m.FetchScope(ctx, app)
+	return true, err
+}
+
+// getRepositories fetches the repository list of a "selected" installation into scope,
+// following Link headers. Each page is requested conditionally on its cached ETag, and
+// unchanged pages reuse the cached repositories. It reports whether the list changed.
+func (m *Manager) getRepositories(
+	ctx context.Context, host, token string, scope *config.InstallationScope,
+) (bool, error) {
+	cachedPages := scope.RepositoryPages
+	cachedRepos := scope.Repositories
+	if countRepositories(cachedPages) != len(cachedRepos) {
+		// Pages and repositories disagree, e.g. the config was edited: fetch everything
+		cachedPages = nil
 	}
 
-	// Fetch repositories with pagination
-	var allRepos []config.RepositoryInfo
-	page := 1
-	perPage := 100
+	var (
+		repos   []config.RepositoryInfo
+		pages   []config.ScopePage
+		offset  int
+		changed bool
+	)
+	apiURL := fmt.Sprintf("%s/installation/repositories?per_page=%d", m.apiBaseURL(host), repositoriesPerPage)
+	for i := 0; apiURL != ""; i++ {
+		var cachedPage *config.ScopePage
+		if i < len(cachedPages) && cachedPages[i].URL == apiURL {
+			cachedPage = &cachedPages[i]
+		}
+		etag := ""
+		if cachedPage != nil {
+			etag = cachedPage.ETag
+		}
 
-	for {
 		var response RepositoriesResponse
-		err := client.Get(
-			fmt.Sprintf("installation/repositories?per_page=%d&page=%d", perPage, page),
-			&response,
-		)
+		newETag, notModified, next, err := m.get(ctx, m.httpClient, apiURL, "token "+token, etag, &response)
 		if err != nil {
-			return nil, err
+			return false, err
 		}
 
-		for _, repo := range response.Repositories {
-			allRepos = append(allRepos, config.RepositoryInfo{
-				FullName: repo.FullName,
-				Private:  repo.Private,
-			})
+		if notModified && cachedPage != nil {
+			repos = append(repos, cachedRepos[offset:offset+cachedPage.Count]...)
+			pages = append(pages, *cachedPage)
+			if next == "" && i+1 < len(cachedPages) {
+				// 304 responses may omit the Link header: the cached pages still apply
+				next = cachedPages[i+1].URL
+			}
+		} else {
+			changed = true
+			for _, repo := range response.Repositories {
+				repos = append(repos, config.RepositoryInfo{
+					FullName: repo.FullName,
+					Private:  repo.Private,
+				})
+			}
+			pages = append(pages, config.ScopePage{URL: apiURL, ETag: newETag, Count: len(response.Repositories)})
 		}
-
-		// Check if we've fetched all repos
-		if len(response.Repositories) < perPage {
-			break
+		if i < len(cachedPages) {
+			offset += cachedPages[i].Count
 		}
-		page++
+		apiURL = next
 	}
 
-	return allRepos, nil
+	if len(pages) != len(cachedPages) {
+		changed = true
+	}
+	scope.Repositories = repos
+	scope.RepositoryPages = pages
+	return changed, nil
 }
 
-// getInstallationToken exchanges JWT for installation access token
-func (m *Manager) getInstallationToken(jwtToken string, installationID int64) (string, error) {
-	client, err := m.clientFactory(api.ClientOptions{
-		Headers: map[string]string{
-			"Authorization": "Bearer " + jwtToken,
-			"Accept":        "application/vnd.github+json",
-		},
-		Host: "api.github.com",
-	})
+// get sends a GET request with client, conditional on etag when set, and decodes a 200
+// response into v. authorization is left to client when empty. It returns the response
+// ETag, whether the resource is unchanged, and the next page URL.
+func (m *Manager) get(
+	ctx context.Context, client *http.Client, apiURL, authorization, etag string, v any,
+) (newETag string, notModified bool, next string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
 	if err != nil {
-		return "", err
+		return "", false, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
 
-	var response struct {
-		Token string `json:"token"`
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, "", fmt.Errorf("failed to make request: %w", err)
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	err = client.Post(
-		fmt.Sprintf("app/installations/%d/access_tokens", installationID),
-		nil,
-		&response,
-	)
+	next, err = auth.FollowNextPage(resp.Header.Get("Link"), apiURL)
 	if err != nil {
-		return "", err
+		return "", false, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return etag, true, next, nil
+	case http.StatusOK:
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return "", false, "", fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return response.Token, nil
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", false, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp.Header.Get("ETag"), false, next, nil
+}
+
+// apiBaseURL returns the REST API base URL of host
+func (m *Manager) apiBaseURL(host string) string {
+	if m.baseURL != "" {
+		return m.baseURL
+	}
+	return auth.APIBaseURL(host)
 }
 
 // NeedsRefresh checks if scope cache needs refreshing
@@ -163,6 +294,25 @@ func (m *Manager) NeedsRefresh(app *config.GitHubApp) bool {
 	return time.Now().After(app.Scope.CacheExpiry)
 }
 
+// appHost returns the GitHub host of an app, from its first pattern
+func appHost(app *config.GitHubApp) string {
+	if len(app.Patterns) == 0 {
+		return ""
+	}
+	pattern := strings.TrimPrefix(strings.TrimPrefix(app.Patterns[0], "https://"), "http://")
+	host, _, _ := strings.Cut(pattern, "/")
+	return host
+}
+
+// countRepositories sums the repositories of pages
+func countRepositories(pages []config.ScopePage) int {
+	count := 0
+	for _, page := range pages {
+		count += page.Count
+	}
+	return count
+}
+
 // API Response types
 type InstallationResponse struct {
 	ID                  int64     `json:"id"`
@@ -8,17 +8,17 @@ import (
 )
 
 func TestNewManager(t *testing.T) {
-	mgr := NewManager()
+	mgr := NewManager(nil)
 	if mgr == nil {
 		t.Fatal("NewManager() returned nil")
 	}
-	if mgr.clientFactory == nil {
-		t.Error("clientFactory should not be nil")
+	if mgr.httpClient == nil {
+		t.Error("httpClient should not be nil")
 	}
 }
 
 func TestManager_NeedsRefresh(t *testing.T) {
-	mgr := NewManager()
+	mgr := NewManager(nil)
 
 	t.Run("nil scope needs refresh", func(t *testing.T) {
 		app := &config.GitHubApp{
@@ -0,0 +1,288 @@
+package scope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AmadeusITGroup/gh-app-auth/pkg/config"
+)
+
+// fakeCredentials hands out fixed JWTs and installation tokens, counting token requests
+type fakeCredentials struct {
+	tokenRequests atomic.Int32
+}
+
+func (f *fakeCredentials) AppJWTTransport(app *config.GitHubApp, base http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer jwt")
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (f *fakeCredentials) GetCredentials(app *config.GitHubApp, repoURL string) (string, string, error) {
+	f.tokenRequests.Add(1)
+	return "ghs_token", app.Name + "[bot]", nil
+}
+
+// fakeScopeServer mocks a "selected" installation whose repositories are served two per
+// page. It honors If-None-Match and counts the full (200) responses it sends.
+type fakeScopeServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	repos []string
+	full  int
+}
+
+func newFakeScopeServer(t *testing.T, repos ...string) *fakeScopeServer {
+	t.Helper()
+	f := &fakeScopeServer{repos: repos}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer jwt" {
+			http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+			return
+		}
+		f.serve(w, r, `"installation-v1"`, InstallationResponse{
+			ID:                  1,
+			Account:             Account{Login: "myorg", Type: "Organization"},
+			RepositorySelection: "selected",
+		}, "")
+	})
+	mux.HandleFunc("/installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token ghs_token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+
+		f.mu.Lock()
+		page := 1
+		_, _ = fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+		start := min((page-1)*2, len(f.repos))
+		end := min(start+2, len(f.repos))
+		response := RepositoriesResponse{TotalCount: len(f.repos)}
+		for _, name := range f.repos[start:end] {
+			response.Repositories = append(response.Repositories, Repository{FullName: name})
+		}
+		more := end < len(f.repos)
+		f.mu.Unlock()
+
+		next := ""
+		if more {
+			next = fmt.Sprintf(`<%s/installation/repositories?per_page=100&page=%d>; rel="next"`, f.URL, page+1)
+		}
+		etag := fmt.Sprintf("%q", fmt.Sprint(response.Repositories))
+		f.serve(w, r, etag, response, next)
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeScopeServer) serve(w http.ResponseWriter, r *http.Request, etag string, body any, link string) {
+	if link != "" {
+		w.Header().Set("Link", link)
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	f.mu.Lock()
+	f.full++
+	f.mu.Unlock()
+	w.Header().Set("ETag", etag)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeScopeServer) fullResponses() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.full
+}
+
+func repoNames(scope *config.InstallationScope) []string {
+	names := make([]string, 0, len(scope.Repositories))
+	for _, repo := range scope.Repositories {
+		names = append(names, repo.FullName)
+	}
+	return names
+}
+
+func TestManager_FetchScope_Conditional(t *testing.T) {
+	server := newFakeScopeServer(t, "myorg/a", "myorg/b", "myorg/c")
+	credentials := &fakeCredentials{}
+	mgr := NewManager(credentials)
+	mgr.baseURL = server.URL
+
+	app := &config.GitHubApp{Name: "app", AppID: 1, InstallationID: 1, Patterns: []string{"github.com/myorg/"}}
+
+	// Given a first refresh that follows the Link headers through both pages
+	changed, err := mgr.FetchScope(context.Background(), app)
+	if err != nil || !changed {
+		t.Fatalf("FetchScope() = %v, %v; want a changed scope", changed, err)
+	}
+	if got := fmt.Sprint(repoNames(app.Scope)); got != "[myorg/a myorg/b myorg/c]" {
+		t.Fatalf("Repositories = %s", got)
+	}
+	if len(app.Scope.RepositoryPages) != 2 || app.Scope.ETag == "" {
+		t.Errorf("Validators = %q, %+v; want an ETag and two pages", app.Scope.ETag, app.Scope.RepositoryPages)
+	}
+	full := server.fullResponses()
+
+	// When nothing changed on GitHub
+	changed, err = mgr.FetchScope(context.Background(), app)
+
+	// Then every request is answered with 304 and the cached repositories are kept
+	if err != nil || changed {
+		t.Errorf("FetchScope() = %v, %v; want an unchanged scope", changed, err)
+	}
+	if server.fullResponses() != full {
+		t.Errorf("Full responses = %d, want %d", server.fullResponses(), full)
+	}
+	if got := fmt.Sprint(repoNames(app.Scope)); got != "[myorg/a myorg/b myorg/c]" {
+		t.Errorf("Repositories = %s", got)
+	}
+
+	// When a repository is added to the last page, only that page is fetched again
+	server.mu.Lock()
+	server.repos = append(server.repos, "myorg/d")
+	server.mu.Unlock()
+
+	changed, err = mgr.FetchScope(context.Background(), app)
+	if err != nil || !changed {
+		t.Errorf("FetchScope() = %v, %v; want a changed scope", changed, err)
+	}
+	if server.fullResponses() != full+1 {
+		t.Errorf("Full responses = %d, want %d", server.fullResponses(), full+1)
+	}
+	if got := fmt.Sprint(repoNames(app.Scope)); got != "[myorg/a myorg/b myorg/c myorg/d]" {
+		t.Errorf("Repositories = %s", got)
+	}
+
+	// Installation tokens come from the credentials, which cache them
+	if credentials.tokenRequests.Load() != 3 {
+		t.Errorf("Token requests = %d, want one per refresh", credentials.tokenRequests.Load())
+	}
+}
+
+func TestManager_FetchScope_RefusesNextPageOnOtherHost(t *testing.T) {
+	// Given a repositories page whose Link header points to another host
+	var leaked atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked.Add(1)
+		_ = json.NewEncoder(w).Encode(RepositoriesResponse{})
+	}))
+	defer other.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/installations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(InstallationResponse{
+			ID: 1, Account: Account{Login: "myorg"}, RepositorySelection: "selected",
+		})
+	})
+	mux.HandleFunc("/installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/installation/repositories?page=2>; rel="next"`, other.URL))
+		_ = json.NewEncoder(w).Encode(RepositoriesResponse{Repositories: []Repository{{FullName: "myorg/a"}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mgr := NewManager(&fakeCredentials{})
+	mgr.baseURL = server.URL
+	app := &config.GitHubApp{Name: "app", AppID: 1, InstallationID: 1, Patterns: []string{"github.com/myorg/"}}
+
+	// Then the refresh fails without sending the installation token there
+	if _, err := mgr.FetchScope(context.Background(), app); err == nil {
+		t.Error("FetchScope() should refuse a next page on another host")
+	}
+	if leaked.Load() != 0 {
+		t.Errorf("Requests sent to the other host = %d, want 0", leaked.Load())
+	}
+}
+
+func TestManager_RefreshAll(t *testing.T) {
+	server := newFakeScopeServer(t, "myorg/a")
+	mgr := NewManager(&fakeCredentials{})
+	mgr.baseURL = server.URL
+
+	apps := make([]*config.GitHubApp, 0, 6)
+	for i := range 5 {
+		apps = append(apps, &config.GitHubApp{
+			Name: fmt.Sprintf("app-%d", i), AppID: int64(i + 1), InstallationID: 1,
+			Patterns: []string{"github.com/myorg/"},
+		})
+	}
+	apps = append(apps, &config.GitHubApp{Name: "no-installation", AppID: 9, Patterns: []string{"github.com/"}})
+
+	results := mgr.RefreshAll(context.Background(), apps, 2)
+
+	if len(results) != len(apps) {
+		t.Fatalf("RefreshAll() = %d results, want %d", len(results), len(apps))
+	}
+	for i, result := range results[:5] {
+		if result.App != apps[i] || result.Err != nil || apps[i].Scope == nil {
+			t.Errorf("results[%d] = %+v, want a refreshed %s", i, result, apps[i].Name)
+		}
+	}
+	if results[5].Err == nil {
+		t.Error("RefreshAll() of an app without installation_id should report an error")
+	}
+}
+
+func TestManager_RefreshOnMiss(t *testing.T) {
+	server := newFakeScopeServer(t, "myorg/a")
+	mgr := NewManager(&fakeCredentials{})
+	mgr.baseURL = server.URL
+
+	now := time.Now()
+	app := &config.GitHubApp{
+		Name: "app", AppID: 1, InstallationID: 1, Patterns: []string{"github.com/myorg/"},
+		Scope: &config.InstallationScope{RepositorySelection: "selected", AccountLogin: "myorg"},
+	}
+
+	// Given a cached scope that predates myorg/a, a miss refreshes it
+	attempted, err := mgr.RefreshOnMiss(context.Background(), app, now)
+	if !attempted || err != nil {
+		t.Fatalf("RefreshOnMiss() = %v, %v; want a refresh", attempted, err)
+	}
+	if got := fmt.Sprint(repoNames(app.Scope)); got != "[myorg/a]" {
+		t.Errorf("Repositories = %s", got)
+	}
+	if !app.Scope.LastMissRefresh.Equal(now) {
+		t.Errorf("LastMissRefresh = %v, want %v", app.Scope.LastMissRefresh, now)
+	}
+
+	// When another miss follows within the interval, it is rate limited
+	if attempted, _ := mgr.RefreshOnMiss(context.Background(), app, now.Add(time.Minute)); attempted {
+		t.Error("RefreshOnMiss() within MissRefreshInterval should not refresh")
+	}
+
+	// Then refreshes resume after the interval, unless disabled for the app
+	later := now.Add(MissRefreshInterval)
+	disabled := false
+	app.RefreshScopeOnMiss = &disabled
+	if attempted, _ := mgr.RefreshOnMiss(context.Background(), app, later); attempted {
+		t.Error("RefreshOnMiss() with refresh_scope_on_miss disabled should not refresh")
+	}
+	app.RefreshScopeOnMiss = nil
+	if attempted, err := mgr.RefreshOnMiss(context.Background(), app, later); !attempted || err != nil {
+		t.Errorf("RefreshOnMiss() after the interval = %v, %v; want a refresh", attempted, err)
+	}
+}
@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned by backends that can serve secrets but not store or delete them
+var ErrReadOnly = errors.New("secret backend is read-only")
+
+// Backend stores and retrieves the secrets of apps and PATs, identified by entry name and type.
+// Get returns ErrNotFound for a missing secret and ErrStorageUnavailable when the store cannot
+// be reached, so that the Manager moves on to the next backend.
+type Backend interface {
+	// Name identifies the backend type, e.g. "keyring"
+	Name() string
+	Get(name string, secretType SecretType) (string, error)
+	Set(name string, secretType SecretType, value string) error
+	Delete(name string, secretType SecretType) error
+}
+
+// BackendSpec selects and configures a backend. Templates may use {name} and {type},
+// which expand to the entry name and the secret type.
+type BackendSpec struct {
+	Type string `yaml:"type" json:"type"`
+	// Dir overrides the directory of the file and encrypted-file backends
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// Variable is the environment variable template of the env backend
+	Variable string `yaml:"variable,omitempty" json:"variable,omitempty"`
+	// Command and Args print the secret for the command backend; StoreArgs receive it on
+	// stdin and DeleteArgs remove it. Without them the backend is read-only.
+	Command    string   `yaml:"command,omitempty" json:"command,omitempty"`
+	Args       []string `yaml:"args,omitempty" json:"args,omitempty"`
+	StoreArgs  []string `yaml:"store_args,omitempty" json:"store_args,omitempty"`
+	DeleteArgs []string `yaml:"delete_args,omitempty" json:"delete_args,omitempty"`
+	// Vault KV v2 settings; the address and credentials default to the VAULT_* environment
+	Address   string `yaml:"address,omitempty" json:"address,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Mount     string `yaml:"mount,omitempty" json:"mount,omitempty"`
+	Path      string `yaml:"path,omitempty" json:"path,omitempty"`
+	Field     string `yaml:"field,omitempty" json:"field,omitempty"`
+	Auth      string `yaml:"auth,omitempty" json:"auth,omitempty"`
+	AuthMount string `yaml:"auth_mount,omitempty" json:"auth_mount,omitempty"`
+	Role      string `yaml:"role,omitempty" json:"role,omitempty"`
+	// CacheTTL keeps fetched secrets in memory for this long, e.g. "5m"; they are never written to disk
+	CacheTTL string `yaml:"cache_ttl,omitempty" json:"cache_ttl,omitempty"`
+}
+
+// BackendOptions carries the Manager settings a backend factory may need
+type BackendOptions struct {
+	// FallbackDir holds the default secrets directory and the machine key
+	FallbackDir    string
+	KeyringTimeout time.Duration
+}
+
+// BackendFactory creates a backend from its spec
+type BackendFactory func(spec BackendSpec, opts BackendOptions) (Backend, error)
+
+// Built-in backend types
+const (
+	BackendTypeKeyring       = "keyring"
+	BackendTypeFile          = "file"
+	BackendTypeEncryptedFile = "encrypted-file"
+	BackendTypeEnv           = "env"
+	BackendTypeCommand       = "command"
+	BackendTypeMemory        = "memory"
+	BackendTypeVault         = "vault"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]BackendFactory{
+		BackendTypeKeyring:       newKeyringBackendFromSpec,
+		BackendTypeFile:          newFileBackendFromSpec(false),
+		BackendTypeEncryptedFile: newFileBackendFromSpec(true),
+		BackendTypeEnv:           newEnvBackendFromSpec,
+		BackendTypeCommand:       newCommandBackendFromSpec,
+		BackendTypeMemory:        newSharedMemoryBackend,
+		BackendTypeVault:         newVaultBackendFromSpec,
+	}
+)
+
+// RegisterBackend makes a backend type available to secret_backends, replacing any
+// existing registration of the same name
+func RegisterBackend(name string, factory BackendFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// BackendTypes returns the registered backend types, sorted
+func BackendTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for name := range registry {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewBackend creates a backend from its spec using the registry
+func NewBackend(spec BackendSpec, opts BackendOptions) (Backend, error) {
+	registryMu.RLock()
+	factory, ok := registry[spec.Type]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown secret backend type %q (available: %s)",
+			spec.Type, strings.Join(BackendTypes(), ", "))
+	}
+	return factory(spec, opts)
+}
+
+// Validate checks that a backend spec names a registered type and has the fields it needs
+func (s BackendSpec) Validate() error {
+	if s.Type == "" {
+		return fmt.Errorf("type is required")
+	}
+	_, err := NewBackend(s, BackendOptions{})
+	return err
+}
+
+// expandTemplate substitutes {name} and {type} in a backend template
+func expandTemplate(template, name string, secretType SecretType) string {
+	return strings.NewReplacer("{name}", name, "{type}", string(secretType)).Replace(template)
+}
@@ -0,0 +1,235 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// readOnlyBackend serves fixed secrets and refuses writes, like the env backend
+type readOnlyBackend struct {
+	*MemoryBackend
+}
+
+func (b *readOnlyBackend) Name() string                         { return "read-only" }
+func (b *readOnlyBackend) Set(string, SecretType, string) error { return ErrReadOnly }
+func (b *readOnlyBackend) Delete(string, SecretType) error      { return ErrReadOnly }
+
+func TestBackendRegistry(t *testing.T) {
+	for _, name := range []string{"keyring", "file", "encrypted-file", "env", "command", "memory", "vault"} {
+		if !slices.Contains(BackendTypes(), name) {
+			t.Errorf("BackendTypes() = %v, missing %q", BackendTypes(), name)
+		}
+	}
+
+	if _, err := NewBackend(BackendSpec{Type: "nope"}, BackendOptions{}); err == nil {
+		t.Error("NewBackend() expected error for an unknown type")
+	}
+	if err := (BackendSpec{Type: BackendTypeCommand}).Validate(); err == nil {
+		t.Error("Validate() expected error for a command backend without command")
+	}
+	if err := (BackendSpec{}).Validate(); err == nil {
+		t.Error("Validate() expected error for a spec without type")
+	}
+
+	custom := NewMemoryBackend()
+	RegisterBackend("test-custom", func(BackendSpec, BackendOptions) (Backend, error) {
+		return custom, nil
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test-custom")
+		registryMu.Unlock()
+	})
+
+	mgr, err := NewManager(t.TempDir()).WithBackends([]BackendSpec{{Type: "test-custom"}})
+	if err != nil {
+		t.Fatalf("WithBackends() failed: %v", err)
+	}
+	if _, err := mgr.Store("app", SecretTypePAT, "token"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	if value, _ := custom.Get("app", SecretTypePAT); value != "token" {
+		t.Errorf("Custom backend value = %q, want %q", value, "token")
+	}
+}
+
+func TestManager_BackendChain(t *testing.T) {
+	readOnly := &readOnlyBackend{MemoryBackend: NewMemoryBackend()}
+	primary := NewMemoryBackend()
+	fallback := NewMemoryBackend()
+	_ = fallback.Set("app", SecretTypePAT, "stale")
+	mgr := NewManagerWithBackends(t.TempDir(), readOnly, primary, fallback)
+
+	if got := mgr.Backends(); !slices.Equal(got, []string{"read-only", "memory", "memory"}) {
+		t.Errorf("Backends() = %v", got)
+	}
+
+	// Stored in the first writable backend, stale copies after it removed
+	backend, err := mgr.Store("app", SecretTypePAT, "fresh")
+	if err != nil || backend != StorageBackend(BackendTypeMemory) {
+		t.Fatalf("Store() = %v, %v", backend, err)
+	}
+	if _, err := fallback.Get("app", SecretTypePAT); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stale fallback copy not removed, Get() error = %v", err)
+	}
+
+	// Read from the first backend that has it
+	_ = readOnly.MemoryBackend.Set("app", SecretTypePAT, "from-env")
+	value, backend, err := mgr.Get("app", SecretTypePAT)
+	if err != nil || value != "from-env" || backend != "read-only" {
+		t.Errorf("Get() = %q, %v, %v; want read-only value", value, backend, err)
+	}
+
+	// Deleted wherever it can be
+	if err := mgr.Delete("app", SecretTypePAT); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := primary.Get("app", SecretTypePAT); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Secret still in primary backend, Get() error = %v", err)
+	}
+
+	// A chain of read-only backends cannot store
+	if _, err := NewManagerWithBackends("", readOnly).Store("app", SecretTypePAT, "x"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Store() error = %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestManager_GetReportsBackendFailure(t *testing.T) {
+	// A failing backend is reported only when no other backend has the secret
+	failing := &commandBackend{command: filepath.Join(t.TempDir(), "missing"), timeout: DefaultCommandTimeout}
+	memory := NewMemoryBackend()
+	mgr := NewManagerWithBackends("", failing, memory)
+
+	if _, _, err := mgr.Get("app", SecretTypePAT); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want the command failure", err)
+	}
+
+	_ = memory.Set("app", SecretTypePAT, "token")
+	if value, _, err := mgr.Get("app", SecretTypePAT); err != nil || value != "token" {
+		t.Errorf("Get() = %q, %v; want value from the next backend", value, err)
+	}
+}
+
+func TestEnvBackend(t *testing.T) {
+	t.Setenv("GH_APP_AUTH_MY_APP_PAT", "ghp_env")
+	t.Setenv("CI_TOKEN_MY_APP", "ghp_custom")
+
+	backend, err := NewBackend(BackendSpec{Type: BackendTypeEnv}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	if value, err := backend.Get("my-app", SecretTypePAT); err != nil || value != "ghp_env" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "ghp_env")
+	}
+	if _, err := backend.Get("other-app", SecretTypePAT); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+	if err := backend.Set("my-app", SecretTypePAT, "x"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set() error = %v, want %v", err, ErrReadOnly)
+	}
+
+	custom, err := NewBackend(BackendSpec{Type: BackendTypeEnv, Variable: "CI_TOKEN_{name}"}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	if value, err := custom.Get("my-app", SecretTypePAT); err != nil || value != "ghp_custom" {
+		t.Errorf("Get() with variable template = %q, %v; want %q", value, err, "ghp_custom")
+	}
+}
+
+func TestCommandBackend(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+
+	// A tiny password store keeping one file per secret
+	dir := t.TempDir()
+	script := filepath.Join(dir, "store.sh")
+	content := `#!/bin/sh
+file="` + dir + `/$GH_APP_AUTH_SECRET_NAME.$GH_APP_AUTH_SECRET_TYPE"
+case "$1" in
+show) [ -f "$file" ] && cat "$file" ;;
+insert) cat > "$file" ;;
+rm) rm "$file" ;;
+esac
+`
+	if err := os.WriteFile(script, []byte(content), 0700); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	backend, err := NewBackend(BackendSpec{
+		Type:       BackendTypeCommand,
+		Command:    script,
+		Args:       []string{"show", "{name}/{type}"},
+		StoreArgs:  []string{"insert"},
+		DeleteArgs: []string{"rm"},
+	}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+
+	if _, err := backend.Get("app", SecretTypePAT); err == nil {
+		t.Error("Get() expected error for a missing secret")
+	}
+	if err := backend.Set("app", SecretTypePAT, "ghp_cmd"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if value, err := backend.Get("app", SecretTypePAT); err != nil || value != "ghp_cmd" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "ghp_cmd")
+	}
+	if err := backend.Delete("app", SecretTypePAT); err != nil {
+		t.Errorf("Delete() failed: %v", err)
+	}
+
+	readOnly, err := NewBackend(BackendSpec{Type: BackendTypeCommand, Command: script}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	if err := readOnly.Set("app", SecretTypePAT, "x"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set() without store_args error = %v, want %v", err, ErrReadOnly)
+	}
+}
+
+func TestFileBackends(t *testing.T) {
+	t.Setenv(MasterKeyEnv, "")
+	t.Setenv(SecretsPassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	fallbackDir := t.TempDir()
+	dir := t.TempDir()
+	opts := BackendOptions{FallbackDir: fallbackDir}
+
+	plain, err := NewBackend(BackendSpec{Type: BackendTypeFile, Dir: dir}, opts)
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	if err := plain.Set("app", SecretTypePAT, "ghp_plain"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "app.pat")); string(data) != "ghp_plain" {
+		t.Errorf("Plain file content = %q, want %q", data, "ghp_plain")
+	}
+
+	encrypted, err := NewBackend(BackendSpec{Type: BackendTypeEncryptedFile, Dir: dir}, opts)
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	// The encrypted backend still reads plaintext files
+	if value, err := encrypted.Get("app", SecretTypePAT); err != nil || value != "ghp_plain" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "ghp_plain")
+	}
+	if err := encrypted.Set("app", SecretTypePAT, "ghp_sealed"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "app.pat")); !isEncryptedSecret(data) {
+		t.Error("Encrypted backend wrote plaintext")
+	}
+	// The machine key stays in the fallback directory
+	if _, err := os.Stat(filepath.Join(fallbackDir, machineKeyFile)); err != nil {
+		t.Errorf("Machine key not in fallback directory: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultCommandTimeout bounds how long a secret command may run; password managers
+// may wait for the user to unlock them
+const DefaultCommandTimeout = 2 * time.Minute
+
+// commandBackend runs an external password manager CLI such as pass, op or bw.
+// GH_APP_AUTH_SECRET_NAME and GH_APP_AUTH_SECRET_TYPE are set in its environment.
+type commandBackend struct {
+	command    string
+	args       []string
+	storeArgs  []string
+	deleteArgs []string
+	timeout    time.Duration
+}
+
+func newCommandBackendFromSpec(spec BackendSpec, _ BackendOptions) (Backend, error) {
+	if strings.TrimSpace(spec.Command) == "" {
+		return nil, fmt.Errorf("command is required for command backend")
+	}
+	return &commandBackend{
+		command:    spec.Command,
+		args:       spec.Args,
+		storeArgs:  spec.StoreArgs,
+		deleteArgs: spec.DeleteArgs,
+		timeout:    DefaultCommandTimeout,
+	}, nil
+}
+
+// Name implements Backend
+func (b *commandBackend) Name() string {
+	return BackendTypeCommand
+}
+
+// Get runs the command and returns what it prints, without the trailing newline
+func (b *commandBackend) Get(name string, secretType SecretType) (string, error) {
+	output, err := b.run(b.args, name, secretType, nil)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(output, "\r\n")
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set runs the store command with the secret on stdin
+func (b *commandBackend) Set(name string, secretType SecretType, value string) error {
+	if len(b.storeArgs) == 0 {
+		return ErrReadOnly
+	}
+	_, err := b.run(b.storeArgs, name, secretType, strings.NewReader(value))
+	return err
+}
+
+// Delete runs the delete command
+func (b *commandBackend) Delete(name string, secretType SecretType) error {
+	if len(b.deleteArgs) == 0 {
+		return ErrReadOnly
+	}
+	_, err := b.run(b.deleteArgs, name, secretType, nil)
+	return err
+}
+
+// run executes the command with expanded args and returns its stdout
+func (b *commandBackend) run(args []string, name string, secretType SecretType, stdin io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = expandTemplate(arg, name, secretType)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.command, expanded...)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"GH_APP_AUTH_SECRET_NAME="+name,
+		"GH_APP_AUTH_SECRET_TYPE="+string(secretType),
+	)
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("secret command %q failed: %w: %s", b.command, err, msg)
+		}
+		return "", fmt.Errorf("secret command %q failed: %w", b.command, err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,275 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MasterKeyEnv holds a base64-encoded 32-byte key used to encrypt filesystem secrets
+	MasterKeyEnv = "GH_APP_AUTH_MASTER_KEY"
+	// SecretsPassphraseEnv holds a passphrase from which the filesystem secrets key is derived
+	SecretsPassphraseEnv = "GH_APP_AUTH_SECRETS_PASSPHRASE"
+
+	// machineKeyFile is the key file created in the fallback directory when no key is provided
+	machineKeyFile = "fallback.key"
+	// encryptedMagic starts every encrypted secret file; older files hold the plaintext secret
+	encryptedMagic = "GHAA\x00\x01"
+	// passphraseIterations is the PBKDF2-SHA256 work factor for passphrase-derived keys
+	passphraseIterations = 600_000
+	saltSize             = 16
+	keySize              = 32
+)
+
+// Errors returned for encrypted filesystem secrets
+var (
+	ErrDecryptFailed    = errors.New("failed to decrypt secret file")
+	ErrMissingMasterKey = errors.New("secret file is encrypted with a key that is not available")
+)
+
+// keySource records in each file which key encrypted it
+type keySource byte
+
+const (
+	keySourceMasterKey  keySource = 1
+	keySourcePassphrase keySource = 2
+	keySourceMachineKey keySource = 3
+)
+
+// machineIDFiles hold a stable per-host identifier on Linux (can be overridden for testing)
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// isEncryptedSecret reports whether file content was written by sealSecret
+func isEncryptedSecret(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+// sealSecret encrypts a secret with AES-256-GCM. The file name is authenticated so an
+// encrypted file cannot be renamed to stand in for another app's secret.
+//
+// Layout: magic | key source | salt (passphrase keys only) | nonce | ciphertext and tag
+func sealSecret(keyDir, fileName string, plaintext []byte) ([]byte, error) {
+	source := currentKeySource()
+
+	var salt []byte
+	if source == keySourcePassphrase {
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+
+	key, err := encryptionKey(keyDir, source, salt, true)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(encryptedMagic), byte(source))
+	header = append(header, salt...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, plaintext, additionalData(header, fileName)), nil
+}
+
+// openSecret decrypts file content written by sealSecret
+func openSecret(keyDir, fileName string, data []byte) ([]byte, error) {
+	rest := data[len(encryptedMagic):]
+	if len(rest) < 1 {
+		return nil, fmt.Errorf("%w: truncated header", ErrDecryptFailed)
+	}
+	source := keySource(rest[0])
+	rest = rest[1:]
+
+	var salt []byte
+	switch source {
+	case keySourcePassphrase:
+		if len(rest) < saltSize {
+			return nil, fmt.Errorf("%w: truncated header", ErrDecryptFailed)
+		}
+		salt, rest = rest[:saltSize], rest[saltSize:]
+	case keySourceMasterKey, keySourceMachineKey:
+	default:
+		return nil, fmt.Errorf("%w: unknown key source %d", ErrDecryptFailed, source)
+	}
+	header := data[:len(data)-len(rest)]
+
+	key, err := encryptionKey(keyDir, source, salt, false)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated file", ErrDecryptFailed)
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(header, fileName))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong %s or corrupted file", ErrDecryptFailed, source)
+	}
+	return plaintext, nil
+}
+
+// currentKeySource picks the key for new files: a master key, then a passphrase, then the machine key
+func currentKeySource() keySource {
+	if os.Getenv(MasterKeyEnv) != "" {
+		return keySourceMasterKey
+	}
+	if os.Getenv(SecretsPassphraseEnv) != "" {
+		return keySourcePassphrase
+	}
+	return keySourceMachineKey
+}
+
+// encryptionKey returns the AES key for a key source; the machine key lives in keyDir.
+// The machine key file is only created when writing; reading never generates a key that could not open it.
+func encryptionKey(keyDir string, source keySource, salt []byte, create bool) ([]byte, error) {
+	switch source {
+	case keySourceMasterKey:
+		encoded := os.Getenv(MasterKeyEnv)
+		if encoded == "" {
+			return nil, fmt.Errorf("%w: set %s", ErrMissingMasterKey, MasterKeyEnv)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("%s must be %d base64-encoded bytes (openssl rand -base64 %d)",
+				MasterKeyEnv, keySize, keySize)
+		}
+		return key, nil
+
+	case keySourcePassphrase:
+		passphrase := os.Getenv(SecretsPassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("%w: set %s", ErrMissingMasterKey, SecretsPassphraseEnv)
+		}
+		key, err := pbkdf2.Key(sha256.New, passphrase, salt, passphraseIterations, keySize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return key, nil
+
+	default:
+		return machineKey(keyDir, create)
+	}
+}
+
+// machineKey derives a key from a random key file in keyDir. On Linux the machine ID
+// is mixed in, so a copied secrets directory does not decrypt on another host.
+func machineKey(keyDir string, create bool) ([]byte, error) {
+	path := filepath.Join(keyDir, machineKeyFile)
+
+	secret, err := os.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		secret, err = createMachineKey(path)
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: machine key %s does not exist", ErrMissingMasterKey, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine key: %w", err)
+	}
+	if len(secret) != keySize {
+		return nil, fmt.Errorf("machine key %s is corrupted", path)
+	}
+
+	key, err := hkdf.Key(sha256.New, secret, machineID(), "gh-app-auth filesystem secrets", keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
+
+// createMachineKey writes a new random key file, keeping the existing one if another process won the race
+func createMachineKey(path string) ([]byte, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate machine key: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create machine key: %w", err)
+	}
+	if _, err := f.Write(secret); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to write machine key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write machine key: %w", err)
+	}
+	return secret, nil
+}
+
+// machineID returns the host's machine ID, or nil where none is available
+func machineID() []byte {
+	for _, path := range machineIDFiles {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := bytes.TrimSpace(data); len(id) > 0 {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+// newAEAD returns AES-256-GCM for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// additionalData binds the header and the file name to the ciphertext
+func additionalData(header []byte, fileName string) []byte {
+	return append(append([]byte{}, header...), fileName...)
+}
+
+// String names the key source in error messages
+func (s keySource) String() string {
+	switch s {
+	case keySourceMasterKey:
+		return MasterKeyEnv
+	case keySourcePassphrase:
+		return SecretsPassphraseEnv
+	case keySourceMachineKey:
+		return "machine key"
+	default:
+		return fmt.Sprintf("key source %d", byte(s))
+	}
+}
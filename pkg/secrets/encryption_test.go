@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// newFallbackManager returns a manager whose secrets always land on the filesystem,
+// with no key configured in the environment and a fake machine ID
+func newFallbackManager(t *testing.T) *Manager {
+	t.Helper()
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	t.Cleanup(func() { keyring.MockInitWithError(nil) })
+
+	t.Setenv(MasterKeyEnv, "")
+	t.Setenv(SecretsPassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	return NewManager(t.TempDir())
+}
+
+// setMachineID points the machine ID lookup at a temp file
+func setMachineID(t *testing.T, id string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "machine-id")
+	if err := os.WriteFile(path, []byte(id+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write machine ID: %v", err)
+	}
+	original := machineIDFiles
+	machineIDFiles = []string{path}
+	t.Cleanup(func() { machineIDFiles = original })
+}
+
+func TestFilesystemEncryption_MachineKey(t *testing.T) {
+	mgr := newFallbackManager(t)
+
+	if _, err := mgr.Store("test-app", SecretTypePAT, "ghp_secret"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	// Overwriting the read-only file must work too
+	if _, err := mgr.Store("test-app", SecretTypePAT, "ghp_rotated"); err != nil {
+		t.Fatalf("Store() overwrite failed: %v", err)
+	}
+
+	value, backend, err := mgr.Get("test-app", SecretTypePAT)
+	if err != nil || backend != StorageBackendFilesystem || value != "ghp_rotated" {
+		t.Fatalf("Get() = %q, %v, %v; want filesystem value", value, backend, err)
+	}
+
+	keyPath := filepath.Join(mgr.fallbackDir, machineKeyFile)
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("Machine key not created: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Machine key permissions = %o, want %o", info.Mode().Perm(), 0600)
+	}
+
+	// The key is bound to the machine: another machine ID cannot open the file
+	setMachineID(t, "machine-b")
+	if _, _, err := mgr.Get("test-app", SecretTypePAT); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Get() on another machine error = %v, want %v", err, ErrDecryptFailed)
+	}
+}
+
+func TestFilesystemEncryption_MasterKey(t *testing.T) {
+	mgr := newFallbackManager(t)
+	masterKey := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", keySize)))
+	t.Setenv(MasterKeyEnv, masterKey)
+
+	if _, err := mgr.Store("test-app", SecretTypePrivateKey, "pem"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	if value, _, err := mgr.Get("test-app", SecretTypePrivateKey); err != nil || value != "pem" {
+		t.Fatalf("Get() = %q, %v; want %q", value, err, "pem")
+	}
+	if _, err := os.Stat(filepath.Join(mgr.fallbackDir, machineKeyFile)); !os.IsNotExist(err) {
+		t.Errorf("Machine key should not be created when a master key is set, stat error = %v", err)
+	}
+
+	t.Setenv(MasterKeyEnv, "")
+	if _, _, err := mgr.Get("test-app", SecretTypePrivateKey); !errors.Is(err, ErrMissingMasterKey) {
+		t.Errorf("Get() without master key error = %v, want %v", err, ErrMissingMasterKey)
+	}
+
+	t.Setenv(MasterKeyEnv, base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", keySize))))
+	if _, _, err := mgr.Get("test-app", SecretTypePrivateKey); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Get() with wrong master key error = %v, want %v", err, ErrDecryptFailed)
+	}
+
+	t.Setenv(MasterKeyEnv, "c2hvcnQ=")
+	if _, err := mgr.Store("test-app", SecretTypePrivateKey, "pem"); err == nil {
+		t.Error("Store() expected error for a master key of the wrong length")
+	}
+}
+
+func TestFilesystemEncryption_Passphrase(t *testing.T) {
+	mgr := newFallbackManager(t)
+	t.Setenv(SecretsPassphraseEnv, "correct-horse")
+
+	if _, err := mgr.Store("test-app", SecretTypePAT, "ghp_secret"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	if value, _, err := mgr.Get("test-app", SecretTypePAT); err != nil || value != "ghp_secret" {
+		t.Fatalf("Get() = %q, %v; want %q", value, err, "ghp_secret")
+	}
+
+	t.Setenv(SecretsPassphraseEnv, "battery-staple")
+	if _, _, err := mgr.Get("test-app", SecretTypePAT); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Get() with wrong passphrase error = %v, want %v", err, ErrDecryptFailed)
+	}
+}
+
+func TestFilesystemEncryption_BoundToFileName(t *testing.T) {
+	mgr := newFallbackManager(t)
+
+	if _, err := mgr.Store("app-a", SecretTypePAT, "ghp_a"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+	// Passing app-a's file off as app-b's is detected
+	if err := os.Rename(
+		mgr.filesystemPath("app-a", SecretTypePAT), mgr.filesystemPath("app-b", SecretTypePAT),
+	); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, _, err := mgr.Get("app-b", SecretTypePAT); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("Get() of a renamed file error = %v, want %v", err, ErrDecryptFailed)
+	}
+}
+
+func TestEncryptFilesystemSecrets(t *testing.T) {
+	mgr := newFallbackManager(t)
+
+	// Given: A plaintext secret written by an older version and an encrypted one
+	legacyPath := mgr.filesystemPath("legacy-app", SecretTypePrivateKey)
+	if err := os.MkdirAll(filepath.Dir(legacyPath), 0700); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(legacyPath, []byte("legacy-pem"), 0400); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := mgr.Store("new-app", SecretTypePAT, "ghp_new"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+
+	// Then: The plaintext secret is still readable and is listed for conversion
+	if value, _, err := mgr.Get("legacy-app", SecretTypePrivateKey); err != nil || value != "legacy-pem" {
+		t.Fatalf("Get() legacy = %q, %v", value, err)
+	}
+	plaintext, err := mgr.PlaintextFilesystemSecrets()
+	if err != nil || !slices.Equal(plaintext, []string{"legacy-app.private_key"}) {
+		t.Fatalf("PlaintextFilesystemSecrets() = %v, %v", plaintext, err)
+	}
+
+	// When: The secrets are encrypted
+	converted, err := mgr.EncryptFilesystemSecrets()
+	if err != nil || !slices.Equal(converted, []string{"legacy-app.private_key"}) {
+		t.Fatalf("EncryptFilesystemSecrets() = %v, %v", converted, err)
+	}
+
+	// Then: The file is encrypted and still holds the same secret
+	data, err := os.ReadFile(legacyPath)
+	if err != nil || !isEncryptedSecret(data) {
+		t.Fatalf("Legacy file not encrypted: %q, %v", data, err)
+	}
+	if value, _, err := mgr.Get("legacy-app", SecretTypePrivateKey); err != nil || value != "legacy-pem" {
+		t.Errorf("Get() after encryption = %q, %v", value, err)
+	}
+
+	// And: Running again converts nothing
+	if converted, err := mgr.EncryptFilesystemSecrets(); err != nil || len(converted) != 0 {
+		t.Errorf("Second EncryptFilesystemSecrets() = %v, %v; want nothing", converted, err)
+	}
+}
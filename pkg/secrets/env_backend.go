@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultEnvVariable names the variable read by the env backend, e.g. GH_APP_AUTH_MY_APP_PRIVATE_KEY
+const defaultEnvVariable = "GH_APP_AUTH_{name}_{type}"
+
+// envBackend reads secrets from environment variables, as injected by CI systems. It is read-only.
+type envBackend struct {
+	variable string
+}
+
+func newEnvBackendFromSpec(spec BackendSpec, _ BackendOptions) (Backend, error) {
+	variable := spec.Variable
+	if variable == "" {
+		variable = defaultEnvVariable
+	}
+	return &envBackend{variable: variable}, nil
+}
+
+// Name implements Backend
+func (b *envBackend) Name() string {
+	return BackendTypeEnv
+}
+
+// Get reads the secret from the variable named by the template
+func (b *envBackend) Get(name string, secretType SecretType) (string, error) {
+	value, ok := os.LookupEnv(envVariableName(expandTemplate(b.variable, name, secretType)))
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set implements Backend; environment variables cannot be stored
+func (b *envBackend) Set(string, SecretType, string) error {
+	return ErrReadOnly
+}
+
+// Delete implements Backend; environment variables cannot be deleted
+func (b *envBackend) Delete(string, SecretType) error {
+	return ErrReadOnly
+}
+
+// envVariableName upper-cases a name and replaces characters not allowed in variable names
+func envVariableName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
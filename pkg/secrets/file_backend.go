@@ -0,0 +1,200 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileBackend stores each secret in its own owner read-only file, encrypted unless it is
+// the plain file backend. Plaintext files are still read by the encrypted backend so that
+// secrets written before encryption was introduced keep working until migrated.
+type fileBackend struct {
+	dir     string
+	keyDir  string // holds the machine key
+	encrypt bool
+}
+
+func newFileBackend(dir, keyDir string, encrypt bool) *fileBackend {
+	return &fileBackend{dir: dir, keyDir: keyDir, encrypt: encrypt}
+}
+
+func newFileBackendFromSpec(encrypt bool) BackendFactory {
+	return func(spec BackendSpec, opts BackendOptions) (Backend, error) {
+		dir := filepath.Join(opts.FallbackDir, "secrets")
+		if spec.Dir != "" {
+			expanded, err := expandHome(spec.Dir)
+			if err != nil {
+				return nil, err
+			}
+			dir = expanded
+		}
+		return newFileBackend(dir, opts.FallbackDir, encrypt), nil
+	}
+}
+
+// Name implements Backend
+func (b *fileBackend) Name() string {
+	if b.encrypt {
+		return BackendTypeEncryptedFile
+	}
+	return BackendTypeFile
+}
+
+// Set stores a secret on the filesystem with secure permissions
+func (b *fileBackend) Set(name string, secretType SecretType, value string) error {
+	path := b.path(name, secretType)
+
+	data := []byte(value)
+	if b.encrypt {
+		sealed, err := sealSecret(b.keyDir, filepath.Base(path), data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt secret: %w", err)
+		}
+		data = sealed
+	}
+	return writeSecretFile(path, data)
+}
+
+// Get retrieves a secret from the filesystem
+func (b *fileBackend) Get(name string, secretType SecretType) (string, error) {
+	path := b.path(name, secretType)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	if !isEncryptedSecret(data) {
+		return string(data), nil
+	}
+	plaintext, err := openSecret(b.keyDir, filepath.Base(path), data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return string(plaintext), nil
+}
+
+// Delete removes a secret from the filesystem
+func (b *fileBackend) Delete(name string, secretType SecretType) error {
+	err := os.Remove(b.path(name, secretType))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// path returns the filesystem path for a secret
+func (b *fileBackend) path(name string, secretType SecretType) string {
+	// Sanitize app name to be filesystem-safe
+	safeName := filepath.Base(name)
+	filename := fmt.Sprintf("%s.%s", safeName, secretType)
+	return filepath.Join(b.dir, filename)
+}
+
+// plaintextSecrets lists the secret files that are not encrypted
+func (b *fileBackend) plaintextSecrets() ([]string, error) {
+	var names []string
+	err := b.walk(func(path string, data []byte) error {
+		if !isEncryptedSecret(data) {
+			names = append(names, filepath.Base(path))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// encryptSecrets encrypts the secret files still stored as plaintext and returns their names
+func (b *fileBackend) encryptSecrets() ([]string, error) {
+	var names []string
+	err := b.walk(func(path string, data []byte) error {
+		if isEncryptedSecret(data) {
+			return nil
+		}
+		sealed, err := sealSecret(b.keyDir, filepath.Base(path), data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filepath.Base(path), err)
+		}
+		if err := writeSecretFile(path, sealed); err != nil {
+			return err
+		}
+		names = append(names, filepath.Base(path))
+		return nil
+	})
+	return names, err
+}
+
+// walk calls fn with the path and content of every secret file
+func (b *fileBackend) walk(fn func(path string, data []byte) error) error {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read secrets directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		// Skip leftovers of interrupted writes
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(b.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read secret file: %w", err)
+		}
+		if err := fn(path, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSecretFile atomically replaces a secret file, leaving it owner read-only
+func writeSecretFile(path string, data []byte) error {
+	// Ensure directory exists with secure permissions
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0400); err != nil {
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write secret file: %w", err)
+	}
+	return nil
+}
+
+// expandHome expands a leading ~ in a configured directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~")), nil
+}
@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringBackend stores secrets in the OS keyring (Keychain, Credential Manager, Secret Service)
+type keyringBackend struct {
+	timeout time.Duration
+}
+
+func newKeyringBackend(timeout time.Duration) *keyringBackend {
+	return &keyringBackend{timeout: timeout}
+}
+
+func newKeyringBackendFromSpec(_ BackendSpec, opts BackendOptions) (Backend, error) {
+	timeout := opts.KeyringTimeout
+	if timeout <= 0 {
+		timeout = defaultKeyringTimeout
+	}
+	return newKeyringBackend(timeout), nil
+}
+
+// Name implements Backend
+func (b *keyringBackend) Name() string {
+	return BackendTypeKeyring
+}
+
+// Set stores a secret in the OS keyring with timeout protection
+func (b *keyringBackend) Set(name string, secretType SecretType, value string) error {
+	ch := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		ch <- keyring.Set(keyringService(name), string(secretType), value)
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(b.timeout):
+		return ErrTimeout
+	}
+}
+
+// Get retrieves a secret from the OS keyring with timeout protection
+func (b *keyringBackend) Get(name string, secretType SecretType) (string, error) {
+	ch := make(chan struct {
+		val string
+		err error
+	}, 1)
+
+	go func() {
+		defer close(ch)
+		val, err := keyring.Get(keyringService(name), string(secretType))
+		ch <- struct {
+			val string
+			err error
+		}{val, err}
+	}()
+
+	select {
+	case res := <-ch:
+		if errors.Is(res.err, keyring.ErrNotFound) {
+			return "", ErrNotFound
+		}
+		if res.err != nil {
+			return "", fmt.Errorf("%w: %w", ErrStorageUnavailable, res.err)
+		}
+		return res.val, nil
+	case <-time.After(b.timeout):
+		return "", fmt.Errorf("%w: %w", ErrStorageUnavailable, ErrTimeout)
+	}
+}
+
+// Delete removes a secret from the OS keyring with timeout protection
+func (b *keyringBackend) Delete(name string, secretType SecretType) error {
+	ch := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		ch <- keyring.Delete(keyringService(name), string(secretType))
+	}()
+
+	select {
+	case err := <-ch:
+		if errors.Is(err, keyring.ErrNotFound) {
+			return ErrNotFound
+		}
+		return err
+	case <-time.After(b.timeout):
+		return ErrTimeout
+	}
+}
+
+// keyringService returns the keyring service name for an app
+func keyringService(name string) string {
+	return fmt.Sprintf("gh-app-auth:%s", name)
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import "sync"
+
+// MemoryBackend keeps secrets in process memory. It is meant for tests; the "memory"
+// backend type shares one instance per process.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// sharedMemory backs the "memory" backend type
+var sharedMemory = NewMemoryBackend()
+
+// NewMemoryBackend creates an empty in-memory backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{secrets: make(map[string]string)}
+}
+
+func newSharedMemoryBackend(BackendSpec, BackendOptions) (Backend, error) {
+	return sharedMemory, nil
+}
+
+// Name implements Backend
+func (b *MemoryBackend) Name() string {
+	return BackendTypeMemory
+}
+
+// Get implements Backend
+func (b *MemoryBackend) Get(name string, secretType SecretType) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	value, ok := b.secrets[memoryKey(name, secretType)]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Set implements Backend
+func (b *MemoryBackend) Set(name string, secretType SecretType, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.secrets[memoryKey(name, secretType)] = value
+	return nil
+}
+
+// Delete implements Backend
+func (b *MemoryBackend) Delete(name string, secretType SecretType) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := memoryKey(name, secretType)
+	if _, ok := b.secrets[key]; !ok {
+		return ErrNotFound
+	}
+	delete(b.secrets, key)
+	return nil
+}
+
+func memoryKey(name string, secretType SecretType) string {
+	return name + "\x00" + string(secretType)
+}
@@ -0,0 +1,197 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ErrInvalidReference is returned for secret references that cannot be parsed
+var ErrInvalidReference = errors.New("invalid secret reference")
+
+// Secret reference schemes
+const (
+	// ReferenceSchemeEnv reads an environment variable, e.g. env:GH_APP_KEY
+	ReferenceSchemeEnv = "env"
+	// ReferenceSchemeFile reads a file, e.g. file:~/keys/app.pem
+	ReferenceSchemeFile = "file"
+	// ReferenceSchemeKeyring reads the keyring entry of a name, e.g. keyring:shared-app
+	ReferenceSchemeKeyring = "keyring"
+	// ReferenceSchemeCommand runs a command and reads its stdout, e.g. cmd:op read op://vault/app/key
+	ReferenceSchemeCommand = "cmd"
+)
+
+// Reference points at a secret kept outside gh-app-auth, written as "scheme:value".
+// It is resolved each time the secret is needed.
+type Reference struct {
+	Scheme string
+	Value  string
+}
+
+// ParseReference parses a secret reference such as env:GH_APP_KEY or cmd:op read op://vault/app/key
+func ParseReference(ref string) (Reference, error) {
+	scheme, value, ok := strings.Cut(strings.TrimSpace(ref), ":")
+	if !ok {
+		return Reference{}, fmt.Errorf("%w %q: expected scheme:value with scheme env, file, keyring or cmd",
+			ErrInvalidReference, ref)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Reference{}, fmt.Errorf("%w %q: empty %s reference", ErrInvalidReference, ref, scheme)
+	}
+
+	switch scheme {
+	case ReferenceSchemeEnv:
+		if strings.ContainsAny(value, "= \t") {
+			return Reference{}, fmt.Errorf("%w %q: invalid variable name", ErrInvalidReference, ref)
+		}
+	case ReferenceSchemeFile, ReferenceSchemeKeyring:
+	case ReferenceSchemeCommand:
+		if _, err := splitCommandLine(value); err != nil {
+			return Reference{}, fmt.Errorf("%w %q: %w", ErrInvalidReference, ref, err)
+		}
+	default:
+		return Reference{}, fmt.Errorf("%w %q: unknown scheme %q (use env, file, keyring or cmd)",
+			ErrInvalidReference, ref, scheme)
+	}
+	return Reference{Scheme: scheme, Value: value}, nil
+}
+
+// String returns the reference as written in the config
+func (r Reference) String() string {
+	return r.Scheme + ":" + r.Value
+}
+
+// Backend returns the backend type that serves the reference
+func (r Reference) Backend() StorageBackend {
+	switch r.Scheme {
+	case ReferenceSchemeEnv:
+		return BackendTypeEnv
+	case ReferenceSchemeFile:
+		return BackendTypeFile
+	case ReferenceSchemeKeyring:
+		return BackendTypeKeyring
+	default:
+		return BackendTypeCommand
+	}
+}
+
+// CheckPrivate checks that a file reference does not point at a file readable by group or
+// others (it should be 600 or 400), as private key files must be. Other schemes pass, and
+// a missing file is left for Resolve to report. Permissions are not checked on Windows.
+func (r Reference) CheckPrivate() error {
+	if r.Scheme != ReferenceSchemeFile || runtime.GOOS == "windows" {
+		return nil
+	}
+	path, err := expandHome(r.Value)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to access %s: %w", path, err)
+	}
+	if info.Mode().Perm()&0044 != 0 {
+		return fmt.Errorf("file %s has overly permissive permissions %o (should be 600 or 400)",
+			path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// Resolve reads the referenced secret. name and secretType identify the config entry and
+// select the keyring item; commands also get them as GH_APP_AUTH_SECRET_NAME and _TYPE.
+func (r Reference) Resolve(name string, secretType SecretType) (string, error) {
+	switch r.Scheme {
+	case ReferenceSchemeEnv:
+		value := os.Getenv(r.Value)
+		if value == "" {
+			return "", fmt.Errorf("%w: environment variable %s is not set", ErrNotFound, r.Value)
+		}
+		return value, nil
+
+	case ReferenceSchemeFile:
+		path, err := expandHome(r.Value)
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case ReferenceSchemeKeyring:
+		return newKeyringBackend(defaultKeyringTimeout).Get(r.Value, secretType)
+
+	case ReferenceSchemeCommand:
+		args, err := splitCommandLine(r.Value)
+		if err != nil {
+			return "", err
+		}
+		backend := &commandBackend{command: args[0], args: args[1:], timeout: DefaultCommandTimeout}
+		return backend.Get(name, secretType)
+
+	default:
+		return "", fmt.Errorf("%w: unknown scheme %q", ErrInvalidReference, r.Scheme)
+	}
+}
+
+// splitCommandLine splits a command line into words. Single and double quotes group words;
+// no shell is involved, so variables and globs are not expanded.
+func splitCommandLine(line string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range line {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return words, nil
+}
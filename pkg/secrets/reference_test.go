@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    Reference
+		wantErr bool
+	}{
+		{ref: "env:GH_APP_KEY", want: Reference{Scheme: "env", Value: "GH_APP_KEY"}},
+		{ref: "file:~/keys/app.pem", want: Reference{Scheme: "file", Value: "~/keys/app.pem"}},
+		{ref: "keyring:shared-app", want: Reference{Scheme: "keyring", Value: "shared-app"}},
+		{ref: "cmd:op read op://vault/app/key", want: Reference{Scheme: "cmd", Value: "op read op://vault/app/key"}},
+		{ref: " env: SPACED ", want: Reference{Scheme: "env", Value: "SPACED"}},
+		{ref: "GH_APP_KEY", wantErr: true},
+		{ref: "env:", wantErr: true},
+		{ref: "env:A=B", wantErr: true},
+		{ref: "vault:secret/app", wantErr: true},
+		{ref: `cmd:op read "unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseReference(tt.ref)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidReference) {
+					t.Errorf("ParseReference() error = %v, want %v", err, ErrInvalidReference)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseReference() = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "op read op://vault/app/key", want: []string{"op", "read", "op://vault/app/key"}},
+		{line: `pass show "team keys/app"`, want: []string{"pass", "show", "team keys/app"}},
+		{line: `sh -c 'echo "$KEY"'`, want: []string{"sh", "-c", `echo "$KEY"`}},
+		{line: `printf a\ b ""`, want: []string{"printf", "a b", ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommandLine(tt.line)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitCommandLine(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestReference_Resolve(t *testing.T) {
+	keyring.MockInit()
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("TEST_REF_KEY", "env-secret")
+		ref, _ := ParseReference("env:TEST_REF_KEY")
+		if value, err := ref.Resolve("app", SecretTypePrivateKey); err != nil || value != "env-secret" {
+			t.Errorf("Resolve() = %q, %v; want env-secret", value, err)
+		}
+		t.Setenv("TEST_REF_KEY", "")
+		if _, err := ref.Resolve("app", SecretTypePrivateKey); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Resolve() of unset variable error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		if err := os.WriteFile(filepath.Join(home, "token"), []byte("ghp_file\n"), 0600); err != nil {
+			t.Fatalf("Failed to write token: %v", err)
+		}
+		ref, _ := ParseReference("file:~/token")
+		if value, err := ref.Resolve("pat", SecretTypePAT); err != nil || value != "ghp_file" {
+			t.Errorf("Resolve() = %q, %v; want ghp_file", value, err)
+		}
+		missing, _ := ParseReference("file:~/missing")
+		if _, err := missing.Resolve("pat", SecretTypePAT); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Resolve() of missing file error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("file permissions", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("file permissions work differently on Windows")
+		}
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		if err := os.WriteFile(filepath.Join(home, "app.pem"), []byte("key"), 0640); err != nil {
+			t.Fatalf("Failed to write key: %v", err)
+		}
+		ref, _ := ParseReference("file:~/app.pem")
+		if err := ref.CheckPrivate(); err == nil {
+			t.Error("CheckPrivate() should fail for a group readable file")
+		}
+		if err := os.Chmod(filepath.Join(home, "app.pem"), 0400); err != nil {
+			t.Fatalf("Chmod() failed: %v", err)
+		}
+		if err := ref.CheckPrivate(); err != nil {
+			t.Errorf("CheckPrivate() error = %v for a private file", err)
+		}
+		for _, other := range []string{"file:~/missing", "env:HOME"} {
+			ref, _ := ParseReference(other)
+			if err := ref.CheckPrivate(); err != nil {
+				t.Errorf("CheckPrivate() of %s error = %v, want nil", other, err)
+			}
+		}
+	})
+
+	t.Run("keyring", func(t *testing.T) {
+		if err := keyring.Set(keyringService("shared-app"), string(SecretTypePrivateKey), "shared-key"); err != nil {
+			t.Fatalf("Failed to seed keyring: %v", err)
+		}
+		ref, _ := ParseReference("keyring:shared-app")
+		if value, err := ref.Resolve("other-app", SecretTypePrivateKey); err != nil || value != "shared-key" {
+			t.Errorf("Resolve() = %q, %v; want shared-key", value, err)
+		}
+	})
+
+	t.Run("cmd", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("uses a shell")
+		}
+		ref, _ := ParseReference(`cmd:sh -c 'echo "$GH_APP_AUTH_SECRET_NAME-$GH_APP_AUTH_SECRET_TYPE"'`)
+		if value, err := ref.Resolve("ci", SecretTypePAT); err != nil || value != "ci-pat" {
+			t.Errorf("Resolve() = %q, %v; want ci-pat", value, err)
+		}
+		if ref.Backend() != BackendTypeCommand {
+			t.Errorf("Backend() = %v, want %v", ref.Backend(), BackendTypeCommand)
+		}
+	})
+}
@@ -1,12 +1,12 @@
-// Package secrets provides secure storage for sensitive data using OS-native keyrings
-// with automatic fallback to filesystem storage.
+// Package secrets provides secure storage for sensitive data through pluggable backends,
+// by default OS-native keyrings with automatic fallback to encrypted filesystem storage.
 package secrets
 
 import (
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/zalando/go-keyring"
@@ -31,77 +31,182 @@ const (
 	SecretTypeInstallToken SecretType = "installation_token"
 	// SecretTypePAT represents a Personal Access Token
 	SecretTypePAT SecretType = "pat"
+	// SecretTypeKeyPassphrase represents the passphrase of an encrypted private key
+	SecretTypeKeyPassphrase SecretType = "key_passphrase"
+	// SecretTypeRefreshToken represents the refresh token of a GitHub App user token
+	SecretTypeRefreshToken SecretType = "refresh_token"
+	// SecretTypeClientSecret represents the client secret of a GitHub App
+	SecretTypeClientSecret SecretType = "client_secret"
 )
 
-// StorageBackend identifies where a secret is stored
+// StorageBackend identifies the backend that stored or served a secret, by backend type
 type StorageBackend string
 
 const (
 	// StorageBackendKeyring indicates the secret is in the OS keyring
-	StorageBackendKeyring StorageBackend = "keyring"
-	// StorageBackendFilesystem indicates the secret is on the filesystem
-	StorageBackendFilesystem StorageBackend = "filesystem"
+	StorageBackendKeyring StorageBackend = BackendTypeKeyring
+	// StorageBackendFilesystem indicates the secret is in the encrypted filesystem fallback
+	StorageBackendFilesystem StorageBackend = BackendTypeEncryptedFile
 )
 
-// Manager handles secure storage and retrieval of secrets
+// defaultKeyringTimeout bounds keyring operations, which hang when no keyring daemon answers
+const defaultKeyringTimeout = 3 * time.Second
+
+// Manager handles secure storage and retrieval of secrets through an ordered chain of
+// backends: secrets are stored in the first backend that accepts them and read from the
+// first backend that has them
 type Manager struct {
 	keyringTimeout time.Duration
 	fallbackDir    string
+	backends       []Backend
 }
 
-// NewManager creates a new secrets manager with the specified fallback directory
+// NewManager creates a new secrets manager with the specified fallback directory.
+// Secrets go to the OS keyring, falling back to encrypted files in fallbackDir.
 func NewManager(fallbackDir string) *Manager {
+	m := &Manager{
+		keyringTimeout: defaultKeyringTimeout,
+		fallbackDir:    fallbackDir,
+	}
+	m.backends = []Backend{newKeyringBackend(m.keyringTimeout), m.filesystem()}
+	return m
+}
+
+// NewManagerWithBackends creates a secrets manager using the given backends in order
+func NewManagerWithBackends(fallbackDir string, backends ...Backend) *Manager {
 	return &Manager{
-		keyringTimeout: 3 * time.Second,
+		keyringTimeout: defaultKeyringTimeout,
 		fallbackDir:    fallbackDir,
+		backends:       backends,
+	}
+}
+
+// WithBackends returns a manager using the backends described by specs, in order,
+// for entries that choose their own. Without specs the manager itself is returned.
+func (m *Manager) WithBackends(specs []BackendSpec) (*Manager, error) {
+	if len(specs) == 0 {
+		return m, nil
+	}
+
+	opts := BackendOptions{FallbackDir: m.fallbackDir, KeyringTimeout: m.keyringTimeout}
+	backends := make([]Backend, 0, len(specs))
+	for i, spec := range specs {
+		backend, err := NewBackend(spec, opts)
+		if err != nil {
+			return nil, fmt.Errorf("secret_backends[%d]: %w", i, err)
+		}
+		backends = append(backends, backend)
 	}
+	return NewManagerWithBackends(m.fallbackDir, backends...), nil
 }
 
-// Store attempts to store a secret in the OS keyring first, falling back to
-// filesystem if keyring is unavailable. Returns the storage backend used.
+// Backends returns the names of the manager's backends, in order
+func (m *Manager) Backends() []string {
+	names := make([]string, len(m.backends))
+	for i, backend := range m.backends {
+		names[i] = backend.Name()
+	}
+	return names
+}
+
+// Store stores a secret in the first backend that accepts it and removes stale copies
+// from the backends after it. Returns the storage backend used.
 func (m *Manager) Store(appName string, secretType SecretType, value string) (StorageBackend, error) {
-	// Try encrypted storage first
-	if err := m.storeInKeyring(appName, secretType, value); err == nil {
-		// Success! Clean up any filesystem version
-		_ = m.deleteFromFilesystem(appName, secretType)
-		return StorageBackendKeyring, nil
+	var errs []error
+	for i, backend := range m.backends {
+		err := backend.Set(appName, secretType, value)
+		if errors.Is(err, ErrReadOnly) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name(), err))
+			continue
+		}
+
+		// Success! Clean up any fallback version
+		for _, later := range m.backends[i+1:] {
+			_ = later.Delete(appName, secretType)
+		}
+		return StorageBackend(backend.Name()), nil
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("failed to store secret: %w", ErrReadOnly)
+	}
+	return "", fmt.Errorf("failed to store in any backend: %w", errors.Join(errs...))
+}
+
+// StoreIn stores a secret in the manager's backend of the given type and removes the
+// copies held by its other backends, e.g. to move a secret between keyring and filesystem
+func (m *Manager) StoreIn(target StorageBackend, appName string, secretType SecretType, value string) error {
+	idx := slices.IndexFunc(m.backends, func(b Backend) bool { return StorageBackend(b.Name()) == target })
+	if idx < 0 {
+		return fmt.Errorf("no %s backend configured", target)
+	}
+	if err := m.backends[idx].Set(appName, secretType, value); err != nil {
+		return fmt.Errorf("failed to store in %s: %w", target, err)
 	}
 
-	// Fallback to filesystem
-	if err := m.storeInFilesystem(appName, secretType, value); err != nil {
-		return "", fmt.Errorf("failed to store in both keyring and filesystem: %w", err)
+	for i, backend := range m.backends {
+		if i != idx {
+			_ = backend.Delete(appName, secretType)
+		}
 	}
+	return nil
+}
 
-	return StorageBackendFilesystem, nil
+// StoreInKeyring stores a secret in the OS keyring only. Unlike Store it never
+// falls back to the filesystem, for secrets that must not be written to disk.
+func (m *Manager) StoreInKeyring(appName string, secretType SecretType, value string) error {
+	if err := newKeyringBackend(m.keyringTimeout).Set(appName, secretType, value); err != nil {
+		return fmt.Errorf("failed to store in keyring: %w", err)
+	}
+	return nil
 }
 
-// Get retrieves a secret, trying keyring first then filesystem
+// Get retrieves a secret from the first backend that has it. Backends that are
+// unavailable are skipped; other failures are reported if no backend has the secret.
 func (m *Manager) Get(appName string, secretType SecretType) (string, StorageBackend, error) {
-	// Try keyring first
-	if value, err := m.getFromKeyring(appName, secretType); err == nil {
-		return value, StorageBackendKeyring, nil
+	var firstErr error
+	for _, backend := range m.backends {
+		value, err := backend.Get(appName, secretType)
+		if err == nil {
+			return value, StorageBackend(backend.Name()), nil
+		}
+		if firstErr == nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrStorageUnavailable) {
+			firstErr = err
+		}
 	}
 
-	// Try filesystem
-	if value, err := m.getFromFilesystem(appName, secretType); err == nil {
-		return value, StorageBackendFilesystem, nil
+	if firstErr != nil {
+		return "", "", firstErr
 	}
-
 	return "", "", ErrNotFound
 }
 
-// Delete removes a secret from both keyring and filesystem
+// Delete removes a secret from every backend
 func (m *Manager) Delete(appName string, secretType SecretType) error {
-	keyringErr := m.deleteFromKeyring(appName, secretType)
-	filesystemErr := m.deleteFromFilesystem(appName, secretType)
-
-	// If both fail, return the first error
-	if keyringErr != nil && filesystemErr != nil {
-		return keyringErr
+	var firstErr error
+	deleted := false
+	for _, backend := range m.backends {
+		err := backend.Delete(appName, secretType)
+		switch {
+		case err == nil:
+			deleted = true
+		case errors.Is(err, ErrReadOnly):
+		case firstErr == nil:
+			firstErr = err
+		}
 	}
 
-	// If either succeeds, consider it a success
-	return nil
+	// If any backend deleted it, consider it a success
+	if deleted {
+		return nil
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return ErrNotFound
 }
 
 // IsAvailable checks if encrypted keyring storage is available
@@ -130,129 +235,23 @@ func (m *Manager) IsAvailable() bool {
 	}
 }
 
-// storeInKeyring stores a secret in the OS keyring with timeout protection
-func (m *Manager) storeInKeyring(appName string, secretType SecretType, value string) error {
-	service := m.keyringService(appName)
-	user := string(secretType)
-
-	ch := make(chan error, 1)
-	go func() {
-		defer close(ch)
-		ch <- keyring.Set(service, user, value)
-	}()
-
-	select {
-	case err := <-ch:
-		return err
-	case <-time.After(m.keyringTimeout):
-		return ErrTimeout
-	}
+// PlaintextFilesystemSecrets lists the filesystem fallback secrets that are not encrypted yet
+func (m *Manager) PlaintextFilesystemSecrets() ([]string, error) {
+	return m.filesystem().plaintextSecrets()
 }
 
-// getFromKeyring retrieves a secret from the OS keyring with timeout protection
-func (m *Manager) getFromKeyring(appName string, secretType SecretType) (string, error) {
-	service := m.keyringService(appName)
-	user := string(secretType)
-
-	ch := make(chan struct {
-		val string
-		err error
-	}, 1)
-
-	go func() {
-		defer close(ch)
-		val, err := keyring.Get(service, user)
-		ch <- struct {
-			val string
-			err error
-		}{val, err}
-	}()
-
-	select {
-	case res := <-ch:
-		if errors.Is(res.err, keyring.ErrNotFound) {
-			return "", ErrNotFound
-		}
-		return res.val, res.err
-	case <-time.After(m.keyringTimeout):
-		return "", ErrTimeout
-	}
-}
-
-// deleteFromKeyring removes a secret from the OS keyring with timeout protection
-func (m *Manager) deleteFromKeyring(appName string, secretType SecretType) error {
-	service := m.keyringService(appName)
-	user := string(secretType)
-
-	ch := make(chan error, 1)
-	go func() {
-		defer close(ch)
-		ch <- keyring.Delete(service, user)
-	}()
-
-	select {
-	case err := <-ch:
-		if errors.Is(err, keyring.ErrNotFound) {
-			return ErrNotFound
-		}
-		return err
-	case <-time.After(m.keyringTimeout):
-		return ErrTimeout
-	}
-}
-
-// storeInFilesystem stores a secret on the filesystem with secure permissions
-func (m *Manager) storeInFilesystem(appName string, secretType SecretType, value string) error {
-	path := m.filesystemPath(appName, secretType)
-
-	// Ensure directory exists with secure permissions
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create secrets directory: %w", err)
-	}
-
-	// Write with secure permissions (owner read-only)
-	if err := os.WriteFile(path, []byte(value), 0400); err != nil {
-		return fmt.Errorf("failed to write secret file: %w", err)
-	}
-
-	return nil
-}
-
-// getFromFilesystem retrieves a secret from the filesystem
-func (m *Manager) getFromFilesystem(appName string, secretType SecretType) (string, error) {
-	path := m.filesystemPath(appName, secretType)
-
-	data, err := os.ReadFile(path)
-	if os.IsNotExist(err) {
-		return "", ErrNotFound
-	}
-	if err != nil {
-		return "", fmt.Errorf("failed to read secret file: %w", err)
-	}
-
-	return string(data), nil
-}
-
-// deleteFromFilesystem removes a secret from the filesystem
-func (m *Manager) deleteFromFilesystem(appName string, secretType SecretType) error {
-	path := m.filesystemPath(appName, secretType)
-	err := os.Remove(path)
-	if os.IsNotExist(err) {
-		return ErrNotFound
-	}
-	return err
+// EncryptFilesystemSecrets encrypts the filesystem fallback secrets still stored as
+// plaintext and returns the names of the converted files
+func (m *Manager) EncryptFilesystemSecrets() ([]string, error) {
+	return m.filesystem().encryptSecrets()
 }
 
-// keyringService returns the keyring service name for an app
-func (m *Manager) keyringService(appName string) string {
-	return fmt.Sprintf("gh-app-auth:%s", appName)
+// filesystem returns the encrypted filesystem fallback backend
+func (m *Manager) filesystem() *fileBackend {
+	return newFileBackend(filepath.Join(m.fallbackDir, "secrets"), m.fallbackDir, true)
 }
 
-// filesystemPath returns the filesystem path for a secret
+// filesystemPath returns the filesystem fallback path for a secret
 func (m *Manager) filesystemPath(appName string, secretType SecretType) string {
-	// Sanitize app name to be filesystem-safe
-	safeAppName := filepath.Base(appName)
-	filename := fmt.Sprintf("%s.%s", safeAppName, secretType)
-	return filepath.Join(m.fallbackDir, "secrets", filename)
+	return m.filesystem().path(appName, secretType)
 }
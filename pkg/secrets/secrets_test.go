@@ -59,14 +59,18 @@ func TestManager_Store_FilesystemFallback(t *testing.T) {
 		t.Errorf("Store() backend = %v, want %v", backend, StorageBackendFilesystem)
 	}
 
-	// And: The secret exists on filesystem
+	// And: The secret exists on filesystem, encrypted
 	path := mgr.filesystemPath("test-app", SecretTypePrivateKey)
 	data, err := os.ReadFile(path)
 	if err != nil {
 		t.Fatalf("Failed to read filesystem: %v", err)
 	}
-	if string(data) != "test-key-value" {
-		t.Errorf("Filesystem value = %v, want %v", string(data), "test-key-value")
+	if strings.Contains(string(data), "test-key-value") || !isEncryptedSecret(data) {
+		t.Errorf("Filesystem value is not encrypted: %q", data)
+	}
+	value, _, err := mgr.Get("test-app", SecretTypePrivateKey)
+	if err != nil || value != "test-key-value" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "test-key-value")
 	}
 
 	// And: File has secure permissions (owner read-only)
@@ -83,6 +87,70 @@ func TestManager_Store_FilesystemFallback(t *testing.T) {
 	}
 }
 
+func TestManager_StoreInKeyring_NoFilesystemFallback(t *testing.T) {
+	// Given: Keyring is unavailable
+	keyring.MockInitWithError(errors.New("keyring unavailable"))
+	defer keyring.MockInitWithError(nil)
+
+	tempDir := t.TempDir()
+	mgr := NewManager(tempDir)
+
+	// When: We store a keyring-only secret
+	err := mgr.StoreInKeyring("test-app", SecretTypePrivateKey, "test-key-value")
+
+	// Then: It fails and nothing is written to disk
+	if err == nil {
+		t.Fatal("StoreInKeyring() expected error when keyring is unavailable")
+	}
+	if _, statErr := os.Stat(mgr.filesystemPath("test-app", SecretTypePrivateKey)); !os.IsNotExist(statErr) {
+		t.Errorf("Expected no filesystem secret, stat error = %v", statErr)
+	}
+
+	// When: The keyring is available
+	keyring.MockInit()
+	if err := mgr.StoreInKeyring("test-app", SecretTypePrivateKey, "test-key-value"); err != nil {
+		t.Fatalf("StoreInKeyring() failed: %v", err)
+	}
+
+	// Then: The secret is in the keyring
+	value, backend, err := mgr.Get("test-app", SecretTypePrivateKey)
+	if err != nil || backend != StorageBackendKeyring || value != "test-key-value" {
+		t.Errorf("Get() = %q, %v, %v; want keyring value", value, backend, err)
+	}
+}
+
+func TestManager_StoreIn(t *testing.T) {
+	// Given: A secret in the keyring
+	keyring.MockInit()
+	t.Setenv(MasterKeyEnv, "")
+	t.Setenv(SecretsPassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	mgr := NewManager(t.TempDir())
+	if _, err := mgr.Store("test-app", SecretTypePAT, "ghp_value"); err != nil {
+		t.Fatalf("Store() failed: %v", err)
+	}
+
+	// When: It is moved to the filesystem fallback
+	if err := mgr.StoreIn(StorageBackendFilesystem, "test-app", SecretTypePAT, "ghp_value"); err != nil {
+		t.Fatalf("StoreIn() failed: %v", err)
+	}
+
+	// Then: Only the filesystem copy is left
+	if _, err := keyring.Get(keyringService("test-app"), string(SecretTypePAT)); err == nil {
+		t.Error("Keyring copy not removed")
+	}
+	value, backend, err := mgr.Get("test-app", SecretTypePAT)
+	if err != nil || backend != StorageBackendFilesystem || value != "ghp_value" {
+		t.Errorf("Get() = %q, %v, %v; want filesystem value", value, backend, err)
+	}
+
+	// And: Backends outside the chain are rejected
+	if err := mgr.StoreIn(BackendTypeVault, "test-app", SecretTypePAT, "x"); err == nil {
+		t.Error("StoreIn() expected error for a backend not in the chain")
+	}
+}
+
 func TestManager_Get_FromKeyring(t *testing.T) {
 	// Given: Secret is in keyring
 	keyring.MockInit()
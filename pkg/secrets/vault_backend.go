@@ -0,0 +1,498 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vault settings read from the environment, as for the vault CLI
+const (
+	VaultAddrEnv      = "VAULT_ADDR"
+	VaultNamespaceEnv = "VAULT_NAMESPACE"
+	VaultCACertEnv    = "VAULT_CACERT"
+	VaultTokenEnv     = "VAULT_TOKEN"
+	VaultRoleIDEnv    = "VAULT_ROLE_ID"
+	VaultSecretIDEnv  = "VAULT_SECRET_ID"
+	VaultJWTEnv       = "VAULT_JWT"
+	VaultJWTFileEnv   = "VAULT_JWT_FILE"
+	VaultJWTRoleEnv   = "VAULT_JWT_ROLE"
+)
+
+// Vault auth methods
+const (
+	VaultAuthToken   = "token"
+	VaultAuthAppRole = "approle"
+	VaultAuthJWT     = "jwt"
+)
+
+const (
+	defaultVaultMount = "secret"
+	defaultVaultPath  = "gh-app-auth/{name}"
+	defaultVaultField = "{type}"
+	// vaultTimeout bounds each Vault operation, including the login it may need
+	vaultTimeout = 30 * time.Second
+	// vaultTokenMargin renews login tokens this long before their lease ends
+	vaultTokenMargin = 30 * time.Second
+)
+
+// errVaultForbidden marks a rejected token, so a cached login token can be replaced once
+var errVaultForbidden = errors.New("permission denied")
+
+// vaultBackend reads and writes one field per secret in a Vault KV v2 secret.
+// By default the private key of app "my-app" is field private_key of secret/gh-app-auth/my-app.
+type vaultBackend struct {
+	address   string
+	namespace string
+	mount     string
+	path      string
+	field     string
+	auth      string
+	authMount string
+	role      string
+	cacheTTL  time.Duration
+}
+
+// vaultCache holds login tokens and, for backends with a cache TTL, fetched secrets.
+// Backends are created for each lookup, so the cache is shared by the process.
+var vaultCache = struct {
+	mu      sync.Mutex
+	tokens  map[string]vaultCachedValue
+	secrets map[string]vaultCachedValue
+}{
+	tokens:  make(map[string]vaultCachedValue),
+	secrets: make(map[string]vaultCachedValue),
+}
+
+type vaultCachedValue struct {
+	value   string
+	expires time.Time // zero for tokens that do not expire
+}
+
+func (v vaultCachedValue) valid(now time.Time) bool {
+	return v.expires.IsZero() || now.Before(v.expires)
+}
+
+func newVaultBackendFromSpec(spec BackendSpec, _ BackendOptions) (Backend, error) {
+	b := &vaultBackend{
+		address:   spec.Address,
+		namespace: spec.Namespace,
+		mount:     strings.Trim(spec.Mount, "/"),
+		path:      strings.Trim(spec.Path, "/"),
+		field:     spec.Field,
+		auth:      spec.Auth,
+		authMount: strings.Trim(spec.AuthMount, "/"),
+		role:      spec.Role,
+	}
+	if b.mount == "" {
+		b.mount = defaultVaultMount
+	}
+	if b.path == "" {
+		b.path = defaultVaultPath
+	}
+	if b.field == "" {
+		b.field = defaultVaultField
+	}
+
+	switch b.auth {
+	case "", VaultAuthToken, VaultAuthAppRole, VaultAuthJWT:
+	default:
+		return nil, fmt.Errorf("unsupported vault auth %q (use token, approle or jwt)", b.auth)
+	}
+
+	if spec.CacheTTL != "" {
+		ttl, err := time.ParseDuration(spec.CacheTTL)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid cache_ttl %q", spec.CacheTTL)
+		}
+		b.cacheTTL = ttl
+	}
+	return b, nil
+}
+
+// Name implements Backend
+func (b *vaultBackend) Name() string {
+	return BackendTypeVault
+}
+
+// Get reads the secret's field from Vault, or from memory within the cache TTL
+func (b *vaultBackend) Get(name string, secretType SecretType) (string, error) {
+	path, field := b.location(name, secretType)
+	cacheKey := b.baseURL() + "|" + b.mount + "|" + path + "|" + field
+
+	if b.cacheTTL > 0 {
+		vaultCache.mu.Lock()
+		cached, ok := vaultCache.secrets[cacheKey]
+		vaultCache.mu.Unlock()
+		if ok && cached.valid(time.Now()) {
+			return cached.value, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+
+	data, _, err := b.read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[field].(string)
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+
+	if b.cacheTTL > 0 {
+		vaultCache.mu.Lock()
+		vaultCache.secrets[cacheKey] = vaultCachedValue{value: value, expires: time.Now().Add(b.cacheTTL)}
+		vaultCache.mu.Unlock()
+	}
+	return value, nil
+}
+
+// Set writes the secret's field, keeping the other fields of the Vault secret
+func (b *vaultBackend) Set(name string, secretType SecretType, value string) error {
+	path, field := b.location(name, secretType)
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+
+	data, version, err := b.read(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		data, err = map[string]any{}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data[field] = value
+	defer b.forget(path, field)
+	return b.write(ctx, path, data, version)
+}
+
+// Delete removes the secret's field, and the Vault secret with all its versions once no field is left
+func (b *vaultBackend) Delete(name string, secretType SecretType) error {
+	path, field := b.location(name, secretType)
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+
+	data, version, err := b.read(ctx, path)
+	if err != nil {
+		return err
+	}
+	if _, ok := data[field]; !ok {
+		return ErrNotFound
+	}
+
+	delete(data, field)
+	defer b.forget(path, field)
+	if len(data) > 0 {
+		return b.write(ctx, path, data, version)
+	}
+	return b.request(ctx, http.MethodDelete, b.kvPath("metadata", path), nil, nil)
+}
+
+// location expands the path and field templates for a secret
+func (b *vaultBackend) location(name string, secretType SecretType) (string, string) {
+	return expandTemplate(b.path, name, secretType), expandTemplate(b.field, name, secretType)
+}
+
+// read returns the current data and version of a KV v2 secret
+func (b *vaultBackend) read(ctx context.Context, path string) (map[string]any, int, error) {
+	var resp struct {
+		Data struct {
+			Data     map[string]any `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := b.request(ctx, http.MethodGet, b.kvPath("data", path), nil, &resp); err != nil {
+		return nil, 0, err
+	}
+	if resp.Data.Data == nil {
+		// Deleted latest version
+		return nil, 0, ErrNotFound
+	}
+	return resp.Data.Data, resp.Data.Metadata.Version, nil
+}
+
+// write stores a KV v2 secret, failing if another writer changed it since version was read
+func (b *vaultBackend) write(ctx context.Context, path string, data map[string]any, version int) error {
+	body := map[string]any{
+		"data":    data,
+		"options": map[string]any{"cas": version},
+	}
+	return b.request(ctx, http.MethodPost, b.kvPath("data", path), body, nil)
+}
+
+// forget drops a cached secret after it changed
+func (b *vaultBackend) forget(path, field string) {
+	vaultCache.mu.Lock()
+	delete(vaultCache.secrets, b.baseURL()+"|"+b.mount+"|"+path+"|"+field)
+	vaultCache.mu.Unlock()
+}
+
+// kvPath returns the API path of a KV v2 secret; kind is "data" or "metadata"
+func (b *vaultBackend) kvPath(kind, path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/%s/%s", b.mount, kind, strings.Join(segments, "/"))
+}
+
+// request calls the Vault API with a token, logging in again once if a cached login token was rejected
+func (b *vaultBackend) request(ctx context.Context, method, path string, body, out any) error {
+	token, fromLogin, err := b.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = b.call(ctx, method, path, token, body, out)
+	if errors.Is(err, errVaultForbidden) && fromLogin {
+		b.dropToken()
+		if token, _, err = b.token(ctx); err != nil {
+			return err
+		}
+		err = b.call(ctx, method, path, token, body, out)
+	}
+	return err
+}
+
+// call performs one Vault API call
+func (b *vaultBackend) call(ctx context.Context, method, path, token string, body, out any) error {
+	address := b.baseURL()
+	if address == "" {
+		return fmt.Errorf("%w: set %s or the vault backend address", ErrStorageUnavailable, VaultAddrEnv)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode vault request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, address+"/v1/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace := b.namespaceValue(); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client, err := vaultHTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: vault request failed: %w", ErrStorageUnavailable, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("vault %s %s: %w", method, path, errVaultForbidden)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("vault %s %s failed: %s", method, path, vaultErrorMessage(resp))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+// token returns a Vault token from VAULT_TOKEN or a cached or new AppRole or JWT login.
+// fromLogin reports whether the token came from a login and may be replaced.
+func (b *vaultBackend) token(ctx context.Context) (string, bool, error) {
+	method := b.authMethod()
+	if method == VaultAuthToken {
+		token := os.Getenv(VaultTokenEnv)
+		if token == "" {
+			return "", false, fmt.Errorf("%w: set %s", ErrStorageUnavailable, VaultTokenEnv)
+		}
+		return token, false, nil
+	}
+
+	loginPath, payload, err := b.loginRequest(method)
+	if err != nil {
+		return "", false, err
+	}
+
+	cacheKey := b.tokenCacheKey(loginPath, payload)
+	vaultCache.mu.Lock()
+	cached, ok := vaultCache.tokens[cacheKey]
+	vaultCache.mu.Unlock()
+	if ok && cached.valid(time.Now()) {
+		return cached.value, true, nil
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if err := b.call(ctx, http.MethodPost, loginPath, "", payload, &resp); err != nil {
+		return "", false, fmt.Errorf("vault %s login failed: %w", method, err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", false, fmt.Errorf("vault %s login returned no token", method)
+	}
+
+	entry := vaultCachedValue{value: resp.Auth.ClientToken}
+	if resp.Auth.LeaseDuration > 0 {
+		lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+		entry.expires = time.Now().Add(max(lease-vaultTokenMargin, lease/2))
+	}
+	vaultCache.mu.Lock()
+	vaultCache.tokens[cacheKey] = entry
+	vaultCache.mu.Unlock()
+
+	return entry.value, true, nil
+}
+
+// authMethod picks the configured auth method, or the first one with credentials in the environment
+func (b *vaultBackend) authMethod() string {
+	switch {
+	case b.auth != "":
+		return b.auth
+	case os.Getenv(VaultTokenEnv) != "":
+		return VaultAuthToken
+	case os.Getenv(VaultRoleIDEnv) != "":
+		return VaultAuthAppRole
+	case os.Getenv(VaultJWTEnv) != "" || os.Getenv(VaultJWTFileEnv) != "":
+		return VaultAuthJWT
+	default:
+		return VaultAuthToken
+	}
+}
+
+// loginRequest returns the login API path and payload for AppRole or JWT auth
+func (b *vaultBackend) loginRequest(method string) (string, map[string]any, error) {
+	mount := b.authMount
+	if mount == "" {
+		mount = method
+	}
+	loginPath := "auth/" + mount + "/login"
+
+	if method == VaultAuthAppRole {
+		roleID, secretID := os.Getenv(VaultRoleIDEnv), os.Getenv(VaultSecretIDEnv)
+		if roleID == "" {
+			return "", nil, fmt.Errorf("%w: set %s and %s", ErrStorageUnavailable, VaultRoleIDEnv, VaultSecretIDEnv)
+		}
+		return loginPath, map[string]any{"role_id": roleID, "secret_id": secretID}, nil
+	}
+
+	jwt := os.Getenv(VaultJWTEnv)
+	if jwt == "" {
+		if file := os.Getenv(VaultJWTFileEnv); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read %s: %w", VaultJWTFileEnv, err)
+			}
+			jwt = strings.TrimSpace(string(data))
+		}
+	}
+	if jwt == "" {
+		return "", nil, fmt.Errorf("%w: set %s or %s", ErrStorageUnavailable, VaultJWTEnv, VaultJWTFileEnv)
+	}
+	role := b.role
+	if role == "" {
+		role = os.Getenv(VaultJWTRoleEnv)
+	}
+	return loginPath, map[string]any{"role": role, "jwt": jwt}, nil
+}
+
+// tokenCacheKey identifies a login, so different credentials never share a token
+func (b *vaultBackend) tokenCacheKey(loginPath string, payload map[string]any) string {
+	encoded, _ := json.Marshal(payload)
+	return b.baseURL() + "|" + b.namespaceValue() + "|" + loginPath + "|" + string(encoded)
+}
+
+// dropToken forgets the cached login token after Vault rejected it
+func (b *vaultBackend) dropToken() {
+	loginPath, payload, err := b.loginRequest(b.authMethod())
+	if err != nil {
+		return
+	}
+	vaultCache.mu.Lock()
+	delete(vaultCache.tokens, b.tokenCacheKey(loginPath, payload))
+	vaultCache.mu.Unlock()
+}
+
+// baseURL returns the Vault address without trailing slash
+func (b *vaultBackend) baseURL() string {
+	address := b.address
+	if address == "" {
+		address = os.Getenv(VaultAddrEnv)
+	}
+	return strings.TrimRight(address, "/")
+}
+
+func (b *vaultBackend) namespaceValue() string {
+	if b.namespace != "" {
+		return b.namespace
+	}
+	return os.Getenv(VaultNamespaceEnv)
+}
+
+// vaultHTTPClient returns an HTTP client trusting VAULT_CACERT when set
+func vaultHTTPClient() (*http.Client, error) {
+	caFile := os.Getenv(VaultCACertEnv)
+	if caFile == "" {
+		return &http.Client{Timeout: vaultTimeout}, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", VaultCACertEnv, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s contains no certificates", VaultCACertEnv)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &http.Client{Timeout: vaultTimeout, Transport: transport}, nil
+}
+
+// vaultErrorMessage extracts the errors Vault reports in a failed response
+func vaultErrorMessage(resp *http.Response) string {
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body); err == nil && len(body.Errors) > 0 {
+		return fmt.Sprintf("%s: %s", resp.Status, strings.Join(body.Errors, "; "))
+	}
+	return resp.Status
+}
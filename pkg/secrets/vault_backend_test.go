@@ -0,0 +1,346 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault is a minimal Vault stand-in with a KV v2 engine at "secret" and AppRole and JWT logins
+type fakeVault struct {
+	mu       sync.Mutex
+	secrets  map[string]map[string]any
+	versions map[string]int
+	tokens   map[string]bool
+	logins   int
+	reads    int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	vault := &fakeVault{
+		secrets:  make(map[string]map[string]any),
+		versions: make(map[string]int),
+		tokens:   map[string]bool{"root-token": true},
+	}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	t.Cleanup(resetVaultCache)
+
+	t.Setenv(VaultAddrEnv, server.URL)
+	for _, env := range []string{VaultNamespaceEnv, VaultCACertEnv, VaultTokenEnv, VaultRoleIDEnv,
+		VaultSecretIDEnv, VaultJWTEnv, VaultJWTFileEnv, VaultJWTRoleEnv} {
+		t.Setenv(env, "")
+	}
+	return vault, server
+}
+
+func resetVaultCache() {
+	vaultCache.mu.Lock()
+	defer vaultCache.mu.Unlock()
+	clear(vaultCache.tokens)
+	clear(vaultCache.secrets)
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var body map[string]any
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "auth/approle/login":
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.login(w)
+		return
+	case path == "auth/jwt/login":
+		if body["role"] != "ci" || body["jwt"] != "ci-jwt" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.login(w)
+		return
+	}
+
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "secret/data/"):
+		key := strings.TrimPrefix(path, "secret/data/")
+		switch r.Method {
+		case http.MethodGet:
+			v.reads++
+			data, ok := v.secrets[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{"data": data, "metadata": map[string]any{"version": v.versions[key]}},
+			})
+		case http.MethodPost:
+			options, _ := body["options"].(map[string]any)
+			if cas, ok := options["cas"].(float64); ok && int(cas) != v.versions[key] {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`))
+				return
+			}
+			v.secrets[key], _ = body["data"].(map[string]any)
+			v.versions[key]++
+		}
+	case strings.HasPrefix(path, "secret/metadata/") && r.Method == http.MethodDelete:
+		key := strings.TrimPrefix(path, "secret/metadata/")
+		delete(v.secrets, key)
+		delete(v.versions, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (v *fakeVault) login(w http.ResponseWriter) {
+	v.logins++
+	token := "login-token-" + strings.Repeat("x", v.logins)
+	v.tokens[token] = true
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"auth": map[string]any{"client_token": token, "lease_duration": 3600},
+	})
+}
+
+// revokeAll simulates expired or revoked login tokens
+func (v *fakeVault) revokeAll() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens = map[string]bool{"root-token": true}
+}
+
+func TestVaultBackend_TokenRoundTrip(t *testing.T) {
+	// Given a Vault server and a token in the environment
+	vault, _ := newFakeVault(t)
+	t.Setenv(VaultTokenEnv, "root-token")
+	backend, err := NewBackend(BackendSpec{Type: BackendTypeVault}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+
+	// When secrets of two types are stored for one app
+	if err := backend.Set("my-app", SecretTypePrivateKey, "pem"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := backend.Set("my-app", SecretTypePAT, "ghp_vault"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+
+	// Then both are fields of the app's KV secret
+	stored := vault.secrets["gh-app-auth/my-app"]
+	if stored["private_key"] != "pem" || stored["pat"] != "ghp_vault" {
+		t.Errorf("Vault secret = %v, want both fields", stored)
+	}
+	if value, err := backend.Get("my-app", SecretTypePrivateKey); err != nil || value != "pem" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "pem")
+	}
+
+	// And deleting one field keeps the other
+	if err := backend.Delete("my-app", SecretTypePrivateKey); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, err := backend.Get("my-app", SecretTypePrivateKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+	if value, _ := backend.Get("my-app", SecretTypePAT); value != "ghp_vault" {
+		t.Errorf("Get() of remaining field = %q, want %q", value, "ghp_vault")
+	}
+
+	// And deleting the last field removes the secret
+	if err := backend.Delete("my-app", SecretTypePAT); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if _, ok := vault.secrets["gh-app-auth/my-app"]; ok {
+		t.Error("Vault secret not removed after its last field was deleted")
+	}
+}
+
+func TestVaultBackend_MountPathAndField(t *testing.T) {
+	vault, _ := newFakeVault(t)
+	t.Setenv(VaultTokenEnv, "root-token")
+	vault.secrets["teams/platform/ci"] = map[string]any{"key": "pem"}
+
+	backend, err := NewBackend(BackendSpec{
+		Type:  BackendTypeVault,
+		Mount: "secret",
+		Path:  "teams/platform/ci",
+		Field: "key",
+	}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	if value, err := backend.Get("ci-app", SecretTypePrivateKey); err != nil || value != "pem" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "pem")
+	}
+
+	// Key entry names contain '#', which must not end the URL path
+	keyed, _ := NewBackend(BackendSpec{Type: BackendTypeVault}, BackendOptions{})
+	if err := keyed.Set("ci-app#primary", SecretTypePrivateKey, "pem2"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if _, ok := vault.secrets["gh-app-auth/ci-app#primary"]; !ok {
+		t.Errorf("Vault secrets = %v, want gh-app-auth/ci-app#primary", vault.secrets)
+	}
+}
+
+func TestVaultBackend_ChainFallback(t *testing.T) {
+	_, _ = newFakeVault(t)
+	t.Setenv(VaultTokenEnv, "root-token")
+
+	vault, _ := NewBackend(BackendSpec{Type: BackendTypeVault}, BackendOptions{})
+	memory := NewMemoryBackend()
+	_ = memory.Set("app", SecretTypePAT, "ghp_memory")
+	mgr := NewManagerWithBackends("", vault, memory)
+
+	value, backend, err := mgr.Get("app", SecretTypePAT)
+	if err != nil || value != "ghp_memory" || backend != StorageBackend(BackendTypeMemory) {
+		t.Errorf("Get() = %q, %v, %v; want value from the memory backend", value, backend, err)
+	}
+
+	// Without credentials Vault is unavailable and skipped as well
+	t.Setenv(VaultTokenEnv, "")
+	if _, err := vault.Get("app", SecretTypePAT); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("Get() without credentials error = %v, want %v", err, ErrStorageUnavailable)
+	}
+	if value, _, err := mgr.Get("app", SecretTypePAT); err != nil || value != "ghp_memory" {
+		t.Errorf("Get() = %q, %v; want value from the memory backend", value, err)
+	}
+
+	t.Setenv(VaultAddrEnv, "")
+	t.Setenv(VaultTokenEnv, "root-token")
+	if _, err := vault.Get("app", SecretTypePAT); !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("Get() without address error = %v, want %v", err, ErrStorageUnavailable)
+	}
+}
+
+func TestVaultBackend_AppRole(t *testing.T) {
+	vault, _ := newFakeVault(t)
+	t.Setenv(VaultRoleIDEnv, "role")
+	t.Setenv(VaultSecretIDEnv, "secret")
+	vault.secrets["gh-app-auth/app"] = map[string]any{"pat": "ghp_approle"}
+
+	backend, _ := NewBackend(BackendSpec{Type: BackendTypeVault}, BackendOptions{})
+
+	// The login token is reused across lookups
+	for range 3 {
+		if value, err := backend.Get("app", SecretTypePAT); err != nil || value != "ghp_approle" {
+			t.Fatalf("Get() = %q, %v; want %q", value, err, "ghp_approle")
+		}
+	}
+	if vault.logins != 1 {
+		t.Errorf("Logins = %d, want 1", vault.logins)
+	}
+
+	// A revoked token is replaced by a new login
+	vault.revokeAll()
+	if value, err := backend.Get("app", SecretTypePAT); err != nil || value != "ghp_approle" {
+		t.Fatalf("Get() after revocation = %q, %v; want %q", value, err, "ghp_approle")
+	}
+	if vault.logins != 2 {
+		t.Errorf("Logins = %d, want 2", vault.logins)
+	}
+
+	// Wrong credentials fail the login
+	resetVaultCache()
+	t.Setenv(VaultSecretIDEnv, "wrong")
+	if _, err := backend.Get("app", SecretTypePAT); err == nil || !strings.Contains(err.Error(), "login failed") {
+		t.Errorf("Get() error = %v, want login failure", err)
+	}
+}
+
+func TestVaultBackend_JWTFromFile(t *testing.T) {
+	vault, _ := newFakeVault(t)
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwtFile, []byte("ci-jwt\n"), 0600); err != nil {
+		t.Fatalf("Failed to write JWT: %v", err)
+	}
+	t.Setenv(VaultJWTFileEnv, jwtFile)
+	vault.secrets["gh-app-auth/app"] = map[string]any{"private_key": "pem"}
+
+	backend, err := NewBackend(BackendSpec{Type: BackendTypeVault, Auth: VaultAuthJWT, Role: "ci"}, BackendOptions{})
+	if err != nil {
+		t.Fatalf("NewBackend() failed: %v", err)
+	}
+	if value, err := backend.Get("app", SecretTypePrivateKey); err != nil || value != "pem" {
+		t.Errorf("Get() = %q, %v; want %q", value, err, "pem")
+	}
+	if vault.logins != 1 {
+		t.Errorf("Logins = %d, want 1", vault.logins)
+	}
+}
+
+func TestVaultBackend_CacheTTL(t *testing.T) {
+	vault, _ := newFakeVault(t)
+	t.Setenv(VaultTokenEnv, "root-token")
+	vault.secrets["gh-app-auth/app"] = map[string]any{"private_key": "pem"}
+
+	uncached, _ := NewBackend(BackendSpec{Type: BackendTypeVault}, BackendOptions{})
+	cached, _ := NewBackend(BackendSpec{Type: BackendTypeVault, CacheTTL: "5m"}, BackendOptions{})
+
+	for range 2 {
+		_, _ = uncached.Get("app", SecretTypePrivateKey)
+	}
+	if vault.reads != 2 {
+		t.Errorf("Reads without cache = %d, want 2", vault.reads)
+	}
+
+	for range 3 {
+		if value, err := cached.Get("app", SecretTypePrivateKey); err != nil || value != "pem" {
+			t.Fatalf("Get() = %q, %v; want %q", value, err, "pem")
+		}
+	}
+	if vault.reads != 3 {
+		t.Errorf("Reads with cache = %d, want 3", vault.reads)
+	}
+
+	// Writes through the backend refresh the cached value
+	if err := cached.Set("app", SecretTypePrivateKey, "pem2"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if value, _ := cached.Get("app", SecretTypePrivateKey); value != "pem2" {
+		t.Errorf("Get() after Set() = %q, want %q", value, "pem2")
+	}
+}
+
+func TestVaultBackend_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    BackendSpec
+		wantErr bool
+	}{
+		{name: "defaults", spec: BackendSpec{Type: BackendTypeVault}},
+		{name: "approle", spec: BackendSpec{Type: BackendTypeVault, Auth: VaultAuthAppRole, CacheTTL: "10m"}},
+		{name: "unknown auth", spec: BackendSpec{Type: BackendTypeVault, Auth: "kerberos"}, wantErr: true},
+		{name: "bad ttl", spec: BackendSpec{Type: BackendTypeVault, CacheTTL: "soon"}, wantErr: true},
+		{name: "negative ttl", spec: BackendSpec{Type: BackendTypeVault, CacheTTL: "-1m"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.spec.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
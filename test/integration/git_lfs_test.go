@@ -0,0 +1,211 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsStandIn is a minimal Git LFS server that requires basic auth on the Batch API
+type lfsStandIn struct {
+	mu       sync.Mutex
+	username string
+	password string
+	batchOK  int
+	uploads  map[string][]byte
+}
+
+func (s *lfsStandIn) handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/myorg/myrepo.git/info/lfs/objects/batch":
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != s.username || pass != s.password {
+				w.Header().Set("LFS-Authenticate", `Basic realm="Git LFS"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var req struct {
+				Objects []struct {
+					OID  string `json:"oid"`
+					Size int64  `json:"size"`
+				} `json:"objects"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			s.mu.Lock()
+			s.batchOK++
+			s.mu.Unlock()
+
+			objects := make([]map[string]interface{}, 0, len(req.Objects))
+			for _, obj := range req.Objects {
+				objects = append(objects, map[string]interface{}{
+					"oid":           obj.OID,
+					"size":          obj.Size,
+					"authenticated": true,
+					"actions": map[string]interface{}{
+						"upload": map[string]interface{}{
+							"href": "http://" + r.Host + "/upload/" + obj.OID,
+						},
+					},
+				})
+			}
+			w.Header().Set("Content-Type", lfsMediaType)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"transfer": "basic", "objects": objects})
+
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/upload/"):
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.mu.Lock()
+			s.uploads[strings.TrimPrefix(r.URL.Path, "/upload/")] = data
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// TestGitLFS_PushUsesPATForRepository drives git lfs against a local stand-in server and
+// checks the Batch API request is authenticated with the PAT matched for the repository
+func TestGitLFS_PushUsesPATForRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git not available, skipping test")
+	}
+	if err := exec.Command("git", "lfs", "version").Run(); err != nil {
+		t.Skip("Git LFS not available, skipping test")
+	}
+
+	const token = "ghp_lfs_test_token"
+	standIn := &lfsStandIn{username: "x-access-token", password: token, uploads: make(map[string][]byte)}
+	server := httptest.NewServer(standIn.handler())
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL: %v", err)
+	}
+
+	// Build before HOME is isolated so the Go build cache is reused
+	binaryPath := buildBinary(t)
+	setupLFSCredentialEnv(t, serverURL.Host, token)
+
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init", "-q")
+	runGit(t, repoDir, "config", "credential.helper", "!"+filepath.ToSlash(binaryPath)+" git-credential")
+	runGit(t, repoDir, "config", "credential.useHttpPath", "true")
+	runGit(t, repoDir, "remote", "add", "origin", server.URL+"/myorg/myrepo.git")
+
+	// Store an object in the local LFS cache through the clean filter
+	content := []byte("large binary content\n")
+	clean := exec.Command("git", "lfs", "clean", "--", "asset.bin")
+	clean.Dir = repoDir
+	clean.Stdin = strings.NewReader(string(content))
+	if output, err := clean.CombinedOutput(); err != nil {
+		t.Fatalf("git lfs clean failed: %v\nOutput: %s", err, output)
+	}
+
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	runGit(t, repoDir, "lfs", "push", "--object-id", "origin", oid)
+
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	if standIn.batchOK == 0 {
+		t.Fatal("Expected an authenticated Batch API request")
+	}
+	if string(standIn.uploads[oid]) != string(content) {
+		t.Errorf("Uploaded content = %q, want %q", standIn.uploads[oid], content)
+	}
+}
+
+// setupLFSCredentialEnv isolates HOME and git config and configures a PAT for <host>/myorg/
+// stored in the filesystem fallback (no keyring in CI)
+func setupLFSCredentialEnv(t *testing.T, host, token string) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	t.Setenv("GH_APP_ID", "")
+	t.Setenv("GH_APP_PRIVATE_KEY_PATH", "")
+
+	configPath := filepath.Join(home, "config.yml")
+	config := fmt.Sprintf(`version: "1.0"
+github_apps: []
+pats:
+  - name: "lfs-pat"
+    patterns:
+      - "%s/myorg/"
+    priority: 5
+`, host)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("GH_APP_AUTH_CONFIG", configPath)
+
+	secretsDir := filepath.Join(home, ".config", "gh", "extensions", "gh-app-auth", "secrets")
+	if err := os.MkdirAll(secretsDir, 0700); err != nil {
+		t.Fatalf("Failed to create secrets dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(secretsDir, "lfs-pat.pat"), []byte(token), 0600); err != nil {
+		t.Fatalf("Failed to write PAT: %v", err)
+	}
+}
+
+// TestGitCredentialHelper_LFSPath checks the credential helper resolves Git LFS
+// endpoint paths to the repository they belong to
+func TestGitCredentialHelper_LFSPath(t *testing.T) {
+	const token = "ghp_lfs_test_token"
+	binaryPath := buildBinary(t)
+	setupLFSCredentialEnv(t, "ghes.example.com", token)
+
+	for _, path := range []string{
+		"myorg/myrepo.git/info/lfs",
+		"myorg/myrepo.git/info/lfs/objects/batch",
+	} {
+		t.Run(path, func(t *testing.T) {
+			cmd := exec.Command(binaryPath, "git-credential", "get")
+			cmd.Stdin = strings.NewReader("protocol=https\nhost=ghes.example.com\npath=" + path + "\n\n")
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("git-credential get failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), "password="+token) {
+				t.Errorf("Expected PAT in output, got: %s", output)
+			}
+		})
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s failed: %v\nOutput: %s", strings.Join(args, " "), err, output)
+	}
+}